@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var log = logrus.WithField("pkg", "auth")
+
+const realm = "logserver"
+
+// Role defines what a user is allowed to do. Each role includes the permissions of the roles below it.
+type Role int
+
+const (
+	// RoleViewer can browse the file tree, read content and search
+	RoleViewer Role = iota
+	// RoleDownloader can also download files and build bundles
+	RoleDownloader
+	// RoleAdmin can also manage the server: jobs, sources and parsers
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:     "viewer",
+	RoleDownloader: "downloader",
+	RoleAdmin:      "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Role) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for role, n := range roleNames {
+		if n == name {
+			*r = role
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role: %s", name)
+}
+
+// Config is the authentication configuration. If no users are configured, authentication is disabled.
+type Config struct {
+	Users []User `json:"users"`
+	// AllowedOrigins are globs of origins, other than the server origin, that browsers may send requests from
+	AllowedOrigins []string `json:"allowed_origins"`
+	// Policy is an external policy service that authorizes the actions of users on sources and paths
+	Policy PolicyConfig `json:"policy"`
+	// Signing configures signed URLs
+	Signing SigningConfig `json:"signing"`
+}
+
+// User is a user that can access the server with basic authentication
+type User struct {
+	Name string `json:"name"`
+	// Password of the user in plain text
+	Password string `json:"password"`
+	// PasswordHash is a bcrypt hash of the password, it is used instead of Password if given
+	PasswordHash string `json:"password_hash"`
+	Role         Role   `json:"role"`
+}
+
+// Auth authenticates requests and enforces roles
+type Auth struct {
+	users  map[string]User
+	tokens *tokens
+	signer *signer
+}
+
+// New returns an authenticator, with the API tokens that were persisted in the store.
+// It returns nil if authentication is disabled.
+func New(c Config, s store.Store) (*Auth, error) {
+	if len(c.Users) == 0 {
+		return nil, nil
+	}
+	a := &Auth{users: make(map[string]User)}
+	for _, u := range c.Users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user without name")
+		}
+		if u.Password == "" && u.PasswordHash == "" {
+			return nil, fmt.Errorf("user %s without password", u.Name)
+		}
+		if _, ok := a.users[u.Name]; ok {
+			return nil, fmt.Errorf("duplicate user %s", u.Name)
+		}
+		a.users[u.Name] = u
+	}
+	var err error
+	if a.tokens, err = loadTokens(s); err != nil {
+		return nil, err
+	}
+	if a.signer, err = newSigner(c.Signing, s); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type userKey struct{}
+
+// UserFromContext returns the authenticated user of a request context
+func UserFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey{}).(User)
+	return u, ok
+}
+
+// WithUser returns a context with an authenticated user, for work that is done on behalf of the user after its
+// request returned
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// ClientName returns the name of the user of a request, or its remote address if it has no user
+func ClientName(r *http.Request) string {
+	if u, ok := UserFromContext(r.Context()); ok {
+		return u.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Require wraps a handler, and allows only requests of users with at least the given role.
+// It is safe to call on a nil authenticator, in which case all requests are allowed.
+func (a *Auth) Require(role Role, h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := a.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if u.Role < role {
+			log.Warnf("User %s with role %s denied access to %s", u.Name, u.Role, r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(WithUser(r.Context(), u)))
+	})
+}
+
+// authenticate returns the user of a request
+func (a *Auth) authenticate(r *http.Request) (User, bool) {
+	if u, ok := UserFromContext(r.Context()); ok {
+		return u, true
+	}
+	// signed URLs give read access to the signed path, with the role of a downloader
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if by, ok := a.signer.verify(r); ok {
+			return User{Name: "signed:" + by, Role: RoleDownloader}, true
+		}
+	}
+	if value := requestToken(r); value != "" {
+		t, ok := a.tokens.authenticate(value)
+		return User{Name: "token:" + t.Name, Role: t.Role}, ok
+	}
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return User{}, false
+	}
+	u, ok := a.users[name]
+	if !ok {
+		return User{}, false
+	}
+	if u.PasswordHash != "" {
+		return u, bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+	}
+	return u, subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
+// RequireWrite is like Require, but requires a different role for reading and writing requests.
+// GET and HEAD requests are considered as reading, and any other method as writing.
+func (a *Auth) RequireWrite(read, write Role, h http.Handler) http.Handler {
+	readH, writeH := a.Require(read, h), a.Require(write, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			readH.ServeHTTP(w, r)
+		default:
+			writeH.ServeHTTP(w, r)
+		}
+	})
+}
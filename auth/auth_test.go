@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Stratoscale/logserver/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequire(t *testing.T) {
+	t.Parallel()
+
+	a, err := New(Config{Users: []User{
+		{Name: "viewer", Password: "v", Role: RoleViewer},
+		{Name: "admin", Password: "a", Role: RoleAdmin},
+	}}, store.NewMemory())
+	require.Nil(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := a.Require(RoleViewer, a.RequireWrite(RoleViewer, RoleAdmin, ok))
+
+	tests := []struct {
+		user, password string
+		method         string
+		want           int
+	}{
+		{method: "GET", want: http.StatusUnauthorized},
+		{user: "viewer", password: "bad", method: "GET", want: http.StatusUnauthorized},
+		{user: "viewer", password: "v", method: "GET", want: http.StatusOK},
+		{user: "viewer", password: "v", method: "POST", want: http.StatusForbidden},
+		{user: "admin", password: "a", method: "POST", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, tt.want, w.Code, "%s:%s %s", tt.user, tt.password, tt.method)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	a, err := New(Config{Users: []User{{Name: "admin", Password: "a", Role: RoleAdmin}}}, store.NewMemory())
+	require.Nil(t, err)
+
+	_, secret, err := a.tokens.create("ci", RoleViewer, 0)
+	require.Nil(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := a.Require(RoleViewer, ok)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+secret)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r = httptest.NewRequest("GET", "/?token="+secret+"x", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOrigins(t *testing.T) {
+	t.Parallel()
+
+	o, err := NewOrigins([]string{"https://*.example.com"})
+	require.Nil(t, err)
+	h := o.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method, origin string
+		want           int
+	}{
+		{method: "POST", want: http.StatusOK},
+		{method: "POST", origin: "http://logserver", want: http.StatusOK},
+		{method: "POST", origin: "https://ui.example.com", want: http.StatusOK},
+		{method: "POST", origin: "https://evil.com", want: http.StatusForbidden},
+		{method: "GET", origin: "https://evil.com", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://logserver/", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, tt.want, w.Code, "%s from %s", tt.method, tt.origin)
+	}
+}
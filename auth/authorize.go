@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/duration"
+)
+
+const (
+	defaultPolicyTimeout         = 5 * time.Second
+	defaultPolicyCacheExpiration = time.Minute
+	// policyCacheSize is the number of decisions that are cached, the cache is cleared when it is full
+	policyCacheSize = 10000
+)
+
+// Authorization is a request of a user to perform an action on a path in a source
+type Authorization struct {
+	// User is the name of the user, it is empty if authentication is disabled
+	User   string `json:"user"`
+	Role   Role   `json:"role"`
+	Action string `json:"action"`
+	FS     string `json:"fs"`
+	Path   string `json:"path"`
+}
+
+// Authorizer decides whether users may perform actions on paths in sources, in addition to their roles
+type Authorizer interface {
+	Authorize(ctx context.Context, a Authorization) (bool, error)
+}
+
+// Authorized returns true if the user of a request context may perform an action on a path in a source.
+// All the actions are allowed if the authorizer is nil, and none of them are allowed if it fails.
+func Authorized(ctx context.Context, authz Authorizer, action, fs, path string) bool {
+	if authz == nil {
+		return true
+	}
+	a := Authorization{Action: action, FS: fs, Path: path}
+	if u, ok := UserFromContext(ctx); ok {
+		a.User, a.Role = u.Name, u.Role
+	}
+	allowed, err := authz.Authorize(ctx, a)
+	if err != nil {
+		log.WithError(err).Errorf("Failed authorizing %+v", a)
+		return false
+	}
+	if !allowed {
+		log.Debugf("Denied %+v", a)
+	}
+	return allowed
+}
+
+// RequireRole returns an authorizer that allows the actions on a source only to users with at least a role,
+// and authorizes the actions that it allows with another authorizer, which may be nil.
+// All the actions are allowed if authentication is disabled.
+func RequireRole(authz Authorizer, role Role, fs string) Authorizer {
+	return &requireRole{Authorizer: authz, role: role, fs: fs}
+}
+
+type requireRole struct {
+	Authorizer
+	role Role
+	fs   string
+}
+
+func (r *requireRole) Authorize(ctx context.Context, a Authorization) (bool, error) {
+	if _, ok := UserFromContext(ctx); ok && a.FS == r.fs && a.Role < r.role {
+		return false, nil
+	}
+	if r.Authorizer == nil {
+		return true, nil
+	}
+	return r.Authorizer.Authorize(ctx, a)
+}
+
+// PolicyConfig configures an external HTTP policy service that authorizes requests
+type PolicyConfig struct {
+	// URL of the policy service. Authorizations are sent as a POST request with an {"input": <authorization>}
+	// body, and the service responds with {"result": true} or {"result": {"allow": true}}, like an OPA decision.
+	URL string `json:"url"`
+	// Timeout of a request to the service
+	Timeout time.Duration `json:"timeout"`
+	// CacheExpiration is the time that decisions are cached, a negative value disables the cache
+	CacheExpiration time.Duration `json:"cache_expiration"`
+}
+
+// UnmarshalJSON decodes the policy configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *PolicyConfig) UnmarshalJSON(b []byte) error {
+	type plain PolicyConfig
+	return duration.Decode(b, (*plain)(c))
+}
+
+type policy struct {
+	PolicyConfig
+	client *http.Client
+	lock   sync.Mutex
+	cache  map[Authorization]decision
+}
+
+type decision struct {
+	allowed bool
+	expires time.Time
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c PolicyConfig) WithDefaults() PolicyConfig {
+	if c.Timeout == 0 {
+		c.Timeout = defaultPolicyTimeout
+	}
+	if c.CacheExpiration == 0 {
+		c.CacheExpiration = defaultPolicyCacheExpiration
+	}
+	return c
+}
+
+// NewPolicy returns an authorizer of an external HTTP policy service. It returns nil if no URL is configured.
+func NewPolicy(c PolicyConfig) Authorizer {
+	if c.URL == "" {
+		return nil
+	}
+	c = c.WithDefaults()
+	return &policy{
+		PolicyConfig: c,
+		client:       &http.Client{Timeout: c.Timeout},
+		cache:        make(map[Authorization]decision),
+	}
+}
+
+func (p *policy) Authorize(ctx context.Context, a Authorization) (bool, error) {
+	if d, ok := p.cached(a); ok {
+		return d, nil
+	}
+	body, err := json.Marshal(struct {
+		Input Authorization `json:"input"`
+	}{Input: a})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("policy request: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("policy request: %s", resp.Status)
+	}
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decoding policy response: %s", err)
+	}
+	allowed, err := policyResult(result.Result)
+	if err != nil {
+		return false, err
+	}
+	p.store(a, allowed)
+	return allowed, nil
+}
+
+// policyResult decodes the result of a policy decision, which is a boolean, or an object with an allow field.
+// An undefined result denies the request.
+func policyResult(raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 {
+		return false, nil
+	}
+	var allowed bool
+	if err := json.Unmarshal(raw, &allowed); err == nil {
+		return allowed, nil
+	}
+	var obj struct {
+		Allow bool `json:"allow"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return false, fmt.Errorf("bad policy result %s", raw)
+	}
+	return obj.Allow, nil
+}
+
+func (p *policy) cached(a Authorization) (bool, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	d, ok := p.cache[a]
+	if !ok || time.Now().After(d.expires) {
+		return false, false
+	}
+	return d.allowed, true
+}
+
+func (p *policy) store(a Authorization, allowed bool) {
+	if p.CacheExpiration < 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.cache) >= policyCacheSize {
+		p.cache = make(map[Authorization]decision)
+	}
+	p.cache[a] = decision{allowed: allowed, expires: time.Now().Add(p.CacheExpiration)}
+}
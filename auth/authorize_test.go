@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var body struct {
+			Input Authorization `json:"input"`
+		}
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body.Input.FS {
+		case "bool":
+			w.Write([]byte(`{"result": true}`))
+		case "object":
+			w.Write([]byte(`{"result": {"allow": true}}`))
+		case "fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer s.Close()
+
+	p := NewPolicy(PolicyConfig{URL: s.URL})
+	ctx := context.Background()
+
+	assert.True(t, Authorized(ctx, p, "search", "bool", "/"))
+	assert.True(t, Authorized(ctx, p, "search", "object", "/"))
+	assert.False(t, Authorized(ctx, p, "search", "undefined", "/"))
+	assert.False(t, Authorized(ctx, p, "search", "fail", "/"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// decisions are cached, failures are not
+	assert.True(t, Authorized(ctx, p, "search", "bool", "/"))
+	assert.False(t, Authorized(ctx, p, "search", "fail", "/"))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	assert.Nil(t, NewPolicy(PolicyConfig{}))
+	assert.True(t, Authorized(ctx, nil, "search", "fail", "/"))
+}
+
+func TestRequireRole(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		denyB  = RequireRole(authorizerFunc(func(a Authorization) bool { return a.FS != "b" }), RoleAdmin, "self")
+		viewer = User{Name: "viewer"}
+		admin  = User{Name: "admin", Role: RoleAdmin}
+	)
+	tests := []struct {
+		authz Authorizer
+		ctx   context.Context
+		fs    string
+		want  bool
+	}{
+		{authz: RequireRole(nil, RoleAdmin, "self"), ctx: WithUser(ctx, viewer), fs: "self", want: false},
+		{authz: RequireRole(nil, RoleAdmin, "self"), ctx: WithUser(ctx, viewer), fs: "a", want: true},
+		{authz: RequireRole(nil, RoleAdmin, "self"), ctx: WithUser(ctx, admin), fs: "self", want: true},
+		// without authentication there are no roles
+		{authz: RequireRole(nil, RoleAdmin, "self"), ctx: ctx, fs: "self", want: true},
+		{authz: denyB, ctx: WithUser(ctx, admin), fs: "self", want: true},
+		{authz: denyB, ctx: WithUser(ctx, admin), fs: "b", want: false},
+		{authz: denyB, ctx: WithUser(ctx, viewer), fs: "self", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Authorized(tt.ctx, tt.authz, "get-content", tt.fs, "/a.log"), "fs %s", tt.fs)
+	}
+}
+
+type authorizerFunc func(a Authorization) bool
+
+func (f authorizerFunc) Authorize(_ context.Context, a Authorization) (bool, error) {
+	return f(a), nil
+}
+
+func TestPolicyConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"policy": {"timeout": "2s", "cache_expiration": "10m"}, "signing": {"max_expiration": "24h"}}`), &c))
+	assert.Equal(t, 2*time.Second, c.Policy.Timeout)
+	assert.Equal(t, 10*time.Minute, c.Policy.CacheExpiration)
+	assert.Equal(t, 24*time.Hour, c.Signing.MaxExpiration)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gobwas/glob"
+)
+
+// Origins checks the origin of browser requests
+type Origins struct {
+	allowed []glob.Glob
+}
+
+// NewOrigins returns an origin checker. Requests from the same origin as the server are always allowed,
+// and the patterns are globs of other allowed origins, for example "https://*.example.com".
+func NewOrigins(patterns []string) (*Origins, error) {
+	o := &Origins{}
+	for _, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compiling origin glob %s: %s", p, err)
+		}
+		o.allowed = append(o.allowed, g)
+	}
+	return o, nil
+}
+
+// CheckWebsocket checks the origin of a websocket upgrade request.
+// If no origins were configured, any origin is allowed.
+func (o *Origins) CheckWebsocket(r *http.Request) bool {
+	if len(o.allowed) == 0 {
+		return true
+	}
+	return o.Allowed(r)
+}
+
+// Protect rejects state-changing requests that were sent from other origins,
+// to protect against cross site request forgery.
+// Requests without an Origin header are not sent by browsers, and are allowed.
+func (o *Origins) Protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !o.Allowed(r) {
+				log.Warnf("Rejected %s %s from origin %s", r.Method, r.URL.Path, r.Header.Get("Origin"))
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Allowed returns true if a request was sent from the server origin or from one of the allowed origins.
+// Requests without an Origin header are allowed.
+func (o *Origins) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	for _, g := range o.allowed {
+		if g.Match(origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stratoscale/logserver/duration"
+	"github.com/Stratoscale/logserver/store"
+)
+
+const (
+	defaultSignedExpiration    = time.Hour
+	defaultMaxSignedExpiration = 7 * 24 * time.Hour
+
+	// signingBucket is the store bucket of the generated signing key
+	signingBucket = "signing"
+	signingKey    = "key"
+)
+
+// Query parameters of signed URLs
+const (
+	signatureParam = "signature"
+	expiresParam   = "expires"
+	signedByParam  = "signed_by"
+)
+
+// SigningConfig configures signed URLs, which give time limited access to downloads without credentials
+type SigningConfig struct {
+	// Key is the secret key of the signatures. If not given, a random key is generated and persisted in the
+	// storage, so signed URLs are valid across restarts only if a storage directory is configured.
+	Key string `json:"key"`
+	// MaxExpiration is the maximal time that a signed URL is valid, 7 days by default
+	MaxExpiration time.Duration `json:"max_expiration"`
+}
+
+// UnmarshalJSON decodes the signing configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *SigningConfig) UnmarshalJSON(b []byte) error {
+	type plain SigningConfig
+	return duration.Decode(b, (*plain)(c))
+}
+
+// signer signs URLs and verifies their signatures
+type signer struct {
+	key           []byte
+	maxExpiration time.Duration
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c SigningConfig) WithDefaults() SigningConfig {
+	if c.MaxExpiration == 0 {
+		c.MaxExpiration = defaultMaxSignedExpiration
+	}
+	return c
+}
+
+func newSigner(c SigningConfig, s store.Store) (*signer, error) {
+	c = c.WithDefaults()
+	key := c.Key
+	if key == "" {
+		switch err := s.Get(signingBucket, signingKey, &key); err {
+		case nil:
+		case store.ErrNotFound:
+			key = randomHex(32)
+			if err := s.Put(signingBucket, signingKey, key); err != nil {
+				return nil, fmt.Errorf("store signing key: %s", err)
+			}
+		default:
+			return nil, fmt.Errorf("load signing key: %s", err)
+		}
+	}
+	return &signer{key: []byte(key), maxExpiration: c.MaxExpiration}, nil
+}
+
+// sign returns a URL that is signed by a user, with its expiration time
+func (s *signer) sign(u *url.URL, user string, expiration time.Duration) (*url.URL, time.Time) {
+	expires := time.Now().Add(expiration).Truncate(time.Second)
+	q := u.Query()
+	q.Del(signatureParam)
+	q.Del(tokenQueryParam)
+	q.Set(expiresParam, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(signedByParam, user)
+	signed := *u
+	signed.RawQuery = q.Encode()
+	q.Set(signatureParam, s.signature(&signed))
+	signed.RawQuery = q.Encode()
+	return &signed, expires
+}
+
+// verify returns the user that signed a request URL, if the signature is valid and did not expire
+func (s *signer) verify(r *http.Request) (string, bool) {
+	q := r.URL.Query()
+	sig := q.Get(signatureParam)
+	expires, err := strconv.ParseInt(q.Get(expiresParam), 10, 64)
+	if sig == "" || err != nil || time.Now().After(time.Unix(expires, 0)) {
+		return "", false
+	}
+	q.Del(signatureParam)
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	if !hmac.Equal([]byte(sig), []byte(s.signature(&u))) {
+		return "", false
+	}
+	return q.Get(signedByParam), true
+}
+
+// signature is the HMAC of the path and the sorted query of a URL
+func (s *signer) signature(u *url.URL) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(u.EscapedPath() + "?" + u.RawQuery))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRequest is the body of a URL signing request
+type signRequest struct {
+	// URL is the path and query of the signed URL, relative to the server
+	URL        string        `json:"url"`
+	Expiration time.Duration `json:"expiration"`
+}
+
+type signResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// SignHandler returns an HTTP handler that signs URLs with POST requests of {"url": "...", "expiration": <nanoseconds>}.
+// Only URLs with one of the given path prefixes can be signed. A signed URL gives read access with the role of a
+// downloader, to anyone who has it, until it expires. The handler should be accessible only to downloaders.
+func (a *Auth) SignHandler(prefixes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case a == nil:
+			http.Error(w, "authentication is disabled", http.StatusNotFound)
+			return
+		case r.Method != http.MethodPost:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req signRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || u.IsAbs() || u.Host != "" {
+			http.Error(w, fmt.Sprintf("bad url %q, expected a path of the server", req.URL), http.StatusBadRequest)
+			return
+		}
+		// the path is cleaned, so it can't escape the prefixes with dot segments
+		u.Path = path.Clean("/" + u.Path)
+		if !hasPrefix(u.Path, prefixes) {
+			http.Error(w, fmt.Sprintf("url %q can't be signed", req.URL), http.StatusForbidden)
+			return
+		}
+		switch {
+		case req.Expiration <= 0:
+			req.Expiration = defaultSignedExpiration
+		case req.Expiration > a.signer.maxExpiration:
+			req.Expiration = a.signer.maxExpiration
+		}
+		user, _ := UserFromContext(r.Context())
+		signed, expires := a.signer.sign(u, user.Name, req.Expiration)
+		log.Infof("User %s signed %s until %s", user.Name, u.Path, expires)
+		writeJSON(w, http.StatusCreated, signResponse{URL: signed.String(), Expires: expires})
+	})
+}
+
+func hasPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	st := store.NewMemory()
+	a, err := New(Config{Users: []User{{Name: "dl", Password: "d", Role: RoleDownloader}}}, st)
+	require.Nil(t, err)
+
+	sign := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/_sign", strings.NewReader(body))
+		r.SetBasicAuth("dl", "d")
+		w := httptest.NewRecorder()
+		a.Require(RoleDownloader, a.SignHandler("/_dl/")).ServeHTTP(w, r)
+		return w
+	}
+
+	w := sign(`{"url": "/_dl/var/log/syslog?fs=node1"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp signResponse
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.WithinDuration(t, time.Now().Add(defaultSignedExpiration), resp.Expires, 2*time.Second)
+
+	assert.Equal(t, http.StatusForbidden, sign(`{"url": "/_tokens"}`).Code)
+	assert.Equal(t, http.StatusForbidden, sign(`{"url": "/_dl/../_tokens"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, sign(`{"url": "http://example.com/_dl/a"}`).Code)
+
+	var got User
+	h := a.Require(RoleDownloader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = UserFromContext(r.Context())
+	}))
+	get := func(method, url string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get(http.MethodGet, resp.URL))
+	assert.Equal(t, User{Name: "signed:dl", Role: RoleDownloader}, got)
+
+	// the signature is valid only for the signed path and query, and only for reading
+	assert.Equal(t, http.StatusUnauthorized, get(http.MethodGet, strings.Replace(resp.URL, "syslog", "messages", 1)))
+	assert.Equal(t, http.StatusUnauthorized, get(http.MethodGet, strings.Replace(resp.URL, "fs=node1", "fs=node2", 1)))
+	assert.Equal(t, http.StatusUnauthorized, get(http.MethodDelete, resp.URL))
+
+	// the generated key is persisted, so signed URLs are valid after a restart
+	a, err = New(Config{Users: []User{{Name: "dl", Password: "d", Role: RoleDownloader}}}, st)
+	require.Nil(t, err)
+	h = a.Require(RoleDownloader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusOK, get(http.MethodGet, resp.URL))
+
+	// expired signatures are rejected
+	u, _ := a.signer.sign(httptest.NewRequest(http.MethodGet, "/_dl/a", nil).URL, "dl", -time.Minute)
+	assert.Equal(t, http.StatusUnauthorized, get(http.MethodGet, u.String()))
+}
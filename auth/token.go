@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/store"
+)
+
+// tokenQueryParam is a query parameter that holds a token, for clients that can't set headers,
+// like browser websockets and download links
+const tokenQueryParam = "token"
+
+// Token is a long lived credential for machine clients
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Role is the scope of the token
+	Role    Role       `json:"role"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+	// Hash is the sha256 of the token secret, the secret itself is not stored
+	Hash string `json:"hash,omitempty"`
+}
+
+func (t *Token) expired() bool {
+	return t.Expires != nil && time.Now().After(*t.Expires)
+}
+
+// tokensBucket is the store bucket of the API tokens
+const tokensBucket = "tokens"
+
+// tokens is a persistent store of API tokens
+type tokens struct {
+	store store.Store
+	m     map[string]*Token
+	lock  sync.Mutex
+}
+
+func loadTokens(s store.Store) (*tokens, error) {
+	ts := &tokens{store: s, m: make(map[string]*Token)}
+	values, err := s.List(tokensBucket)
+	if err != nil {
+		return nil, fmt.Errorf("load tokens: %s", err)
+	}
+	for id, value := range values {
+		t := new(Token)
+		if err := json.Unmarshal(value, t); err != nil {
+			return nil, fmt.Errorf("decode token %s: %s", id, err)
+		}
+		ts.m[t.ID] = t
+	}
+	log.Infof("Loaded %d tokens", len(values))
+	return ts, nil
+}
+
+// create creates a new token and returns it with its secret
+func (ts *tokens) create(name string, role Role, expiration time.Duration) (Token, string, error) {
+	id, secret := randomHex(8), randomHex(32)
+	t := &Token{
+		ID:      id,
+		Name:    name,
+		Role:    role,
+		Created: time.Now(),
+		Hash:    hash(secret),
+	}
+	if expiration > 0 {
+		expires := t.Created.Add(expiration)
+		t.Expires = &expires
+	}
+	if err := ts.store.Put(tokensBucket, id, t); err != nil {
+		return Token{}, "", err
+	}
+	ts.lock.Lock()
+	ts.m[id] = t
+	ts.lock.Unlock()
+	// the token secret is prefixed with its id for a quick lookup
+	ret := *t
+	ret.Hash = ""
+	return ret, id + "." + secret, nil
+}
+
+func (ts *tokens) revoke(id string) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if _, ok := ts.m[id]; !ok {
+		return fmt.Errorf("token %s not found", id)
+	}
+	if err := ts.store.Delete(tokensBucket, id); err != nil {
+		return err
+	}
+	delete(ts.m, id)
+	return nil
+}
+
+func (ts *tokens) list() []Token {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	list := make([]Token, 0, len(ts.m))
+	for _, t := range ts.m {
+		ret := *t
+		ret.Hash = ""
+		list = append(list, ret)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// authenticate returns the token of a token secret
+func (ts *tokens) authenticate(value string) (Token, bool) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return Token{}, false
+	}
+	ts.lock.Lock()
+	t, ok := ts.m[parts[0]]
+	ts.lock.Unlock()
+	if !ok || t.expired() {
+		return Token{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash(parts[1]))) != 1 {
+		return Token{}, false
+	}
+	return *t, true
+}
+
+// requestToken returns the token that was given in a request
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return r.URL.Query().Get(tokenQueryParam)
+}
+
+// createTokenRequest is the body of a token creation request
+type createTokenRequest struct {
+	Name       string        `json:"name"`
+	Role       Role          `json:"role"`
+	Expiration time.Duration `json:"expiration"`
+}
+
+// createTokenResponse holds the created token and its secret. The secret can't be retrieved later.
+type createTokenResponse struct {
+	Token
+	Secret string `json:"secret"`
+}
+
+// TokensHandler returns an HTTP handler for managing API tokens:
+//
+//	GET    /      list tokens
+//	POST   /      create a token: {"name": "...", "role": "viewer", "expiration": <nanoseconds>}
+//	DELETE /<id>  revoke a token
+//
+// The handler should be accessible only to admins.
+func (a *Auth) TokensHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a == nil {
+			http.Error(w, "authentication is disabled", http.StatusNotFound)
+			return
+		}
+		id := strings.Trim(r.URL.Path, "/")
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, a.tokens.list())
+
+		case id == "" && r.Method == http.MethodPost:
+			var req createTokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Name == "" {
+				http.Error(w, "token without name", http.StatusBadRequest)
+				return
+			}
+			t, secret, err := a.tokens.create(req.Name, req.Role, req.Expiration)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Infof("Created token %s (%s) with role %s", t.ID, t.Name, t.Role)
+			writeJSON(w, http.StatusCreated, createTokenResponse{Token: t, Secret: secret})
+
+		case id != "" && r.Method == http.MethodDelete:
+			if err := a.tokens.revoke(id); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Infof("Revoked token %s", id)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func hash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
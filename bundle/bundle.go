@@ -0,0 +1,214 @@
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/download"
+	"github.com/Stratoscale/logserver/job"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/temp"
+	"github.com/gobwas/glob"
+	"github.com/kr/fs"
+)
+
+var log = logrus.WithField("pkg", "bundle")
+
+// Kind is the job kind of bundle builds
+const Kind = "bundle"
+
+// Manifest describes the content of a requested bundle
+type Manifest struct {
+	Files []Selector `json:"files"`
+	// FilterTime skips files that were last modified before its start
+	FilterTime struct {
+		Start *time.Time `json:"start"`
+	} `json:"filter_time"`
+}
+
+// Selector selects files from sources. Both fields are globs.
+type Selector struct {
+	FS   string `json:"fs"`
+	Path string `json:"path"`
+}
+
+// New returns a handler that builds bundles asynchronously as jobs.
+// A bundle is created by a POST request with a manifest, and the response is the created job.
+// The build progress is tracked with the job API, and when the job is done, the bundle can be
+// downloaded as the job artifact.
+// It also registers the bundle kind in the job manager, so bundles can be created with the job API.
+// The bundles are created in the temporary storage, and have only the files that the user who created
+// them may download.
+func New(sources source.Provider, jobs *job.Manager, tmp *temp.Storage, authz auth.Authorizer) http.Handler {
+	starter := Starter(sources, tmp, authz)
+	jobs.Register(Kind, starter)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		params, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		j, err := jobs.Start(r.Context(), Kind, params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j)
+	})
+}
+
+// Starter returns a job starter that builds bundles from the given sources, each bundle is built from the
+// sources that were current when its job started. Files are added only if the user of the create request
+// is authorized to download them.
+func Starter(sources source.Provider, tmp *temp.Storage, authz auth.Authorizer) job.Starter {
+	return func(ctx context.Context, params json.RawMessage) (job.Func, error) {
+		var m Manifest
+		if err := json.Unmarshal(params, &m); err != nil {
+			return nil, fmt.Errorf("decode manifest: %s", err)
+		}
+		selectors, err := compile(m.Files)
+		if err != nil {
+			return nil, err
+		}
+		// the job outlives the create request, so it keeps only the user of the request
+		user, hasUser := auth.UserFromContext(ctx)
+		return func(ctx context.Context, progress func(done, total int)) (string, error) {
+			if hasUser {
+				ctx = auth.WithUser(ctx, user)
+			}
+			current, release := sources.Acquire()
+			defer release()
+			files := collect(ctx, current, selectors, m.FilterTime.Start, authz)
+			return write(ctx, tmp, files, download.NewZipManifest(string(params)), progress)
+		}, nil
+	}
+}
+
+type file struct {
+	src  source.Source
+	path string
+	stat os.FileInfo
+}
+
+// collect walks the sources and returns all the files that match the selectors, and that the user of the
+// context may download
+func collect(ctx context.Context, sources source.Sources, selectors []selector, since *time.Time, authz auth.Authorizer) []file {
+	var files []file
+	for _, src := range sources {
+		var paths []glob.Glob
+		for _, sel := range selectors {
+			if sel.fs.Match(src.Name) {
+				paths = append(paths, sel.path)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		for walker := fs.WalkFS("", src.WithContext(ctx).FS); walker.Step() && ctx.Err() == nil; {
+			if walker.Err() != nil || walker.Stat().IsDir() {
+				continue
+			}
+			if since != nil && walker.Stat().ModTime().Before(*since) {
+				continue
+			}
+			p := strings.Trim(walker.Path(), "/")
+			for _, g := range paths {
+				if !g.Match(p) {
+					continue
+				}
+				if auth.Authorized(ctx, authz, "download", src.Name, "/"+p) {
+					files = append(files, file{src: src, path: p, stat: walker.Stat()})
+				}
+				break
+			}
+		}
+	}
+	return files
+}
+
+// write writes the files and their manifest into a zip and returns its path
+func write(ctx context.Context, tmp *temp.Storage, files []file, manifest *download.ZipManifest, progress func(done, total int)) (string, error) {
+	f, err := tmp.TempFile("logserver-bundle-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+	progress(0, len(files))
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			f.Remove()
+			return "", err
+		}
+		file.src = file.src.WithContext(ctx)
+		if err := addFile(z, manifest, file); err == temp.ErrQuota {
+			f.Remove()
+			return "", err
+		} else if err != nil {
+			log.WithError(err).Warnf("Failed adding %s:%s to bundle", file.src.Name, file.path)
+		}
+		progress(i+1, len(files))
+	}
+	if err := manifest.Write(z); err != nil {
+		f.Remove()
+		return "", err
+	}
+	if err := z.Close(); err != nil {
+		f.Remove()
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func addFile(z *zip.Writer, manifest *download.ZipManifest, f file) error {
+	r, err := f.src.FS.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return manifest.Add(z, download.ZipEntry{FS: f.src.Name, Path: f.path, File: path.Join(f.src.Name, f.path), ModTime: f.stat.ModTime()}, r)
+}
+
+type selector struct {
+	fs   glob.Glob
+	path glob.Glob
+}
+
+func compile(selectors []Selector) ([]selector, error) {
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no files were selected")
+	}
+	var ret []selector
+	for _, s := range selectors {
+		if s.FS == "" {
+			s.FS = "*"
+		}
+		fsGlob, err := glob.Compile(s.FS)
+		if err != nil {
+			return nil, fmt.Errorf("compiling fs glob %s: %s", s.FS, err)
+		}
+		pathGlob, err := glob.Compile(strings.Trim(s.Path, "/"), '/')
+		if err != nil {
+			return nil, fmt.Errorf("compiling path glob %s: %s", s.Path, err)
+		}
+		ret = append(ret, selector{fs: fsGlob, path: pathGlob})
+	}
+	return ret, nil
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"time"
 
+	"github.com/Stratoscale/logserver/duration"
 	"github.com/bluele/gcache"
 )
 
@@ -17,12 +18,24 @@ type Config struct {
 	Size       int           `json:"size"`
 }
 
-func New(c Config) gcache.Cache {
+// UnmarshalJSON decodes the cache configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
 	if c.Expiration == 0 {
 		c.Expiration = defaultExpiration
 	}
 	if c.Size == 0 {
 		c.Size = defaultSize
 	}
+	return c
+}
+
+func New(c Config) gcache.Cache {
+	c = c.WithDefaults()
 	return gcache.New(c.Size).Expiration(c.Expiration).Build()
 }
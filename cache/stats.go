@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/bluele/gcache"
+)
+
+var log = logrus.WithField("pkg", "cache")
+
+// Kinder is implemented by cache keys to name their kind in the cache stats
+type Kinder interface {
+	Kind() string
+}
+
+// Sizer is implemented by cached values that can estimate their memory footprint in bytes
+type Sizer interface {
+	MemSize() int64
+}
+
+// Stats are statistics of the cache entries
+type Stats struct {
+	Entries int `json:"entries"`
+	// Bytes is the estimated memory usage of the entries that can estimate it
+	Bytes   int64   `json:"bytes"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	// Kinds are the stats of each kind of cache keys
+	Kinds map[string]KindStats `json:"kinds"`
+}
+
+// KindStats are statistics of the entries of a kind of cache keys
+type KindStats struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Collect returns the stats of a cache
+func Collect(c gcache.Cache) Stats {
+	// listing the entries counts as hits, so the counters are read first
+	s := Stats{
+		Hits:    c.HitCount(),
+		Misses:  c.MissCount(),
+		HitRate: c.HitRate(),
+		Kinds:   make(map[string]KindStats),
+	}
+	for key, val := range c.GetALL() {
+		var size int64
+		if sizer, ok := val.(Sizer); ok {
+			size = sizer.MemSize()
+		}
+		kind := keyKind(key)
+		k := s.Kinds[kind]
+		k.Entries++
+		k.Bytes += size
+		s.Kinds[kind] = k
+		s.Entries++
+		s.Bytes += size
+	}
+	return s
+}
+
+// Flush removes the entries of a kind from the cache, or all of them if the kind is empty.
+// It returns the number of removed entries.
+func Flush(c gcache.Cache, kind string) int {
+	if kind == "" {
+		n := c.Len()
+		c.Purge()
+		return n
+	}
+	n := 0
+	for _, key := range c.Keys() {
+		if keyKind(key) == kind && c.Remove(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// Handler serves the cache stats on GET requests, and flushes the cache on DELETE requests.
+// A kind query parameter flushes only the entries of that kind.
+func Handler(c gcache.Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.Method {
+		case http.MethodGet:
+			resp = Collect(c)
+		case http.MethodDelete:
+			kind := r.URL.Query().Get("kind")
+			n := Flush(c, kind)
+			log.Infof("Flushed %d cache entries of kind %q", n, kind)
+			resp = map[string]int{"flushed": n}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.WithError(err).Error("Failed writing cache response")
+		}
+	})
+}
+
+// keyKind returns the kind of a cache key, keys that don't name their kind are identified by their type
+func keyKind(key interface{}) string {
+	if k, ok := key.(Kinder); ok {
+		return k.Kind()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", key), "*")
+}
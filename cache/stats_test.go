@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type treeKey string
+
+func (treeKey) Kind() string { return "tree" }
+
+type sized int64
+
+func (s sized) MemSize() int64 { return int64(s) }
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	c := New(Config{})
+	require.Nil(t, c.Set(treeKey("a"), sized(10)))
+	require.Nil(t, c.Set(treeKey("b"), sized(20)))
+	require.Nil(t, c.Set("other", "value"))
+	c.Get(treeKey("a"))
+	c.Get(treeKey("missing"))
+
+	h := Handler(c)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var s Stats
+	require.Nil(t, json.NewDecoder(rec.Body).Decode(&s))
+	assert.Equal(t, Stats{
+		Entries: 3,
+		Bytes:   30,
+		Hits:    1,
+		Misses:  1,
+		HitRate: 0.5,
+		Kinds: map[string]KindStats{
+			"tree":   {Entries: 2, Bytes: 30},
+			"string": {Entries: 1},
+		},
+	}, s)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/?kind=tree", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"flushed": 2}`, rec.Body.String())
+	assert.Equal(t, 1, c.Len())
+
+	assert.Equal(t, 1, Flush(c, ""))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"expiration": "10m", "size": 5}`), &c))
+	assert.Equal(t, Config{Expiration: 10 * time.Minute, Size: 5}, c)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/Stratoscale/logserver/cache"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/kr/fs"
+)
+
+const (
+	// checkMaxFiles is the number of files that are listed from each source in a check
+	checkMaxFiles = 100
+	// checkMaxLines is the number of lines of a sample file that are parsed in a check
+	checkMaxLines = 20
+	// checkMaxParserFiles is the number of sample files that a parser is checked against
+	checkMaxParserFiles = 10
+)
+
+// Results of checks, only failed checks fail the command
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkWarn = "WARN"
+	checkSkip = "SKIP"
+)
+
+// checkResult is a single line in the check report
+type checkResult struct {
+	check   string
+	name    string
+	result  string
+	details string
+}
+
+// sample is a file that was found in a source
+type sample struct {
+	src  source.Source
+	path string
+}
+
+// check runs a preflight of a configuration: it connects to every source, lists a sample of
+// its files, and runs each parser against lines of a file that it applies to. It writes a report
+// and returns false if any of the checks failed.
+func check(cfg config, w io.Writer) bool {
+	var (
+		results []checkResult
+		samples []sample
+		c       = cache.New(cfg.Cache)
+	)
+
+	for _, srcCfg := range cfg.Sources {
+		r := checkResult{check: "source", name: srcCfg.Name, result: checkFail}
+		srcs, err := source.New([]source.Config{srcCfg}, c)
+		switch {
+		case err != nil:
+			r.details = err.Error()
+		case len(srcs) == 0:
+			r.details = fmt.Sprintf("failed connecting to %s", srcCfg.URL)
+		default:
+			files, err := listSample(srcs[0])
+			for _, f := range files {
+				samples = append(samples, sample{src: srcs[0], path: f})
+			}
+			switch {
+			case err != nil:
+				r.details = err.Error()
+			case len(files) == 0:
+				r.result, r.details = checkWarn, "no files"
+			default:
+				r.result, r.details = checkPass, fmt.Sprintf("listed %d files", len(files))
+			}
+			defer srcs.CloseSources()
+		}
+		results = append(results, r)
+	}
+
+	parsers := cfg.Parsers
+	if cfg.ParsersDir != "" {
+		dirParsers, err := parse.LoadDir(cfg.ParsersDir)
+		if err != nil {
+			results = append(results, checkResult{check: "parsers_dir", name: cfg.ParsersDir, result: checkFail, details: err.Error()})
+		}
+		parsers = append(append([]parse.Config{}, parsers...), dirParsers...)
+	}
+
+	for i, parserCfg := range parsers {
+		r := checkResult{check: "parser", name: parserCfg.Glob, result: checkFail}
+		if r.name == "" {
+			r.name = fmt.Sprintf("#%d", i+1)
+		}
+		p, err := parse.New([]parse.Config{parserCfg})
+		if err != nil {
+			r.details = err.Error()
+		} else {
+			r.result, r.details = checkParser(p, parserCfg.Glob, samples)
+		}
+		results = append(results, r)
+	}
+
+	passed := true
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tNAME\tRESULT\tDETAILS")
+	for _, r := range results {
+		if r.result == checkFail {
+			passed = false
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.check, r.name, r.result, r.details)
+	}
+	tw.Flush()
+	return passed
+}
+
+// listSample walks a source and returns the paths of up to checkMaxFiles files
+func listSample(src source.Source) ([]string, error) {
+	var (
+		files  []string
+		walker = fs.WalkFS(src.FS.Join(), src.FS)
+	)
+	for walker.Step() && len(files) < checkMaxFiles {
+		if err := walker.Err(); err != nil {
+			return files, err
+		}
+		if !walker.Stat().IsDir() {
+			files = append(files, walker.Path())
+		}
+	}
+	return files, nil
+}
+
+// checkParser runs a parser against the first lines of sample files that it applies to. It passes
+// if lines of one of the files were parsed, and is skipped if the parser applies to none of the files.
+// A parser that parsed none of the files gets a warning, since the sample might not include its logs.
+func checkParser(p parse.Parse, pattern string, samples []sample) (result string, details string) {
+	tried := 0
+	for _, s := range samples {
+		if tried == checkMaxParserFiles {
+			break
+		}
+		if !p.Applies(s.path) {
+			continue
+		}
+		tried++
+		lines, parsed, err := parseSample(p, s)
+		if err != nil {
+			details = fmt.Sprintf("read %s:%s: %s", s.src.Name, s.path, err)
+			continue
+		}
+		if parsed > 0 {
+			return checkPass, fmt.Sprintf("parsed %d/%d lines of %s:%s", parsed, lines, s.src.Name, s.path)
+		}
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+	switch {
+	case tried == 0:
+		return checkSkip, fmt.Sprintf("no sample file matches %s", pattern)
+	case details != "":
+		return checkFail, details
+	}
+	return checkWarn, fmt.Sprintf("no lines were parsed in %d files that match %s", tried, pattern)
+}
+
+// parseSample parses the first lines of a sample file, and returns the number of lines that were read and parsed
+func parseSample(p parse.Parse, s sample) (lines int, parsed int, err error) {
+	f, err := filesystem.OpenText(s.src.FS, s.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lines < checkMaxLines && scanner.Scan() {
+		lines++
+		if p.Matches(s.path, scanner.Bytes()) {
+			parsed++
+		}
+	}
+	return lines, parsed, scanner.Err()
+}
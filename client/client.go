@@ -0,0 +1,294 @@
+// Package client is a Go client of the websocket protocol of the logserver.
+//
+// The server serves a single request at a time on a connection, so the requests of a client are sent one after
+// the other. A client reconnects when its connection is lost, with an exponential backoff between the attempts.
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/engine"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/gorilla/websocket"
+)
+
+var log = logrus.WithField("pkg", "client")
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultMaxReconnectDelay = 30 * time.Second
+	// cancelTimeout is the time to wait for a cancelled request to finish before the connection is dropped
+	cancelTimeout = 5 * time.Second
+)
+
+// Config of a client
+type Config struct {
+	// Header is sent with the websocket handshake, for example with an authorization token
+	Header http.Header
+	// ReconnectDelay is the delay before the second connection attempt, it is doubled on every failed attempt
+	ReconnectDelay time.Duration
+	// MaxReconnectDelay is the maximal delay between connection attempts
+	MaxReconnectDelay time.Duration
+	// Dialer dials the websocket, the default dialer by default
+	Dialer *websocket.Dialer
+}
+
+// Client of the websocket protocol
+type Client struct {
+	url string
+	Config
+
+	// lock is held while a request is served, and guards the connection and the request ids
+	lock   sync.Mutex
+	conn   *websocket.Conn
+	nextID int
+	// writeLock guards writes to the connection, since a request is cancelled while its responses are read
+	writeLock sync.Mutex
+}
+
+// Dial connects to the websocket of a logserver, for example ws://localhost:8888/_ws
+func Dial(ctx context.Context, url string, c Config) (*Client, error) {
+	if c.ReconnectDelay == 0 {
+		c.ReconnectDelay = defaultReconnectDelay
+	}
+	if c.MaxReconnectDelay == 0 {
+		c.MaxReconnectDelay = defaultMaxReconnectDelay
+	}
+	if c.Dialer == nil {
+		c.Dialer = websocket.DefaultDialer
+	}
+	cl := &Client{url: url, Config: c, nextID: 1}
+	if err := cl.connect(ctx); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// Close closes the connection of the client, it waits for the running request to finish
+func (c *Client) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Do sends a request, and calls fn with each of its responses, until the request is finished.
+// The action of the request should be set, and its id is set by the client.
+// If the context is done or fn returns an error, the request is cancelled and the error is returned.
+// An error response of the server is returned as an error.
+func (c *Client) Do(ctx context.Context, req engine.Request, fn func(*engine.Response) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.send(ctx, &req); err != nil {
+		return err
+	}
+	conn := c.conn
+
+	// cancel the request when the context is done, or when fn fails
+	var (
+		cancelID   = c.nextID
+		cancelOnce sync.Once
+		done       = make(chan struct{})
+		fnErr      error
+	)
+	c.nextID++
+	cancel := func() {
+		cancelOnce.Do(func() {
+			if err := c.write(conn, &engine.Request{Meta: engine.Meta{ID: cancelID, Action: "cancel"}}); err != nil {
+				log.WithError(err).Warnf("Failed cancelling request %d", req.ID)
+			}
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+			return
+		}
+		// drop the connection if the server does not finish the cancelled request
+		select {
+		case <-time.After(cancelTimeout):
+			conn.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	for {
+		var resp engine.Response
+		if err := conn.ReadJSON(&resp); err != nil {
+			c.drop()
+			return fmt.Errorf("reading response: %s", err)
+		}
+		switch {
+		// responses of previous requests and events are ignored
+		case resp.ID != req.ID:
+		case resp.Finished:
+			if fnErr != nil {
+				return fnErr
+			}
+			return ctx.Err()
+		// the finished response follows the error response
+		case resp.Error != "":
+			if fnErr == nil {
+				fnErr = fmt.Errorf("%s: %s", req.Action, resp.Error)
+			}
+		// responses that arrive after the request was cancelled are dropped
+		case fnErr != nil, ctx.Err() != nil:
+		default:
+			if err := fn(&resp); err != nil {
+				fnErr = err
+				cancel()
+			}
+		}
+	}
+}
+
+// Tree returns the file tree of the sources that match the filters of the request
+func (c *Client) Tree(ctx context.Context, req engine.Request) ([]*engine.File, error) {
+	req.Action = "get-file-tree"
+	var files []*engine.File
+	err := c.Do(ctx, req, func(resp *engine.Response) error {
+		files = append(files, resp.Files...)
+		return nil
+	})
+	return files, err
+}
+
+// Content calls fn with the lines of the file in the path of the request
+func (c *Client) Content(ctx context.Context, req engine.Request, fn func(*parse.Log) error) error {
+	req.Action = "get-content"
+	return c.Do(ctx, req, eachLine(fn))
+}
+
+// Search calls fn with the lines that match the search request
+func (c *Client) Search(ctx context.Context, req engine.Request, fn func(*parse.Log) error) error {
+	req.Action = "search"
+	return c.Do(ctx, req, eachLine(fn))
+}
+
+// SearchLines returns an iterator of the lines that match the search request.
+// The iterator should be closed if it is not consumed until its end.
+func (c *Client) SearchLines(ctx context.Context, req engine.Request) *Lines {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lines{ch: make(chan *parse.Log), cancel: cancel}
+	go func() {
+		defer close(l.ch)
+		l.err = c.Search(ctx, req, func(line *parse.Log) error {
+			select {
+			case l.ch <- line:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return l
+}
+
+// Lines iterates over the lines of a request
+type Lines struct {
+	ch     chan *parse.Log
+	line   *parse.Log
+	err    error
+	cancel context.CancelFunc
+}
+
+// Next advances the iterator to the next line, it returns false when there are no more lines, or on failure
+func (l *Lines) Next() bool {
+	line, ok := <-l.ch
+	l.line = line
+	return ok
+}
+
+// Line returns the current line of the iterator
+func (l *Lines) Line() *parse.Log {
+	return l.line
+}
+
+// Err returns the error of the iteration, it should be called after Next returned false
+func (l *Lines) Err() error {
+	return l.err
+}
+
+// Close stops the iteration, and cancels the request if it is still running
+func (l *Lines) Close() {
+	l.cancel()
+	for range l.ch {
+	}
+}
+
+func eachLine(fn func(*parse.Log) error) func(*engine.Response) error {
+	return func(resp *engine.Response) error {
+		for i := range resp.Lines {
+			if err := fn(&resp.Lines[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// send sends a request, it reconnects if the connection was lost. It is called with the lock held.
+func (c *Client) send(ctx context.Context, req *engine.Request) error {
+	req.ID = c.nextID
+	c.nextID++
+	if c.conn != nil {
+		err := c.write(c.conn, req)
+		if err == nil {
+			return nil
+		}
+		log.WithError(err).Warnf("Failed sending request, reconnecting")
+		c.drop()
+	}
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+	return c.write(c.conn, req)
+}
+
+func (c *Client) write(conn *websocket.Conn, req *engine.Request) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return conn.WriteJSON(req)
+}
+
+// connect dials the server until it succeeds or the context is done
+func (c *Client) connect(ctx context.Context) error {
+	delay := c.ReconnectDelay
+	for {
+		conn, _, err := c.Dialer.Dial(c.url, c.Header)
+		if err == nil {
+			c.conn = conn
+			return nil
+		}
+		log.WithError(err).Warnf("Failed connecting to %s, retrying in %s", c.url, delay)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("connecting to %s: %s", c.url, err)
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > c.MaxReconnectDelay {
+			delay = c.MaxReconnectDelay
+		}
+	}
+}
+
+// drop closes a failed connection, the next request reconnects
+func (c *Client) drop() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
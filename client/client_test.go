@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Stratoscale/logserver/engine"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	sources := source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+			"var/log/syslog": "start\nerror: disk full\nstop\n",
+		})},
+		{Name: "node2", FS: filesystem.NewMemory(map[string]string{
+			"var/log/syslog": "error: network down\n",
+		})},
+	}
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	return httptest.NewServer(engine.New(engine.Config{}, sources, parser, gcache.New(10).Build()))
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	s := newServer(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	c, err := Dial(ctx, "ws://"+s.Listener.Addr().String(), Config{})
+	require.Nil(t, err)
+	defer c.Close()
+
+	files, err := c.Tree(ctx, engine.Request{})
+	require.Nil(t, err)
+	var keys []string
+	for _, f := range files {
+		keys = append(keys, f.Key)
+	}
+	assert.Contains(t, keys, "var/log/syslog")
+
+	var content []string
+	err = c.Content(ctx, engine.Request{FilterSource: []string{"node1"}, Path: engine.Path{"var", "log", "syslog"}}, func(l *parse.Log) error {
+		content = append(content, l.Msg)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"start", "error: disk full", "stop"}, content)
+
+	var found []string
+	err = c.Search(ctx, engine.Request{Regexp: "error"}, func(l *parse.Log) error {
+		found = append(found, l.FS)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{"node1", "node2"}, found)
+
+	// the callback error cancels the request, and the client can be used for the next request
+	stop := errors.New("stop")
+	assert.Equal(t, stop, c.Search(ctx, engine.Request{Regexp: "error"}, func(*parse.Log) error { return stop }))
+
+	lines := c.SearchLines(ctx, engine.Request{Regexp: "error", FilterSource: []string{"node2"}})
+	require.True(t, lines.Next())
+	assert.Equal(t, "error: network down", lines.Line().Msg)
+	assert.False(t, lines.Next())
+	assert.Nil(t, lines.Err())
+
+	// the server errors are returned
+	err = c.Do(ctx, engine.Request{Meta: engine.Meta{Action: "search"}, Regexp: "("}, func(*engine.Response) error { return nil })
+	assert.NotNil(t, err)
+
+	// a closed client reconnects on the next request
+	require.Nil(t, c.Close())
+	_, err = c.Tree(ctx, engine.Request{})
+	assert.Nil(t, err)
+}
+
+func TestDialFailure(t *testing.T) {
+	t.Parallel()
+
+	s := newServer(t)
+	addr := "ws://" + s.Listener.Addr().String()
+	s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Dial(ctx, addr, Config{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,420 @@
+// Code generated by "logserver client-sdk". DO NOT EDIT.
+
+// Types of the websocket protocol, generated from the Go types of the server.
+// Durations are in nanoseconds, and times are RFC3339 strings.
+
+export interface Aggregation {
+  field: string;
+  count: number;
+  min: number;
+  max: number;
+  avg: number;
+  sum: number;
+  percentiles?: Record<string, number>;
+}
+
+export interface Artifact {
+  kind: string;
+  id?: string;
+  title: string;
+  creator?: string;
+  created: string;
+}
+
+export interface Config {
+  glob: string;
+  json_mapping: Record<string, string>;
+  regexp: string;
+  time_formats: string[];
+  append_args: boolean;
+  delimiter: string;
+  columns: string[];
+  column_mapping: Record<string, string>;
+  pipeline?: Config[];
+}
+
+export interface Estimate {
+  files: number;
+  bytes: number;
+  sources: SourceEstimate[];
+  cached: boolean;
+}
+
+export interface Event {
+  type: string;
+  time: string;
+  data: unknown;
+  path?: string;
+}
+
+export interface File {
+  key: string;
+  path: Path;
+  is_dir: boolean;
+  instances: FileInstance[];
+}
+
+export interface FileInstance {
+  size: number;
+  fs: string;
+  uncompressed_size?: number;
+  mtime?: string | null;
+}
+
+export interface FileStatus {
+  fs: string;
+  status: string;
+  size?: number;
+  error?: string;
+}
+
+export interface Log {
+  msg: string;
+  level: string;
+  time?: string | null;
+  fs: string;
+  file_name: string;
+  line: number;
+  offset: number;
+  thread?: string;
+  path?: string;
+  lineno: number;
+  fields?: Record<string, string>;
+  repeat?: number;
+  raw?: string;
+  gap?: number;
+}
+
+export interface Manifest {
+  created: string;
+  files: ManifestFile[];
+  start?: string | null;
+  end?: string | null;
+  partial?: boolean;
+}
+
+export interface ManifestFile {
+  fs: string;
+  path: Path;
+  size: number;
+  format: string;
+  start?: string | null;
+  end?: string | null;
+}
+
+export interface Meta {
+  id: number;
+  action: string;
+  fs?: string;
+  path?: Path;
+}
+
+export interface ParserInfo {
+  glob: string;
+  json_mapping: Record<string, string>;
+  regexp: string;
+  time_formats: string[];
+  append_args: boolean;
+  delimiter: string;
+  columns: string[];
+  column_mapping: Record<string, string>;
+  pipeline?: Config[];
+  format: string;
+  applies: boolean;
+  examples?: string[];
+}
+
+export type Path = string[];
+
+export interface Preset {
+  name: string;
+  description?: string;
+  regexp: string;
+  path?: Path;
+  filter_fs?: string[];
+  filter_group?: string[];
+  filter_tags?: Record<string, string>;
+}
+
+export interface Request {
+  meta: Meta;
+  path: Path;
+  regexp: string;
+  filter_fs: string[];
+  filter_group: string[];
+  filter_time: TimeRange;
+  filter_tags: Record<string, string>;
+  follow: boolean;
+  peek_lines: number;
+  filter_level: string[];
+  filter_path: string;
+  modified_since?: string | null;
+  modified_before?: string | null;
+  query: string;
+  field: string;
+  percentiles: number[];
+  trace: string;
+  collapse: boolean;
+  gap_threshold: number;
+  ordered: boolean;
+  max_matches_per_file: number;
+  max_total_matches: number;
+  include_artifacts: boolean;
+  from_byte_offset: number;
+  from_line: number;
+  time?: string | null;
+  targets: Target[];
+  window_lines: number;
+  speed: number;
+  page_token: string;
+  permalink: string;
+  events: string[];
+  compression: string;
+  dictionary_id: string;
+  include_raw: boolean;
+  watch_key: string;
+  session: string;
+  natural_sort: boolean;
+  paths: Path[];
+}
+
+export interface Response {
+  meta: Meta;
+  lines?: Log[];
+  tail?: Log[];
+  sources?: SourceInfo[];
+  presets?: Preset[];
+  aggregation?: Aggregation | null;
+  estimate?: Estimate | null;
+  manifest?: Manifest | null;
+  tree?: File[];
+  error?: string;
+  finished?: boolean;
+  partial?: boolean;
+  late?: boolean;
+  chunk?: number;
+  eof?: boolean;
+  source_errors?: SourceError[];
+  next_page?: string;
+  permalink?: string;
+  stale?: string;
+  artifacts?: Artifact[];
+  parsers?: ParserInfo[];
+  retry_after?: number;
+  event?: Event | null;
+  compressed?: string;
+  dictionary_id?: string;
+  dictionary?: string;
+  watch_key?: string;
+  watch_request?: Request | null;
+  watched?: Response | null;
+  file_status?: FileStatus | null;
+  seek_verify?: SeekVerification | null;
+}
+
+export interface SeekVerification {
+  fs: string;
+  offset: number;
+  line: number;
+  line_offset: number;
+  line_ending: string;
+  exact: boolean;
+  scanned: string;
+  seeked: string;
+  size: number;
+}
+
+export interface SourceError {
+  fs: string;
+  code: string;
+  message: string;
+}
+
+export interface SourceEstimate {
+  fs: string;
+  files: number;
+  bytes: number;
+}
+
+export interface SourceInfo {
+  name: string;
+  groups?: string[];
+  tags?: Record<string, string>;
+  latency?: number;
+}
+
+export interface Target {
+  fs: string;
+  path: Path;
+}
+
+export interface TimeRange {
+  start?: string | null;
+  end?: string | null;
+}
+
+// The client of the websocket protocol.
+
+// RequestInit is a request, where only the action is required
+export type RequestInit = Partial<Request> & { meta: Partial<Meta> & { action: string } };
+
+export interface ClientOptions {
+  // reconnectDelay is the delay before the first reconnection attempt, in milliseconds, 1000 by default.
+  // The delay is doubled on every failed attempt, up to maxReconnectDelay.
+  reconnectDelay?: number;
+  // maxReconnectDelay is the maximal delay between reconnection attempts, in milliseconds, 30000 by default
+  maxReconnectDelay?: number;
+  // WebSocket is the websocket implementation, the global one by default
+  WebSocket?: typeof WebSocket;
+}
+
+// CancelledError rejects requests that were cancelled, or replaced by another request
+export class CancelledError extends Error {
+  constructor(message = "request was cancelled") {
+    super(message);
+    this.name = "CancelledError";
+  }
+}
+
+interface Pending {
+  id: number;
+  onResponse: (resp: Response) => void;
+  resolve: () => void;
+  reject: (err: Error) => void;
+}
+
+interface Subscription {
+  events: string[];
+  onEvent: (resp: Response) => void;
+}
+
+// LogserverClient sends requests on a websocket, and reconnects when the connection is lost.
+// The server serves a single request at a time on a connection, so a new request cancels the running one.
+// Event subscriptions are kept across requests, and are renewed when the client reconnects.
+export class LogserverClient {
+  private ws: WebSocket | null = null;
+  private nextId = 1;
+  private pending: Pending | null = null;
+  private subscription: Subscription | null = null;
+  private queue: string[] = [];
+  private closed = false;
+  private delay: number;
+  private readonly options: Required<ClientOptions>;
+
+  constructor(private readonly url: string, options: ClientOptions = {}) {
+    this.options = {
+      reconnectDelay: options.reconnectDelay || 1000,
+      maxReconnectDelay: options.maxReconnectDelay || 30000,
+      WebSocket: options.WebSocket || WebSocket,
+    };
+    this.delay = this.options.reconnectDelay;
+    this.connect();
+  }
+
+  // request sends a request, and calls onResponse with each of its responses. The returned promise is resolved
+  // when the request finished, and rejected if it failed, was cancelled, or the connection was lost.
+  request(req: RequestInit, onResponse: (resp: Response) => void = () => undefined): Promise<void> {
+    this.cancelPending(new CancelledError("request was replaced by another request"));
+    const id = this.nextId++;
+    const message = { ...req, meta: { ...req.meta, id } };
+    return new Promise<void>((resolve, reject) => {
+      this.pending = { id, onResponse, resolve, reject };
+      this.send(message);
+    });
+  }
+
+  // cancel cancels the running request
+  cancel(): void {
+    if (this.cancelPending(new CancelledError())) {
+      this.send({ meta: { id: this.nextId++, action: "cancel" } });
+    }
+  }
+
+  // subscribe subscribes to server events with the given type globs, it replaces the previous subscription
+  subscribe(events: string[], onEvent: (resp: Response) => void): void {
+    this.subscription = { events, onEvent };
+    this.send({ meta: { id: this.nextId++, action: "subscribe-events" }, events });
+  }
+
+  // unsubscribe stops the subscription to server events
+  unsubscribe(): void {
+    this.subscription = null;
+    this.send({ meta: { id: this.nextId++, action: "unsubscribe-events" } });
+  }
+
+  // close closes the connection, and rejects the running request
+  close(): void {
+    this.closed = true;
+    this.cancelPending(new CancelledError("client was closed"));
+    if (this.ws) {
+      this.ws.close();
+    }
+  }
+
+  private connect(): void {
+    const ws = new this.options.WebSocket(this.url);
+    this.ws = ws;
+    ws.onopen = () => {
+      this.delay = this.options.reconnectDelay;
+      if (this.subscription) {
+        const { events } = this.subscription;
+        ws.send(JSON.stringify({ meta: { id: this.nextId++, action: "subscribe-events" }, events }));
+      }
+      this.queue.splice(0).forEach(message => ws.send(message));
+    };
+    ws.onmessage = (e: MessageEvent) => this.receive(JSON.parse(e.data) as Response);
+    ws.onclose = () => {
+      this.ws = null;
+      this.cancelPending(new Error("connection was lost"));
+      if (!this.closed) {
+        setTimeout(() => this.connect(), this.delay);
+        this.delay = Math.min(this.delay * 2, this.options.maxReconnectDelay);
+      }
+    };
+  }
+
+  private send(message: object): void {
+    const data = JSON.stringify(message);
+    if (this.ws && this.ws.readyState === this.options.WebSocket.OPEN) {
+      this.ws.send(data);
+    } else {
+      this.queue.push(data);
+    }
+  }
+
+  private receive(resp: Response): void {
+    if (resp.meta.action === "subscribe-events") {
+      if (this.subscription && !resp.finished) {
+        this.subscription.onEvent(resp);
+      }
+      return;
+    }
+    const pending = this.pending;
+    if (!pending || resp.meta.id !== pending.id) {
+      // responses of cancelled requests are ignored
+      return;
+    }
+    if (resp.finished) {
+      this.pending = null;
+      pending.resolve();
+      return;
+    }
+    if (resp.error) {
+      this.pending = null;
+      pending.reject(new Error(resp.error));
+      return;
+    }
+    pending.onResponse(resp);
+  }
+
+  private cancelPending(err: Error): boolean {
+    const pending = this.pending;
+    if (!pending) {
+      return false;
+    }
+    this.pending = null;
+    this.queue = this.queue.filter(message => JSON.parse(message).meta.id !== pending.id);
+    pending.reject(err);
+    return true;
+  }
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/notify"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of configuration files
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// configFormat returns the format of a configuration file. If the format is not given, it is detected
+// by the file extension, and files without a yaml extension are json files.
+func configFormat(fileName, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case formatJSON:
+		return formatJSON, nil
+	case formatYAML, "yml":
+		return formatYAML, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown config format: %s", format)
+	}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		return formatYAML, nil
+	default:
+		return formatJSON, nil
+	}
+}
+
+// decodeConfig decodes a configuration in the given format. YAML configurations are converted to json,
+// so they have the same keys and values as json configurations.
+func decodeConfig(r io.Reader, format string, cfg *config) error {
+	if format != formatYAML {
+		return json.NewDecoder(r).Decode(cfg)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b, err = yamlToJSON(b)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(b)).Decode(cfg)
+}
+
+// includedConfig is a file that is included in the configuration, with more sources and parsers
+type includedConfig struct {
+	Sources []source.Config `json:"sources"`
+	Parsers []parse.Config  `json:"parsers"`
+}
+
+// include appends the sources and parsers of the included files to the configuration, in the order of the
+// include globs, and of the file names of each glob. Relative globs are relative to the directory of the
+// configuration file. A file that matches multiple globs is included once.
+func (c *config) include(dir string) error {
+	included := make(map[string]bool)
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		fileNames, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("include %s: %s", pattern, err)
+		}
+		for _, fileName := range fileNames {
+			if included[fileName] {
+				continue
+			}
+			included[fileName] = true
+			inc, err := readInclude(fileName)
+			if err != nil {
+				return fmt.Errorf("include %s: %s", fileName, err)
+			}
+			c.Sources = append(c.Sources, inc.Sources...)
+			c.Parsers = append(c.Parsers, inc.Parsers...)
+		}
+	}
+	return nil
+}
+
+// readInclude reads an included file, in the format of its extension. Other keys than the sources and
+// the parsers are an error, since they would not be merged.
+func readInclude(fileName string) (includedConfig, error) {
+	var inc includedConfig
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return inc, err
+	}
+	if format, _ := configFormat(fileName, ""); format == formatYAML {
+		if b, err = yamlToJSON(b); err != nil {
+			return inc, err
+		}
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return inc, d.Decode(&inc)
+}
+
+// yamlToJSON converts a yaml document to json
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue converts a decoded yaml value to a value that can be encoded to json. Yaml maps may have keys
+// that are not strings, like numbers, which are converted to strings as json object keys.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = jsonValue(value)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// expandEnv expands the ${VAR} placeholders of environment variables in the sources and in the dynamic mode
+// configuration, so secrets and deployment specific values don't have to be written in the file
+func (c *config) expandEnv() error {
+	for i := range c.Sources {
+		if err := c.Sources[i].ExpandEnv(); err != nil {
+			return err
+		}
+	}
+	if err := c.Dynamic.ExpandEnv(); err != nil {
+		return fmt.Errorf("dynamic %s", err)
+	}
+	return nil
+}
+
+// withDefaults returns the configuration with the defaults that the server applies to unset values, so the
+// configuration that the server runs with can be printed
+func (c config) withDefaults() config {
+	c.Global = c.Global.WithDefaults()
+	c.Sources = append([]source.Config{}, c.Sources...)
+	for i := range c.Sources {
+		c.Sources[i] = c.Sources[i].WithDefaults()
+	}
+	c.Dynamic = c.Dynamic.WithDefaults()
+	c.Cache = c.Cache.WithDefaults()
+	c.Route = c.Route.WithDefaults()
+	c.Jobs = c.Jobs.WithDefaults()
+	c.Webhooks = append([]notify.Config{}, c.Webhooks...)
+	for i := range c.Webhooks {
+		c.Webhooks[i] = c.Webhooks[i].WithDefaults()
+	}
+	c.Auth.Policy = c.Auth.Policy.WithDefaults()
+	c.Auth.Signing = c.Auth.Signing.WithDefaults()
+	c.Uploads = c.Uploads.WithDefaults()
+	c.Snapshots = c.Snapshots.WithDefaults()
+	c.Admission = c.Admission.WithDefaults()
+	c.Self = c.Self.WithDefaults()
+	return c
+}
+
+// redacted replaces the secrets of a printed configuration
+const redacted = "REDACTED"
+
+// withoutSecrets returns the configuration with its secrets redacted: the passwords of users, the signing key,
+// the header values of webhooks, which usually hold tokens, and the passwords in source URLs
+func (c config) withoutSecrets() config {
+	c.Auth.Users = append([]auth.User{}, c.Auth.Users...)
+	for i := range c.Auth.Users {
+		if c.Auth.Users[i].Password != "" {
+			c.Auth.Users[i].Password = redacted
+		}
+	}
+	if c.Auth.Signing.Key != "" {
+		c.Auth.Signing.Key = redacted
+	}
+	c.Webhooks = append([]notify.Config{}, c.Webhooks...)
+	for i, w := range c.Webhooks {
+		if w.Headers == nil {
+			continue
+		}
+		c.Webhooks[i].Headers = make(map[string]string, len(w.Headers))
+		for name := range w.Headers {
+			c.Webhooks[i].Headers[name] = redacted
+		}
+	}
+	c.Sources = append([]source.Config{}, c.Sources...)
+	for i, src := range c.Sources {
+		u, err := url.Parse(src.URL)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.Sources[i].URL = u.String()
+		}
+	}
+	return c
+}
@@ -1,15 +1,135 @@
 package debug
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/http/pprof"
+	"sync"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 )
 
-func PProfHandle(r *mux.Router) {
-	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+var log = logrus.WithField("pkg", "debug")
+
+// VarsHandle mounts the handler of the published variables, like the open files of each source
+func VarsHandle(r *mux.Router, h http.Handler) {
+	r.Path("/debug/vars").Handler(h)
+}
+
+// PProfHandle mounts the pprof endpoints, including the execution trace, and the profiling state handler
+func PProfHandle(r *mux.Router, pprof, state http.Handler) {
+	r.Path("/debug/profiling").Handler(state)
+	r.PathPrefix("/debug/pprof/").Handler(pprof)
+}
+
+// Profiling is the state of the pprof endpoints. It is enabled on startup in debug mode, and can be enabled
+// at runtime to diagnose a live server, optionally until a deadline, after which it is disabled again.
+type Profiling struct {
+	lock    sync.Mutex
+	enabled bool
+	until   time.Time
+}
+
+// PProf serves the pprof endpoints, including the execution trace, while the profiling is enabled
+func (p *Profiling) PProf() http.Handler {
+	r := mux.NewRouter()
 	r.PathPrefix("/debug/pprof/cmdline").HandlerFunc(pprof.Cmdline)
 	r.PathPrefix("/debug/pprof/profile").HandlerFunc(pprof.Profile)
 	r.PathPrefix("/debug/pprof/symbol").HandlerFunc(pprof.Symbol)
 	r.PathPrefix("/debug/pprof/trace").HandlerFunc(pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !p.Enabled() {
+			http.Error(w, "profiling is disabled", http.StatusNotFound)
+			return
+		}
+		r.ServeHTTP(w, req)
+	})
+}
+
+// ProfilingState is the json of the profiling state
+type ProfilingState struct {
+	Enabled bool `json:"enabled"`
+	// Until is the time at which the profiling is disabled, if it was enabled for a duration
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// profilingRequest changes the profiling state, if the duration is given, the profiling is enabled for it
+type profilingRequest struct {
+	Enabled  bool   `json:"enabled"`
+	Duration string `json:"duration"`
+}
+
+// NewProfiling returns the profiling state, enabled or disabled
+func NewProfiling(enabled bool) *Profiling {
+	return &Profiling{enabled: enabled}
+}
+
+// Enabled returns true if the pprof endpoints are served
+func (p *Profiling) Enabled() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.enabledLocked()
+}
+
+func (p *Profiling) enabledLocked() bool {
+	return p.enabled && (p.until.IsZero() || time.Now().Before(p.until))
+}
+
+// Set enables or disables the profiling, a positive duration disables it after the duration
+func (p *Profiling) Set(enabled bool, d time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.enabled = enabled
+	p.until = time.Time{}
+	if enabled && d > 0 {
+		p.until = time.Now().Add(d)
+	}
+}
+
+// State returns the profiling state
+func (p *Profiling) State() ProfilingState {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s := ProfilingState{Enabled: p.enabledLocked()}
+	if s.Enabled && !p.until.IsZero() {
+		until := p.until
+		s.Until = &until
+	}
+	return s
+}
+
+// Handler serves the profiling state on GET, and changes it on PUT with a json of the enabled state and an
+// optional duration, like {"enabled": true, "duration": "15m"}
+func (p *Profiling) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req profilingRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "bad profiling request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			var d time.Duration
+			if req.Duration != "" {
+				var err error
+				if d, err = time.ParseDuration(req.Duration); err != nil || d < 0 {
+					http.Error(w, "bad profiling duration: "+req.Duration, http.StatusBadRequest)
+					return
+				}
+			}
+			p.Set(req.Enabled, d)
+			log.Warnf("Profiling was set to %t by %s (duration: %q)", req.Enabled, r.RemoteAddr, req.Duration)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.State()); err != nil {
+			log.WithError(err).Error("Failed writing profiling state")
+		}
+	})
 }
@@ -0,0 +1,62 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiling(t *testing.T) {
+	t.Parallel()
+
+	p := NewProfiling(false)
+	r := mux.NewRouter()
+	PProfHandle(r, p.PProf(), p.Handler())
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	state := func() ProfilingState {
+		rec := do(http.MethodGet, "/debug/profiling", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var s ProfilingState
+		require.Nil(t, json.NewDecoder(rec.Body).Decode(&s))
+		return s
+	}
+
+	assert.Equal(t, ProfilingState{}, state())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/debug/pprof/", "").Code)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/debug/profiling", `{"enabled": true}`).Code)
+	assert.Equal(t, ProfilingState{Enabled: true}, state())
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/debug/pprof/", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/debug/pprof/cmdline", "").Code)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/debug/profiling", `{"enabled": false}`).Code)
+	assert.False(t, state().Enabled)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/debug/pprof/", "").Code)
+
+	// enabled for a duration
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/debug/profiling", `{"enabled": true, "duration": "50ms"}`).Code)
+	s := state()
+	assert.True(t, s.Enabled)
+	require.NotNil(t, s.Until)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, ProfilingState{}, state())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/debug/pprof/", "").Code)
+
+	// bad requests
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/debug/profiling", `{"enabled": true, "duration": "soon"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/debug/profiling", `not json`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "/debug/profiling", "").Code)
+	assert.False(t, state().Enabled)
+}
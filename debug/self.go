@@ -0,0 +1,113 @@
+package debug
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+)
+
+const (
+	defaultSelfName    = "logserver"
+	defaultSelfEntries = 1000
+	// selfRingFile is the name of the file of the recent entries, when the logs are not written to a file
+	selfRingFile = "logserver.log"
+)
+
+// SelfConfig configures the self-monitoring source, a virtual source of the logs of the logserver itself
+type SelfConfig struct {
+	Enabled bool `json:"enabled"`
+	// Name of the source, "logserver" by default
+	Name string `json:"name"`
+	// LogFile is a file that the logs are written to, in addition to the standard error.
+	// The source serves the directory of the file, so rotated log files are served as well.
+	LogFile string `json:"log_file"`
+	// Entries is the number of recent entries that are kept in memory when no log file is given, 1000 by default
+	Entries int `json:"entries"`
+}
+
+// Self is the self-monitoring source
+type Self struct {
+	// Name of the source
+	Name string
+	// FS serves the logs of the logserver
+	FS filesystem.FileSystem
+	// File is the name of the log file in FS, which is parsed as JSON logs
+	File string
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c SelfConfig) WithDefaults() SelfConfig {
+	if c.Name == "" {
+		c.Name = defaultSelfName
+	}
+	if c.Entries == 0 {
+		c.Entries = defaultSelfEntries
+	}
+	return c
+}
+
+// NewSelf writes the logs of the logserver, as JSON lines, to the log file of the config, or to a ring of
+// recent entries, and returns a filesystem that serves them
+func NewSelf(c SelfConfig) (*Self, error) {
+	c = c.WithDefaults()
+	var (
+		s = &Self{Name: c.Name}
+		w io.Writer
+	)
+	if c.LogFile != "" {
+		f, err := os.OpenFile(c.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %s", err)
+		}
+		dir, err := filepath.Abs(filepath.Dir(c.LogFile))
+		if err != nil {
+			return nil, fmt.Errorf("log file directory: %s", err)
+		}
+		if s.FS, err = filesystem.NewLocal(&url.URL{Scheme: "file", Path: dir}); err != nil {
+			return nil, fmt.Errorf("log file directory: %s", err)
+		}
+		s.File = filepath.Base(c.LogFile)
+		w = f
+	} else {
+		ring := filesystem.NewRing(selfRingFile, c.Entries)
+		s.FS, s.File, w = ring, selfRingFile, ring
+	}
+	logrus.AddHook(&selfHook{w: w, formatter: &logrus.JSONFormatter{}})
+	return s, nil
+}
+
+// Parser returns the config of a parser of the JSON logs of the source
+func (s *Self) Parser() parse.Config {
+	return parse.Config{
+		Glob:        s.File,
+		JsonMapping: map[string]string{parse.KeyTime: "time", parse.KeyLevel: "level", parse.KeyMsg: "msg"},
+		TimeFormats: []string{time.RFC3339},
+		AppendArgs:  true,
+	}
+}
+
+// selfHook writes every log entry to a writer
+type selfHook struct {
+	w         io.Writer
+	formatter logrus.Formatter
+}
+
+func (h *selfHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *selfHook) Fire(e *logrus.Entry) error {
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	_, err = h.w.Write(data)
+	return err
+}
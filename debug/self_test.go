@@ -0,0 +1,38 @@
+package debug
+
+import (
+	"bufio"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelf(t *testing.T) {
+	s, err := NewSelf(SelfConfig{Enabled: true, Entries: 10})
+	require.Nil(t, err)
+	assert.Equal(t, "logserver", s.Name)
+
+	logrus.WithField("pkg", "test").Warnf("self %d", 1)
+
+	p, err := parse.New([]parse.Config{s.Parser()})
+	require.Nil(t, err)
+	f, err := s.FS.Open(s.File)
+	require.Nil(t, err)
+	defer f.Close()
+
+	var lines []*parse.Log
+	scanner := bufio.NewScanner(f)
+	mem := new(parse.Memory)
+	for scanner.Scan() {
+		lines = append(lines, p.Parse(s.File, scanner.Bytes(), mem))
+	}
+	require.NotEmpty(t, lines)
+	last := lines[len(lines)-1]
+	assert.Equal(t, "warning", last.Level)
+	assert.Contains(t, last.Msg, "self 1")
+	assert.Contains(t, last.Msg, "pkg=test")
+	assert.NotNil(t, last.Time)
+}
@@ -0,0 +1,65 @@
+package download
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// validator identifies a version of a download, so clients can skip downloading content that did not change
+type validator struct {
+	etag    string
+	modTime time.Time
+}
+
+// newValidator returns the validator of a download of files with the given sizes and modification times.
+// The key distinguishes downloads of different content, like a zip of the files and a deduplicated zip of them.
+func newValidator(key string, sizes []int64, modTimes []time.Time) validator {
+	var v validator
+	h := fnv.New64a()
+	fmt.Fprint(h, key)
+	for i := range sizes {
+		fmt.Fprintf(h, "|%d|%d", sizes[i], modTimes[i].UnixNano())
+		if modTimes[i].After(v.modTime) {
+			v.modTime = modTimes[i]
+		}
+	}
+	v.etag = fmt.Sprintf(`"%x"`, h.Sum64())
+	return v
+}
+
+// notModified sets the validator headers of a response, and responds with 304 Not Modified if the conditional
+// headers of the request match the validator. If-None-Match takes precedence over If-Modified-Since.
+func (v validator) notModified(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("ETag", v.etag)
+	if !v.modTime.IsZero() {
+		w.Header().Set("Last-Modified", v.modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	var match bool
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		match = etagMatch(inm, v.etag)
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !v.modTime.IsZero() {
+		// http times have a resolution of seconds
+		match = !v.modTime.Truncate(time.Second).After(ims)
+	}
+	if match {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return match
+}
+
+// etagMatch returns true if an If-None-Match header matches an etag, with a weak comparison
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditional(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mtime = time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+		node1 = filesystem.NewMemory(nil)
+		node2 = filesystem.NewMemory(nil)
+	)
+	node1.WriteFile("app.log", []byte("node1 lines"), mtime)
+	node2.WriteFile("app.log", []byte("node2 lines"), mtime)
+	h := New("/", source.Sources{{Name: "node1", FS: node1}, {Name: "node2", FS: node2}}, gcache.New(0).Build(), nil, nil)
+
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, url := range []string{"/app.log?fs=node1", "/app.log.zip"} {
+		w := get(url, nil)
+		require.Equal(t, http.StatusOK, w.Code, url)
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag, url)
+		assert.Equal(t, "Mon, 01 Jan 2018 10:00:00 GMT", w.Header().Get("Last-Modified"), url)
+
+		for _, tt := range []struct {
+			header http.Header
+			want   int
+		}{
+			{header: http.Header{"If-None-Match": {etag}}, want: http.StatusNotModified},
+			{header: http.Header{"If-None-Match": {`"other", W/` + etag}}, want: http.StatusNotModified},
+			{header: http.Header{"If-None-Match": {`"other"`}}, want: http.StatusOK},
+			{header: http.Header{"If-Modified-Since": {"Mon, 01 Jan 2018 10:00:00 GMT"}}, want: http.StatusNotModified},
+			{header: http.Header{"If-Modified-Since": {"Mon, 01 Jan 2018 09:00:00 GMT"}}, want: http.StatusOK},
+			// the etag takes precedence
+			{header: http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {"Mon, 01 Jan 2018 10:00:00 GMT"}}, want: http.StatusOK},
+		} {
+			w := get(url, tt.header)
+			assert.Equal(t, tt.want, w.Code, "%s %v", url, tt.header)
+			if tt.want == http.StatusNotModified {
+				assert.Zero(t, w.Body.Len())
+			}
+		}
+
+		// a deduplicated zip is different content
+		if url == "/app.log.zip" {
+			assert.NotEqual(t, etag, get(url+"?dedup=1", nil).Header().Get("ETag"))
+		}
+	}
+
+	// a changed file has a new etag
+	etag := get("/app.log.zip", nil).Header().Get("ETag")
+	node2.AppendFile("app.log", []byte("\nmore lines"))
+	w := get("/app.log.zip", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
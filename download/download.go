@@ -2,41 +2,54 @@ package download
 
 import (
 	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
 	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/temp"
 	"github.com/bluele/gcache"
 )
 
 var log = logrus.WithField("pkg", "router")
 
-func New(root string, sources source.Sources, cache gcache.Cache) http.Handler {
+// New returns a download handler. If authz is not nil, it authorizes the "download" action of each source.
+// The zips of multiple sources are created in the temporary storage. Each download uses the sources that
+// were current when it started.
+func New(root string, sources source.Provider, cache gcache.Cache, authz auth.Authorizer, tmp *temp.Storage) http.Handler {
 	return &handler{
 		sources: sources,
 		cache:   cache,
 		root:    root,
+		authz:   authz,
+		tmp:     tmp,
 	}
 }
 
 type handler struct {
-	sources source.Sources
+	sources source.Provider
 	cache   gcache.Cache
 	root    string
+	authz   auth.Authorizer
+	tmp     *temp.Storage
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// collect all wanted sources
+	all, release := h.sources.Acquire()
+	defer release()
 	sources := querySources(r.URL.Query())
 	var downloadSources []source.Source
-	for _, src := range h.sources {
+	for _, src := range all {
 		if sources[src.Name] {
 			downloadSources = append(downloadSources, src)
 		}
@@ -44,7 +57,22 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// if no specific source was specified, collect all of them
 	if len(downloadSources) == 0 {
-		downloadSources = h.sources
+		downloadSources = all
+	}
+
+	if h.authz != nil && len(downloadSources) > 0 {
+		path := strings.TrimSuffix(r.URL.Path, ".zip")
+		var allowed []source.Source
+		for _, src := range downloadSources {
+			if auth.Authorized(r.Context(), h.authz, "download", src.Name, path) {
+				allowed = append(allowed, src)
+			}
+		}
+		if len(allowed) == 0 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		downloadSources = allowed
 	}
 
 	switch {
@@ -68,12 +96,16 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *handler) downloadOne(w http.ResponseWriter, r *http.Request, src source.Source) {
 	path := r.URL.Path
 	log.Debugf("Download one file: %v, source: %v", path, src.Name)
+	src = src.WithContext(r.Context())
 
-	_, err := src.FS.Lstat(path)
+	stat, err := src.FS.Lstat(path)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
+	if newValidator("", []int64{stat.Size()}, []time.Time{stat.ModTime()}).notModified(w, r) {
+		return
+	}
 
 	f, err := src.FS.Open(path)
 	if err != nil {
@@ -90,39 +122,84 @@ func (h *handler) downloadOne(w http.ResponseWriter, r *http.Request, src source
 func (h *handler) downloadMany(w http.ResponseWriter, r *http.Request, sources []source.Source) {
 	path := strings.TrimSuffix(r.URL.Path, ".zip")
 	log.Debugf("Download multiple files: %v, sources: %v", path, sources)
+	bound := make([]source.Source, len(sources))
+	for i, src := range sources {
+		bound[i] = src.WithContext(r.Context())
+	}
+	sources = bound
+
+	// the files are checked before the zip is created, so an unchanged zip is not created again
+	var (
+		dedup    = r.URL.Query().Get("dedup") != ""
+		stats    = make(map[string]os.FileInfo)
+		sizes    []int64
+		modTimes []time.Time
+	)
+	for _, src := range sources {
+		stat, err := src.FS.Lstat(path)
+		if err != nil {
+			log.Debugf("Failed stat file %v/ %v: %v", src.Name, path, err)
+			continue
+		}
+		stats[src.Name] = stat
+		sizes = append(sizes, stat.Size())
+		modTimes = append(modTimes, stat.ModTime())
+	}
+	if newValidator(fmt.Sprintf("zip|%t", dedup), sizes, modTimes).notModified(w, r) {
+		return
+	}
 
 	// create a zip file
-	f, err := ioutil.TempFile("/tmp", "logserver-dl-")
+	f, err := h.tmp.TempFile("logserver-dl-")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer f.Remove()
 
-	defer f.Close()
-	defer os.Remove(f.Name())
+	var (
+		manifest = NewZipManifest(manifestRequest(r.URL))
+		// stored maps content hash to the name it was stored with in the zip
+		stored = make(map[string]string)
+	)
 
 	// create a zip achiever
 	z := zip.NewWriter(f)
 	for _, src := range sources {
-
+		stat, ok := stats[src.Name]
+		if !ok {
+			continue
+		}
 		fsFile, err := src.FS.Open(path)
 		if err != nil {
 			log.Debugf("Failed opening file %v/ %v: %v", src.Name, path, err)
 			continue
 		}
 
-		zipFileName := fmt.Sprintf("%s-%s", src.Name, filepath.Base(path))
-		zipFile, err := z.Create(zipFileName)
+		entry := ZipEntry{FS: src.Name, Path: path, File: fmt.Sprintf("%s-%s", src.Name, filepath.Base(path)), ModTime: stat.ModTime()}
+		if dedup {
+			err = h.addDedup(z, manifest, stored, entry, fsFile)
+		} else {
+			err = manifest.Add(z, entry, fsFile)
+		}
+		fsFile.Close()
+		if err == temp.ErrQuota {
+			zipError(w, err)
+			return
+		}
 		if err != nil {
-			log.Debugf("Failed creating zip file: %v", err)
-			continue
+			log.Debugf("Failed adding file to zip: %v", err)
 		}
-		io.Copy(zipFile, fsFile)
+	}
+
+	if err := manifest.Write(z); err != nil {
+		zipError(w, err)
+		return
 	}
 
 	err = z.Close()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		zipError(w, err)
 		return
 	}
 
@@ -134,6 +211,63 @@ func (h *handler) downloadMany(w http.ResponseWriter, r *http.Request, sources [
 	io.Copy(w, f)
 }
 
+// zipError responds with the error of creating a zip, a zip that does not fit in the temporary storage
+// is reported as insufficient storage
+func zipError(w http.ResponseWriter, err error) {
+	if err == temp.ErrQuota {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// addDedup adds a file to a zip only if a file with the same content was not added yet.
+// The manifest entry of the file has the name of the zip file that holds the content.
+func (h *handler) addDedup(z *zip.Writer, manifest *ZipManifest, stored map[string]string, e ZipEntry, r io.Reader) error {
+	// stage the file content in a temporary file to calculate its hash before adding it
+	tmp, err := h.tmp.TempFile("logserver-dl-stage-")
+	if err != nil {
+		return err
+	}
+	defer tmp.Remove()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), r); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if storedName, ok := stored[sum]; ok {
+		info, err := tmp.Stat()
+		if err != nil {
+			return err
+		}
+		e.File, e.Size, e.SHA256 = storedName, info.Size(), sum
+		manifest.Files = append(manifest.Files, e)
+		return nil
+	}
+
+	tmp.Seek(0, io.SeekStart)
+	if err := manifest.Add(z, e, tmp); err != nil {
+		return err
+	}
+	stored[sum] = e.File
+	return nil
+}
+
+// manifestRequest returns the download request of a zip manifest. Only the parameters that select the files
+// are kept, so credentials in the URL, like tokens and signatures, are not written in the zip.
+func manifestRequest(u *url.URL) string {
+	q := url.Values{}
+	for _, key := range []string{"fs", "dedup"} {
+		if v, ok := u.Query()[key]; ok {
+			q[key] = v
+		}
+	}
+	req := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return req.String()
+}
+
 func contentType(path string) string {
 	switch filepath.Ext(path) {
 	default:
@@ -0,0 +1,178 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/auth"
+)
+
+const (
+	// burstWindow is the time of traffic that a bandwidth limit allows to send at once
+	burstWindow = time.Second
+	// retryAfter is the time that clients are told to wait when they have too many downloads
+	retryAfter = 5 * time.Second
+)
+
+// Limits of downloads, they protect the interactive traffic from a few large downloads.
+// Clients are identified by their user name, or by their remote address when authentication is disabled.
+// Zero values mean no limit.
+type Limits struct {
+	// MaxConcurrent is the number of downloads of all clients at the same time
+	MaxConcurrent int `json:"max_concurrent"`
+	// ClientMaxConcurrent is the number of downloads of a single client at the same time
+	ClientMaxConcurrent int `json:"client_max_concurrent"`
+	// BytesPerSecond is the bandwidth of all the downloads together
+	BytesPerSecond int64 `json:"bytes_per_second"`
+	// ClientBytesPerSecond is the bandwidth of the downloads of a single client
+	ClientBytesPerSecond int64 `json:"client_bytes_per_second"`
+}
+
+// Limiter enforces the download limits
+type Limiter struct {
+	Limits
+	lock    sync.Mutex
+	running int
+	clients map[string]*client
+	global  *bucket
+}
+
+type client struct {
+	running int
+	bucket  *bucket
+}
+
+// NewLimiter returns a download limiter
+func NewLimiter(l Limits) *Limiter {
+	return &Limiter{Limits: l, clients: make(map[string]*client), global: newBucket(l.BytesPerSecond)}
+}
+
+// Handler wraps a download handler with the limits. Downloads beyond the concurrency limits are rejected
+// with 429 Too Many Requests, and the responses are throttled to the bandwidth limits.
+// It should be wrapped by the authentication handler, so downloads are limited by users.
+func (l *Limiter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := auth.ClientName(r)
+		c, err := l.start(name)
+		if err != nil {
+			log.Warnf("Download of %s rejected: %s", name, err)
+			w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer l.finish(name)
+		if l.global == nil && c.bucket == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(&throttledWriter{ResponseWriter: w, ctx: r.Context(), buckets: []*bucket{l.global, c.bucket}}, r)
+	})
+}
+
+func (l *Limiter) start(name string) (*client, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	c := l.clients[name]
+	if c == nil {
+		c = &client{bucket: newBucket(l.ClientBytesPerSecond)}
+		l.clients[name] = c
+	}
+	switch {
+	case l.MaxConcurrent > 0 && l.running >= l.MaxConcurrent:
+		return nil, fmt.Errorf("too many concurrent downloads")
+	case l.ClientMaxConcurrent > 0 && c.running >= l.ClientMaxConcurrent:
+		return nil, fmt.Errorf("too many concurrent downloads of %s", name)
+	}
+	l.running++
+	c.running++
+	return c, nil
+}
+
+func (l *Limiter) finish(name string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.running--
+	c := l.clients[name]
+	c.running--
+	// the client is forgotten only after it paid for the bandwidth it used
+	if c.running == 0 && c.bucket.idle() {
+		delete(l.clients, name)
+	}
+}
+
+// bucket limits a bandwidth. It tracks the time at which the bytes that were sent so far are paid for,
+// and delays writes that are ahead of it by more than the burst window.
+type bucket struct {
+	rate int64
+	lock sync.Mutex
+	paid time.Time
+}
+
+// newBucket returns a bucket of a bandwidth in bytes per second, or nil for an unlimited bandwidth
+func newBucket(rate int64) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucket{rate: rate}
+}
+
+// wait waits until n bytes can be sent. It is safe to call on a nil bucket, which does not wait.
+func (b *bucket) wait(ctx context.Context, n int) error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	now := time.Now()
+	if b.paid.Before(now) {
+		b.paid = now
+	}
+	b.paid = b.paid.Add(time.Duration(int64(n) * int64(time.Second) / b.rate))
+	delay := b.paid.Sub(now) - burstWindow
+	b.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// idle returns true if the bucket has no debt, it is true for a nil bucket
+func (b *bucket) idle() bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return !b.paid.After(time.Now())
+}
+
+// throttledWriter delays the writes of a response according to bandwidth buckets
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	buckets []*bucket
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	for _, bkt := range w.buckets {
+		if err := bkt.wait(w.ctx, len(b)); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
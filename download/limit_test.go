@@ -0,0 +1,76 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var (
+		l       = NewLimiter(Limits{MaxConcurrent: 2, ClientMaxConcurrent: 1})
+		started = make(chan struct{})
+		release = make(chan struct{})
+		h       = l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+		}))
+	)
+	download := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/file", nil)
+		r.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	done := make(chan int)
+	for _, remote := range []string{"1.1.1.1:1000", "2.2.2.2:1000"} {
+		go func(remote string) { done <- download(remote).Code }(remote)
+		<-started
+	}
+
+	// a second download of a client, and a download of a third client, are rejected
+	rec := download("1.1.1.1:2000")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, download("3.3.3.3:1000").Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	go func() { <-started }()
+	assert.Equal(t, http.StatusOK, download("3.3.3.3:1000").Code)
+	assert.Empty(t, l.clients)
+}
+
+func TestBucket(t *testing.T) {
+	t.Parallel()
+
+	var (
+		b   = newBucket(1000)
+		ctx = context.Background()
+	)
+	assert.Nil(t, (*bucket)(nil).wait(ctx, 1000))
+	assert.True(t, (*bucket)(nil).idle())
+
+	// a second of traffic is sent at once, the rest is delayed
+	start := time.Now()
+	require.Nil(t, b.wait(ctx, 1000))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.False(t, b.idle())
+	require.Nil(t, b.wait(ctx, 200))
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, b.wait(cancelled, 1000))
+}
@@ -0,0 +1,69 @@
+package download
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Stratoscale/logserver/version"
+)
+
+// ManifestName is the name of the manifest file in generated zips
+const ManifestName = "manifest.json"
+
+// ZipManifest describes the files of a generated zip, so consumers can verify its integrity and provenance
+type ZipManifest struct {
+	// Logserver is the build information of the server that generated the zip
+	Logserver version.Info `json:"logserver"`
+	Created   time.Time    `json:"created"`
+	// Request is the request that selected the files, the download URL or the bundle manifest
+	Request string     `json:"request"`
+	Files   []ZipEntry `json:"files"`
+}
+
+// ZipEntry describes a source file in a zip
+type ZipEntry struct {
+	FS   string `json:"fs"`
+	Path string `json:"path"`
+	// File is the name of the file in the zip, files with identical content share it in deduplicated zips
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// NewZipManifest returns an empty manifest of a zip that is generated for a request
+func NewZipManifest(request string) *ZipManifest {
+	return &ZipManifest{Logserver: version.Get(), Created: time.Now(), Request: request, Files: []ZipEntry{}}
+}
+
+// Add adds the content of a source file to a zip, and adds its entry, with the given source, path and
+// modification time, to the manifest
+func (m *ZipManifest) Add(z *zip.Writer, e ZipEntry, r io.Reader) error {
+	w, err := z.Create(e.File)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	e.Size, err = io.Copy(io.MultiWriter(w, hash), r)
+	if err != nil {
+		return err
+	}
+	e.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	m.Files = append(m.Files, e)
+	return nil
+}
+
+// Write adds the manifest file to a zip, it should be called after all the files were added
+func (m *ZipManifest) Write(z *zip.Writer) error {
+	w, err := z.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
@@ -0,0 +1,65 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipManifest(t *testing.T) {
+	t.Parallel()
+
+	sources := source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{"app.log": "same"})},
+		{Name: "node2", FS: filesystem.NewMemory(map[string]string{"app.log": "same"})},
+		{Name: "node3", FS: filesystem.NewMemory(map[string]string{"app.log": "different"})},
+	}
+	h := New("/", sources, gcache.New(0).Build(), nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app.log.zip?dedup=1&token=secret", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.Nil(t, err)
+	var (
+		names    []string
+		manifest ZipManifest
+	)
+	for _, f := range z.File {
+		names = append(names, f.Name)
+		if f.Name == ManifestName {
+			r, err := f.Open()
+			require.Nil(t, err)
+			require.Nil(t, json.NewDecoder(r).Decode(&manifest))
+			r.Close()
+		}
+	}
+	assert.Equal(t, []string{"node1-app.log", "node3-app.log", ManifestName}, names)
+
+	// credentials are not written in the manifest
+	assert.Equal(t, "/app.log.zip?dedup=1", manifest.Request)
+	require.Len(t, manifest.Files, 3)
+	for i, want := range []ZipEntry{
+		{FS: "node1", File: "node1-app.log", Size: 4, SHA256: "0967115f2813a3541eaef77de9d9d5773f1c0c04314b0bbfe4ff3b3b1c55b5d5"},
+		{FS: "node2", File: "node1-app.log", Size: 4, SHA256: "0967115f2813a3541eaef77de9d9d5773f1c0c04314b0bbfe4ff3b3b1c55b5d5"},
+		{FS: "node3", File: "node3-app.log", Size: 9, SHA256: "9d6f965ac832e40a5df6c06afe983e3b449c07b843ff51ce76204de05c690d11"},
+	} {
+		got := manifest.Files[i]
+		assert.Equal(t, want.FS, got.FS)
+		assert.Equal(t, "/app.log", got.Path)
+		assert.Equal(t, want.File, got.File)
+		assert.Equal(t, want.Size, got.Size)
+		assert.Equal(t, want.SHA256, got.SHA256)
+		assert.False(t, got.ModTime.IsZero())
+	}
+}
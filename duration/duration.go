@@ -0,0 +1,75 @@
+// Package duration decodes configurations whose durations are given as strings, like "2s" or "5m"
+package duration
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Decode decodes a json object into a pointer to a struct. The values of its time.Duration fields, and of the
+// time.Duration fields of its embedded structs, can be strings that time.ParseDuration parses, they are replaced
+// with their nanoseconds before decoding. Durations can still be given in nanoseconds.
+//
+// It is meant for UnmarshalJSON methods of configurations, which decode a type without the method:
+//
+//	func (c *Config) UnmarshalJSON(b []byte) error {
+//		type plain Config
+//		return duration.Decode(b, (*plain)(c))
+//	}
+//
+// The method should not be defined on embedded structs, since it would be promoted to the embedding struct.
+func Decode(b []byte, v interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil || fields == nil {
+		// not an object, let the json package report the error
+		return json.Unmarshal(b, v)
+	}
+	if err := replace(fields, reflect.TypeOf(v).Elem()); err != nil {
+		return err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// replace replaces the string durations of the fields of a struct type in a json object with their nanoseconds
+func replace(fields map[string]json.RawMessage, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := replace(fields, f.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.Type != durationType {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		raw, ok := fields[name]
+		if !ok || len(raw) == 0 || raw[0] != '"' {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		fields[name] = json.RawMessage(strconv.FormatInt(int64(d), 10))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package duration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type limits struct {
+	Timeout time.Duration `json:"timeout"`
+}
+
+type config struct {
+	Name     string        `json:"name"`
+	Interval time.Duration `json:"interval,omitempty"`
+	limits
+}
+
+func (c *config) UnmarshalJSON(b []byte) error {
+	type plain config
+	return Decode(b, (*plain)(c))
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	var c config
+	require.Nil(t, json.Unmarshal([]byte(`{"name": "a", "interval": "1m30s", "timeout": "2s"}`), &c))
+	assert.Equal(t, config{Name: "a", Interval: 90 * time.Second, limits: limits{Timeout: 2 * time.Second}}, c)
+
+	// durations in nanoseconds
+	require.Nil(t, json.Unmarshal([]byte(`{"interval": 1000}`), &c))
+	assert.Equal(t, time.Microsecond, c.Interval)
+
+	// configurations in lists
+	var cs []config
+	require.Nil(t, json.Unmarshal([]byte(`[{"timeout": "5m"}]`), &cs))
+	require.Len(t, cs, 1)
+	assert.Equal(t, 5*time.Minute, cs[0].Timeout)
+
+	err := json.Unmarshal([]byte(`{"timeout": "2 minutes"}`), &c)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+	assert.NotNil(t, json.Unmarshal([]byte(`{"interval": true}`), &c))
+	assert.NotNil(t, json.Unmarshal([]byte(`[]`), &c))
+}
@@ -1,44 +1,111 @@
 package dynamic
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
 	"github.com/Stratoscale/logserver/download"
+	"github.com/Stratoscale/logserver/duration"
 	"github.com/Stratoscale/logserver/engine"
 	"github.com/Stratoscale/logserver/parse"
 	"github.com/Stratoscale/logserver/route"
 	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/store"
 	"github.com/bluele/gcache"
 	"github.com/gorilla/mux"
 )
 
+var log = logrus.WithField("pkg", "dynamic")
+
 const defaultMarkFile = "logstack.enable"
 
 // Config is dynamic configuration
 type Config struct {
 	Root     string `json:"root"`
 	MarkFile string `json:"mark_file"`
+	// Prefix is the URL path under which the bundles are served. It is required for serving the bundles
+	// together with the configured sources, when the server is not run in dynamic mode.
+	Prefix string `json:"prefix"`
 	source.Flags
+	// Downloads limits the downloads of the bundles, if not set, they are not limited
+	Downloads *download.Limiter `json:"-"`
+}
+
+// UnmarshalJSON decodes the dynamic configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
+	if c.MarkFile == "" {
+		c.MarkFile = defaultMarkFile
+	}
+	return c
+}
+
+// URLPrefix returns the clean URL path under which the bundles are served, or an empty string if they are
+// served on the root path
+func (c Config) URLPrefix() string {
+	if p := strings.Trim(c.Prefix, "/"); p != "" {
+		return "/" + p
+	}
+	return ""
+}
+
+// ExpandEnv expands the ${VAR} placeholders of environment variables in the paths of the configuration
+func (c *Config) ExpandEnv() error {
+	for name, field := range map[string]*string{
+		"root":         &c.Root,
+		"mark_file":    &c.MarkFile,
+		"prefix":       &c.Prefix,
+		"open_journal": &c.OpenJournal,
+	} {
+		var err error
+		if *field, err = source.ExpandEnv(*field); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
 }
 
-func New(c Config, engineCfg engine.Config, p parse.Parse, cache gcache.Cache) (http.Handler, error) {
+func New(c Config, engineCfg engine.Config, p parse.Parse, cache gcache.Cache, a *auth.Auth, st store.Store) (http.Handler, error) {
+	c = c.WithDefaults()
 	var err error
 	c.Root, err = filepath.Abs(c.Root)
 	if err != nil {
 		return nil, err
 	}
+	if c.Prefix != "" && c.URLPrefix() == "" {
+		return nil, fmt.Errorf("prefix must not be the root path")
+	}
+	c.Prefix = c.URLPrefix()
 	h := &handler{
 		Config:    c,
 		parse:     p,
 		cache:     cache,
 		engineCfg: engineCfg,
+		auth:      a,
 	}
-	if h.MarkFile == "" {
-		h.MarkFile = defaultMarkFile
+	// engines are created per request in dynamic mode, prefetching the tree on each of them is useless
+	h.engineCfg.Prefetch = false
+	// the engines serve the sources of a bundle, not the configured sources, uploads and snapshots of the server
+	// that the bundles may be served together with
+	h.engineCfg.Sources, h.engineCfg.Context = nil, nil
+	h.engineCfg.Uploads, h.engineCfg.Snapshots = nil, nil
+	h.manifests = &manifests{
+		store:     st,
+		engineCfg: h.engineCfg,
+		parse:     p,
+		cache:     cache,
+		building:  make(map[string]bool),
 	}
 	return h, nil
 }
@@ -49,16 +116,31 @@ type handler struct {
 	cache     gcache.Cache
 	route     route.Config
 	engineCfg engine.Config
+	auth      *auth.Auth
+	manifests *manifests
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Prefix == "" {
+		h.serve(w, r)
+		return
+	}
+	if r.URL.Path != h.Prefix && !strings.HasPrefix(r.URL.Path, h.Prefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	http.StripPrefix(h.Prefix, http.HandlerFunc(h.serve)).ServeHTTP(w, r)
+}
+
+// serve serves a bundle according to a URL path that is relative to the prefix
+func (h *handler) serve(w http.ResponseWriter, r *http.Request) {
 	root, err := h.searchRoot(r.URL.Path)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 	if root == "" {
-		http.FileServer(http.Dir(h.Root)).ServeHTTP(w, r)
+		h.auth.Require(auth.RoleDownloader, http.FileServer(http.Dir(h.Root))).ServeHTTP(w, r)
 		return
 	}
 
@@ -88,9 +170,18 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	serverPath := root[len(h.Root):]
 	rtr := mux.NewRouter()
 
+	// the manifest of a bundle is built when it is first mounted
+	h.manifests.get(serverPath, srcConfig)
+	engineCfg := h.engineCfg
+	engineCfg.Manifest = func() *engine.Manifest { return h.manifests.get(serverPath, srcConfig) }
+
 	// add websocket handler on the server root
-	route.Engine(rtr, "/", engine.New(h.engineCfg, src, h.parse, h.cache))
-	route.Download(rtr, "/", download.New(filepath.Join(serverPath, "_dl"), src, h.cache))
+	route.Engine(rtr, "/", engine.New(engineCfg, src, h.parse, h.cache))
+	var dl http.Handler = download.New(filepath.Join(h.Prefix, serverPath, "_dl"), src, h.cache, nil, h.Temp)
+	if h.Downloads != nil {
+		dl = h.Downloads.Handler(dl)
+	}
+	route.Download(rtr, "/", h.auth.Require(auth.RoleDownloader, dl))
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -100,7 +191,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Handle with index on anything that has prefix of server path that did not match anything else
 	err = route.Index(rtr, "/", route.Config{
 		// BasePath is used to determined the websocket path
-		BasePath: serverPath,
+		BasePath: h.Prefix + serverPath,
 		// RootPath is for taking the static files, which are served by the root handler
 		RootPath: ""})
 	if err != nil {
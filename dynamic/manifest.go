@@ -0,0 +1,85 @@
+package dynamic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/engine"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/store"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// manifestBucket is the store bucket of the bundle manifests, by the bundle paths
+	manifestBucket = "manifests"
+	// manifestTimeout is the maximal duration of building a manifest
+	manifestTimeout = 10 * time.Minute
+)
+
+// manifests builds a manifest for each bundle when it is first mounted, and persists it in the store
+type manifests struct {
+	store     store.Store
+	engineCfg engine.Config
+	parse     parse.Parse
+	cache     gcache.Cache
+	// building are the bundles whose manifests are being built
+	building map[string]bool
+	lock     sync.Mutex
+}
+
+// get returns the manifest of a bundle, or nil if it is not built yet.
+// If the manifest was not built, it starts building it.
+func (m *manifests) get(bundle string, srcConfig []source.Config) *engine.Manifest {
+	var manifest engine.Manifest
+	err := m.store.Get(manifestBucket, bundle, &manifest)
+	if err == nil {
+		return &manifest
+	}
+	if err != store.ErrNotFound {
+		log.WithError(err).Errorf("Failed loading manifest of %s", bundle)
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.building[bundle] {
+		return nil
+	}
+	m.building[bundle] = true
+	go m.build(bundle, srcConfig)
+	return nil
+}
+
+func (m *manifests) build(bundle string, srcConfig []source.Config) {
+	defer func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		delete(m.building, bundle)
+	}()
+
+	// the sources of the request that mounted the bundle are closed when the request ends,
+	// so the manifest is built with its own sources
+	src, err := source.New(srcConfig, m.cache)
+	if err != nil {
+		log.WithError(err).Errorf("Failed opening sources of %s for a manifest", bundle)
+		return
+	}
+	defer src.CloseSources()
+
+	ctx, cancel := context.WithTimeout(context.Background(), manifestTimeout)
+	defer cancel()
+	start := time.Now()
+	manifest := engine.BuildManifest(ctx, m.engineCfg, src, m.parse, m.cache)
+	if ctx.Err() != nil {
+		log.Warnf("Building manifest of %s timed out after %s", bundle, manifestTimeout)
+		return
+	}
+	if err := m.store.Put(manifestBucket, bundle, manifest); err != nil {
+		log.WithError(err).Errorf("Failed storing manifest of %s", bundle)
+		return
+	}
+	log.Infof("Built manifest of %s with %d files in %s", bundle, len(manifest.Files), time.Since(start))
+}
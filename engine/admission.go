@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueTimeout = 10 * time.Second
+	defaultRetryAfter   = 5 * time.Second
+)
+
+// heavyActions are the actions that scan file contents, they are subject to admission control
+var heavyActions = map[string]bool{
+	"search":    true,
+	"aggregate": true,
+	"trace":     true,
+}
+
+// admissionMetrics are the metrics of the admission controller, published in /debug/vars
+var admissionMetrics = expvar.NewMap("admission")
+
+// AdmissionConfig limits the heavy requests, like searches, that are served at the same time
+type AdmissionConfig struct {
+	// MaxConcurrent is the number of heavy requests that are served at the same time, zero disables admission control
+	MaxConcurrent int `json:"max_concurrent"`
+	// MaxQueued is the number of heavy requests that wait for a slot, requests beyond it are rejected immediately
+	MaxQueued int `json:"max_queued"`
+	// QueueTimeout is the maximal time a request waits for a slot before it is rejected
+	QueueTimeout time.Duration `json:"queue_timeout"`
+	// RetryAfter is the time that rejected clients are told to wait before retrying
+	RetryAfter time.Duration `json:"retry_after"`
+}
+
+// Admission queues or rejects heavy requests when the server is saturated, instead of letting all of them
+// compete on the sources. It is shared by the handlers that serve heavy requests.
+type Admission struct {
+	AdmissionConfig
+	slots  chan struct{}
+	lock   sync.Mutex
+	queued int
+}
+
+// errBusy is returned when a request is not admitted
+type errBusy struct {
+	retryAfter time.Duration
+}
+
+func (e errBusy) Error() string {
+	return fmt.Sprintf("server is busy, retry after %s", e.retryAfter)
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c AdmissionConfig) WithDefaults() AdmissionConfig {
+	if c.QueueTimeout == 0 {
+		c.QueueTimeout = defaultQueueTimeout
+	}
+	if c.RetryAfter == 0 {
+		c.RetryAfter = defaultRetryAfter
+	}
+	return c
+}
+
+// NewAdmission returns an admission controller, or nil if admission control is disabled
+func NewAdmission(c AdmissionConfig) *Admission {
+	if c.MaxConcurrent <= 0 {
+		return nil
+	}
+	c = c.WithDefaults()
+	admissionMetrics.Set("max_concurrent", expvarInt(int64(c.MaxConcurrent)))
+	return &Admission{AdmissionConfig: c, slots: make(chan struct{}, c.MaxConcurrent)}
+}
+
+// Admit waits for a slot of a heavy request. It returns a function that releases the slot, or an errBusy
+// error if the queue is full or the request waited too long. A nil admission admits all requests.
+func (a *Admission) Admit(ctx context.Context) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return a.admitted(), nil
+	default:
+	}
+
+	a.lock.Lock()
+	if a.queued >= a.MaxQueued {
+		a.lock.Unlock()
+		admissionMetrics.Add("rejected", 1)
+		return nil, errBusy{retryAfter: a.RetryAfter}
+	}
+	a.queued++
+	a.lock.Unlock()
+	admissionMetrics.Add("queued", 1)
+	defer func() {
+		a.lock.Lock()
+		a.queued--
+		a.lock.Unlock()
+		admissionMetrics.Add("queued", -1)
+	}()
+
+	timer := time.NewTimer(a.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		return a.admitted(), nil
+	case <-timer.C:
+		admissionMetrics.Add("rejected", 1)
+		return nil, errBusy{retryAfter: a.RetryAfter}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *Admission) admitted() func() {
+	admissionMetrics.Add("running", 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			admissionMetrics.Add("running", -1)
+			<-a.slots
+		})
+	}
+}
+
+func expvarInt(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmission(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, NewAdmission(AdmissionConfig{}))
+	release, err := (*Admission)(nil).Admit(context.Background())
+	require.Nil(t, err)
+	release()
+
+	a := NewAdmission(AdmissionConfig{MaxConcurrent: 1, MaxQueued: 1, QueueTimeout: time.Minute})
+	ctx := context.Background()
+
+	release, err = a.Admit(ctx)
+	require.Nil(t, err)
+
+	// the second request waits in the queue until the first one is released
+	admitted := make(chan func())
+	go func() {
+		release, err := a.Admit(ctx)
+		assert.Nil(t, err)
+		admitted <- release
+	}()
+	for {
+		a.lock.Lock()
+		queued := a.queued
+		a.lock.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	_, err = a.Admit(ctx)
+	assert.Equal(t, errBusy{retryAfter: defaultRetryAfter}, err)
+
+	release()
+	release()
+	release = <-admitted
+
+	// a queued request is rejected after the queue timeout, and stops waiting when it is cancelled
+	a.QueueTimeout = time.Millisecond
+	_, err = a.Admit(ctx)
+	assert.Equal(t, errBusy{retryAfter: defaultRetryAfter}, err)
+	a.QueueTimeout = time.Minute
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = a.Admit(cancelled)
+	assert.Equal(t, context.Canceled, err)
+
+	release()
+	release, err = a.Admit(ctx)
+	require.Nil(t, err)
+	release()
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Stratoscale/logserver/parse"
+)
+
+var defaultPercentiles = []float64{50, 90, 99}
+
+// Aggregation is summary statistics of a numeric field across the matches of a search
+type Aggregation struct {
+	Field string `json:"field"`
+	// Count is the number of matched lines with a numeric value in the field
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Sum   float64 `json:"sum"`
+	// Percentiles maps a percentile, for example "p90", to its value
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// aggregate runs a search and responds with statistics of a numeric field of the matched lines,
+// instead of the lines themselves. The field is a named capture group of the search regexp,
+// or a numeric field of the parsed log.
+func (h *handler) aggregate(ctx context.Context, req Request, send chan<- *Response) {
+	if req.Field == "" {
+		send <- &Response{Meta: req.Meta, Error: "Aggregation field was not specified"}
+		return
+	}
+
+	var (
+		values []float64
+		ch     = make(chan *Response)
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range ch {
+			for i := range resp.Lines {
+				if v, ok := fieldValue(&resp.Lines[i], req.Field); ok {
+					values = append(values, v)
+				}
+			}
+			// errors and partial results are passed to the client, lines are not
+			if resp.Error != "" || resp.Partial || len(resp.SourceErrors) > 0 {
+				resp.Lines = nil
+				send <- resp
+			}
+		}
+	}()
+	h.search(ctx, req, ch)
+	close(ch)
+	<-done
+
+	if ctx.Err() != nil {
+		return
+	}
+	percentiles := req.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = defaultPercentiles
+	}
+	send <- &Response{Meta: req.Meta, Aggregation: newAggregation(req.Field, values, percentiles)}
+}
+
+// fieldValue returns the numeric value of a field in a log line
+func fieldValue(line *parse.Log, field string) (float64, bool) {
+	if s, ok := line.Fields[field]; ok {
+		v, err := strconv.ParseFloat(s, 64)
+		return v, err == nil
+	}
+	switch field {
+	case parse.KeyLineNo:
+		return float64(line.LineNo), true
+	}
+	return 0, false
+}
+
+func newAggregation(field string, values []float64, percentiles []float64) *Aggregation {
+	a := &Aggregation{Field: field, Count: len(values)}
+	if len(values) == 0 {
+		return a
+	}
+	sort.Float64s(values)
+	a.Min, a.Max = values[0], values[len(values)-1]
+	for _, v := range values {
+		a.Sum += v
+	}
+	a.Avg = a.Sum / float64(len(values))
+	a.Percentiles = make(map[string]float64, len(percentiles))
+	for _, p := range percentiles {
+		// nearest rank percentile
+		rank := int(math.Ceil(p / 100 * float64(len(values))))
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(values) {
+			rank = len(values)
+		}
+		a.Percentiles[fmt.Sprintf("p%g", p)] = values[rank-1]
+	}
+	return a
+}
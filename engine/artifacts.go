@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"time"
+)
+
+// Artifact is a saved result of an investigation that matched a search
+type Artifact struct {
+	// Kind is the kind of the artifact, currently only "snapshot"
+	Kind string `json:"kind"`
+	// ID is empty for artifacts that the user may not share
+	ID      string    `json:"id,omitempty"`
+	Title   string    `json:"title"`
+	Creator string    `json:"creator,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// searchArtifacts sends the saved artifacts whose titles match the search regexp, in a single response
+// before the matching lines. Up to search_max_size artifacts are sent, the newest first.
+func (h *handler) searchArtifacts(ctx context.Context, req Request, re *regexp.Regexp, send chan<- *Response) {
+	if h.Snapshots == nil {
+		return
+	}
+	snapshots, err := h.Snapshots.Search(ctx, re.MatchString, h.SearchMaxSize)
+	if err != nil {
+		log.WithError(err).Error("Failed searching snapshots")
+		return
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+	artifacts := make([]Artifact, 0, len(snapshots))
+	for _, s := range snapshots {
+		artifacts = append(artifacts, Artifact{Kind: "snapshot", ID: s.ID, Title: s.Title, Creator: s.Creator, Created: s.Created})
+	}
+	send <- &Response{Meta: req.Meta, Artifacts: artifacts}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/source"
+)
+
+// authorize filters the sources of a request to the sources in which the user of the context is authorized to
+// perform the request action on the request path, or on all the base paths of a search. It fails if the user is not authorized in any of them.
+// The targets of get-window and create-permalink requests, and the file of a resolve-permalink request, are
+// authorized when they are read, and the mirrored requests of a watch request are authorized when they are sent.
+// A dictionary of a get-dictionary request is authorized with the file that it was made from.
+func (h *handler) authorize(ctx context.Context, req *Request) error {
+	switch req.Action {
+	case "get-window", "create-permalink", "resolve-permalink", "watch", "get-dictionary":
+		return nil
+	}
+	if h.Authorizer == nil {
+		return nil
+	}
+	var (
+		sources = filterSources(h.sources(*req), req.filterSourceMap)
+		allowed = make(map[string]bool, len(sources))
+	)
+	for _, src := range sources {
+		if h.authorizedPaths(ctx, *req, src) {
+			allowed[src.Name] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return errForbidden{action: req.Action}
+	}
+	req.filterSourceMap = allowed
+	return nil
+}
+
+// authorizedPaths returns true if the user of the context is authorized to perform the request action on all
+// the paths that the request reads in a source
+func (h *handler) authorizedPaths(ctx context.Context, req Request, src source.Source) bool {
+	for _, path := range req.searchPaths() {
+		if !auth.Authorized(ctx, h.Authorizer, req.Action, src.Name, src.FS.Join(path...)) {
+			return false
+		}
+	}
+	return true
+}
+
+// errForbidden is the error of a request that the user is not authorized to perform in any source
+type errForbidden struct {
+	action string
+}
+
+func (e errForbidden) Error() string {
+	return fmt.Sprintf("forbidden: %s", e.action)
+}
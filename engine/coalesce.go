@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+type serveFunc func(context.Context, Request, chan<- *Response)
+
+// maxFlightJoinResponses is the number of responses of a flight after which it can't be joined. The responses
+// are kept for clients that join, so new requests don't join a flight that already buffered many responses.
+const maxFlightJoinResponses = 1000
+
+// flight is a request that is being served. Its responses are shared among all the
+// clients that sent an identical request while it was served.
+type flight struct {
+	sync.Mutex
+	responses []*Response
+	done      bool
+	// update is closed and replaced whenever the flight changes
+	update chan struct{}
+	// refs count the clients waiting for the flight responses, protected by the flights lock
+	refs   int
+	cancel context.CancelFunc
+}
+
+// flights hold all the requests that are currently served
+type flights struct {
+	sync.Mutex
+	m map[string]*flight
+}
+
+// coalesce serves a request with a serve function. Identical requests that are
+// served concurrently share a single call to the serve function, and all the
+// clients get all the responses, including those that were sent before they joined.
+func (h *handler) coalesce(ctx context.Context, req Request, send chan<- *Response, serve serveFunc) {
+	key, ok := coalesceKey(req)
+	if !ok {
+		serve(ctx, req, send)
+		return
+	}
+	f := h.flights.join(key, req, serve)
+	defer h.flights.leave(key, f)
+
+	for i := 0; ; i++ {
+		resp, ok := f.wait(ctx, i)
+		if !ok {
+			return
+		}
+		r := *resp
+		r.ID = req.ID
+		send <- &r
+	}
+}
+
+// coalesceKey returns a key that is equal for identical requests. It returns false if the request should not
+// be coalesced. The key includes the sources that the request is served from, which are narrowed to the
+// sources that the user is authorized in, so users with different permissions don't share flights.
+func coalesceKey(req Request) (string, bool) {
+	req.ID = 0
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	if req.filterSourceMap == nil {
+		return string(b), true
+	}
+	sources := make([]string, 0, len(req.filterSourceMap))
+	for name, ok := range req.filterSourceMap {
+		if ok {
+			sources = append(sources, name)
+		}
+	}
+	sort.Strings(sources)
+	s, err := json.Marshal(sources)
+	if err != nil {
+		return "", false
+	}
+	return string(b) + string(s), true
+}
+
+func (fs *flights) join(key string, req Request, serve serveFunc) *flight {
+	fs.Lock()
+	defer fs.Unlock()
+	if f, ok := fs.m[key]; ok {
+		log.Debugf("Joining running request %d", req.ID)
+		f.refs++
+		return f
+	}
+
+	// the serving context is not bound to a specific client, it is cancelled
+	// when all the clients left the flight
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &flight{update: make(chan struct{}), refs: 1, cancel: cancel}
+	fs.m[key] = f
+
+	ch := make(chan *Response)
+	go func() {
+		serve(ctx, req, ch)
+		close(ch)
+	}()
+	go func() {
+		for resp := range ch {
+			if f.add(resp) == maxFlightJoinResponses {
+				fs.remove(key, f)
+			}
+		}
+		fs.remove(key, f)
+		f.finish()
+		cancel()
+	}()
+	return f
+}
+
+// leave is called by a client that does not wait for responses any more
+func (fs *flights) leave(key string, f *flight) {
+	fs.Lock()
+	defer fs.Unlock()
+	f.refs--
+	if f.refs == 0 {
+		f.cancel()
+		if fs.m[key] == f {
+			delete(fs.m, key)
+		}
+	}
+}
+
+func (fs *flights) remove(key string, f *flight) {
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.m[key] == f {
+		delete(fs.m, key)
+	}
+}
+
+// add adds a response to the flight, and returns the number of its responses
+func (f *flight) add(resp *Response) int {
+	f.Lock()
+	defer f.Unlock()
+	f.responses = append(f.responses, resp)
+	close(f.update)
+	f.update = make(chan struct{})
+	return len(f.responses)
+}
+
+func (f *flight) finish() {
+	f.Lock()
+	defer f.Unlock()
+	f.done = true
+	close(f.update)
+}
+
+// wait returns the i'th response of the flight, it blocks until such a response is available.
+// It returns false if the flight is done or the context was cancelled.
+func (f *flight) wait(ctx context.Context, i int) (*Response, bool) {
+	for {
+		f.Lock()
+		if i < len(f.responses) {
+			resp := f.responses[i]
+			f.Unlock()
+			return resp, true
+		}
+		if f.done {
+			f.Unlock()
+			return nil, false
+		}
+		update := f.update
+		f.Unlock()
+
+		select {
+		case <-update:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
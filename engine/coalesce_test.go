@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// coalesceRequest serves a request with coalescing and returns its responses
+func coalesceRequest(ctx context.Context, h *handler, req Request, serve serveFunc) []*Response {
+	var (
+		send  = make(chan *Response)
+		resps []*Response
+		done  = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range send {
+			resps = append(resps, resp)
+		}
+	}()
+	h.coalesce(ctx, req, send, serve)
+	close(send)
+	<-done
+	return resps
+}
+
+// eventually waits until a condition is true, and fails the test if it is false for a second
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("condition was not met")
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+
+	var (
+		calls   int32
+		release = make(chan struct{})
+	)
+	serve := func(ctx context.Context, req Request, send chan<- *Response) {
+		atomic.AddInt32(&calls, 1)
+		send <- &Response{Meta: req.Meta, Lines: []parse.Log{{Msg: "first"}}}
+		<-release
+		send <- &Response{Meta: req.Meta, Lines: []parse.Log{{Msg: "second"}}}
+	}
+
+	// the second request joins the flight of the first, and gets the response that was sent before it joined
+	var (
+		wg    sync.WaitGroup
+		resps = make([][]*Response, 2)
+	)
+	wg.Add(2)
+	for i := range resps {
+		go func(i int) {
+			defer wg.Done()
+			resps[i] = coalesceRequest(context.Background(), h, Request{Meta: Meta{ID: i + 1, Action: "search"}, Regexp: "x"}, serve)
+		}(i)
+		// wait until the first request started its flight
+		eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 })
+	}
+	eventually(t, func() bool {
+		h.flights.Lock()
+		defer h.flights.Unlock()
+		for _, f := range h.flights.m {
+			return f.refs == 2
+		}
+		return false
+	})
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for i, r := range resps {
+		require.Len(t, r, 2)
+		for _, resp := range r {
+			// the responses have the id of the request of each client
+			assert.Equal(t, i+1, resp.ID)
+		}
+		assert.Equal(t, "first", r[0].Lines[0].Msg)
+		assert.Equal(t, "second", r[1].Lines[0].Msg)
+	}
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+
+	var (
+		started   = make(chan struct{})
+		cancelled = make(chan struct{})
+	)
+	serve := func(ctx context.Context, req Request, send chan<- *Response) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		coalesceRequest(ctx, h, Request{Meta: Meta{ID: 1, Action: "search"}}, serve)
+	}()
+	<-started
+	// the flight is cancelled when its last client left
+	cancel()
+	<-done
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("flight was not cancelled")
+	}
+	h.flights.Lock()
+	assert.Empty(t, h.flights.m)
+	h.flights.Unlock()
+}
+
+func TestCoalesceNotJoined(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+
+	var calls int32
+	serve := func(ctx context.Context, req Request, send chan<- *Response) {
+		atomic.AddInt32(&calls, 1)
+		send <- &Response{Meta: req.Meta}
+	}
+
+	// requests that can't be encoded as a key are served without coalescing
+	_, ok := coalesceKey(Request{Speed: math.NaN()})
+	assert.False(t, ok)
+	resps := coalesceRequest(context.Background(), h, Request{Meta: Meta{ID: 1, Action: "replay"}, Speed: math.NaN()}, serve)
+	assert.Len(t, resps, 1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// a flight that buffered too many responses can't be joined
+	release := make(chan struct{})
+	big := func(ctx context.Context, req Request, send chan<- *Response) {
+		atomic.AddInt32(&calls, 1)
+		for i := 0; i < maxFlightJoinResponses; i++ {
+			send <- &Response{Meta: req.Meta}
+		}
+		<-release
+	}
+	req := Request{Meta: Meta{ID: 1, Action: "search"}, Regexp: "big"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		coalesceRequest(context.Background(), h, req, big)
+	}()
+	eventually(t, func() bool {
+		h.flights.Lock()
+		defer h.flights.Unlock()
+		return atomic.LoadInt32(&calls) == 2 && len(h.flights.m) == 0
+	})
+	close(release)
+	resps = coalesceRequest(context.Background(), h, req, big)
+	assert.Len(t, resps, maxFlightJoinResponses)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	<-done
+}
+
+// testUserKey is the context key of the user of a request in tests
+type testUserKey struct{}
+
+// userAuthorizer authorizes the users of the request contexts in the sources of each user
+type userAuthorizer map[string][]string
+
+func (u userAuthorizer) Authorize(ctx context.Context, a auth.Authorization) (bool, error) {
+	user, _ := ctx.Value(testUserKey{}).(string)
+	for _, fs := range u[user] {
+		if fs == a.FS {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestCoalesceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{Authorizer: userAuthorizer{"admin": {"node1", "node2"}, "guest": {"node2"}}}, memorySources(), parser, gcache.New(10).Build())
+
+	var (
+		calls   int32
+		release = make(chan struct{})
+	)
+	serve := func(ctx context.Context, req Request, send chan<- *Response) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		for _, src := range filterSources(h.sources(req), req.filterSourceMap) {
+			send <- &Response{Meta: Meta{ID: req.ID, FS: src.Name}}
+		}
+	}
+	request := func(user string) (context.Context, Request) {
+		ctx := context.WithValue(context.Background(), testUserKey{}, user)
+		req := Request{Meta: Meta{ID: 1, Action: "search"}, Regexp: "error"}
+		require.Nil(t, req.Init(h.source))
+		require.Nil(t, h.authorize(ctx, &req))
+		return ctx, req
+	}
+
+	// the guest does not join the flight of the admin, which has results of a source that the guest can't read
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx, req := request("admin")
+		assert.Len(t, coalesceRequest(ctx, h, req, serve), 2)
+	}()
+	eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 })
+	var guest []*Response
+	guestDone := make(chan struct{})
+	go func() {
+		defer close(guestDone)
+		ctx, req := request("guest")
+		guest = coalesceRequest(ctx, h, req, serve)
+	}()
+	eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 })
+	close(release)
+	<-done
+	<-guestDone
+	require.Len(t, guest, 1)
+	assert.Equal(t, "node2", guest[0].FS)
+}
@@ -0,0 +1,20 @@
+package engine
+
+import "github.com/Stratoscale/logserver/parse"
+
+// collapse counts a line in the last pending line if they are identical, and returns true if it was counted.
+// Lines are identical if they have the same message and level, their times may be different.
+func collapse(pending []parse.Log, line *parse.Log) bool {
+	if len(pending) == 0 {
+		return false
+	}
+	last := &pending[len(pending)-1]
+	if last.Msg != line.Msg || last.Level != line.Level {
+		return false
+	}
+	if last.Repeat == 0 {
+		last.Repeat = 1
+	}
+	last.Repeat++
+	return true
+}
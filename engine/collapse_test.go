@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapse(t *testing.T) {
+	t.Parallel()
+
+	var pending []parse.Log
+	for _, l := range []parse.Log{
+		{Msg: "disk failed", Level: "ERROR", Line: 1},
+		{Msg: "disk failed", Level: "ERROR", Line: 2},
+		{Msg: "disk failed", Level: "ERROR", Line: 3},
+		{Msg: "disk failed", Level: "INFO", Line: 4},
+		{Msg: "disk replaced", Level: "INFO", Line: 5},
+	} {
+		l := l
+		if !collapse(pending, &l) {
+			pending = append(pending, l)
+		}
+	}
+	assert.Equal(t, []parse.Log{
+		{Msg: "disk failed", Level: "ERROR", Line: 1, Repeat: 3},
+		{Msg: "disk failed", Level: "INFO", Line: 4},
+		{Msg: "disk replaced", Level: "INFO", Line: 5},
+	}, pending)
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Stratoscale/logserver/auth"
+)
+
+const (
+	// compressionDeflate compresses the lines of content responses with deflate and a dictionary of the file type
+	compressionDeflate = "deflate"
+	// dictionarySize is the maximal size of a dictionary, the size of the deflate window
+	dictionarySize = 32 * 1024
+	// minDictionarySize is the minimal size of a sample that a dictionary is made from
+	minDictionarySize = 4 * 1024
+	// maxDictionaries is the number of file types that have dictionaries
+	maxDictionaries = 256
+)
+
+// dictionary is a preset dictionary of deflate compression
+type dictionary struct {
+	id   string
+	data []byte
+	// fs and path are the file that the dictionary was made from, the dictionary is served only to users that
+	// may read it
+	fs   string
+	path string
+}
+
+// dictionaryKey is the key of the dictionary of a file type in a source
+type dictionaryKey struct {
+	fs       string
+	fileType string
+}
+
+// dictionaries are the compression dictionaries of the file types of each source. A dictionary of a file type
+// is made from the first lines of the first file of the type that is compressed, and it does not change
+// afterwards, so clients can fetch each dictionary once, by its ID.
+type dictionaries struct {
+	sync.Mutex
+	byType map[dictionaryKey]*dictionary
+	byID   map[string]*dictionary
+}
+
+// get returns the dictionary of a file type in a source. If the type has no dictionary, a dictionary is made from
+// the sample of the file in the path. It returns nil if the sample is too small, or if there are too many
+// dictionaries.
+func (d *dictionaries) get(fs, fileType, path string, sample []byte) *dictionary {
+	d.Lock()
+	defer d.Unlock()
+	key := dictionaryKey{fs: fs, fileType: fileType}
+	if dict, ok := d.byType[key]; ok {
+		return dict
+	}
+	if len(sample) < minDictionarySize || len(d.byType) >= maxDictionaries {
+		return nil
+	}
+	if len(sample) > dictionarySize {
+		sample = sample[:dictionarySize]
+	}
+	sum := sha256.Sum256(sample)
+	dict := &dictionary{id: hex.EncodeToString(sum[:8]), data: append([]byte(nil), sample...), fs: fs, path: path}
+	d.byType[key] = dict
+	d.byID[dict.id] = dict
+	return dict
+}
+
+func (d *dictionaries) byDictionaryID(id string) *dictionary {
+	d.Lock()
+	defer d.Unlock()
+	return d.byID[id]
+}
+
+// dictionaryType returns the type of a file for its compression dictionary, according to its extension.
+// Extensions of compressed files and numbers of rotated files are ignored, so rotated logs have the type of the log.
+func dictionaryType(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	for {
+		ext := filepath.Ext(name)
+		if _, err := strconv.Atoi(strings.TrimPrefix(ext, ".")); ext == "" || err != nil {
+			break
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+	if ext := filepath.Ext(name); ext != "" {
+		return ext
+	}
+	return name
+}
+
+// compressLines replaces the lines of a content response with their compressed json. The dictionary of the file
+// type is used only if the user of the context may read the file that it was made from.
+func (h *handler) compressLines(ctx context.Context, resp *Response, path string) {
+	if len(resp.Lines) == 0 {
+		return
+	}
+	data, err := json.Marshal(resp.Lines)
+	if err != nil {
+		log.WithError(err).Error("Failed encoding lines")
+		return
+	}
+	var (
+		dict    = h.dictionaries.get(resp.FS, dictionaryType(path), path, data)
+		dictBuf []byte
+		buf     bytes.Buffer
+	)
+	if dict != nil && !h.dictionaryAuthorized(ctx, dict) {
+		dict = nil
+	}
+	if dict != nil {
+		dictBuf = dict.data
+		resp.DictionaryID = dict.id
+	}
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dictBuf)
+	if err != nil {
+		log.WithError(err).Error("Failed creating compressor")
+		return
+	}
+	w.Write(data)
+	w.Close()
+	resp.Lines, resp.Compressed = nil, buf.Bytes()
+}
+
+// serveDictionary responds with a compression dictionary, if the user may read the file it was made from
+func (h *handler) serveDictionary(ctx context.Context, req Request, send chan<- *Response) {
+	dict := h.dictionaries.byDictionaryID(req.DictionaryID)
+	if dict == nil || !h.dictionaryAuthorized(ctx, dict) {
+		send <- &Response{Meta: req.Meta, Error: "Unknown dictionary " + req.DictionaryID}
+		return
+	}
+	send <- &Response{Meta: req.Meta, DictionaryID: dict.id, Dictionary: dict.data}
+}
+
+// dictionaryAuthorized returns true if the user of the context may read the file that a dictionary was made from
+func (h *handler) dictionaryAuthorized(ctx context.Context, dict *dictionary) bool {
+	return auth.Authorized(ctx, h.Authorizer, "get-content", dict.fs, dict.path)
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressLines(t *testing.T) {
+	t.Parallel()
+
+	h := newHandler(Config{}, nil, nil, nil)
+	lines := func(from int) []parse.Log {
+		var lines []parse.Log
+		for i := from; i < from+200; i++ {
+			lines = append(lines, parse.Log{Msg: fmt.Sprintf("data disk %d was found in distribution table", i), Level: "INFO", Line: i})
+		}
+		return lines
+	}
+
+	// the first response of a file type makes its dictionary, which is used for the following responses
+	first := &Response{Meta: Meta{FS: "node1"}, Lines: lines(0)}
+	h.compressLines(context.Background(), first, "dir/service.log")
+	second := &Response{Meta: Meta{FS: "node1"}, Lines: lines(200)}
+	h.compressLines(context.Background(), second, "dir/service.log.1.gz")
+	require.NotEmpty(t, second.DictionaryID)
+	assert.Equal(t, first.DictionaryID, second.DictionaryID)
+	assert.Nil(t, second.Lines)
+
+	send := make(chan *Response, 1)
+	h.serveDictionary(context.Background(), Request{DictionaryID: second.DictionaryID}, send)
+	dict := <-send
+	require.NotEmpty(t, dict.Dictionary)
+
+	data, err := ioutil.ReadAll(flate.NewReaderDict(bytes.NewReader(second.Compressed), dict.Dictionary))
+	require.Nil(t, err)
+	var got []parse.Log
+	require.Nil(t, json.Unmarshal(data, &got))
+	assert.Equal(t, lines(200), got)
+	plain, _ := json.Marshal(got)
+	assert.True(t, len(second.Compressed) < len(plain)/10, "compressed %d of %d bytes", len(second.Compressed), len(plain))
+
+	h.serveDictionary(context.Background(), Request{DictionaryID: "missing"}, send)
+	assert.NotEmpty(t, (<-send).Error)
+}
+
+// pathAuthorizer authorizes with a function of the authorization
+type pathAuthorizer func(a auth.Authorization) bool
+
+func (f pathAuthorizer) Authorize(ctx context.Context, a auth.Authorization) (bool, error) {
+	return f(a), nil
+}
+
+func TestCompressLinesAuthorization(t *testing.T) {
+	t.Parallel()
+
+	// the secret file can be read only by the admin
+	authz := pathAuthorizer(func(a auth.Authorization) bool {
+		return a.User == "admin" || a.Path != "secret/service.log"
+	})
+	h := newHandler(Config{Authorizer: authz}, nil, nil, nil)
+	var (
+		admin = auth.WithUser(context.Background(), auth.User{Name: "admin"})
+		guest = auth.WithUser(context.Background(), auth.User{Name: "guest"})
+	)
+	lines := func(msg string) []parse.Log {
+		var lines []parse.Log
+		for i := 0; i < 200; i++ {
+			lines = append(lines, parse.Log{Msg: fmt.Sprintf("%s %d", msg, i), Line: i})
+		}
+		return lines
+	}
+	dictionary := func(ctx context.Context, id string) []byte {
+		send := make(chan *Response, 1)
+		h.serveDictionary(ctx, Request{DictionaryID: id}, send)
+		return (<-send).Dictionary
+	}
+
+	secret := &Response{Meta: Meta{FS: "node1"}, Lines: lines("password of the database")}
+	h.compressLines(admin, secret, "secret/service.log")
+	require.NotEmpty(t, secret.DictionaryID)
+	assert.NotEmpty(t, dictionary(admin, secret.DictionaryID))
+
+	// a dictionary is not used for, or served to, users that may not read the file it was made from
+	public := &Response{Meta: Meta{FS: "node1"}, Lines: lines("request served")}
+	h.compressLines(guest, public, "public/service.log")
+	assert.Empty(t, public.DictionaryID)
+	assert.NotEmpty(t, public.Compressed)
+	assert.Empty(t, dictionary(guest, secret.DictionaryID))
+
+	// each source has its own dictionaries
+	other := &Response{Meta: Meta{FS: "node2"}, Lines: lines("request served")}
+	h.compressLines(guest, other, "public/service.log")
+	require.NotEmpty(t, other.DictionaryID)
+	assert.NotEqual(t, secret.DictionaryID, other.DictionaryID)
+	assert.NotEmpty(t, dictionary(guest, other.DictionaryID))
+}
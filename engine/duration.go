@@ -0,0 +1,16 @@
+package engine
+
+import "github.com/Stratoscale/logserver/duration"
+
+// UnmarshalJSON decodes the configuration, where durations are given in nanoseconds, or as strings like "2s" or "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// UnmarshalJSON decodes the admission configuration, where durations are given in nanoseconds, or as strings
+// like "10s"
+func (c *AdmissionConfig) UnmarshalJSON(b []byte) error {
+	type plain AdmissionConfig
+	return duration.Decode(b, (*plain)(c))
+}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationStrings(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"content_batch_time": "2s", "cache_expiration": "5m", "search_timeout": 1000, "content_batch_size": 10}`), &c))
+	assert.Equal(t, 2*time.Second, c.ContentBatchTime)
+	assert.Equal(t, 5*time.Minute, c.CacheExpiration)
+	assert.Equal(t, time.Microsecond, c.SearchTimeout)
+	assert.Equal(t, 10, c.ContentBatchSize)
+
+	var a AdmissionConfig
+	require.Nil(t, json.Unmarshal([]byte(`{"queue_timeout": "1m30s"}`), &a))
+	assert.Equal(t, 90*time.Second, a.QueueTimeout)
+
+	err := json.Unmarshal([]byte(`{"tree_timeout": "2 minutes"}`), &c)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tree_timeout")
+	assert.NotNil(t, json.Unmarshal([]byte(`{"tree_timeout": true}`), &c))
+	assert.NotNil(t, json.Unmarshal([]byte(`[]`), &c))
+}
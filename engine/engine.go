@@ -1,9 +1,9 @@
 package engine
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,12 +11,18 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
 	"github.com/Stratoscale/logserver/debug"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/notify"
 	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/snapshot"
 	"github.com/Stratoscale/logserver/source"
 	"github.com/bluele/gcache"
+	"github.com/gobwas/glob"
 	"github.com/gorilla/websocket"
 	"github.com/kr/fs"
 )
@@ -27,6 +33,10 @@ const (
 	defaultContentBatchSize = 2000
 	defaultContentBatchTime = time.Second * 2
 	defaultSearchMaxSize    = 5000
+	defaultTreeTimeout      = time.Minute * 2
+	defaultContentTimeout   = time.Minute * 10
+	defaultSearchTimeout    = time.Minute * 10
+	defaultFollowMaxDelay   = time.Second * 10
 )
 
 // Config are global configuration parameter for logserver
@@ -37,10 +47,76 @@ type Config struct {
 	CacheExpiration   time.Duration `json:"cache_expiration"`
 	ExcludeExtensions []string      `json:"exclude_extensions"`
 	ExcludeDirs       []string      `json:"exclude_dirs"`
+	// Prefetch walks the sources on startup to populate the tree cache
+	Prefetch bool `json:"prefetch"`
+	// PrefetchInterval repeats the prefetch periodically, zero means prefetch only on startup
+	PrefetchInterval time.Duration `json:"prefetch_interval"`
+	// Timeouts of the different actions. A negative value disables the timeout.
+	TreeTimeout    time.Duration `json:"tree_timeout"`
+	ContentTimeout time.Duration `json:"content_timeout"`
+	SearchTimeout  time.Duration `json:"search_timeout"`
+	// StragglerCutoff is the time that sources are given to complete a search after the first
+	// source completed. Sources that did not complete are cancelled. Zero disables the cutoff.
+	StragglerCutoff time.Duration `json:"straggler_cutoff"`
+	// GapThreshold is the default minimal time between consecutive lines of content and ordered search responses
+	// that is marked as a gap. Zero disables the gap markers.
+	GapThreshold time.Duration `json:"gap_threshold"`
+	// InferLevels sets the level of lines that no parser parsed according to keywords in them, like ERROR or
+	// Traceback, so level filters apply to unparsed files
+	InferLevels bool `json:"infer_levels"`
+	// FollowMinBatchSize is the minimal number of lines in a content response of a followed file. Fewer lines
+	// are sent only when the file stopped growing, or when they waited FollowMaxDelay. Zero, the default,
+	// sends the new lines of a followed file whenever they are read.
+	FollowMinBatchSize int `json:"follow_min_batch_size"`
+	// FollowMaxDelay is the maximal time that lines of a followed file wait for a batch, 10 seconds by default
+	FollowMaxDelay time.Duration `json:"follow_max_delay"`
+	// TreePageSize is the maximal number of files in a tree response, larger trees are sent in pages.
+	// Zero sends a tree in a single response.
+	TreePageSize int `json:"tree_page_size"`
+	// NaturalSort sorts the files of tree responses in natural order, so rotated files like app.log.2 are before
+	// app.log.10. By default, the files are sent in the order in which the sources were walked.
+	NaturalSort bool `json:"natural_sort"`
+	// MultiPatternTerms matches the texts of queries with several terms in a single scan of each line,
+	// instead of a scan for each of the texts, so the cost of a search does not grow with the number of terms
+	MultiPatternTerms bool `json:"multi_pattern_terms"`
+	// Presets are named searches that are offered to the clients
+	Presets []Preset `json:"presets"`
+	// CheckOrigin checks the origin of websocket requests, if not set, any origin is allowed
+	CheckOrigin func(r *http.Request) bool `json:"-"`
+	// Uploads provides files that were uploaded in a session, if not set, uploads are not served
+	Uploads Uploads `json:"-"`
+	// Events are sent to subscribed clients, and source events are sent to them.
+	// If not set, clients can't subscribe to events.
+	Events *notify.Broker `json:"-"`
+	// Manifest returns the manifest of the sources, or nil if it is not ready yet.
+	// If not set, manifests are not served.
+	Manifest func() *Manifest `json:"-"`
+	// Authorizer authorizes the action of a request in each source, in addition to the roles of the users.
+	// If not set, all the actions are authorized.
+	Authorizer auth.Authorizer `json:"-"`
+	// Admission limits the heavy requests that are served at the same time, if not set, they are not limited
+	Admission *Admission `json:"-"`
+	// Snapshots are the saved snapshots that searches can include, if not set, searches don't include artifacts
+	Snapshots *snapshot.Snapshots `json:"-"`
+	// Parsers returns the current parsers, when they are reloaded on changes. If not set, the parsers that the
+	// handler was created with are used.
+	Parsers func() parse.Parse `json:"-"`
+	// Sources are the current sources, when they can be replaced while the server runs. Each request uses the
+	// sources that were current when it started, which are not closed until it finished. If not set, the
+	// sources that the handler was created with are used.
+	Sources *source.Registry `json:"-"`
+	// Context is the lifetime of the handler, its background work, like the tree prefetch, stops when it is
+	// done. If not set, the background work runs until the process exits.
+	Context context.Context `json:"-"`
 }
 
 // New returns a new websocket handler
 func New(c Config, source source.Sources, parser parse.Parse, cache gcache.Cache) http.Handler {
+	return newHandler(c, source, parser, cache)
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
 	if c.ContentBatchSize == 0 {
 		c.ContentBatchSize = defaultContentBatchSize
 	}
@@ -50,6 +126,29 @@ func New(c Config, source source.Sources, parser parse.Parse, cache gcache.Cache
 	if c.SearchMaxSize == 0 {
 		c.SearchMaxSize = defaultSearchMaxSize
 	}
+	if c.TreeTimeout == 0 {
+		c.TreeTimeout = defaultTreeTimeout
+	}
+	if c.ContentTimeout == 0 {
+		c.ContentTimeout = defaultContentTimeout
+	}
+	if c.SearchTimeout == 0 {
+		c.SearchTimeout = defaultSearchTimeout
+	}
+	if c.FollowMaxDelay == 0 {
+		c.FollowMaxDelay = defaultFollowMaxDelay
+	}
+	return c
+}
+
+func newHandler(c Config, source source.Sources, parser parse.Parse, cache gcache.Cache) *handler {
+	c = c.WithDefaults()
+	if c.CheckOrigin == nil {
+		c.CheckOrigin = func(*http.Request) bool { return true }
+	}
+	if c.Context == nil {
+		c.Context = context.Background()
+	}
 	h := &handler{
 		Config:            c,
 		source:            source,
@@ -57,6 +156,15 @@ func New(c Config, source source.Sources, parser parse.Parse, cache gcache.Cache
 		cache:             cache,
 		excludeDirs:       list2Map(c.ExcludeDirs),
 		excludeExtensions: list2Map(c.ExcludeExtensions),
+		flights:           flights{m: make(map[string]*flight)},
+		latencies:         latencies{m: make(map[string]time.Duration)},
+		health:            health{down: make(map[string]bool)},
+		dictionaries:      dictionaries{byType: make(map[dictionaryKey]*dictionary), byID: make(map[string]*dictionary)},
+		watches:           watchSessions{m: make(map[string]*watchSession)},
+		gzipSizes:         newGzipSizes(),
+	}
+	if c.Prefetch {
+		go h.prefetch()
 	}
 	return h
 }
@@ -68,6 +176,12 @@ type handler struct {
 	cache             gcache.Cache
 	excludeDirs       map[string]bool
 	excludeExtensions map[string]bool
+	flights           flights
+	latencies         latencies
+	health            health
+	dictionaries      dictionaries
+	watches           watchSessions
+	gzipSizes         gzipSizes
 }
 
 // Path describes a file path
@@ -88,13 +202,119 @@ type Request struct {
 	Path         Path      `json:"path"`
 	Regexp       string    `json:"regexp"`
 	FilterSource []string  `json:"filter_fs"`
+	FilterGroup  []string  `json:"filter_group"`
 	FilterTime   TimeRange `json:"filter_time"`
+	// FilterTags selects the sources that have all the given tags
+	FilterTags map[string]string `json:"filter_tags"`
+	// Follow keeps reading a file after its end was reached, for new lines that are written to it
+	Follow bool `json:"follow"`
+	// PeekLines is the number of lines to return from each side of a file in a peek request
+	PeekLines int `json:"peek_lines"`
+	// FilterLevel returns only lines with one of the given log levels
+	FilterLevel []string `json:"filter_level"`
+	// FilterPath is a glob of the paths of the searched files
+	FilterPath string `json:"filter_path"`
+	// ModifiedSince and ModifiedBefore prune the searched files by their modification time, before they are opened
+	ModifiedSince  *time.Time `json:"modified_since"`
+	ModifiedBefore *time.Time `json:"modified_before"`
+	// Query is a text of combined filters, see applyQuery
+	Query string `json:"query"`
+	// Field is the name of the aggregated field in an aggregate request
+	Field string `json:"field"`
+	// Percentiles to compute in an aggregate request
+	Percentiles []float64 `json:"percentiles"`
+	// Trace is the ID that is searched in a trace request
+	Trace string `json:"trace"`
+	// Collapse sends runs of identical consecutive lines as a single line with a repeat count
+	Collapse bool `json:"collapse"`
+	// GapThreshold overrides the default gap threshold of the server, a negative value disables the gap markers
+	GapThreshold time.Duration `json:"gap_threshold"`
+	// Ordered sends the search results ordered by the time of the lines, instead of by the
+	// order in which the files were searched
+	Ordered bool `json:"ordered"`
+	// MaxMatchesPerFile stops searching a file after the given number of lines matched
+	MaxMatchesPerFile int `json:"max_matches_per_file"`
+	// MaxTotalMatches stops a search after the given number of lines matched in all the files
+	MaxTotalMatches int `json:"max_total_matches"`
+	// IncludeArtifacts includes the saved artifacts, like snapshots, whose titles match the regexp of a search
+	IncludeArtifacts bool `json:"include_artifacts"`
+	// FromByteOffset reads the content of a file from the offset of one of its lines, as returned
+	// in the offset of lines, without reading the lines before it
+	FromByteOffset int64 `json:"from_byte_offset"`
+	// FromLine is the line number of the line at FromByteOffset, if not given, lines are not numbered
+	FromLine int `json:"from_line"`
+	// Time is the time around which lines are returned in a get-window request
+	Time *time.Time `json:"time"`
+	// Targets are the files of a get-window request
+	Targets []Target `json:"targets"`
+	// WindowLines is the number of lines before and after the time in a get-window request,
+	// or around the line of a permalink in a resolve-permalink request
+	WindowLines int `json:"window_lines"`
+	// Speed multiplies the pace of a replay request, 2 replays a file twice as fast as it was written
+	Speed float64 `json:"speed"`
+	// PageToken continues a get-file-tree request from the page of a continuation token of a tree response
+	PageToken string `json:"page_token"`
+	// Permalink is the token of a resolve-permalink request
+	Permalink string `json:"permalink"`
+	// Events are globs of the event types of a subscribe-events request
+	Events []string `json:"events"`
+	// Compression of the lines of content responses, "deflate" compresses them with the dictionary of the
+	// file type. By default the lines are not compressed.
+	Compression string `json:"compression"`
+	// DictionaryID is the ID of the dictionary of a get-dictionary request
+	DictionaryID string `json:"dictionary_id"`
+	// IncludeRaw sets the original line, before it was parsed, in the raw field of each line
+	IncludeRaw bool `json:"include_raw"`
+	// WatchKey is the key of a shared session that a watch request joins
+	WatchKey string `json:"watch_key"`
+	// Session is an uploads session, its uploaded files are served as an additional source
+	Session string `json:"session"`
+	// NaturalSort sorts the files of a tree response in natural order, even if the server does not sort them
+	NaturalSort bool `json:"natural_sort"`
+	// Paths are the base paths of a search, aggregate or trace request, to search multiple files and directories
+	// that were selected in the tree. When set, the path of the request is not searched.
+	Paths []Path `json:"paths"`
 
 	filterSourceMap map[string]bool
+	filterPath      glob.Glob
+	// terms are regular expressions from the query that a line message should match
+	terms []*regexp.Regexp
+	// termSet matches the terms together, if multi-pattern matching is enabled
+	termSet *termSet
+	// matches counts the matches of a search with max_total_matches
+	matches *matchLimit
+	// sources are the sources that were acquired for the request
+	sources source.Sources
 }
 
-func (r *Request) Init() {
+// Init prepares the request filters. The query is applied on the filters, and source groups
+// in the filter are expanded to the names of the sources in them.
+func (r *Request) Init(sources source.Sources) error {
+	if r.Compression != "" && r.Compression != compressionDeflate {
+		return fmt.Errorf("unknown compression %s", r.Compression)
+	}
+	if err := r.applyQuery(time.Now()); err != nil {
+		return err
+	}
+	if err := r.compileFilters(); err != nil {
+		return err
+	}
+	if len(r.FilterSource) == 0 && len(r.FilterGroup) == 0 && len(r.FilterTags) == 0 {
+		return nil
+	}
 	r.filterSourceMap = sourceSet(r.FilterSource)
+	groups := sourceSet(r.FilterGroup)
+	for _, src := range sources {
+		for _, group := range src.Groups {
+			if groups[group] {
+				r.filterSourceMap[src.Name] = true
+			}
+		}
+		if len(r.FilterTags) > 0 && hasTags(src, r.FilterTags) {
+			r.filterSourceMap[src.Name] = true
+		}
+	}
+	return nil
 }
 
 type TimeRange struct {
@@ -104,15 +324,83 @@ type TimeRange struct {
 
 // Response from the server
 type Response struct {
-	Meta     `json:"meta"`
-	Lines    []parse.Log `json:"lines,omitempty"`
-	Files    []*File     `json:"tree,omitempty"`
-	Error    string      `json:"error,omitempty"`
-	Finished bool        `json:"finished,omitempty"`
+	Meta    `json:"meta"`
+	Lines   []parse.Log  `json:"lines,omitempty"`
+	Tail    []parse.Log  `json:"tail,omitempty"`
+	Sources []SourceInfo `json:"sources,omitempty"`
+	Presets []Preset     `json:"presets,omitempty"`
+	// Aggregation is the result of an aggregate request
+	Aggregation *Aggregation `json:"aggregation,omitempty"`
+	// Estimate is the result of an estimate request
+	Estimate *Estimate `json:"estimate,omitempty"`
+	// Manifest is the result of a get-manifest request
+	Manifest *Manifest `json:"manifest,omitempty"`
+	Files    []*File   `json:"tree,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Finished bool      `json:"finished,omitempty"`
+	// Partial is set when not all the files were walked due to source limits
+	Partial bool `json:"partial,omitempty"`
+	// Late is set on search responses of a source that were sent after another source finished
+	Late bool `json:"late,omitempty"`
+	// Chunk is the sequence number, starting from 1, of a content response of a file in a source.
+	// Clients can use it to detect missing or reordered responses.
+	Chunk int `json:"chunk,omitempty"`
+	// EOF is set on the last content response of a file in a source
+	EOF bool `json:"eof,omitempty"`
+	// SourceErrors are errors of sources that failed to respond, the results are incomplete when they are set
+	SourceErrors []SourceError `json:"source_errors,omitempty"`
+	// NextPage is the continuation token of the next page of a paged tree response, see Request.PageToken
+	NextPage string `json:"next_page,omitempty"`
+	// Permalink is the token of a create-permalink response
+	Permalink string `json:"permalink,omitempty"`
+	// Stale is set on a resolve-permalink response when the line of the permalink is not in the file anymore
+	Stale string `json:"stale,omitempty"`
+	// Artifacts are the saved artifacts that matched a search with include_artifacts
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// Parsers is the result of a get-parsers request
+	Parsers []ParserInfo `json:"parsers,omitempty"`
+	// RetryAfter is the number of seconds to wait before retrying a request that was rejected because the
+	// server is busy
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Event is an event that was sent to a subscribe-events request
+	Event *notify.Event `json:"event,omitempty"`
+	// Compressed are the lines of a content response with compression, as compressed json
+	Compressed []byte `json:"compressed,omitempty"`
+	// DictionaryID is the ID of the dictionary of the compressed lines, or of a get-dictionary response
+	DictionaryID string `json:"dictionary_id,omitempty"`
+	// Dictionary is the content of the dictionary of a get-dictionary response
+	Dictionary []byte `json:"dictionary,omitempty"`
+	// WatchKey is the key of the session of a share response, which other connections can watch
+	WatchKey string `json:"watch_key,omitempty"`
+	// WatchRequest is a request of a watched session, it is sent to a watch request when the shared
+	// connection sends it, and when the watch request joins the session
+	WatchRequest *Request `json:"watch_request,omitempty"`
+	// Watched is a response of a request of a watched session
+	Watched *Response `json:"watched,omitempty"`
+	// FileStatus is the status of the file of a get-content request in the source of the response, it is set
+	// on the last response of each source
+	FileStatus *FileStatus `json:"file_status,omitempty"`
+	// SeekVerify is the verification of the line at the offset of a seek-verify request, in the source of the response
+	SeekVerify *SeekVerification `json:"seek_verify,omitempty"`
+}
+
+// MemSize estimates the memory footprint of the files of a cached tree response
+func (r *Response) MemSize() int64 {
+	size := int64(unsafe.Sizeof(*r))
+	for _, f := range r.Files {
+		size += int64(unsafe.Sizeof(*f)) + int64(len(f.Key))
+		for _, p := range f.Path {
+			size += int64(unsafe.Sizeof(p)) + int64(len(p))
+		}
+		for _, inst := range f.Instances {
+			size += int64(unsafe.Sizeof(inst)) + int64(len(inst.FS))
+		}
+	}
+	return size
 }
 
 func (r Response) FilterSources(sources map[string]bool) *Response {
-	if len(sources) == 0 {
+	if sources == nil {
 		return &r
 	}
 	files := make([]*File, 0, len(r.Files))
@@ -123,9 +411,25 @@ func (r Response) FilterSources(sources map[string]bool) *Response {
 		}
 	}
 	r.Files = files
+	var errs []SourceError
+	for _, err := range r.SourceErrors {
+		if sources[err.FS] {
+			errs = append(errs, err)
+		}
+	}
+	r.SourceErrors = errs
 	return &r
 }
 
+// SourceInfo describes a source
+type SourceInfo struct {
+	Name   string            `json:"name"`
+	Groups []string          `json:"groups,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// Latency is the average search duration of the source
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
 // File describes a file in multiple file systems
 type File struct {
 	Key   string `json:"key"`
@@ -154,6 +458,10 @@ func (f File) FilterSources(sources map[string]bool) *File {
 type FileInstance struct {
 	Size int64  `json:"size"`
 	FS   string `json:"fs"`
+	// UncompressedSize is an estimate of the uncompressed size of a gzip file, it is set only for gzip files
+	UncompressedSize int64 `json:"uncompressed_size,omitempty"`
+	// ModTime is the modification time of the file, it is set only in locate responses
+	ModTime *time.Time `json:"mtime,omitempty"`
 }
 
 func list2Map(list []string) map[string]bool {
@@ -168,9 +476,7 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Infof("New WS Client from: %s", r.RemoteAddr)
 	defer log.Info("Disconnected WS Client from: %s", r.RemoteAddr)
 	u := &websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin: h.CheckOrigin,
 	}
 	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
@@ -185,6 +491,10 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx    context.Context
 		cancel context.CancelFunc
 		serves sync.WaitGroup
+		// unsubscribe stops the subscription to events
+		unsubscribe context.CancelFunc
+		// shared is the session that mirrors the requests of the connection to its watchers
+		shared *watchSession
 	)
 
 	defer func() {
@@ -192,6 +502,12 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if cancel != nil {
 			cancel()
 		}
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		if shared != nil {
+			h.unshare(shared)
+		}
 		// wait for all servings to finish
 		serves.Wait()
 		// close send channel to stop reader
@@ -205,7 +521,64 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			log.WithError(err).Errorf("Failed read")
 			return
 		}
-		req.Init()
+		// the sources are released when the request finished, so they are not closed under it
+		var release func()
+		req.sources, release = h.acquire()
+		err := req.Init(h.sources(req))
+		if err == nil {
+			h.compileTerms(&req)
+			err = h.authorize(r.Context(), &req)
+		}
+		if err != nil {
+			release()
+			send <- &Response{Meta: req.Meta, Error: err.Error()}
+			send <- &Response{Meta: req.Meta, Finished: true}
+			continue
+		}
+
+		// a subscription to events is kept until the client subscribes again or unsubscribes,
+		// it is not cancelled by other requests
+		// requests that don't read the sources release them right away, a watch request sees the sources of the
+		// requests that it mirrors
+		switch req.Action {
+		case "subscribe-events", "unsubscribe-events", "share", "unshare", "cancel", "watch":
+			release()
+		}
+		switch req.Action {
+		case "subscribe-events", "unsubscribe-events":
+			if unsubscribe != nil {
+				unsubscribe()
+			}
+			if req.Action == "unsubscribe-events" {
+				send <- &Response{Meta: req.Meta, Finished: true}
+				continue
+			}
+			serves.Add(1)
+			unsubscribe = h.startSubscription(r.Context(), req, send, serves.Done)
+			continue
+
+		// a shared connection mirrors the requests that it sends after the share request to the watchers
+		// of its session, until it unshares or disconnects
+		case "share", "unshare":
+			if shared != nil {
+				h.unshare(shared)
+				shared = nil
+			}
+			if req.Action == "share" {
+				shared = h.share()
+				send <- &Response{Meta: req.Meta, WatchKey: shared.key}
+			}
+			send <- &Response{Meta: req.Meta, Finished: true}
+			continue
+
+		// a cancel request stops the running request without starting another one
+		case "cancel":
+			if cancel != nil {
+				cancel()
+			}
+			send <- &Response{Meta: req.Meta, Finished: true}
+			continue
+		}
 
 		// cancel the last serving up on a new request
 		if cancel != nil {
@@ -213,8 +586,11 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		ctx, cancel = context.WithCancel(r.Context())
 		serves.Add(1)
+		out, mirrored := h.mirror(shared, req, send)
 		go func() {
-			h.serve(ctx, req, send)
+			h.serve(ctx, req, out)
+			mirrored()
+			release()
 			serves.Done()
 		}()
 	}
@@ -233,25 +609,134 @@ func reader(conn *websocket.Conn, ch <-chan *Response) {
 func (h *handler) serve(ctx context.Context, req Request, send chan<- *Response) {
 	defer debug.Time(log, "Request %+v", req.Meta)()
 
+	parent := ctx
+	if heavyActions[req.Action] {
+		release, err := h.Admission.Admit(ctx)
+		if err != nil {
+			if busy, ok := err.(errBusy); ok {
+				log.Warnf("Request %d was not admitted", req.ID)
+				send <- &Response{Meta: req.Meta, Error: busy.Error(), RetryAfter: int(busy.retryAfter.Seconds())}
+			}
+			send <- &Response{Meta: req.Meta, Finished: true}
+			return
+		}
+		defer release()
+	}
+	if timeout := h.timeout(req); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	switch req.Action {
 	case "get-file-tree":
-		h.serveTree(ctx, req, send)
+		h.coalesce(ctx, req, send, h.serveTree)
 
 	case "get-content":
 		h.serveContent(ctx, req, send)
 
 	case "search":
-		h.search(ctx, req, send)
+		h.coalesce(ctx, req, send, h.search)
+
+	case "peek":
+		h.peek(ctx, req, send)
+
+	case "get-sources":
+		h.serveSources(ctx, req, send)
+
+	case "get-presets":
+		h.servePresets(ctx, req, send)
+
+	case "aggregate":
+		h.aggregate(ctx, req, send)
+
+	case "trace":
+		h.trace(ctx, req, send)
+
+	case "estimate":
+		h.estimate(ctx, req, send)
+
+	case "locate":
+		h.locate(ctx, req, send)
+
+	case "get-manifest":
+		h.serveManifest(ctx, req, send)
+
+	case "get-window":
+		h.window(ctx, req, send)
+
+	case "get-dictionary":
+		h.serveDictionary(ctx, req, send)
+
+	case "get-parsers":
+		h.serveParsers(ctx, req, send)
+
+	case "create-permalink":
+		h.createPermalinks(ctx, req, send)
+
+	case "resolve-permalink":
+		h.resolvePermalink(ctx, req, send)
+
+	case "replay":
+		h.replay(ctx, req, send)
+
+	case "watch":
+		h.watch(ctx, req, send)
+
+	case "seek-verify":
+		h.seekVerify(ctx, req, send)
 	}
 
 	if err := ctx.Err(); err != nil {
-		log.Debugf("Request %d cancelled", req.ID)
+		if parent.Err() == nil {
+			log.Warnf("Request %d timed out", req.ID)
+			send <- &Response{Meta: req.Meta, Error: fmt.Sprintf("Request timed out after %s", h.timeout(req))}
+		} else {
+			log.Debugf("Request %d cancelled", req.ID)
+		}
 	}
 	send <- &Response{Meta: req.Meta, Finished: true}
 }
 
+// compileTerms compiles the terms of a request to a term set, if multi-pattern matching is enabled and
+// the request has several terms
+func (h *handler) compileTerms(req *Request) {
+	if h.MultiPatternTerms && len(req.terms) > 1 {
+		req.termSet = newTermSet(req.terms)
+	}
+}
+
+// timeout returns the timeout of a request according to its action
+func (h *handler) timeout(req Request) time.Duration {
+	switch req.Action {
+	case "get-file-tree", "estimate", "locate":
+		return h.TreeTimeout
+	case "get-content", "peek", "get-window", "create-permalink", "resolve-permalink", "seek-verify":
+		// followed files are read until the client cancels the request
+		if req.Follow {
+			return 0
+		}
+		return h.ContentTimeout
+	case "search", "aggregate", "trace":
+		return h.SearchTimeout
+	}
+	return 0
+}
+
 type treeCacheKey string
 
+// Kind names the kind of the key in the cache stats
+func (treeCacheKey) Kind() string { return "tree" }
+
+func (h *handler) serveSources(ctx context.Context, req Request, send chan<- *Response) {
+	sources := h.sources(req)
+	infos := make([]SourceInfo, 0, len(sources))
+	for _, src := range filterSources(sources, req.filterSourceMap) {
+		infos = append(infos, SourceInfo{Name: src.Name, Groups: src.Groups, Tags: src.Tags, Latency: h.latencies.get(src.Name)})
+	}
+	send <- &Response{Meta: req.Meta, Sources: infos}
+}
+
 func (h *handler) serveTree(ctx context.Context, req Request, send chan<- *Response) {
 	var (
 		cacheKey = treeCacheKey(filepath.Join(req.Path...))
@@ -261,56 +746,179 @@ func (h *handler) serveTree(ctx context.Context, req Request, send chan<- *Respo
 		resp = val.(*Response)
 	} else {
 		// if not cached, load from all sources
-		var (
-			c       = newCombiner()
-			wg      sync.WaitGroup
-			sources = h.source
-		)
-		wg.Add(len(sources))
-		for _, src := range sources {
-			go func(src source.Source) {
-				defer wg.Done()
-				h.srcTree(ctx, req, src, c)
-			}(src)
+		resp = h.loadTree(ctx, req)
+	}
+
+	resp = h.treeWithLive(ctx, req, resp)
+	resp = resp.FilterSources(req.filterSourceMap)
+	// a cached tree has the metadata of the request that loaded it
+	resp.Meta = req.Meta
+	if h.NaturalSort || req.NaturalSort {
+		resp.Files = sortNatural(resp.Files)
+	}
+	h.sendTree(req, resp, send)
+}
+
+// loadTree walks all the sources, except the live sources, and stores the combined tree in the cache
+func (h *handler) loadTree(ctx context.Context, req Request) *Response {
+	var (
+		c       = newCombiner()
+		wg      sync.WaitGroup
+		sources source.Sources
+	)
+	for _, src := range h.baseSources(req) {
+		if !src.Watched {
+			sources = append(sources, src)
+		}
+	}
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			h.srcTree(ctx, req, src, c)
+		}(src)
+	}
+	wg.Wait()
+	log.Debugf("Serve tree for %v with %d files", req.Path, len(c.files))
+	resp := &Response{Meta: req.Meta, Files: c.files, Partial: c.partial, SourceErrors: c.errors}
+
+	// don't cache a tree of a cancelled walk, since it might be partial
+	if ctx.Err() != nil {
+		return resp
+	}
+	if err := h.cache.Set(treeCacheKey(filepath.Join(req.Path...)), resp); err != nil {
+		log.WithError(err).Warnf("Set cache")
+	}
+	return resp
+}
+
+// treeWithLive adds the files of the live sources, which are not cached, to a tree of the other sources.
+// Live sources are sources with watched trees, which are always fresh, and the uploaded files of the
+// request session, which are private to the session.
+func (h *handler) treeWithLive(ctx context.Context, req Request, resp *Response) *Response {
+	var live source.Sources
+	for _, src := range h.baseSources(req) {
+		if src.Watched {
+			live = append(live, src)
 		}
-		wg.Wait()
-		log.Debugf("Serve tree for %v with %d files", req.Path, len(c.files))
-		resp = &Response{Meta: req.Meta, Files: c.files}
-		if err := h.cache.Set(cacheKey, resp); err != nil {
-			log.WithError(err).Warnf("Set cache")
+	}
+	if src, ok := h.uploadSource(req); ok {
+		live = append(live, src)
+	}
+	if len(live) == 0 {
+		return resp
+	}
+	c := newCombiner()
+	for _, f := range resp.Files {
+		for _, instance := range f.Instances {
+			cp := *f
+			cp.Instances = nil
+			c.add(cp, instance)
 		}
 	}
+	for _, src := range live {
+		h.srcTree(ctx, req, src, c)
+	}
+	return &Response{
+		Meta:         resp.Meta,
+		Files:        c.files,
+		Partial:      resp.Partial || c.partial,
+		SourceErrors: append(append([]SourceError(nil), resp.SourceErrors...), c.errors...),
+	}
+}
 
-	resp = resp.FilterSources(req.filterSourceMap)
-	resp.ID = req.ID
-	send <- resp
+// prefetch walks the sources and populates the tree cache, so the first
+// tree request won't pay for a cold walk. If a prefetch interval is defined
+// the walk is repeated periodically, until the context of the handler is done.
+func (h *handler) prefetch() {
+	for {
+		done := debug.Time(log, "Prefetch tree")
+		sources, release := h.acquire()
+		h.loadTree(h.Context, Request{Meta: Meta{Action: "get-file-tree"}, sources: sources})
+		release()
+		done()
+		if h.PrefetchInterval == 0 {
+			return
+		}
+		select {
+		case <-h.Context.Done():
+			return
+		case <-time.After(h.PrefetchInterval):
+		}
+	}
 }
 
-func (h *handler) recurseTree(ctx context.Context, path string, src source.Source, f func(*fs.Walker)) {
-	walker := fs.WalkFS(path, src.FS)
+// recurseTree walks a source from a given path, and calls f for every walked file.
+// It returns true if the walk was stopped due to the source limits, and not all the
+// files were walked, and the first error that occurred during the walk.
+func (h *handler) recurseTree(ctx context.Context, path string, src source.Source, f func(*fs.Walker)) (partial bool, walkErr error) {
+	const sep = string(os.PathSeparator)
+	walkCtx := ctx
+	if src.WalkTimeout > 0 {
+		var cancel context.CancelFunc
+		walkCtx, cancel = context.WithTimeout(ctx, src.WalkTimeout)
+		defer cancel()
+	}
+
+	var (
+		walker                         = fs.WalkFS(path, filesystem.WithContext(walkCtx, src.FS))
+		count                          = 0
+		excludeDirs, excludeExtensions = h.excludes(src)
+	)
 	for walker.Step() {
-		if err := ctx.Err(); err != nil {
-			return
+		if err := walkCtx.Err(); err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("Walk timeout %s:%s after %s", src.Name, path, src.WalkTimeout)
+				return true, walkErr
+			}
+			return false, walkErr
+		}
+
+		if walker.Path() == path {
+			h.updateHealth(src.Name, walker.Err())
 		}
 
 		if err := walker.Err(); err != nil {
+			// the path might not exist in all the sources, it is not an error
+			if os.IsNotExist(err) {
+				continue
+			}
 			log.WithError(err).Errorf("Failed walk %s:%s", src.Name, path)
+			if walkErr == nil {
+				walkErr = err
+			}
 			continue
 		}
 
 		if walker.Stat().IsDir() {
-			if _, ok := h.excludeDirs[filepath.Base(walker.Path())]; ok {
+			if excludeDirs[filepath.Base(walker.Path())] {
 				walker.SkipDir()
 				continue
 			}
 		} else {
-			if _, ok := h.excludeExtensions[filepath.Ext(walker.Path())]; ok {
+			if excludeExtensions[filepath.Ext(walker.Path())] {
+				continue
+			}
+		}
+
+		if rel := strings.Trim(strings.TrimPrefix(walker.Path(), path), sep); rel != "" {
+			if src.MaxDepth > 0 && strings.Count(rel, sep) >= src.MaxDepth {
+				if walker.Stat().IsDir() {
+					walker.SkipDir()
+				}
+				partial = true
 				continue
 			}
+			count++
+			if src.MaxFiles > 0 && count > src.MaxFiles {
+				log.Warnf("Walk %s:%s exceeded %d files", src.Name, path, src.MaxFiles)
+				return true, walkErr
+			}
 		}
 
 		f(walker)
 	}
+	return partial, walkErr
 }
 
 // srcTree returns a file tree from a single source
@@ -318,7 +926,7 @@ func (h *handler) srcTree(ctx context.Context, req Request, src source.Source, c
 	const sep = string(os.PathSeparator)
 	path := src.FS.Join(req.Path...)
 
-	h.recurseTree(ctx, path, src, func(walker *fs.Walker) {
+	partial, err := h.recurseTree(ctx, path, src, func(walker *fs.Walker) {
 		key := strings.Trim(walker.Path(), sep)
 		if key == "" {
 			return
@@ -331,17 +939,38 @@ func (h *handler) srcTree(ctx context.Context, req Request, src source.Source, c
 				IsDir: walker.Stat().IsDir(),
 			},
 			FileInstance{
-				Size: walker.Stat().Size(),
-				FS:   src.Name,
+				Size:             walker.Stat().Size(),
+				FS:               src.Name,
+				UncompressedSize: h.uncompressedSize(src.WithContext(ctx), walker.Path(), walker.Stat()),
 			},
 		)
 	})
+	if partial {
+		c.setPartial()
+	}
+	if err != nil {
+		c.addError(newSourceError(src.Name, codeWalk, err))
+	}
 }
 
 type combiner struct {
-	files []*File
-	index map[string]*File
-	lock  sync.Mutex
+	files   []*File
+	index   map[string]*File
+	partial bool
+	errors  []SourceError
+	lock    sync.Mutex
+}
+
+func (c *combiner) addError(err SourceError) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.errors = append(c.errors, err)
+}
+
+func (c *combiner) setPartial() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.partial = true
 }
 
 func newCombiner() *combiner {
@@ -360,7 +989,7 @@ func (c *combiner) add(f File, instance FileInstance) {
 
 func (h *handler) serveContent(ctx context.Context, req Request, send chan<- *Response) {
 	wg := sync.WaitGroup{}
-	sources := filterSources(h.source, req.filterSourceMap)
+	sources := filterSources(h.sources(req), req.filterSourceMap)
 	wg.Add(len(sources))
 	for _, src := range sources {
 		go func(src source.Source) {
@@ -381,60 +1010,234 @@ func (h *handler) search(ctx context.Context, req Request, send chan<- *Response
 		}
 		return
 	}
-	nodes := filterSources(h.source, req.filterSourceMap)
+	if req.MaxTotalMatches > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		req.matches = &matchLimit{max: int64(req.MaxTotalMatches), cancel: cancel}
+	}
+	if req.IncludeArtifacts {
+		h.searchArtifacts(ctx, req, re, send)
+	}
+	if req.Ordered {
+		h.searchOrdered(ctx, req, send, re)
+		return
+	}
+	// start with the fastest sources, so their results are sent first
+	nodes := h.latencies.byLatency(filterSources(h.sources(req), req.filterSourceMap))
+	st := newStragglers(h.StragglerCutoff)
 	wg := sync.WaitGroup{}
 	wg.Add(len(nodes))
 	for _, node := range nodes {
 		go func(node source.Source) {
 			defer wg.Done()
-			path := node.FS.Join(req.Path...)
-			h.searchNode(ctx, send, req, node, path, re)
+			defer st.done()
+			h.searchLatency(ctx, send, req, node, re, st)
 		}(node)
 	}
 	wg.Wait()
 }
 
-func (h *handler) searchNode(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, re *regexp.Regexp) {
-	h.recurseTree(ctx, path, node, func(walker *fs.Walker) {
+// searchLatency searches a source and measures its latency. Responses that are sent after
+// another source already finished are marked as late, and when the straggler cutoff passes,
+// the search is cancelled with a partial response.
+func (h *handler) searchLatency(ctx context.Context, send chan<- *Response, req Request, node source.Source, re *regexp.Regexp, st *stragglers) {
+	nodeCtx, cancel := st.context(ctx)
+	defer cancel()
+
+	var (
+		ch    = make(chan *Response)
+		fwd   = make(chan struct{})
+		start = time.Now()
+	)
+	go func() {
+		defer close(fwd)
+		for resp := range ch {
+			resp.Late = st.late()
+			send <- resp
+		}
+	}()
+	h.searchNode(nodeCtx, ch, req, node, re)
+	close(ch)
+	<-fwd
+
+	switch {
+	case ctx.Err() != nil:
+	case nodeCtx.Err() != nil:
+		log.Warnf("Search of %s was cut off after %s", node.Name, time.Since(start))
+		send <- &Response{Meta: Meta{ID: req.ID, Action: req.Action, FS: node.Name}, Partial: true, Late: true}
+	default:
+		h.latencies.add(node.Name, time.Since(start))
+	}
+}
+
+// searchNode searches the base paths of a request in a source
+func (h *handler) searchNode(ctx context.Context, send chan<- *Response, req Request, node source.Source, re *regexp.Regexp) {
+	// files that are reachable through multiple paths, like hard links and bind mounts, are searched once
+	seen := make(map[filesystem.FileID]bool)
+	for _, path := range req.searchPaths() {
+		if ctx.Err() != nil {
+			return
+		}
+		h.searchPath(ctx, send, req, node, node.FS.Join(path...), re, seen)
+	}
+}
+
+func (h *handler) searchPath(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, re *regexp.Regexp, seen map[filesystem.FileID]bool) {
+	partial, err := h.recurseTree(ctx, path, node, func(walker *fs.Walker) {
+		if id, ok := filesystem.ID(walker.Stat()); ok {
+			if seen[id] {
+				log.Debugf("Skipping %s:%s, it was searched through another path", node.Name, walker.Path())
+				if walker.Stat().IsDir() {
+					walker.SkipDir()
+				}
+				return
+			}
+			seen[id] = true
+		}
 		filePath := walker.Path()
+		if !req.matchPath(filePath) || !req.matchModTime(walker.Stat()) {
+			return
+		}
 		h.read(ctx, send, req, node, filePath, re)
 	})
+	if partial {
+		send <- &Response{Meta: Meta{ID: req.ID, Action: req.Action, FS: node.Name}, Partial: true}
+	}
+	if err != nil {
+		send <- sourceErrorResponse(req, node.Name, codeWalk, err)
+	}
+}
+
+// parsers returns the current parsers
+func (h *handler) parsers() parse.Parse {
+	if h.Parsers != nil {
+		return h.Parsers()
+	}
+	return h.parse
+}
+
+// parseLine parses a line of a file, and infers its level if no parser parsed the file.
+// If raw is true, the original line is kept in the parsed line.
+func (h *handler) parseLine(path string, data []byte, mem *parse.Memory, raw bool) *parse.Log {
+	line := h.parsers().Parse(path, data, mem)
+	if h.InferLevels && line.Level == "" && mem.Format() == "text" {
+		line.Level = parse.InferLevel(line.Msg)
+	}
+	if raw {
+		line.Raw = string(data)
+	}
+	return line
 }
 
 func (h *handler) read(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, re *regexp.Regexp) {
+	node = node.WithContext(ctx)
 	log := log.WithField("path", fmt.Sprintf("%s:%s", node.Name, path))
+	// content responses have the status of the file, so clients can tell an empty file from a missing one,
+	// or from a file that failed to open
+	content := re == nil
+	sendError := func(code string, err error) {
+		resp := sourceErrorResponse(req, node.Name, code, err)
+		if content {
+			resp = withFileStatus(resp)
+		}
+		send <- resp
+	}
 	stat, err := node.FS.Lstat(path)
 	if err != nil {
 		// the file might not exists in all filesystem, so just return without an error
+		switch {
+		case !content:
+		case os.IsNotExist(err):
+			send <- fileStatusResponse(req, node.Name, statusMissing, nil)
+		default:
+			log.WithError(err).Error("Failed stat")
+			sendError(codeStat, err)
+		}
 		return
 	}
 	if stat.IsDir() {
+		if content {
+			send <- fileStatusResponse(req, node.Name, statusMissing, fmt.Errorf("%s is a directory", path))
+		}
 		return
 	}
 
-	r, err := node.FS.Open(path)
+	r, err := filesystem.OpenText(node.FS, path)
 	if err != nil {
 		log.WithError(err).Error("Failed open")
+		sendError(codeOpen, err)
 		return
 	}
 	defer r.Close()
 
+	// content can be read from a byte offset of a line, the offsets of lines are returned in responses
+	var (
+		fromOffset = 0
+		lineNumber = 1
+	)
+	if re == nil && req.FromByteOffset > 0 {
+		if err := seekTo(r, req.FromByteOffset); err != nil {
+			log.WithError(err).Error("Failed seek")
+			sendError(codeRead, err)
+			return
+		}
+		fromOffset = int(req.FromByteOffset)
+		// line numbers are unknown without reading the file prefix, unless the client knows them
+		lineNumber = req.FromLine
+	}
+
 	var (
-		scanner      = bufio.NewScanner(r)
 		logLines     []parse.Log
 		lastRespTime = time.Now()
-		lineNumber   = 1
-		fileOffset   = 0
 		respMeta     = Meta{
 			ID:     req.Meta.ID,
 			Action: req.Meta.Action,
 			FS:     node.Name,
 			Path:   strings.Split(path, "/"),
 		}
-		sentAny      = false
 		parserMemory = new(parse.Memory)
+		matches      = 0
+		gaps         *gapDetector
+		// chunk numbers the content responses of the file, search responses are not numbered
+		chunk     = 0
+		nextChunk = func() int {
+			if re != nil {
+				return 0
+			}
+			chunk++
+			return chunk
+		}
+		newResponse = func(eof bool) *Response {
+			resp := &Response{Meta: respMeta, Lines: logLines, Chunk: nextChunk(), EOF: eof}
+			if re == nil && req.Compression == compressionDeflate {
+				h.compressLines(ctx, resp, path)
+			}
+			return resp
+		}
+		flush = func() {
+			send <- newResponse(false)
+			logLines = nil
+			lastRespTime = time.Now()
+		}
+		input io.Reader = r
 	)
 
+	// in follow mode, don't stop at the end of the file, wait for new lines to be written to it,
+	// and flush the pending lines when waiting
+	following := req.Follow && re == nil
+	if following {
+		input = &followReader{ctx: ctx, r: r, interval: followInterval, idle: func(quiet bool) {
+			if h.followFlush(len(logLines), time.Since(lastRespTime), quiet) {
+				flush()
+			}
+		}}
+	}
+	if re == nil {
+		gaps = h.gapDetector(req)
+	}
+	scanner, offsets := newLineScanner(input, fromOffset)
+
 	// set initial buffer size to 64kb and allow it to increase up to 1mb
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
@@ -446,18 +1249,17 @@ func (h *handler) read(ctx context.Context, send chan<- *Response, req Request,
 		if err := ctx.Err(); err != nil {
 			return
 		}
-		line := h.parse.Parse(path, scanner.Bytes(), parserMemory)
+		line := h.parseLine(path, scanner.Bytes(), parserMemory, req.IncludeRaw)
 
 		// if a search was defined, check for match and if no match was found continue
 		// without sending the line
-		if re != nil && !re.MatchString(line.Msg) {
+		if (re != nil && !matchFields(re, line)) || !req.matchLine(line) {
 			lineNumber += 1
-			fileOffset += len(scanner.Bytes())
 			continue
 		}
 
 		line.FileName = path
-		line.Offset = fileOffset
+		line.Offset = offsets.offset
 		line.FS = node.Name
 		line.Line = lineNumber
 
@@ -465,31 +1267,59 @@ func (h *handler) read(ctx context.Context, send chan<- *Response, req Request,
 			continue
 		}
 
+		if gap := gaps.check(line); gap != nil {
+			logLines = append(logLines, *gap)
+		}
+
+		// runs of identical lines are sent as a single line with a repeat count
+		if req.Collapse && collapse(logLines, line) {
+			lineNumber += 1
+			continue
+		}
+
+		// the search is done when enough lines matched in all the files
+		if re != nil && !req.matches.take() {
+			break
+		}
+
 		logLines = append(logLines, *line)
 		lineNumber += 1
-		fileOffset += len(scanner.Bytes())
+		matches++
 
 		// if we read lines more than the defined batch size or batch time,
-		// send them to the client and continue
-		if len(logLines) > h.ContentBatchSize || time.Now().Sub(lastRespTime) > h.ContentBatchTime {
-			sentAny = true
-			send <- &Response{Meta: respMeta, Lines: logLines}
-			logLines = nil
-			lastRespTime = time.Now()
+		// send them to the client and continue. Small batches of followed files wait for more lines.
+		if waited := time.Now().Sub(lastRespTime); len(logLines) > h.contentBatchSize(node) ||
+			(waited > h.ContentBatchTime && (!following || h.followFlush(len(logLines), waited, false))) {
+			flush()
 		}
 		// max search lines exceeded
-		if re != nil && len(logLines) > h.SearchMaxSize {
+		if re != nil && len(logLines) > h.searchMaxSize(node) {
 			return
 		}
+		// the file is done when enough lines matched in it, or in all the files
+		if re != nil && (matches == req.MaxMatchesPerFile || req.matches.reached()) {
+			break
+		}
 	}
 	if err := scanner.Err(); err != nil {
-		log.WithError(err).Errorf("Failed scan")
+		if ctx.Err() == nil {
+			log.WithError(err).Errorf("Failed scan")
+			sendError(codeRead, err)
+		}
 		return
 	}
-	if len(logLines) == 0 && (sentAny || re != nil) {
+	// the last content response is always sent, to mark the end of the file
+	if re != nil && len(logLines) == 0 {
 		return
 	}
-	send <- &Response{Meta: respMeta, Lines: logLines}
+	resp := newResponse(content)
+	if content {
+		resp.FileStatus = &FileStatus{FS: node.Name, Status: statusOK, Size: stat.Size()}
+		if stat.Size() == 0 {
+			resp.FileStatus.Status = statusEmpty
+		}
+	}
+	send <- resp
 
 }
 
@@ -501,8 +1331,18 @@ func sourceSet(sourceList []string) map[string]bool {
 	return sources
 }
 
+// hasTags returns true if a source has all the given tags
+func hasTags(src source.Source, tags map[string]string) bool {
+	for key, value := range tags {
+		if v, ok := src.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
 func filterSources(sources []source.Source, filterSources map[string]bool) []source.Source {
-	if len(filterSources) == 0 {
+	if filterSources == nil {
 		return sources
 	}
 	ret := make([]source.Source, 0, len(filterSources))
@@ -515,11 +1355,11 @@ func filterSources(sources []source.Source, filterSources map[string]bool) []sou
 }
 
 func filterOutTime(line *parse.Log, timeRange TimeRange) bool {
-	if start := timeRange.Start; start != nil {
-		return line.Time == nil || start.After(*line.Time)
+	if start := timeRange.Start; start != nil && (line.Time == nil || start.After(*line.Time)) {
+		return true
 	}
-	if end := timeRange.End; end != nil {
-		return line.Time == nil || end.Before(*line.Time)
+	if end := timeRange.End; end != nil && (line.Time == nil || end.Before(*line.Time)) {
+		return true
 	}
 	return false
 }
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/snapshot"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/store"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySources returns sources that are served from memory
+func memorySources() source.Sources {
+	return source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+			"var/log/syslog":   "start\nerror: disk full\nstop\n",
+			"var/log/app.log":  "app started\n",
+			"etc/logserver.cf": "not a log\n",
+		})},
+		{Name: "node2", FS: filesystem.NewMemory(map[string]string{
+			"var/log/syslog": "error: network down\n",
+		})},
+	}
+}
+
+// serveRequest serves a request and returns its responses, without the finished response
+func serveRequest(t *testing.T, h *handler, req Request) []*Response {
+	t.Helper()
+	require.Nil(t, req.Init(h.source))
+	h.compileTerms(&req)
+	var (
+		send  = make(chan *Response)
+		resps []*Response
+		done  = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range send {
+			if !resp.Finished {
+				resps = append(resps, resp)
+			}
+		}
+	}()
+	h.serve(context.Background(), req, send)
+	close(send)
+	<-done
+	return resps
+}
+
+func TestMemorySources(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}, Path: Path{"var", "log"}})
+	require.Len(t, resps, 1)
+	var keys []string
+	for _, f := range resps[0].Files {
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+	assert.Equal(t, []string{"var/log", "var/log/app.log", "var/log/syslog"}, keys)
+
+	resps = serveRequest(t, h, Request{Meta: Meta{Action: "get-content"}, Path: Path{"var", "log", "syslog"}, FilterSource: []string{"node1"}})
+	var msgs []string
+	for _, resp := range resps {
+		for _, l := range resp.Lines {
+			msgs = append(msgs, l.Msg)
+		}
+	}
+	assert.Equal(t, []string{"start", "error: disk full", "stop"}, msgs)
+
+	resps = serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "error"})
+	msgs = nil
+	for _, resp := range resps {
+		for _, l := range resp.Lines {
+			msgs = append(msgs, l.FS+": "+l.Msg)
+		}
+	}
+	sort.Strings(msgs)
+	assert.Equal(t, []string{"node1: error: disk full", "node2: error: network down"}, msgs)
+}
+
+func TestSearchArtifacts(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	snapshots := snapshot.New(snapshot.Config{}, store.NewMemory())
+	for _, title := range []string{"disk full on node1", "network is slow"} {
+		w := httptest.NewRecorder()
+		snapshots.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "`+title+`"}`)))
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+	h := newHandler(Config{Snapshots: snapshots}, memorySources(), parser, gcache.New(10).Build())
+
+	search := func(include bool) (artifacts []Artifact, lines int) {
+		for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "disk", IncludeArtifacts: include}) {
+			artifacts = append(artifacts, resp.Artifacts...)
+			lines += len(resp.Lines)
+		}
+		return
+	}
+
+	artifacts, lines := search(true)
+	assert.Equal(t, 1, lines)
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "snapshot", artifacts[0].Kind)
+	assert.Equal(t, "disk full on node1", artifacts[0].Title)
+
+	artifacts, lines = search(false)
+	assert.Equal(t, 1, lines)
+	assert.Empty(t, artifacts)
+}
+
+func TestSourceTags(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := memorySources()
+	sources[0].Tags = map[string]string{"role": "storage", "rack": "r1"}
+	sources[1].Tags = map[string]string{"role": "network", "rack": "r1"}
+	h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "get-sources"}})
+	require.Len(t, resps, 1)
+	require.Len(t, resps[0].Sources, 2)
+	assert.Equal(t, map[string]string{"role": "storage", "rack": "r1"}, resps[0].Sources[0].Tags)
+
+	searched := func(req Request) []string {
+		req.Meta = Meta{Action: "search"}
+		req.Regexp = "error"
+		var fss []string
+		for _, resp := range serveRequest(t, h, req) {
+			for _, l := range resp.Lines {
+				fss = append(fss, l.FS)
+			}
+		}
+		sort.Strings(fss)
+		return fss
+	}
+	assert.Equal(t, []string{"node1"}, searched(Request{FilterTags: map[string]string{"role": "storage"}}))
+	assert.Equal(t, []string{"node1", "node2"}, searched(Request{FilterTags: map[string]string{"rack": "r1"}}))
+	assert.Empty(t, searched(Request{FilterTags: map[string]string{"rack": "r1", "role": "compute"}}))
+	assert.Equal(t, []string{"node2"}, searched(Request{Query: "tag:role=network"}))
+	assert.NotNil(t, (&Request{Query: "tag:role"}).Init(sources))
+}
+
+func TestModifiedFilter(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	var (
+		now = time.Now()
+		fs  = filesystem.NewMemory(nil)
+	)
+	fs.WriteFile("old.log", []byte("error: old\n"), now.Add(-48*time.Hour))
+	fs.WriteFile("recent.log", []byte("error: recent\n"), now.Add(-time.Hour))
+	fs.WriteFile("new.log", []byte("error: new\n"), now)
+	h := newHandler(Config{}, source.Sources{{Name: "node1", FS: fs}}, parser, gcache.New(10).Build())
+
+	searched := func(req Request) []string {
+		req.Meta = Meta{Action: "search"}
+		req.Regexp = "error"
+		var msgs []string
+		for _, resp := range serveRequest(t, h, req) {
+			for _, l := range resp.Lines {
+				msgs = append(msgs, l.Msg)
+			}
+		}
+		sort.Strings(msgs)
+		return msgs
+	}
+	since, before := now.Add(-2*time.Hour), now.Add(-time.Minute)
+	assert.Equal(t, []string{"error: new", "error: recent"}, searched(Request{ModifiedSince: &since}))
+	assert.Equal(t, []string{"error: old", "error: recent"}, searched(Request{ModifiedBefore: &before}))
+	assert.Equal(t, []string{"error: recent"}, searched(Request{ModifiedSince: &since, ModifiedBefore: &before}))
+	assert.Equal(t, []string{"error: new", "error: recent"}, searched(Request{Query: "modified:1d"}))
+}
+
+func TestInferLevels(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+
+	searched := func(c Config) []string {
+		h := newHandler(c, memorySources(), parser, gcache.New(10).Build())
+		var msgs []string
+		for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, FilterLevel: []string{"error"}}) {
+			for _, l := range resp.Lines {
+				assert.Equal(t, parse.LevelError, l.Level)
+				msgs = append(msgs, l.Msg)
+			}
+		}
+		sort.Strings(msgs)
+		return msgs
+	}
+	assert.Empty(t, searched(Config{}))
+	assert.Equal(t, []string{"error: disk full", "error: network down"}, searched(Config{InferLevels: true}))
+}
+
+func TestIncludeRaw(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New([]parse.Config{{Glob: "*syslog", Regexp: `^(?P<level>\w+): (?P<msg>.*)$`}})
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+
+	content := func(raw bool) []parse.Log {
+		req := Request{Meta: Meta{Action: "get-content"}, Path: Path{"var", "log", "syslog"}, FilterSource: []string{"node2"}, IncludeRaw: raw}
+		var lines []parse.Log
+		for _, resp := range serveRequest(t, h, req) {
+			lines = append(lines, resp.Lines...)
+		}
+		return lines
+	}
+
+	lines := content(false)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "network down", lines[0].Msg)
+	assert.Equal(t, "", lines[0].Raw)
+
+	lines = content(true)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "network down", lines[0].Msg)
+	assert.Equal(t, "error", lines[0].Level)
+	assert.Equal(t, "error: network down", lines[0].Raw)
+}
+
+func TestSearchHardLinks(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "links")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "a"), 0755))
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "b"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a", "app.log"), []byte("error: disk full\n"), 0644))
+	require.Nil(t, os.Link(filepath.Join(dir, "a", "app.log"), filepath.Join(dir, "b", "app.log")))
+
+	fs, err := filesystem.NewLocal(&url.URL{Scheme: "file", Path: dir})
+	require.Nil(t, err)
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, source.Sources{{Name: "node1", FS: fs}}, parser, gcache.New(10).Build())
+
+	var files []string
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "error"}) {
+		for _, l := range resp.Lines {
+			files = append(files, l.FileName)
+		}
+	}
+	require.Len(t, files, 1)
+}
+
+func TestSearchPaths(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+			"var/log/syslog":     "error: disk full\n",
+			"var/log/app/1.log":  "error: app crashed\n",
+			"var/log/app/2.log":  "error: app hanged\n",
+			"var/lib/db/db.log":  "error: db locked\n",
+			"etc/logserver.conf": "error: not a log\n",
+		})},
+	}
+	h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+	search := func(req Request) []string {
+		var msgs []string
+		for _, resp := range serveRequest(t, h, req) {
+			for _, l := range resp.Lines {
+				msgs = append(msgs, l.Msg)
+			}
+		}
+		sort.Strings(msgs)
+		return msgs
+	}
+
+	// nested and repeated paths are searched once
+	paths := []Path{{"var", "log", "app"}, {"var", "lib"}, {"var", "log", "app", "1.log"}, {"var", "lib"}, {"var", "missing"}}
+	assert.Equal(t,
+		[]string{"error: app crashed", "error: app hanged", "error: db locked"},
+		search(Request{Meta: Meta{Action: "search"}, Regexp: "error", Paths: paths}))
+	assert.Equal(t,
+		[]string{"error: app crashed", "error: app hanged", "error: db locked"},
+		search(Request{Meta: Meta{Action: "search"}, Regexp: "error", Paths: paths, Ordered: true}))
+
+	// without paths, the path is searched
+	assert.Equal(t,
+		[]string{"error: app crashed", "error: app hanged", "error: disk full"},
+		search(Request{Meta: Meta{Action: "search"}, Regexp: "error", Path: Path{"var", "log"}}))
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+)
+
+// Codes of source errors
+const (
+	codeWalk       = "walk_failed"
+	codeOpen       = "open_failed"
+	codeRead       = "read_failed"
+	codeStat       = "stat_failed"
+	codeNotFound   = "not_found"
+	codePermission = "permission_denied"
+	codeTimeout    = "timeout"
+)
+
+// SourceError is an error of a single source in a request to multiple sources.
+// The results of a response with source errors are incomplete.
+type SourceError struct {
+	FS      string `json:"fs"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// newSourceError returns a source error. The code is derived from the error if possible,
+// otherwise the given code is used.
+func newSourceError(fs string, code string, err error) SourceError {
+	switch {
+	case os.IsNotExist(err):
+		code = codeNotFound
+	case os.IsPermission(err):
+		code = codePermission
+	case err == context.DeadlineExceeded:
+		code = codeTimeout
+	default:
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			code = codeTimeout
+		}
+	}
+	return SourceError{FS: fs, Code: code, Message: err.Error()}
+}
+
+// sourceErrorResponse returns a response that holds a single source error
+func sourceErrorResponse(req Request, fs string, code string, err error) *Response {
+	return &Response{
+		Meta:         Meta{ID: req.ID, Action: req.Action, FS: fs},
+		SourceErrors: []SourceError{newSourceError(fs, code, err)},
+	}
+}
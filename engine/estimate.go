@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+)
+
+// Estimate is the work that a search would do, without executing it
+type Estimate struct {
+	// Files is the number of files that would be searched, in all the sources
+	Files int `json:"files"`
+	// Bytes is the total size of the searched files
+	Bytes int64 `json:"bytes"`
+	// Sources are the estimates of each source that has files to search
+	Sources []SourceEstimate `json:"sources"`
+	// Cached is true if the estimate was computed from the cached file tree
+	Cached bool `json:"cached"`
+}
+
+// SourceEstimate is the work that a search would do in a single source
+type SourceEstimate struct {
+	FS    string `json:"fs"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// estimate responds with the number of files and bytes that a search request would scan.
+// The estimate is computed from the file tree of the request path, which is taken from the cache
+// if possible, so an estimate does not read any file. Since there is no search index, all the
+// matching files would be scanned.
+func (h *handler) estimate(ctx context.Context, req Request, send chan<- *Response) {
+	var (
+		cacheKey = treeCacheKey(filepath.Join(req.Path...))
+		tree     *Response
+		cached   bool
+	)
+	if val, err := h.cache.Get(cacheKey); err == nil {
+		tree, cached = val.(*Response), true
+	} else {
+		tree = h.loadTree(ctx, req)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	tree = h.treeWithLive(ctx, req, tree)
+	tree = tree.FilterSources(req.filterSourceMap)
+
+	var (
+		e         = &Estimate{Cached: cached}
+		perSource = make(map[string]*SourceEstimate)
+	)
+	for _, f := range tree.Files {
+		if f.IsDir || !req.matchPath(f.Key) {
+			continue
+		}
+		for _, instance := range f.Instances {
+			s := perSource[instance.FS]
+			if s == nil {
+				s = &SourceEstimate{FS: instance.FS}
+				perSource[instance.FS] = s
+			}
+			s.Files++
+			s.Bytes += instance.Size
+			e.Files++
+			e.Bytes += instance.Size
+		}
+	}
+	for _, s := range perSource {
+		e.Sources = append(e.Sources, *s)
+	}
+	sort.Slice(e.Sources, func(i, j int) bool { return e.Sources[i].FS < e.Sources[j].FS })
+
+	send <- &Response{Meta: req.Meta, Estimate: e, Partial: tree.Partial, SourceErrors: tree.SourceErrors}
+}
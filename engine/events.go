@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/Stratoscale/logserver/notify"
+)
+
+// Types of source events
+const (
+	eventSourceDown = "source.down"
+	eventSourceUp   = "source.up"
+)
+
+// SourceEvent is the data of an event of a source
+type SourceEvent struct {
+	FS    string `json:"fs"`
+	Error string `json:"error,omitempty"`
+}
+
+// startSubscription subscribes to events in the background, and returns a function that stops the subscription.
+// The done function is called when the subscription stopped.
+func (h *handler) startSubscription(ctx context.Context, req Request, send chan<- *Response, done func()) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer done()
+		h.subscribe(ctx, req, send)
+	}()
+	return cancel
+}
+
+// subscribe sends the events that match the request event globs, until the context is cancelled
+func (h *handler) subscribe(ctx context.Context, req Request, send chan<- *Response) {
+	defer func() { send <- &Response{Meta: req.Meta, Finished: true} }()
+	if h.Events == nil {
+		send <- &Response{Meta: req.Meta, Error: "Events are not available"}
+		return
+	}
+	sub, err := h.Events.Subscribe(req.Events)
+	if err != nil {
+		send <- &Response{Meta: req.Meta, Error: err.Error()}
+		return
+	}
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.C:
+			send <- &Response{Meta: req.Meta, Event: &e}
+		}
+	}
+}
+
+// health tracks which sources are down, according to the walks of their trees
+type health struct {
+	sync.Mutex
+	down map[string]bool
+}
+
+// updateHealth updates the state of a source according to the result of a walk of a path in it.
+// A source is down when the path could not be read, and up when it was read. A path that does not exist
+// in a source, or that the source has no permission to read, does not change its state.
+// An event is sent when a source goes down, or comes back up.
+func (h *handler) updateHealth(name string, err error) {
+	if h.Events == nil || os.IsNotExist(err) || os.IsPermission(err) {
+		return
+	}
+	h.health.Lock()
+	down, known := h.health.down[name]
+	h.health.down[name] = err != nil
+	h.health.Unlock()
+
+	switch {
+	case err != nil && !down:
+		log.WithError(err).Warnf("Source %s is down", name)
+		h.Events.Notify(notify.Event{Type: eventSourceDown, Data: SourceEvent{FS: name, Error: err.Error()}})
+	case err == nil && down && known:
+		log.Infof("Source %s is up", name)
+		h.Events.Notify(notify.Event{Type: eventSourceUp, Data: SourceEvent{FS: name}})
+	}
+}
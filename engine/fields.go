@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"regexp"
+
+	"github.com/Stratoscale/logserver/parse"
+)
+
+// matchFields matches a log message with a search regexp. The named capture groups
+// of the regexp are extracted to the fields of the line.
+func matchFields(re *regexp.Regexp, line *parse.Log) bool {
+	if re.NumSubexp() == 0 {
+		return re.MatchString(line.Msg)
+	}
+	match := re.FindStringSubmatch(line.Msg)
+	if match == nil {
+		return false
+	}
+	for i, name := range re.SubexpNames() {
+		if name == "" || i == 0 {
+			continue
+		}
+		if line.Fields == nil {
+			line.Fields = make(map[string]string)
+		}
+		line.Fields[name] = match[i]
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// followInterval is the interval for checking for new content in a followed file
+const followInterval = time.Second
+
+// followReader reads a file that is being written. Instead of returning EOF at the end
+// of the file, it waits for more content until the context is done.
+type followReader struct {
+	ctx      context.Context
+	r        io.Reader
+	interval time.Duration
+	// idle is called when all the current content of the file was read. It is quiet if the file did not grow
+	// since the previous call.
+	idle func(quiet bool)
+	// grew is true if content was read since the last call to idle
+	grew bool
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		if n > 0 {
+			f.grew = true
+			return n, nil
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		f.idle(!f.grew)
+		f.grew = false
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// followFlush returns true if the pending lines of a followed file should be sent. Without a minimal batch
+// size, any pending lines are sent. Otherwise, small batches are sent only when the file is quiet, or when
+// the lines waited the maximal delay, so frequent small writes don't produce a response each.
+func (h *handler) followFlush(pending int, waited time.Duration, quiet bool) bool {
+	if pending == 0 {
+		return false
+	}
+	if h.FollowMinBatchSize <= 0 {
+		return true
+	}
+	return pending >= h.FollowMinBatchSize || quiet || waited >= h.FollowMaxDelay
+}
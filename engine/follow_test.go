@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowFlush(t *testing.T) {
+	t.Parallel()
+
+	h := &handler{}
+	assert.False(t, h.followFlush(0, time.Hour, true))
+	assert.True(t, h.followFlush(1, 0, false))
+
+	h = &handler{Config: Config{FollowMinBatchSize: 100, FollowMaxDelay: 10 * time.Second}}
+	assert.False(t, h.followFlush(10, time.Second, false))
+	assert.True(t, h.followFlush(100, time.Second, false))
+	// small batches are sent when the file stopped growing, or when they waited too long
+	assert.True(t, h.followFlush(10, time.Second, true))
+	assert.True(t, h.followFlush(10, 10*time.Second, false))
+}
+
+func TestFollowReaderQuiet(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks := make(chan string, 1)
+	chunks <- "line 1\n"
+	var quiets []bool
+	f := &followReader{ctx: ctx, r: readerFunc(func(p []byte) (int, error) {
+		select {
+		case c := <-chunks:
+			return copy(p, c), nil
+		default:
+			return 0, io.EOF
+		}
+	}), interval: time.Millisecond, idle: func(quiet bool) {
+		quiets = append(quiets, quiet)
+		if len(quiets) == 2 {
+			cancel()
+		}
+	}}
+
+	p := make([]byte, 100)
+	n, err := f.Read(p)
+	require.Nil(t, err)
+	assert.Equal(t, "line 1\n", string(p[:n]))
+	_, err = f.Read(p)
+	assert.Equal(t, context.Canceled, err)
+	// the file grew before the first idle call, and was quiet before the second
+	assert.Equal(t, []bool{false, true}, quiets)
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
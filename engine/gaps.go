@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+)
+
+// gapDetector detects gaps between the times of consecutive lines, which may indicate that a node hang,
+// or that logs were lost in a rotation
+type gapDetector struct {
+	threshold time.Duration
+	last      *time.Time
+}
+
+// gapDetector returns the gap detector of a request, or nil if gaps are not marked
+func (h *handler) gapDetector(req Request) *gapDetector {
+	threshold := h.GapThreshold
+	if req.GapThreshold != 0 {
+		threshold = req.GapThreshold
+	}
+	if threshold <= 0 {
+		return nil
+	}
+	return &gapDetector{threshold: threshold}
+}
+
+// check returns a marker line if the time of a line is after the time of the previous line with a time by at
+// least the threshold. The marker has the time of the previous line, and the location of the line.
+// It is safe to call on a nil detector, which never returns a marker.
+func (g *gapDetector) check(line *parse.Log) *parse.Log {
+	if g == nil || line.Time == nil {
+		return nil
+	}
+	last := g.last
+	g.last = line.Time
+	if last == nil {
+		return nil
+	}
+	gap := line.Time.Sub(*last)
+	if gap < g.threshold {
+		return nil
+	}
+	return &parse.Log{
+		Msg:      fmt.Sprintf("gap: %s with no logs", humanDuration(gap)),
+		Time:     last,
+		FS:       line.FS,
+		FileName: line.FileName,
+		Line:     line.Line,
+		Offset:   line.Offset,
+		Gap:      gap,
+	}
+}
+
+// mark returns the lines with markers of the gaps between them. Markers between lines of different files
+// have no location. It is safe to call on a nil detector, which returns the lines as is.
+func (g *gapDetector) mark(lines []parse.Log) []parse.Log {
+	if g == nil {
+		return lines
+	}
+	marked := make([]parse.Log, 0, len(lines))
+	var prev *parse.Log
+	for i := range lines {
+		line := &lines[i]
+		if gap := g.check(line); gap != nil {
+			if prev == nil || prev.FS != line.FS || prev.FileName != line.FileName {
+				gap.FS, gap.FileName, gap.Line, gap.Offset = "", "", 0, 0
+			}
+			marked = append(marked, *gap)
+		}
+		if line.Time != nil {
+			prev = line
+		}
+		marked = append(marked, *line)
+	}
+	return marked
+}
+
+// humanDuration formats a duration in the largest units, like "14 minutes" or "2 hours 5 minutes"
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return plural(int(d/time.Second), "second")
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d%time.Hour < time.Minute:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d/time.Hour), "hour") + " " + plural(int(d%time.Hour/time.Minute), "minute")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
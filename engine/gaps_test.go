@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGaps(t *testing.T) {
+	t.Parallel()
+
+	var (
+		t0   = time.Date(2017, 12, 25, 16, 0, 0, 0, time.UTC)
+		at   = func(d time.Duration) *time.Time { t := t0.Add(d); return &t }
+		line = func(fs string, d time.Duration) parse.Log {
+			l := parse.Log{Msg: "line", FS: fs, FileName: "log", Line: int(d / time.Minute), Offset: int(d / time.Minute)}
+			if d >= 0 {
+				l.Time = at(d)
+			}
+			return l
+		}
+	)
+
+	h := &handler{Config: Config{GapThreshold: 10 * time.Minute}}
+	assert.Nil(t, h.gapDetector(Request{GapThreshold: -1}))
+	assert.Equal(t, time.Minute, h.gapDetector(Request{GapThreshold: time.Minute}).threshold)
+
+	g := h.gapDetector(Request{})
+	lines := g.mark([]parse.Log{
+		line("node1", 0),
+		line("node1", 5*time.Minute),
+		// lines without a time don't end a gap
+		line("node1", -1),
+		line("node1", 19*time.Minute),
+		line("node2", 31*time.Minute),
+	})
+	assert.Len(t, lines, 7)
+	gap := lines[3]
+	assert.Equal(t, "gap: 14 minutes with no logs", gap.Msg)
+	assert.Equal(t, 14*time.Minute, gap.Gap)
+	assert.Equal(t, at(5*time.Minute), gap.Time)
+	assert.Equal(t, "node1", gap.FS)
+	assert.Equal(t, 19, gap.Line)
+	// a gap between files has no location
+	gap = lines[5]
+	assert.Equal(t, "gap: 12 minutes with no logs", gap.Msg)
+	assert.Empty(t, gap.FS)
+	assert.Zero(t, gap.Offset)
+
+	// the detector continues across batches
+	l := line("node1", 3*time.Hour)
+	assert.Equal(t, "gap: 2 hours 29 minutes with no logs", g.check(&l).Msg)
+
+	var disabled *gapDetector
+	assert.Nil(t, disabled.check(&l))
+	assert.Len(t, disabled.mark(lines), 7)
+}
+
+func TestHumanDuration(t *testing.T) {
+	t.Parallel()
+
+	for d, want := range map[time.Duration]string{
+		45 * time.Second:              "45 seconds",
+		time.Minute + time.Second:     "1 minute",
+		14 * time.Minute:              "14 minutes",
+		time.Hour:                     "1 hour",
+		2*time.Hour + 30*time.Second:  "2 hours",
+		26*time.Hour + 5*time.Minute:  "26 hours 5 minutes",
+		time.Hour + time.Minute + 1e9: "1 hour 1 minute",
+	} {
+		assert.Equal(t, want, humanDuration(d), d.String())
+	}
+}
@@ -0,0 +1,335 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// grafanaMaxLines is the number of lines that are returned in a table or as annotations
+	grafanaMaxLines = 1000
+	// grafanaMaxPoints is the number of data points of a time series, when Grafana does not limit them
+	grafanaMaxPoints = 1000
+)
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	// Type is "timeserie" or "table"
+	Type string `json:"type"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int64           `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange           `json:"range"`
+	Annotation map[string]interface{} `json:"annotation"`
+}
+
+type grafanaSeries struct {
+	Target string `json:"target"`
+	// Datapoints are pairs of a count of lines and a time in milliseconds
+	Datapoints [][2]int64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type,omitempty"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaAnnotation struct {
+	Annotation map[string]interface{} `json:"annotation"`
+	Time       int64                  `json:"time"`
+	Title      string                 `json:"title"`
+	Text       string                 `json:"text"`
+	Tags       []string               `json:"tags"`
+}
+
+var grafanaColumns = []grafanaColumn{
+	{Text: "Time", Type: "time"},
+	{Text: "Source", Type: "string"},
+	{Text: "Path", Type: "string"},
+	{Text: "Level", Type: "string"},
+	{Text: "Message", Type: "string"},
+}
+
+// NewGrafana returns an HTTP handler that implements the API of a Grafana SimpleJSON datasource.
+// A target of a query is a name of a preset or a search query, see applyQuery. Time series count the lines that
+// match a target in each interval of the range, and tables and annotations list the matching lines.
+func NewGrafana(c Config, source source.Sources, parser parse.Parse, cache gcache.Cache) http.Handler {
+	// the tree is prefetched, and the health of sources is tracked, by the websocket handler
+	c.Prefetch = false
+	c.Events = nil
+	return &grafana{h: newHandler(c, source, parser, cache)}
+}
+
+type grafana struct {
+	h *handler
+}
+
+func (g *grafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == "" {
+		// the datasource connection test
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	if path != "/search" {
+		release, err := g.h.Admission.Admit(ctx)
+		if err != nil {
+			if busy, ok := err.(errBusy); ok {
+				w.Header().Set("Retry-After", fmt.Sprint(int(busy.retryAfter.Seconds())))
+			}
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+	}
+	if g.h.SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.h.SearchTimeout)
+		defer cancel()
+	}
+
+	switch path {
+	case "/search":
+		writeGrafana(w, g.metrics(), nil)
+	case "/query":
+		var q grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, fmt.Sprintf("bad query: %s", err), http.StatusBadRequest)
+			return
+		}
+		resp, err := g.query(ctx, q)
+		writeGrafana(w, resp, err)
+	case "/annotations":
+		var q grafanaAnnotationQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, fmt.Sprintf("bad query: %s", err), http.StatusBadRequest)
+			return
+		}
+		resp, err := g.annotations(ctx, q)
+		writeGrafana(w, resp, err)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// metrics returns the suggested targets: the presets, and filters of each source and group
+func (g *grafana) metrics() []string {
+	var (
+		metrics []string
+		groups  = make(map[string]bool)
+		tags    = make(map[string]bool)
+	)
+	for _, p := range g.h.Presets {
+		metrics = append(metrics, p.Name)
+	}
+	sources, release := g.h.acquire()
+	defer release()
+	for _, src := range sources {
+		metrics = append(metrics, "fs:"+src.Name)
+		for _, group := range src.Groups {
+			groups[group] = true
+		}
+		for key, value := range src.Tags {
+			tags[key+"="+value] = true
+		}
+	}
+	for group := range groups {
+		metrics = append(metrics, "group:"+group)
+	}
+	for tag := range tags {
+		metrics = append(metrics, "tag:"+tag)
+	}
+	sort.Strings(metrics[len(g.h.Presets):])
+	return metrics
+}
+
+func (g *grafana) query(ctx context.Context, q grafanaQuery) ([]interface{}, error) {
+	interval := time.Duration(q.IntervalMs) * time.Millisecond
+	maxPoints := q.MaxDataPoints
+	if maxPoints <= 0 {
+		maxPoints = grafanaMaxPoints
+	}
+	if span := q.Range.To.Sub(q.Range.From); interval < span/time.Duration(maxPoints) {
+		interval = span / time.Duration(maxPoints)
+	}
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+
+	resp := make([]interface{}, 0, len(q.Targets))
+	for _, t := range q.Targets {
+		if t.Type == "table" {
+			lines, err := g.search(ctx, t.Target, q.Range, grafanaMaxLines)
+			if err != nil {
+				return nil, err
+			}
+			resp = append(resp, linesTable(lines))
+			continue
+		}
+		lines, err := g.search(ctx, t.Target, q.Range, 0)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, countSeries(t.Target, lines, q.Range, interval))
+	}
+	return resp, nil
+}
+
+func (g *grafana) annotations(ctx context.Context, q grafanaAnnotationQuery) ([]grafanaAnnotation, error) {
+	query, _ := q.Annotation["query"].(string)
+	lines, err := g.search(ctx, query, q.Range, grafanaMaxLines)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make([]grafanaAnnotation, 0, len(lines))
+	for _, l := range lines {
+		tags := []string{l.FS}
+		if l.Level != "" {
+			tags = append(tags, l.Level)
+		}
+		annotations = append(annotations, grafanaAnnotation{
+			Annotation: q.Annotation,
+			Time:       l.Time.UnixNano() / int64(time.Millisecond),
+			Title:      l.FS + ":" + l.FileName,
+			Text:       l.Msg,
+			Tags:       tags,
+		})
+	}
+	return annotations, nil
+}
+
+// search returns the lines that match a target in a time range, up to max lines if it is positive
+func (g *grafana) search(ctx context.Context, target string, tr grafanaRange, max int) ([]parse.Log, error) {
+	req := Request{
+		Meta:            Meta{Action: "search"},
+		Query:           target,
+		FilterTime:      TimeRange{Start: &tr.From, End: &tr.To},
+		MaxTotalMatches: max,
+	}
+	for _, p := range g.h.Presets {
+		if p.Name == target {
+			req.Query = ""
+			req.Regexp, req.Path, req.FilterSource, req.FilterGroup = p.Regexp, p.Path, p.FilterSource, p.FilterGroup
+			req.FilterTags = p.FilterTags
+			break
+		}
+	}
+	var release func()
+	req.sources, release = g.h.acquire()
+	defer release()
+	if err := req.Init(g.h.sources(req)); err != nil {
+		return nil, err
+	}
+	g.h.compileTerms(&req)
+	if err := g.h.authorize(ctx, &req); err != nil {
+		return nil, err
+	}
+
+	var (
+		lines []parse.Log
+		errs  []string
+		ch    = make(chan *Response)
+		done  = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range ch {
+			lines = append(lines, resp.Lines...)
+			if resp.Error != "" {
+				errs = append(errs, resp.Error)
+			}
+		}
+	}()
+	g.h.search(ctx, req, ch)
+	close(ch)
+	<-done
+
+	switch {
+	case len(errs) > 0:
+		return nil, fmt.Errorf("%s", strings.Join(errs, ", "))
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("search of %s: %s", target, ctx.Err())
+	}
+	if max > 0 && len(lines) > max {
+		lines = lines[:max]
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return traceLess(&lines[i], &lines[j]) })
+	return lines, nil
+}
+
+// countSeries counts the lines in each interval of a time range
+func countSeries(target string, lines []parse.Log, tr grafanaRange, interval time.Duration) grafanaSeries {
+	var (
+		start  = tr.From.Truncate(interval)
+		counts = make([]int64, tr.To.Sub(start)/interval+1)
+	)
+	for _, l := range lines {
+		if i := int(l.Time.Sub(start) / interval); i >= 0 && i < len(counts) {
+			counts[i]++
+		}
+	}
+	s := grafanaSeries{Target: target, Datapoints: make([][2]int64, len(counts))}
+	for i, count := range counts {
+		t := start.Add(time.Duration(i) * interval)
+		s.Datapoints[i] = [2]int64{count, t.UnixNano() / int64(time.Millisecond)}
+	}
+	return s
+}
+
+// linesTable returns the lines as a table
+func linesTable(lines []parse.Log) grafanaTable {
+	t := grafanaTable{Type: "table", Columns: grafanaColumns, Rows: make([][]interface{}, 0, len(lines))}
+	for _, l := range lines {
+		t.Rows = append(t.Rows, []interface{}{l.Time.UnixNano() / int64(time.Millisecond), l.FS, l.FileName, l.Level, l.Msg})
+	}
+	return t
+}
+
+func writeGrafana(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		code := http.StatusBadRequest
+		if _, ok := err.(errForbidden); ok {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Failed writing grafana response")
+	}
+}
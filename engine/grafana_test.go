@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrafanaAdmission(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	a := NewAdmission(AdmissionConfig{MaxConcurrent: 1, MaxQueued: 1, QueueTimeout: time.Minute, RetryAfter: 2 * time.Second})
+	g := NewGrafana(Config{Admission: a}, memorySources(), parser, gcache.New(10).Build())
+	release, err := a.Admit(context.Background())
+	require.Nil(t, err)
+	defer release()
+
+	query := func(ctx context.Context) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"targets": [{"target": "error"}]}`))
+		g.ServeHTTP(w, r.WithContext(ctx))
+		return w
+	}
+
+	// a query that left the queue before it was admitted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := query(ctx)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), context.Canceled.Error())
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	// a query that was rejected since the queue is full
+	queued := make(chan struct{})
+	go func() {
+		defer close(queued)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		query(ctx)
+	}()
+	eventually(t, func() bool {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		return a.queued == 1
+	})
+	w = query(context.Background())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	<-queued
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// gzipSizesCacheSize is the number of gzip files whose uncompressed sizes are cached
+	gzipSizesCacheSize = 10000
+	gzipExt            = ".gz"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipSizes caches the uncompressed sizes of gzip files, so they are read once for each version of a file
+type gzipSizes struct {
+	sync.Mutex
+	cache gcache.Cache
+	// unseekable are the sources whose files can't be seeked, like nginx sources, their gzip files are not
+	// read for their sizes, since that requires reading them entirely
+	unseekable map[string]bool
+}
+
+type gzipSizeKey struct {
+	fs, path string
+	size     int64
+	modTime  time.Time
+}
+
+func newGzipSizes() gzipSizes {
+	return gzipSizes{cache: gcache.New(gzipSizesCacheSize).LRU().Build(), unseekable: make(map[string]bool)}
+}
+
+// uncompressedSize returns an estimate of the uncompressed size of a gzip file, or zero if it is not a gzip file
+// or its size could not be read. The size is read from the trailer of the file, which has the size of the last
+// member of the file modulo 4GiB, so the estimate is wrong for files with multiple members, and for files of
+// more than 4GiB, whose size is assumed to be the smallest that is larger than the compressed size.
+func (h *handler) uncompressedSize(src source.Source, path string, stat os.FileInfo) int64 {
+	if stat.IsDir() || !strings.HasSuffix(path, gzipExt) {
+		return 0
+	}
+	key := gzipSizeKey{fs: src.Name, path: path, size: stat.Size(), modTime: stat.ModTime()}
+	if size, err := h.gzipSizes.cache.Get(key); err == nil {
+		return size.(int64)
+	}
+	h.gzipSizes.Lock()
+	unseekable := h.gzipSizes.unseekable[src.Name]
+	h.gzipSizes.Unlock()
+	if unseekable {
+		return 0
+	}
+
+	size, seekable := readGzipSize(src, path, stat.Size())
+	if !seekable {
+		log.Debugf("Files of %s can't be seeked, not reading sizes of gzip files", src.Name)
+		h.gzipSizes.Lock()
+		h.gzipSizes.unseekable[src.Name] = true
+		h.gzipSizes.Unlock()
+		return 0
+	}
+	h.gzipSizes.cache.Set(key, size)
+	return size
+}
+
+// readGzipSize reads the uncompressed size from the trailer of a gzip file. It returns false if the file
+// can't be seeked.
+func readGzipSize(src source.Source, path string, compressed int64) (int64, bool) {
+	f, err := src.FS.Open(path)
+	if err != nil {
+		return 0, true
+	}
+	defer f.Close()
+	var (
+		magic   = make([]byte, len(gzipMagic))
+		trailer = make([]byte, 4)
+	)
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != string(gzipMagic) {
+		return 0, true
+	}
+	if _, err := f.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+		return 0, false
+	}
+	if _, err := io.ReadFull(f, trailer); err != nil {
+		return 0, true
+	}
+	size := int64(binary.LittleEndian.Uint32(trailer))
+	for size < compressed {
+		size += 1 << 32
+	}
+	return size, true
+}
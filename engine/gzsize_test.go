@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUncompressedSize(t *testing.T) {
+	t.Parallel()
+
+	var (
+		content = strings.Repeat("a repetitive log line\n", 1000)
+		buf     bytes.Buffer
+	)
+	z := gzip.NewWriter(&buf)
+	z.Write([]byte(content))
+	require.Nil(t, z.Close())
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := source.Sources{{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+		"app.log.gz":  buf.String(),
+		"fake.log.gz": "not gzip",
+		"app.log":     content,
+	})}}
+	h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+	sizes := make(map[string]FileInstance)
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}}) {
+		for _, f := range resp.Files {
+			require.Len(t, f.Instances, 1)
+			sizes[f.Key] = f.Instances[0]
+		}
+	}
+	assert.Equal(t, FileInstance{FS: "node1", Size: int64(buf.Len()), UncompressedSize: int64(len(content))}, sizes["app.log.gz"])
+	assert.Equal(t, FileInstance{FS: "node1", Size: 8}, sizes["fake.log.gz"])
+	assert.Equal(t, FileInstance{FS: "node1", Size: int64(len(content))}, sizes["app.log"])
+	// the sizes are read once for each version of a file
+	assert.Equal(t, 2, h.gzipSizes.cache.Len())
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/source"
+)
+
+// latencyWeight is the weight of a new measurement in the moving average of the source latency
+const latencyWeight = 0.3
+
+// latencies holds a moving average of the search duration of each source
+type latencies struct {
+	sync.Mutex
+	m map[string]time.Duration
+}
+
+func (l *latencies) add(name string, d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if prev, ok := l.m[name]; ok {
+		d = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(prev))
+	}
+	l.m[name] = d
+}
+
+func (l *latencies) get(name string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return l.m[name]
+}
+
+// byLatency returns the sources sorted from the fastest to the slowest.
+// Sources that were not measured yet are considered fast.
+func (l *latencies) byLatency(sources source.Sources) source.Sources {
+	sorted := make(source.Sources, len(sources))
+	copy(sorted, sources)
+	l.Lock()
+	defer l.Unlock()
+	sort.SliceStable(sorted, func(i, j int) bool { return l.m[sorted[i].Name] < l.m[sorted[j].Name] })
+	return sorted
+}
+
+// stragglers tracks the sources of a search. After the first source finished, the other sources
+// are considered late, and if a cutoff is configured, they are cancelled when it passes.
+type stragglers struct {
+	cutoff    time.Duration
+	once      sync.Once
+	firstDone chan struct{}
+}
+
+func newStragglers(cutoff time.Duration) *stragglers {
+	return &stragglers{cutoff: cutoff, firstDone: make(chan struct{})}
+}
+
+// done marks a source as finished
+func (s *stragglers) done() {
+	s.once.Do(func() { close(s.firstDone) })
+}
+
+// late returns true if any of the sources already finished
+func (s *stragglers) late() bool {
+	select {
+	case <-s.firstDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// context returns a context of a source search, which is cancelled when the cutoff
+// passed after the first source finished.
+func (s *stragglers) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if s.cutoff <= 0 {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.firstDone:
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.cutoff):
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkLimits(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	files := map[string]string{
+		"a.log":         "error a\n",
+		"dir/b.log":     "error b\n",
+		"dir/sub/c.log": "error c\n",
+	}
+
+	tests := []struct {
+		name        string
+		limits      source.Limits
+		wantKeys    []string
+		wantLines   int
+		wantPartial bool
+	}{
+		{
+			name:      "no limits",
+			wantKeys:  []string{"a.log", "dir", "dir/b.log", "dir/sub", "dir/sub/c.log"},
+			wantLines: 3,
+		},
+		{
+			name:        "max depth",
+			limits:      source.Limits{MaxDepth: 1},
+			wantKeys:    []string{"a.log", "dir"},
+			wantLines:   1,
+			wantPartial: true,
+		},
+		{
+			name:        "max files",
+			limits:      source.Limits{MaxFiles: 3},
+			wantKeys:    []string{"a.log", "dir", "dir/b.log"},
+			wantLines:   2,
+			wantPartial: true,
+		},
+		{
+			name:        "walk timeout",
+			limits:      source.Limits{WalkTimeout: time.Nanosecond},
+			wantPartial: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sources := source.Sources{{Name: "node1", FS: filesystem.NewMemory(files), Limits: tt.limits}}
+			h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+			resps := serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}})
+			require.Len(t, resps, 1)
+			var keys []string
+			for _, f := range resps[0].Files {
+				keys = append(keys, f.Key)
+			}
+			sort.Strings(keys)
+			assert.Equal(t, tt.wantKeys, keys)
+			assert.Equal(t, tt.wantPartial, resps[0].Partial)
+
+			// a search with a partial walk sends a partial response of the source
+			var (
+				lines   int
+				partial bool
+			)
+			for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "error"}) {
+				lines += len(resp.Lines)
+				partial = partial || resp.Partial
+			}
+			assert.Equal(t, tt.wantLines, lines)
+			assert.Equal(t, tt.wantPartial, partial)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Stratoscale/logserver/source"
+)
+
+// locate responds with the instances of a single path in all the sources, with their sizes and
+// modification times. Only the path itself is checked in each source, no directory is walked.
+func (h *handler) locate(ctx context.Context, req Request, send chan<- *Response) {
+	var (
+		c       = newCombiner()
+		wg      sync.WaitGroup
+		sources = filterSources(h.sources(req), req.filterSourceMap)
+		key     = strings.Join(req.Path, string(os.PathSeparator))
+	)
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			src = src.WithContext(ctx)
+			stat, err := src.FS.Lstat(src.FS.Join(req.Path...))
+			switch {
+			case os.IsNotExist(err):
+			case err != nil:
+				c.addError(newSourceError(src.Name, codeStat, err))
+			default:
+				instance := FileInstance{Size: stat.Size(), FS: src.Name}
+				// some filesystems don't report modification times
+				if mtime := stat.ModTime(); !mtime.IsZero() {
+					instance.ModTime = &mtime
+				}
+				c.add(File{Key: key, Path: req.Path, IsDir: stat.IsDir()}, instance)
+			}
+		}(src)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	for _, f := range c.files {
+		sort.Slice(f.Instances, func(i, j int) bool { return f.Instances[i].FS < f.Instances[j].FS })
+	}
+	send <- &Response{Meta: req.Meta, Files: c.files, SourceErrors: c.errors}
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/kr/fs"
+)
+
+// manifestPeekLines is the number of lines that are read from each side of a file
+// to find the time range of the file
+const manifestPeekLines = 20
+
+// Manifest describes all the files of a set of sources, like the sources of a bundle
+// in dynamic mode, so clients can show what the bundle covers without walking it
+type Manifest struct {
+	Created time.Time      `json:"created"`
+	Files   []ManifestFile `json:"files"`
+	// Start and End are the time range of all the files
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+	// Partial is set when not all the files were walked due to source limits
+	Partial bool `json:"partial,omitempty"`
+}
+
+// ManifestFile describes a file in a source
+type ManifestFile struct {
+	FS   string `json:"fs"`
+	Path Path   `json:"path"`
+	Size int64  `json:"size"`
+	// Format is the format of the file that was detected by the parsers
+	Format string `json:"format"`
+	// Start and End are the times of the first and last lines of the file that have a time
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// BuildManifest walks all the sources, and describes each of their files with the time range of its lines,
+// which is taken from the first and last lines of the file
+func BuildManifest(ctx context.Context, c Config, sources source.Sources, parser parse.Parse, cache gcache.Cache) *Manifest {
+	c.Prefetch = false
+	var (
+		h    = New(c, sources, parser, cache).(*handler)
+		m    = &Manifest{Created: time.Now()}
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			files, partial := h.manifestSource(ctx, src)
+			lock.Lock()
+			defer lock.Unlock()
+			m.Files = append(m.Files, files...)
+			m.Partial = m.Partial || partial
+		}(src)
+	}
+	wg.Wait()
+
+	for _, f := range m.Files {
+		if f.Start != nil && (m.Start == nil || f.Start.Before(*m.Start)) {
+			m.Start = f.Start
+		}
+		if f.End != nil && (m.End == nil || f.End.After(*m.End)) {
+			m.End = f.End
+		}
+	}
+	return m
+}
+
+func (h *handler) manifestSource(ctx context.Context, src source.Source) ([]ManifestFile, bool) {
+	const sep = string(os.PathSeparator)
+	var files []ManifestFile
+	partial, err := h.recurseTree(ctx, src.FS.Join(), src, func(walker *fs.Walker) {
+		if walker.Stat().IsDir() {
+			return
+		}
+		f := ManifestFile{
+			FS:   src.Name,
+			Path: strings.Split(strings.Trim(walker.Path(), sep), sep),
+			Size: walker.Stat().Size(),
+		}
+		p, _, err := h.peekFile(ctx, src, walker.Path(), manifestPeekLines, false)
+		if err != nil || p == nil {
+			return
+		}
+		f.Format = p.format
+		f.Start = firstTime(p.head)
+		if f.End = lastTime(p.tail); f.End == nil {
+			f.End = lastTime(p.head)
+		}
+		files = append(files, f)
+	})
+	if err != nil {
+		log.WithError(err).Warnf("Failed walking %s for a manifest", src.Name)
+	}
+	return files, partial || err != nil
+}
+
+func firstTime(lines []parse.Log) *time.Time {
+	for _, l := range lines {
+		if l.Time != nil {
+			return l.Time
+		}
+	}
+	return nil
+}
+
+func lastTime(lines []parse.Log) *time.Time {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Time != nil {
+			return lines[i].Time
+		}
+	}
+	return nil
+}
+
+// serveManifest responds with the manifest of the sources, if it was built
+func (h *handler) serveManifest(ctx context.Context, req Request, send chan<- *Response) {
+	if h.Manifest == nil {
+		send <- &Response{Meta: req.Meta, Error: "Manifests are available only for bundles in dynamic mode"}
+		return
+	}
+	m := h.Manifest()
+	if m == nil {
+		send <- &Response{Meta: req.Meta, Error: "Manifest is not ready yet"}
+		return
+	}
+	if req.filterSourceMap != nil {
+		filtered := *m
+		filtered.Files = nil
+		for _, f := range m.Files {
+			if req.filterSourceMap[f.FS] {
+				filtered.Files = append(filtered.Files, f)
+			}
+		}
+		m = &filtered
+	}
+	send <- &Response{Meta: req.Meta, Manifest: m}
+}
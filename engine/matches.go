@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// matchLimit counts the matches of all the files in a search, and stops
+// the search when the max_total_matches of the request is reached
+type matchLimit struct {
+	max    int64
+	n      int64
+	cancel context.CancelFunc
+}
+
+// take counts a match, and returns false if the limit was already reached. The search
+// is cancelled when the last allowed match is taken, the file that took it should send
+// its pending matches and stop.
+func (m *matchLimit) take() bool {
+	if m == nil {
+		return true
+	}
+	n := atomic.AddInt64(&m.n, 1)
+	if n == m.max {
+		m.cancel()
+	}
+	return n <= m.max
+}
+
+// reached returns true if the search was stopped since the limit was reached
+func (m *matchLimit) reached() bool {
+	return m != nil && atomic.LoadInt64(&m.n) >= m.max
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sortNatural returns the files of a tree sorted by the natural order of their paths, without changing the
+// order of the given files, which might be cached
+func sortNatural(files []*File) []*File {
+	sorted := append([]*File(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return pathLess(sorted[i].Path, sorted[j].Path) })
+	return sorted
+}
+
+// pathLess compares paths by their elements in natural order, so the files of a directory follow it
+func pathLess(a, b Path) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := naturalCompare(a[i], b[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(a) < len(b)
+}
+
+// naturalCompare compares names in natural order: runs of digits are compared by their numeric value, so
+// app.log.2 is before app.log.10, and other characters are compared case insensitively. Names that are equal
+// in natural order, like app.log and App.log, are compared by their bytes.
+func naturalCompare(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		if isDigit(x[0]) && isDigit(y[0]) {
+			dx, dy := digitsPrefix(x), digitsPrefix(y)
+			if c := compareNumbers(dx, dy); c != 0 {
+				return c
+			}
+			x, y = x[len(dx):], y[len(dy):]
+			continue
+		}
+		rx, nx := utf8.DecodeRuneInString(x)
+		ry, ny := utf8.DecodeRuneInString(y)
+		if fx, fy := unicode.ToLower(rx), unicode.ToLower(ry); fx != fy {
+			if fx < fy {
+				return -1
+			}
+			return 1
+		}
+		x, y = x[nx:], y[ny:]
+	}
+	switch {
+	case x != "":
+		return 1
+	case y != "":
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitsPrefix returns the run of digits at the start of a string
+func digitsPrefix(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// compareNumbers compares runs of digits by their numeric value, without parsing them, so they can be longer than
+// an integer. Numbers with the same value and more leading zeros, like 007 and 7, are after the shorter ones.
+func compareNumbers(a, b string) int {
+	ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	switch {
+	case len(ta) != len(tb):
+		if len(ta) < len(tb) {
+			return -1
+		}
+		return 1
+	case ta != tb:
+		return strings.Compare(ta, tb)
+	case len(a) != len(b):
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"app.log.10", "App.log", "app.log.2", "app.log", "app.log.1", "b", "app.log.02", "app.log.9999999999999999999999", "ä"}
+	sort.Slice(names, func(i, j int) bool { return naturalCompare(names[i], names[j]) < 0 })
+	assert.Equal(t, []string{"App.log", "app.log", "app.log.1", "app.log.2", "app.log.02", "app.log.10", "app.log.9999999999999999999999", "b", "ä"}, names)
+}
+
+func TestNaturalSort(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+			"log/app.log.10":   "",
+			"log/app.log.2":    "",
+			"log/app.log":      "",
+			"log/10/a.log":     "",
+			"log/9/a.log":      "",
+			"log/app.log.1.gz": "",
+		})},
+	}
+
+	keys := func(h *handler, req Request) []string {
+		resps := serveRequest(t, h, req)
+		require.Len(t, resps, 1)
+		var keys []string
+		for _, f := range resps[0].Files {
+			keys = append(keys, f.Key)
+		}
+		return keys
+	}
+	want := []string{"log", "log/9", "log/9/a.log", "log/10", "log/10/a.log", "log/app.log", "log/app.log.1.gz", "log/app.log.2", "log/app.log.10"}
+
+	h := newHandler(Config{NaturalSort: true}, sources, parser, gcache.New(10).Build())
+	assert.Equal(t, want, keys(h, Request{Meta: Meta{Action: "get-file-tree"}, Path: Path{"log"}}))
+
+	// without the server option, the client can ask for the natural order
+	h = newHandler(Config{}, sources, parser, gcache.New(10).Build())
+	assert.Equal(t, want, keys(h, Request{Meta: Meta{Action: "get-file-tree"}, Path: Path{"log"}, NaturalSort: true}))
+}
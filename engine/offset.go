@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+)
+
+// lineOffsets is a split function of a scanner that splits lines, and tracks the byte offset of
+// each line in the file, including the line endings that the scanner strips, both \n and \r\n
+type lineOffsets struct {
+	// offset is the byte offset of the last scanned line
+	offset int
+	// ending is the line ending of the last scanned line, which is empty for a last line without one
+	ending string
+	next   int
+}
+
+func (l *lineOffsets) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if token != nil {
+		l.offset = l.next
+		l.ending = string(data[len(token):advance])
+	}
+	l.next += advance
+	return advance, token, err
+}
+
+// newLineScanner returns a scanner of the lines of a reader that starts at a byte offset of a file
+func newLineScanner(r io.Reader, offset int) (*bufio.Scanner, *lineOffsets) {
+	var (
+		scanner = bufio.NewScanner(r)
+		lines   = &lineOffsets{offset: offset, next: offset}
+	)
+	scanner.Split(lines.split)
+	return scanner, lines
+}
+
+// seekTo moves a file to a byte offset, by seeking if possible, or by reading up to the offset
+func seekTo(f io.ReadSeeker, offset int64) error {
+	if off, err := f.Seek(offset, io.SeekStart); err == nil && off == offset {
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, f, offset)
+	return err
+}
+
+// atLineStart returns true if a byte offset of a file is the start of a line: the start of the file, or the
+// byte after a line ending. The file is moved to the offset.
+func atLineStart(f io.ReadSeeker, offset int64) (bool, error) {
+	if offset == 0 {
+		return true, nil
+	}
+	if err := seekTo(f, offset-1); err != nil {
+		return false, err
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false, err
+	}
+	return b[0] == '\n', nil
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+)
+
+// orderedParallelism is the number of sources that are searched concurrently in an ordered search
+const orderedParallelism = 2
+
+// searchOrdered searches the sources and responds with the matched lines ordered by their time.
+// The matches of each file are collected, and the files are merged with a heap, so lines of a
+// file keep their order, and lines without a time are sent after the line that preceded them in
+// their file. Gaps between the merged lines are marked. Since all the matches are collected before they are sent, fewer sources are searched
+// concurrently than in a regular search.
+func (h *handler) searchOrdered(ctx context.Context, req Request, send chan<- *Response, re *regexp.Regexp) {
+	var (
+		streams = make(map[string]*stream)
+		ch      = make(chan *Response)
+		done    = make(chan struct{})
+		slots   = make(chan struct{}, orderedParallelism)
+		wg      sync.WaitGroup
+	)
+	go func() {
+		defer close(done)
+		for resp := range ch {
+			for _, line := range resp.Lines {
+				key := line.FS + ":" + line.FileName
+				s := streams[key]
+				if s == nil {
+					s = new(stream)
+					streams[key] = s
+				}
+				s.lines = append(s.lines, line)
+			}
+			// errors and partial results are passed to the client, lines are sent after merging
+			if resp.Error != "" || resp.Partial || len(resp.SourceErrors) > 0 {
+				resp.Lines = nil
+				send <- resp
+			}
+		}
+	}()
+
+	nodes := filterSources(h.sources(req), req.filterSourceMap)
+	wg.Add(len(nodes))
+	for _, node := range nodes {
+		go func(node source.Source) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+			h.searchNode(ctx, ch, req, node, re)
+		}(node)
+	}
+	wg.Wait()
+	close(ch)
+	<-done
+
+	if ctx.Err() != nil && !req.matches.reached() {
+		return
+	}
+	gaps := h.gapDetector(req)
+	mergeStreams(streams, h.ContentBatchSize, func(lines []parse.Log) {
+		send <- &Response{Meta: req.Meta, Lines: gaps.mark(lines)}
+	})
+}
+
+// stream is the matched lines of a single file
+type stream struct {
+	lines []parse.Log
+	// last is the time of the last line that was taken from the stream
+	last time.Time
+}
+
+// time returns the time that orders the next line of the stream, lines without
+// a time are ordered by the time of the line before them
+func (s *stream) time() time.Time {
+	if t := s.lines[0].Time; t != nil {
+		return *t
+	}
+	return s.last
+}
+
+// streamHeap orders streams by the time of their next line
+type streamHeap []*stream
+
+func (h streamHeap) Len() int      { return len(h) }
+func (h streamHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h streamHeap) Less(i, j int) bool {
+	ti, tj := h[i].time(), h[j].time()
+	if !ti.Equal(tj) {
+		return ti.Before(tj)
+	}
+	a, b := &h[i].lines[0], &h[j].lines[0]
+	if a.FS != b.FS {
+		return a.FS < b.FS
+	}
+	return a.FileName < b.FileName
+}
+
+func (h *streamHeap) Push(x interface{}) { *h = append(*h, x.(*stream)) }
+
+func (h *streamHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// mergeStreams merges the lines of the streams by time, and passes them to send in batches
+func mergeStreams(streams map[string]*stream, batchSize int, send func([]parse.Log)) {
+	h := make(streamHeap, 0, len(streams))
+	for _, s := range streams {
+		h = append(h, s)
+	}
+	heap.Init(&h)
+
+	var batch []parse.Log
+	for h.Len() > 0 {
+		s := h[0]
+		line := s.lines[0]
+		s.lines = s.lines[1:]
+		if line.Time != nil {
+			s.last = *line.Time
+		}
+		if len(s.lines) > 0 {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+		batch = append(batch, line)
+		if len(batch) >= batchSize {
+			send(batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		send(batch)
+	}
+}
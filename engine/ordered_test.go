@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeStreams(t *testing.T) {
+	t.Parallel()
+
+	at := func(sec int) *time.Time {
+		t := time.Date(2018, 1, 1, 0, 0, sec, 0, time.UTC)
+		return &t
+	}
+	streams := map[string]*stream{
+		"a:1.log": {lines: []parse.Log{
+			{FS: "a", FileName: "1.log", Line: 1, Time: at(1)},
+			{FS: "a", FileName: "1.log", Line: 2},
+			{FS: "a", FileName: "1.log", Line: 3, Time: at(4)},
+		}},
+		"a:2.log": {lines: []parse.Log{
+			{FS: "a", FileName: "2.log", Line: 1, Time: at(2)},
+			{FS: "a", FileName: "2.log", Line: 2, Time: at(3)},
+		}},
+		"b:1.log": {lines: []parse.Log{
+			{FS: "b", FileName: "1.log", Line: 1, Time: at(1)},
+			{FS: "b", FileName: "1.log", Line: 2, Time: at(5)},
+		}},
+	}
+
+	var batches [][]string
+	mergeStreams(streams, 3, func(lines []parse.Log) {
+		var batch []string
+		for _, l := range lines {
+			batch = append(batch, fmt.Sprintf("%s:%s:%d", l.FS, l.FileName, l.Line))
+		}
+		batches = append(batches, batch)
+	})
+	assert.Equal(t, [][]string{
+		{"a:1.log:1", "a:1.log:2", "b:1.log:1"},
+		{"a:2.log:1", "a:2.log:2", "a:1.log:3"},
+		{"b:1.log:2"},
+	}, batches)
+}
@@ -0,0 +1,31 @@
+package engine
+
+import "github.com/Stratoscale/logserver/source"
+
+// contentBatchSize returns the number of lines in a content response of a file of a source
+func (h *handler) contentBatchSize(src source.Source) int {
+	if src.ContentBatchSize > 0 {
+		return src.ContentBatchSize
+	}
+	return h.ContentBatchSize
+}
+
+// searchMaxSize returns the maximal number of lines in a search response of a file of a source
+func (h *handler) searchMaxSize(src source.Source) int {
+	if src.SearchMaxSize > 0 {
+		return src.SearchMaxSize
+	}
+	return h.SearchMaxSize
+}
+
+// excludes returns the names of the directories and the extensions of the files that are not walked in a source
+func (h *handler) excludes(src source.Source) (dirs, extensions map[string]bool) {
+	dirs, extensions = h.excludeDirs, h.excludeExtensions
+	if src.ExcludeDirs != nil {
+		dirs = list2Map(src.ExcludeDirs)
+	}
+	if src.ExcludeExtensions != nil {
+		extensions = list2Map(src.ExcludeExtensions)
+	}
+	return dirs, extensions
+}
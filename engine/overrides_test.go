@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceOverrides(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	files := map[string]string{
+		"log/syslog":      "1\n2\n3\n4\n5\n",
+		"log/app.gz":      "",
+		"log/old/app.log": "",
+	}
+	sources := source.Sources{
+		{Name: "local", FS: filesystem.NewMemory(files)},
+		{Name: "slow", FS: filesystem.NewMemory(files), Overrides: source.Overrides{
+			ContentBatchSize:  1,
+			ExcludeDirs:       []string{},
+			ExcludeExtensions: []string{".log"},
+		}},
+	}
+	h := newHandler(Config{ExcludeDirs: []string{"old"}, ExcludeExtensions: []string{".gz"}}, sources, parser, gcache.New(10).Build())
+
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}, Path: Path{"log"}})
+	require.Len(t, resps, 1)
+	var paths []string
+	for _, f := range resps[0].Files {
+		for _, inst := range f.Instances {
+			paths = append(paths, inst.FS+":"+f.Key)
+		}
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{
+		"local:log", "local:log/syslog",
+		"slow:log", "slow:log/app.gz", "slow:log/old", "slow:log/syslog",
+	}, paths)
+
+	chunks := make(map[string]int)
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "get-content"}, Path: Path{"log", "syslog"}}) {
+		if len(resp.Lines) > 0 {
+			chunks[resp.FS]++
+		}
+	}
+	assert.Equal(t, map[string]int{"local": 1, "slow": 3}, chunks)
+}
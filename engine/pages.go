@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// pageToken is the position of a tree page. The total number of files detects a tree that changed between
+// the request that returned the token and the request that continues from it.
+type pageToken struct {
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+func (t pageToken) String() string {
+	b, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(token string) (pageToken, error) {
+	var t pageToken
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return t, fmt.Errorf("bad page token: %s", err)
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("bad page token: %s", err)
+	}
+	return t, nil
+}
+
+// sendTree sends a tree response. When the tree has more files than the tree page size, its files are sent in
+// pages, each page but the last with a continuation token of the next page. The tree is sent from the page of the
+// page token of the request, if given, so a client can continue an interrupted tree. The source errors and the
+// partial flag are sent on the first sent page.
+func (h *handler) sendTree(req Request, resp *Response, send chan<- *Response) {
+	size := h.TreePageSize
+	if size <= 0 || (len(resp.Files) <= size && req.PageToken == "") {
+		send <- resp
+		return
+	}
+	offset := 0
+	if req.PageToken != "" {
+		t, err := decodePageToken(req.PageToken)
+		if err != nil {
+			send <- &Response{Meta: req.Meta, Error: err.Error()}
+			return
+		}
+		if t.Total != len(resp.Files) || t.Offset > len(resp.Files) {
+			send <- &Response{Meta: req.Meta, Error: "the tree changed since the page token was returned, request it again"}
+			return
+		}
+		offset = t.Offset
+	}
+	for first := true; first || offset < len(resp.Files); first = false {
+		end := offset + size
+		if end > len(resp.Files) {
+			end = len(resp.Files)
+		}
+		page := &Response{Meta: resp.Meta, Files: resp.Files[offset:end]}
+		if first {
+			page.Partial, page.SourceErrors = resp.Partial, resp.SourceErrors
+		}
+		if end < len(resp.Files) {
+			page.NextPage = pageToken{Offset: end, Total: len(resp.Files)}.String()
+		}
+		send <- page
+		offset = end
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreePages(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	var (
+		single = newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+		paged  = newHandler(Config{TreePageSize: 2}, memorySources(), parser, gcache.New(10).Build())
+		tree   = func(h *handler, token string) []*Response {
+			return serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}, PageToken: token})
+		}
+	)
+	keys := func(resps []*Response) []string {
+		var keys []string
+		for _, resp := range resps {
+			for _, f := range resp.Files {
+				keys = append(keys, f.Key)
+			}
+		}
+		return keys
+	}
+
+	whole := tree(single, "")
+	require.Len(t, whole, 1)
+	require.Len(t, whole[0].Files, 6)
+
+	pages := tree(paged, "")
+	require.Len(t, pages, 3)
+	assert.ElementsMatch(t, keys(whole), keys(pages))
+	assert.Len(t, pages[0].Files, 2)
+	assert.NotEmpty(t, pages[0].NextPage)
+	assert.NotEmpty(t, pages[1].NextPage)
+	assert.Empty(t, pages[2].NextPage)
+
+	// a tree continues from a page token, the order of the files is kept while the tree is cached
+	rest := tree(paged, pages[0].NextPage)
+	require.Len(t, rest, 2)
+	assert.Equal(t, keys(pages[1:]), keys(rest))
+
+	resps := tree(paged, pageToken{Offset: 2, Total: 5}.String())
+	require.Len(t, resps, 1)
+	assert.Contains(t, resps[0].Error, "tree changed")
+	resps = tree(paged, "not a token")
+	require.Len(t, resps, 1)
+	assert.Contains(t, resps[0].Error, "bad page token")
+}
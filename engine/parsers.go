@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+
+	"github.com/Stratoscale/logserver/parse"
+)
+
+// maxParserExamples is the number of example files of each parser
+const maxParserExamples = 5
+
+// ParserInfo describes a parser and the files that it applies to
+type ParserInfo struct {
+	parse.Info
+	// Applies is set if the parser applies to the path of the request
+	Applies bool `json:"applies"`
+	// Examples are files of the cached tree that the parser applies to
+	Examples []string `json:"examples,omitempty"`
+}
+
+// serveParsers returns the parsers in the order in which they are tried on files. A file is handled by the
+// first parser that applies to it and parses its lines, or served as text if none of them parses them.
+func (h *handler) serveParsers(ctx context.Context, req Request, send chan<- *Response) {
+	var (
+		path    = filepath.Join(req.Path...)
+		files   = h.cachedFiles()
+		parsers = h.parsers()
+		infos   = make([]ParserInfo, 0, len(parsers))
+	)
+	for i, info := range parsers.Info() {
+		p := ParserInfo{Info: info, Applies: path != "" && parsers.AppliesAt(i, path)}
+		for _, name := range files {
+			if len(p.Examples) == maxParserExamples {
+				break
+			}
+			if parsers.AppliesAt(i, name) {
+				p.Examples = append(p.Examples, name)
+			}
+		}
+		infos = append(infos, p)
+	}
+	send <- &Response{Meta: req.Meta, Parsers: infos}
+}
+
+// cachedFiles returns the sorted paths of the files in the cached tree of all the sources,
+// or nothing if the tree is not cached
+func (h *handler) cachedFiles() []string {
+	val, err := h.cache.GetIFPresent(treeCacheKey(""))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, f := range val.(*Response).Files {
+		if !f.IsDir {
+			files = append(files, filepath.Join(f.Path...))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
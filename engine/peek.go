@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+)
+
+const (
+	defaultPeekLines = 5
+	// peekChunkSize is the size of the chunks that are read from the end of a file
+	// when looking for its last lines
+	peekChunkSize = 64 * 1024
+)
+
+// peek returns the first and last lines of a file in each of the sources
+func (h *handler) peek(ctx context.Context, req Request, send chan<- *Response) {
+	n := req.PeekLines
+	if n <= 0 {
+		n = defaultPeekLines
+	}
+	wg := sync.WaitGroup{}
+	sources := filterSources(h.sources(req), req.filterSourceMap)
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			path := src.FS.Join(req.Path...)
+			h.peekSource(ctx, send, req, src, path, n)
+		}(src)
+	}
+	wg.Wait()
+}
+
+func (h *handler) peekSource(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, n int) {
+	p, code, err := h.peekFile(ctx, node, path, n, req.IncludeRaw)
+	if err != nil {
+		send <- sourceErrorResponse(req, node.Name, code, err)
+		return
+	}
+	if p == nil {
+		return
+	}
+	respMeta := Meta{
+		ID:     req.Meta.ID,
+		Action: req.Meta.Action,
+		FS:     node.Name,
+		Path:   strings.Split(strings.Trim(path, "/"), "/"),
+	}
+	send <- &Response{Meta: respMeta, Lines: p.head, Tail: p.tail}
+}
+
+// peeked are the first and last lines of a file
+type peeked struct {
+	head, tail []parse.Log
+	// format is the format of the file, according to the parser that parsed its lines
+	format string
+}
+
+// peekFile reads the first and last n lines of a file. It returns nil without an error if the path is
+// not a file in the source, or if the context was cancelled. On errors, it returns the source error code.
+// If raw is true, the lines include the original lines.
+func (h *handler) peekFile(ctx context.Context, node source.Source, path string, n int, raw bool) (*peeked, string, error) {
+	node = node.WithContext(ctx)
+	log := log.WithField("path", node.Name+":"+path)
+	stat, err := node.FS.Lstat(path)
+	if err != nil || stat.IsDir() {
+		return nil, "", nil
+	}
+
+	r, err := filesystem.OpenText(node.FS, path)
+	if err != nil {
+		log.WithError(err).Error("Failed open")
+		return nil, codeOpen, err
+	}
+	// the file is opened again if reading its end failed
+	defer func() { r.Close() }()
+
+	scanner, offsets := newLineScanner(r, 0)
+	var (
+		mem        = new(parse.Memory)
+		head, tail []parse.Log
+		lineNumber = 1
+		newLine    = func(data []byte, lineNumber, offset int) parse.Log {
+			line := h.parseLine(path, data, mem, raw)
+			line.FileName = path
+			line.FS = node.Name
+			line.Line = lineNumber
+			line.Offset = offset
+			return *line
+		}
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for len(head) < n && scanner.Scan() {
+		head = append(head, newLine(scanner.Bytes(), lineNumber, offsets.offset))
+		lineNumber += 1
+	}
+
+	// for big files, try to read the last lines from the end of the file, which is much cheaper
+	// than scanning it all. Line numbers of those lines are unknown without a full scan.
+	tailed := false
+	if len(head) == n && stat.Size() > 2*peekChunkSize {
+		var lines []tailLine
+		if lines, tailed = tailLines(r, stat.Size(), n); tailed {
+			for _, l := range lines {
+				tail = append(tail, newLine(l.data, 0, int(l.offset)))
+			}
+		} else {
+			// the file was moved from the position of the scanner, so it is scanned again after the head lines
+			r.Close()
+			if r, err = filesystem.OpenText(node.FS, path); err != nil {
+				log.WithError(err).Error("Failed open")
+				return nil, codeOpen, err
+			}
+			scanner, offsets = newLineScanner(r, 0)
+			scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+			for i := 0; i < len(head); i++ {
+				scanner.Scan()
+			}
+		}
+	}
+
+	// fallback to scanning the rest of the file and keeping only the last lines
+	if !tailed {
+		for scanner.Scan() {
+			if err := ctx.Err(); err != nil {
+				return nil, "", nil
+			}
+			if len(tail) == n {
+				tail = tail[1:]
+			}
+			tail = append(tail, newLine(scanner.Bytes(), lineNumber, offsets.offset))
+			lineNumber += 1
+		}
+		if err := scanner.Err(); err != nil {
+			log.WithError(err).Errorf("Failed scan")
+			return nil, codeRead, err
+		}
+	}
+	return &peeked{head: head, tail: tail, format: mem.Format()}, "", nil
+}
+
+type tailLine struct {
+	offset int64
+	data   []byte
+}
+
+// tailLines reads the last n lines of a file by seeking backwards from its end.
+// It returns false if the file does not support seeking.
+func tailLines(f io.ReadSeeker, size int64, n int) ([]tailLine, bool) {
+	var (
+		buf []byte
+		pos = size
+	)
+	// read one more line than needed, since the first line in the buffer might be partial
+	for pos > 0 && bytes.Count(buf, []byte{'\n'}) <= n {
+		chunk := int64(peekChunkSize)
+		if chunk > pos {
+			chunk = pos
+		}
+		pos -= chunk
+		if off, err := f.Seek(pos, io.SeekStart); err != nil || off != pos {
+			return nil, false
+		}
+		b := make([]byte, chunk)
+		if _, err := io.ReadFull(f, b); err != nil {
+			return nil, false
+		}
+		buf = append(b, buf...)
+	}
+
+	// the lines are split like the lines of the head, so their offsets are computed the same way
+	var (
+		lines            []tailLine
+		scanner, offsets = newLineScanner(bytes.NewReader(buf), int(pos))
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), len(buf)+1)
+	for i := 0; scanner.Scan(); i++ {
+		// skip partial first line
+		if i == 0 && pos > 0 {
+			continue
+		}
+		lines = append(lines, tailLine{offset: int64(offsets.offset), data: append([]byte(nil), scanner.Bytes()...)})
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, true
+}
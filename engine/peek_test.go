@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenSeekFS is a filesystem whose files are moved by seeks that fail, like remote files whose connection
+// broke during a seek
+type brokenSeekFS struct {
+	filesystem.FileSystem
+}
+
+func (fs brokenSeekFS) Open(name string) (filesystem.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return brokenSeekFile{File: f}, nil
+}
+
+type brokenSeekFile struct {
+	filesystem.File
+}
+
+func (f brokenSeekFile) Seek(offset int64, whence int) (int64, error) {
+	f.File.Seek(offset, whence)
+	return 0, fmt.Errorf("seek failed")
+}
+
+func TestPeekOffsets(t *testing.T) {
+	t.Parallel()
+
+	// a file that is big enough to read its tail from its end, with both \n and \r\n line endings
+	var (
+		b       strings.Builder
+		offsets []int
+		msgs    []string
+	)
+	for i := 0; i < 30000; i++ {
+		offsets = append(offsets, b.Len())
+		msgs = append(msgs, fmt.Sprintf("line %05d", i))
+		b.WriteString(msgs[i])
+		if i%2 == 0 {
+			b.WriteString("\r")
+		}
+		b.WriteString("\n")
+	}
+	fs := filesystem.NewMemory(map[string]string{"app.log": b.String()})
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, nil, parser, gcache.New(10).Build())
+
+	check := func(src source.Source, tailLineNumbers bool) {
+		p, _, err := h.peekFile(context.Background(), src, "app.log", 3, false)
+		require.Nil(t, err)
+		require.NotNil(t, p)
+		require.Len(t, p.head, 3)
+		require.Len(t, p.tail, 3)
+		for i, l := range p.head {
+			assert.Equal(t, msgs[i], l.Msg)
+			assert.Equal(t, offsets[i], l.Offset)
+			assert.Equal(t, i+1, l.Line)
+		}
+		for i, l := range p.tail {
+			j := len(msgs) - 3 + i
+			assert.Equal(t, msgs[j], l.Msg, src.Name)
+			assert.Equal(t, offsets[j], l.Offset, src.Name)
+			if tailLineNumbers {
+				assert.Equal(t, j+1, l.Line, src.Name)
+			}
+		}
+	}
+	check(source.Source{Name: "seekable", FS: fs}, false)
+	// when reading the end of the file fails, the rest of the file is scanned from the end of the head
+	check(source.Source{Name: "broken", FS: brokenSeekFS{FileSystem: fs}}, true)
+}
@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+)
+
+// staleReason is the stale indication of a permalink whose line is not in the file anymore
+const staleReason = "file was rotated or changed since the link was created"
+
+// Permalink is an anchor of a line in a file. It is encoded in a permalink token, which clients can share.
+type Permalink struct {
+	FS   string `json:"fs"`
+	Path Path   `json:"path"`
+	// Line is the line number of the anchored line, zero if it is unknown
+	Line   int `json:"line,omitempty"`
+	Offset int `json:"offset"`
+	// ModTime is the modification time of the file when the permalink was created
+	ModTime time.Time `json:"mtime"`
+	// Hash is a checksum of the anchored line, for detecting that the file changed
+	Hash uint32 `json:"hash"`
+}
+
+func (p Permalink) token() string {
+	b, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePermalink(token string) (Permalink, error) {
+	var p Permalink
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(b, &p)
+	}
+	if err != nil {
+		return p, fmt.Errorf("bad permalink: %s", err)
+	}
+	return p, nil
+}
+
+// createPermalinks responds with a permalink token of the line at from_byte_offset in each target.
+// The from_line is stored in the permalink, if it is given.
+func (h *handler) createPermalinks(ctx context.Context, req Request, send chan<- *Response) {
+	sources := make(map[string]source.Source)
+	for _, src := range h.sources(req) {
+		sources[src.Name] = src
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(req.Targets))
+	for _, t := range req.Targets {
+		go func(t Target) {
+			defer wg.Done()
+			src, ok := sources[t.FS]
+			if !ok {
+				send <- sourceErrorResponse(req, t.FS, codeNotFound, fmt.Errorf("source %s was not found", t.FS))
+				return
+			}
+			path := src.FS.Join(t.Path...)
+			if !auth.Authorized(ctx, h.Authorizer, req.Action, src.Name, path) {
+				send <- sourceErrorResponse(req, t.FS, codePermission, fmt.Errorf("forbidden: %s", req.Action))
+				return
+			}
+			p, code, err := anchorLine(src.WithContext(ctx), path, int(req.FromByteOffset))
+			if err != nil {
+				send <- sourceErrorResponse(req, t.FS, code, err)
+				return
+			}
+			p.Path, p.Line = t.Path, req.FromLine
+			send <- &Response{Meta: fileMeta(req, src.Name, path), Permalink: p.token()}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// anchorLine returns a permalink of the line at an offset of a file, without its path and line number.
+// On errors, it returns the source error code.
+func anchorLine(src source.Source, path string, offset int) (Permalink, string, error) {
+	stat, err := src.FS.Lstat(path)
+	if err != nil {
+		return Permalink{}, codeStat, err
+	}
+	if stat.IsDir() {
+		return Permalink{}, codeStat, fmt.Errorf("%s is a directory", path)
+	}
+	r, err := filesystem.OpenText(src.FS, path)
+	if err != nil {
+		return Permalink{}, codeOpen, err
+	}
+	defer r.Close()
+	// a permalink of an offset in the middle of a line would never resolve, since it is not the offset of a line
+	start, err := atLineStart(r, int64(offset))
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return Permalink{}, codeNotFound, fmt.Errorf("no line at offset %d of %s", offset, path)
+	}
+	if err != nil {
+		return Permalink{}, codeRead, err
+	}
+	if !start {
+		return Permalink{}, codeNotFound, fmt.Errorf("offset %d of %s is not the start of a line", offset, path)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return Permalink{}, codeRead, err
+		}
+		return Permalink{}, codeNotFound, fmt.Errorf("no line at offset %d of %s", offset, path)
+	}
+	return Permalink{FS: src.Name, Offset: offset, ModTime: stat.ModTime(), Hash: crc32.ChecksumIEEE(scanner.Bytes())}, "", nil
+}
+
+// resolvePermalink responds with the lines around the line of a permalink: up to window_lines lines before it,
+// and up to window_lines lines from it. If the line is not in the file anymore, the response is marked as stale,
+// and holds the lines around its offset.
+func (h *handler) resolvePermalink(ctx context.Context, req Request, send chan<- *Response) {
+	p, err := decodePermalink(req.Permalink)
+	if err != nil {
+		send <- &Response{Meta: req.Meta, Error: err.Error()}
+		return
+	}
+	var src *source.Source
+	for _, s := range h.sources(req) {
+		if s.Name == p.FS {
+			src = &s
+			break
+		}
+	}
+	if src == nil {
+		send <- sourceErrorResponse(req, p.FS, codeNotFound, fmt.Errorf("source %s was not found", p.FS))
+		return
+	}
+	path := src.FS.Join(p.Path...)
+	if !auth.Authorized(ctx, h.Authorizer, req.Action, src.Name, path) {
+		send <- sourceErrorResponse(req, p.FS, codePermission, fmt.Errorf("forbidden: %s", req.Action))
+		return
+	}
+	n := req.WindowLines
+	if n <= 0 {
+		n = defaultWindowLines
+	}
+	if n > h.SearchMaxSize {
+		n = h.SearchMaxSize
+	}
+
+	log := log.WithField("path", src.Name+":"+path)
+	*src = src.WithContext(ctx)
+	if _, err := src.FS.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%s: %s", path, staleReason)
+		}
+		send <- sourceErrorResponse(req, src.Name, codeStat, err)
+		return
+	}
+	r, err := filesystem.OpenText(src.FS, path)
+	if err != nil {
+		log.WithError(err).Error("Failed open")
+		send <- sourceErrorResponse(req, src.Name, codeOpen, err)
+		return
+	}
+	defer r.Close()
+
+	var (
+		scanner, offsets = newLineScanner(r, 0)
+		mem              = new(parse.Memory)
+		before, after    []parse.Log
+		lineNumber       = 0
+		stale            = true
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for len(after) < n && scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		lineNumber++
+		if len(after) == 0 && offsets.offset < p.Offset {
+			line := h.parseLine(path, scanner.Bytes(), mem, req.IncludeRaw)
+			if len(before) == n {
+				before = before[1:]
+			}
+			before = append(before, fileLine(line, src.Name, path, lineNumber, offsets.offset))
+			continue
+		}
+		if len(after) == 0 {
+			stale = offsets.offset != p.Offset || crc32.ChecksumIEEE(scanner.Bytes()) != p.Hash ||
+				(p.Line > 0 && p.Line != lineNumber)
+		}
+		line := h.parseLine(path, scanner.Bytes(), mem, req.IncludeRaw)
+		after = append(after, fileLine(line, src.Name, path, lineNumber, offsets.offset))
+	}
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Error("Failed scan")
+		send <- sourceErrorResponse(req, src.Name, codeRead, err)
+		return
+	}
+	resp := &Response{Meta: fileMeta(req, src.Name, path), Lines: append(before, after...)}
+	if stale {
+		resp.Stale = staleReason
+	}
+	send <- resp
+}
+
+// fileLine sets the location of a parsed line in a file of a source
+func fileLine(line *parse.Log, fs, path string, lineNumber, offset int) parse.Log {
+	line.FileName = path
+	line.FS = fs
+	line.Line = lineNumber
+	line.Offset = offset
+	return *line
+}
+
+// fileMeta is the metadata of a response of a file in a source
+func fileMeta(req Request, fs, path string) Meta {
+	return Meta{
+		ID:     req.Meta.ID,
+		Action: req.Meta.Action,
+		FS:     fs,
+		Path:   strings.Split(strings.Trim(path, string(os.PathSeparator)), string(os.PathSeparator)),
+	}
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermalink(t *testing.T) {
+	t.Parallel()
+
+	fs := filesystem.NewMemory(map[string]string{"log": "one\ntwo\nthree\nfour\n"})
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, source.Sources{{Name: "node1", FS: fs}}, parser, gcache.New(10).Build())
+
+	resps := serveRequest(t, h, Request{
+		Meta:           Meta{Action: "create-permalink"},
+		Targets:        []Target{{FS: "node1", Path: Path{"log"}}, {FS: "missing", Path: Path{"log"}}},
+		FromByteOffset: 4,
+		FromLine:       2,
+	})
+	require.Len(t, resps, 2)
+	var token string
+	for _, resp := range resps {
+		if resp.FS == "node1" {
+			token = resp.Permalink
+		} else {
+			assert.Equal(t, codeNotFound, resp.SourceErrors[0].Code)
+		}
+	}
+	require.NotEmpty(t, token)
+
+	resolve := func() *Response {
+		resps := serveRequest(t, h, Request{Meta: Meta{Action: "resolve-permalink"}, Permalink: token, WindowLines: 1})
+		require.Len(t, resps, 1)
+		return resps[0]
+	}
+	msgs := func(resp *Response) []string {
+		var msgs []string
+		for _, l := range resp.Lines {
+			msgs = append(msgs, l.Msg)
+		}
+		return msgs
+	}
+
+	// lines that were appended don't change the anchor
+	fs.AppendFile("log", []byte("five\n"))
+	resp := resolve()
+	assert.Empty(t, resp.Stale)
+	assert.Equal(t, []string{"one", "two"}, msgs(resp))
+	assert.Equal(t, 2, resp.Lines[1].Line)
+
+	// the file was rotated
+	fs.WriteFile("log", []byte("six\nseven\n"), time.Now())
+	resp = resolve()
+	assert.Equal(t, staleReason, resp.Stale)
+	assert.Equal(t, []string{"six", "seven"}, msgs(resp))
+
+	fs.RemoveFile("log")
+	resp = resolve()
+	require.Len(t, resp.SourceErrors, 1)
+	assert.Equal(t, codeStat, resp.SourceErrors[0].Code)
+	assert.Contains(t, resp.SourceErrors[0].Message, staleReason)
+
+	resps = serveRequest(t, h, Request{Meta: Meta{Action: "resolve-permalink"}, Permalink: "bad"})
+	require.Len(t, resps, 1)
+	assert.Contains(t, resps[0].Error, "bad permalink")
+}
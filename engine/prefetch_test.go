@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := newHandler(Config{Context: ctx, PrefetchInterval: time.Millisecond}, memorySources(), parser, gcache.New(10).Build())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.prefetch()
+	}()
+	eventually(t, func() bool {
+		_, err := h.cache.Get(treeCacheKey(""))
+		return err == nil
+	})
+
+	// a tree from the prefetched cache has the metadata of the request
+	resps := serveRequest(t, h, Request{Meta: Meta{ID: 7, Action: "get-file-tree"}})
+	require.Len(t, resps, 1)
+	assert.Equal(t, Meta{ID: 7, Action: "get-file-tree"}, resps[0].Meta)
+	assert.NotEmpty(t, resps[0].Files)
+
+	// the periodic prefetch stops when the context of the handler is done
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("prefetch did not stop")
+	}
+}
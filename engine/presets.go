@@ -0,0 +1,22 @@
+package engine
+
+import "context"
+
+// Preset is a named search that is defined by the server operator
+type Preset struct {
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Regexp       string            `json:"regexp"`
+	Path         Path              `json:"path,omitempty"`
+	FilterSource []string          `json:"filter_fs,omitempty"`
+	FilterGroup  []string          `json:"filter_group,omitempty"`
+	FilterTags   map[string]string `json:"filter_tags,omitempty"`
+}
+
+func (h *handler) servePresets(ctx context.Context, req Request, send chan<- *Response) {
+	presets := h.Presets
+	if presets == nil {
+		presets = []Preset{}
+	}
+	send <- &Response{Meta: req.Meta, Presets: presets}
+}
@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/gobwas/glob"
+)
+
+// applyQuery parses the request query and applies it on the request filters.
+//
+// A query is a list of space separated terms. A term of the form key:value is a filter,
+// and any other term is a text that should appear in the log message. Texts with spaces
+// should be quoted. The supported filters are:
+//
+//	level:ERROR     log level
+//	fs:node1        source name
+//	group:storage   source group
+//	tag:rack=r1     source tag
+//	path:dir/*.log  glob of the file path
+//	re:fail(ed)?    regular expression of the log message
+//	since:2h        lines from the last duration, or since a RFC3339 time
+//	until:1h        lines until a duration ago, or until a RFC3339 time
+//	modified:2h     files that were modified in the last duration, or since a RFC3339 time
+//
+// For example: level:ERROR fs:node1 path:mancala* "disk failed" since:2h
+func (r *Request) applyQuery(now time.Time) error {
+	for _, term := range splitQuery(r.Query) {
+		key, value := "", term
+		if i := strings.Index(term, ":"); i > 0 && !strings.HasPrefix(term, `"`) {
+			key, value = term[:i], term[i+1:]
+		}
+		value = strings.Trim(value, `"`)
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "level":
+			r.FilterLevel = append(r.FilterLevel, value)
+		case "fs":
+			r.FilterSource = append(r.FilterSource, value)
+		case "group":
+			r.FilterGroup = append(r.FilterGroup, value)
+		case "tag":
+			i := strings.Index(value, "=")
+			if i <= 0 {
+				return fmt.Errorf("bad tag %s, expected key=value", value)
+			}
+			if r.FilterTags == nil {
+				r.FilterTags = make(map[string]string)
+			}
+			r.FilterTags[value[:i]] = value[i+1:]
+		case "path":
+			r.FilterPath = value
+		case "re":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return fmt.Errorf("bad regexp %s: %s", value, err)
+			}
+			r.terms = append(r.terms, re)
+		case "since":
+			t, err := parseQueryTime(value, now)
+			if err != nil {
+				return fmt.Errorf("bad since value %s: %s", value, err)
+			}
+			r.FilterTime.Start = &t
+		case "until":
+			t, err := parseQueryTime(value, now)
+			if err != nil {
+				return fmt.Errorf("bad until value %s: %s", value, err)
+			}
+			r.FilterTime.End = &t
+		case "modified":
+			t, err := parseQueryTime(value, now)
+			if err != nil {
+				return fmt.Errorf("bad modified value %s: %s", value, err)
+			}
+			r.ModifiedSince = &t
+		default:
+			// unknown keys are part of the text, for example "error:" in a log message
+			r.terms = append(r.terms, regexp.MustCompile(regexp.QuoteMeta(strings.Trim(term, `"`))))
+		}
+	}
+	return nil
+}
+
+// splitQuery splits a query to terms by spaces, spaces in quotes are not split
+func splitQuery(q string) []string {
+	var (
+		terms  []string
+		term   []rune
+		quoted bool
+	)
+	for _, c := range q {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			term = append(term, c)
+		case c == ' ' && !quoted:
+			if len(term) > 0 {
+				terms = append(terms, string(term))
+			}
+			term = nil
+		default:
+			term = append(term, c)
+		}
+	}
+	if len(term) > 0 {
+		terms = append(terms, string(term))
+	}
+	return terms
+}
+
+// parseQueryTime parses a time that is given as a duration before now, or as a RFC3339 time.
+// Durations can also be given in days, for example 2d.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// compileFilters compiles the request filters that are not given as source names
+func (r *Request) compileFilters() error {
+	if r.FilterPath != "" {
+		g, err := glob.Compile(strings.Trim(r.FilterPath, "/"), '/')
+		if err != nil {
+			return fmt.Errorf("bad path filter %s: %s", r.FilterPath, err)
+		}
+		r.filterPath = g
+	}
+	return nil
+}
+
+// matchPath returns true if a file path passes the path filter
+func (r *Request) matchPath(path string) bool {
+	return r.filterPath == nil || r.filterPath.Match(strings.Trim(path, "/"))
+}
+
+// multiPathActions are the actions that can search multiple base paths
+var multiPathActions = map[string]bool{
+	"search":    true,
+	"aggregate": true,
+	"trace":     true,
+}
+
+// searchPaths returns the base paths that a request searches: its paths if it can search multiple paths, without
+// paths that are inside another base path, so their files are not searched twice, or otherwise its path
+func (r *Request) searchPaths() []Path {
+	if len(r.Paths) == 0 || !multiPathActions[r.Action] {
+		return []Path{r.Path}
+	}
+	var paths []Path
+	for i, p := range r.Paths {
+		inside := false
+		for j, other := range r.Paths {
+			// of equal paths, only the first is kept
+			if i != j && isPrefix(other, p) && (len(other) < len(p) || j < i) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// isPrefix returns true if a path is a prefix of another path, by their elements
+func isPrefix(prefix, path Path) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchModTime returns true if a file passes the modification time filters, directories always pass
+func (r *Request) matchModTime(stat os.FileInfo) bool {
+	if stat.IsDir() {
+		return true
+	}
+	mtime := stat.ModTime()
+	return (r.ModifiedSince == nil || !mtime.Before(*r.ModifiedSince)) &&
+		(r.ModifiedBefore == nil || mtime.Before(*r.ModifiedBefore))
+}
+
+// matchLine returns true if a log line passes the level filter and contains all the query texts
+func (r *Request) matchLine(line *parse.Log) bool {
+	if len(r.FilterLevel) > 0 {
+		match := false
+		for _, level := range r.FilterLevel {
+			if strings.EqualFold(level, line.Level) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if r.termSet != nil {
+		return r.termSet.match(line.Msg)
+	}
+	for _, re := range r.terms {
+		if !re.MatchString(line.Msg) {
+			return false
+		}
+	}
+	return true
+}
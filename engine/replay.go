@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+)
+
+const defaultReplaySpeed = 1
+
+// replay streams the lines of the file in the request path, paced by their times: each line is sent when the
+// time between it and the start of the replay, divided by the speed, has passed. The replay starts at the start
+// of the time filter, so the files of all the sources are replayed on the same clock, or at the first line of
+// each file if no start is given. It ends at the end of the time filter, or at the end of the file.
+// Lines without a time are sent with the line before them.
+func (h *handler) replay(ctx context.Context, req Request, send chan<- *Response) {
+	speed := req.Speed
+	if speed < 0 {
+		send <- &Response{Meta: req.Meta, Error: fmt.Sprintf("Bad replay speed %g", speed)}
+		return
+	}
+	if speed == 0 {
+		speed = defaultReplaySpeed
+	}
+	var (
+		start   = time.Now()
+		sources = filterSources(h.sources(req), req.filterSourceMap)
+		wg      sync.WaitGroup
+	)
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			h.replayFile(ctx, send, req, src, src.FS.Join(req.Path...), start, speed)
+		}(src)
+	}
+	wg.Wait()
+}
+
+func (h *handler) replayFile(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, start time.Time, speed float64) {
+	node = node.WithContext(ctx)
+	log := log.WithField("path", node.Name+":"+path)
+	if stat, err := node.FS.Lstat(path); err != nil || stat.IsDir() {
+		// the file might not exist in all the sources
+		return
+	}
+	r, err := filesystem.OpenText(node.FS, path)
+	if err != nil {
+		log.WithError(err).Error("Failed open")
+		send <- sourceErrorResponse(req, node.Name, codeOpen, err)
+		return
+	}
+	defer r.Close()
+
+	var (
+		scanner, offsets = newLineScanner(r, 0)
+		mem              = new(parse.Memory)
+		meta             = fileMeta(req, node.Name, path)
+		base             = req.FilterTime.Start
+		lines            []parse.Log
+		lineNumber       = 0
+		// skip is set while the lines are before the start of the replay
+		skip = base != nil
+	)
+	flush := func() bool {
+		if len(lines) == 0 {
+			return true
+		}
+		select {
+		case send <- &Response{Meta: meta, Lines: lines}:
+			lines = nil
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		lineNumber++
+		line := h.parseLine(path, scanner.Bytes(), mem, req.IncludeRaw)
+		line.FileName = path
+		line.FS = node.Name
+		line.Line = lineNumber
+		line.Offset = offsets.offset
+		if line.Time != nil {
+			if req.FilterTime.End != nil && line.Time.After(*req.FilterTime.End) {
+				break
+			}
+			if base == nil {
+				base = line.Time
+			}
+			skip = line.Time.Before(*base)
+			due := start.Add(time.Duration(float64(line.Time.Sub(*base)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				if !flush() {
+					return
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+		}
+		if skip {
+			continue
+		}
+		lines = append(lines, *line)
+		if len(lines) >= h.contentBatchSize(node) && !flush() {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Error("Failed scan")
+		send <- sourceErrorResponse(req, node.Name, codeRead, err)
+		return
+	}
+	flush()
+}
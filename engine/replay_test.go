@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	sources := source.Sources{
+		{Name: "node1", FS: filesystem.NewMemory(map[string]string{
+			"app.log": "2017-12-25T16:00:00Z start\n" +
+				"2017-12-25T16:00:01Z working\n" +
+				"traceback\n" +
+				"2017-12-25T16:00:02Z stop\n",
+		})},
+	}
+	parser, err := parse.New([]parse.Config{{
+		Glob:        "*.log",
+		Regexp:      `(?P<time>\S+Z) (?P<msg>.*)`,
+		TimeFormats: []string{time.RFC3339},
+	}})
+	require.Nil(t, err)
+	h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+	replay := func(req Request) ([]string, time.Duration) {
+		req.Action = "replay"
+		req.Path = Path{"app.log"}
+		start := time.Now()
+		var msgs []string
+		for _, resp := range serveRequest(t, h, req) {
+			require.Empty(t, resp.Error)
+			for _, l := range resp.Lines {
+				msgs = append(msgs, l.Msg)
+			}
+		}
+		return msgs, time.Since(start)
+	}
+
+	// two seconds of logs are replayed in 100ms
+	msgs, took := replay(Request{Speed: 20})
+	assert.Equal(t, []string{"start", "working", "traceback", "stop"}, msgs)
+	assert.True(t, took >= 100*time.Millisecond, "took %s", took)
+	assert.True(t, took < time.Second, "took %s", took)
+
+	// the time filter selects the replayed lines
+	msgs, _ = replay(Request{Speed: 20, FilterTime: TimeRange{
+		Start: mustTime("2017-12-25T16:00:01Z"),
+		End:   mustTime("2017-12-25T16:00:01Z"),
+	}})
+	assert.Equal(t, []string{"working", "traceback"}, msgs)
+
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "replay"}, Path: Path{"app.log"}, Speed: -1})
+	require.Len(t, resps, 1)
+	assert.Contains(t, resps[0].Error, "Bad replay speed")
+}
+
+func mustTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/source"
+)
+
+// SeekVerification compares the line at a byte offset of a file, as found by scanning the file from its
+// start, with the line that is read by seeking to the offset, like get-content from_byte_offset and
+// permalinks do. It is the response of the seek-verify debug action.
+type SeekVerification struct {
+	FS     string `json:"fs"`
+	Offset int    `json:"offset"`
+	// Line is the number of the line that contains the offset, and LineOffset is the offset of its start
+	Line       int `json:"line"`
+	LineOffset int `json:"line_offset"`
+	// LineEnding is the ending of the line: \n, \r\n, or empty for a last line without one
+	LineEnding string `json:"line_ending"`
+	// Exact is true if the offset is the start of the line, and then Scanned and Seeked should be equal
+	Exact   bool   `json:"exact"`
+	Scanned string `json:"scanned"`
+	Seeked  string `json:"seeked"`
+	Size    int64  `json:"size"`
+}
+
+// seekVerify responds with the verification of the line at from_byte_offset of a file in each of the
+// sources that have the file
+func (h *handler) seekVerify(ctx context.Context, req Request, send chan<- *Response) {
+	wg := sync.WaitGroup{}
+	sources := filterSources(h.sources(req), req.filterSourceMap)
+	wg.Add(len(sources))
+	for _, src := range sources {
+		go func(src source.Source) {
+			defer wg.Done()
+			path := src.FS.Join(req.Path...)
+			v, code, err := verifySeek(src.WithContext(ctx), path, int(req.FromByteOffset))
+			if err != nil {
+				send <- sourceErrorResponse(req, src.Name, code, err)
+				return
+			}
+			if v == nil {
+				return
+			}
+			send <- &Response{Meta: fileMeta(req, src.Name, path), SeekVerify: v}
+		}(src)
+	}
+	wg.Wait()
+}
+
+// verifySeek returns the verification of the line at an offset of a file. It returns nil without an error
+// if the path is not a file in the source. On errors, it returns the source error code.
+func verifySeek(src source.Source, path string, offset int) (*SeekVerification, string, error) {
+	stat, err := src.FS.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, codeStat, err
+	}
+	if stat.IsDir() {
+		return nil, "", nil
+	}
+	v := &SeekVerification{FS: src.Name, Offset: offset, Size: stat.Size()}
+
+	r, err := filesystem.OpenText(src.FS, path)
+	if err != nil {
+		return nil, codeOpen, err
+	}
+	defer r.Close()
+	scanner, offsets := newLineScanner(r, 0)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	found := false
+	for !found && scanner.Scan() {
+		v.Line++
+		found = offset < offsets.next
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, codeRead, err
+	}
+	if !found || offset < 0 {
+		return nil, codeNotFound, fmt.Errorf("no line at offset %d of %s", offset, path)
+	}
+	v.LineOffset, v.LineEnding, v.Exact = offsets.offset, offsets.ending, offsets.offset == offset
+	v.Scanned = scanner.Text()
+
+	// the file is opened again, since seeking a scanned file does not reset the buffer of its scanner
+	seeked, err := filesystem.OpenText(src.FS, path)
+	if err != nil {
+		return nil, codeOpen, err
+	}
+	defer seeked.Close()
+	if err := seekTo(seeked, int64(offset)); err != nil {
+		return nil, codeRead, err
+	}
+	scanner = bufio.NewScanner(seeked)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if scanner.Scan() {
+		v.Seeked = scanner.Text()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, codeRead, err
+	}
+	return v, "", nil
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRLFOffsets(t *testing.T) {
+	t.Parallel()
+
+	fs := filesystem.NewMemory(map[string]string{"log": "a\r\nbb\r\nccc\n\r\ndd"})
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, source.Sources{{Name: "node1", FS: fs}}, parser, gcache.New(10).Build())
+
+	offsets := func(req Request) []int {
+		var offsets []int
+		for _, resp := range serveRequest(t, h, req) {
+			for _, l := range resp.Lines {
+				offsets = append(offsets, l.Offset)
+			}
+		}
+		return offsets
+	}
+	assert.Equal(t, []int{0, 3, 7, 11, 13}, offsets(Request{Meta: Meta{Action: "get-content"}, Path: Path{"log"}}))
+	assert.Equal(t, []int{7, 11, 13}, offsets(Request{Meta: Meta{Action: "get-content"}, Path: Path{"log"}, FromByteOffset: 7}))
+
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "create-permalink"}, Targets: []Target{{FS: "node1", Path: Path{"log"}}}, FromByteOffset: 4})
+	require.Len(t, resps, 1)
+	require.Len(t, resps[0].SourceErrors, 1)
+	assert.Equal(t, codeNotFound, resps[0].SourceErrors[0].Code)
+	assert.Contains(t, resps[0].SourceErrors[0].Message, "not the start of a line")
+}
+
+func TestSeekVerify(t *testing.T) {
+	t.Parallel()
+
+	fs := filesystem.NewMemory(map[string]string{"log": "a\r\nbb\r\nccc\ndd"})
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, source.Sources{{Name: "node1", FS: fs}, {Name: "node2", FS: filesystem.NewMemory(nil)}}, parser, gcache.New(10).Build())
+
+	verify := func(offset int64) *Response {
+		resps := serveRequest(t, h, Request{Meta: Meta{Action: "seek-verify"}, Path: Path{"log"}, FromByteOffset: offset})
+		require.Len(t, resps, 1)
+		return resps[0]
+	}
+
+	tests := []struct {
+		offset int64
+		want   SeekVerification
+	}{
+		{offset: 3, want: SeekVerification{FS: "node1", Offset: 3, Line: 2, LineOffset: 3, LineEnding: "\r\n", Exact: true, Scanned: "bb", Seeked: "bb", Size: 13}},
+		{offset: 9, want: SeekVerification{FS: "node1", Offset: 9, Line: 3, LineOffset: 7, LineEnding: "\n", Scanned: "ccc", Seeked: "c", Size: 13}},
+		{offset: 11, want: SeekVerification{FS: "node1", Offset: 11, Line: 4, LineOffset: 11, Exact: true, Scanned: "dd", Seeked: "dd", Size: 13}},
+	}
+	for _, tt := range tests {
+		resp := verify(tt.offset)
+		require.NotNil(t, resp.SeekVerify)
+		assert.Equal(t, tt.want, *resp.SeekVerify)
+	}
+
+	resp := verify(13)
+	require.Len(t, resp.SourceErrors, 1)
+	assert.Equal(t, codeNotFound, resp.SourceErrors[0].Code)
+}
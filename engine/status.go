@@ -0,0 +1,38 @@
+package engine
+
+// Statuses of the file of a get-content request in a source
+const (
+	statusOK      = "ok"
+	statusEmpty   = "empty"
+	statusMissing = "missing"
+	statusError   = "error"
+)
+
+// FileStatus is the status of the file of a get-content request in a source. Without it, an empty file,
+// a file that is missing in the source, and a file that failed to open, all look like a source without lines.
+type FileStatus struct {
+	FS     string `json:"fs"`
+	Status string `json:"status"`
+	// Size is the size of the file when it was opened, in bytes
+	Size  int64  `json:"size,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// fileStatusResponse returns a response of a get-content request with the status of the file in a source,
+// for a source that has no content responses of the file
+func fileStatusResponse(req Request, fs string, status string, err error) *Response {
+	resp := &Response{Meta: Meta{ID: req.ID, Action: req.Action, FS: fs}, FileStatus: &FileStatus{FS: fs, Status: status}}
+	if err != nil {
+		resp.FileStatus.Error = err.Error()
+	}
+	return resp
+}
+
+// withFileStatus sets the error status of the file in a source error response of a get-content request
+func withFileStatus(resp *Response) *Response {
+	if len(resp.SourceErrors) > 0 {
+		e := resp.SourceErrors[0]
+		resp.FileStatus = &FileStatus{FS: e.FS, Status: statusError, Error: e.Message}
+	}
+	return resp
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStatus(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := source.Sources{
+		{Name: "full", FS: filesystem.NewMemory(map[string]string{"var/log/syslog": "start\n"})},
+		{Name: "empty", FS: filesystem.NewMemory(map[string]string{"var/log/syslog": ""})},
+		{Name: "missing", FS: filesystem.NewMemory(map[string]string{"var/log/app.log": "start\n"})},
+		{Name: "dir", FS: filesystem.NewMemory(map[string]string{"var/log/syslog/1.log": "start\n"})},
+	}
+	h := newHandler(Config{}, sources, parser, gcache.New(10).Build())
+
+	statuses := make(map[string]FileStatus)
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "get-content"}, Path: Path{"var", "log", "syslog"}}) {
+		if resp.FileStatus != nil {
+			statuses[resp.FS] = *resp.FileStatus
+		}
+	}
+	assert.Equal(t, map[string]FileStatus{
+		"full":    {FS: "full", Status: statusOK, Size: 6},
+		"empty":   {FS: "empty", Status: statusEmpty},
+		"missing": {FS: "missing", Status: statusMissing},
+		"dir":     {FS: "dir", Status: statusMissing, Error: "var/log/syslog is a directory"},
+	}, statuses)
+
+	// searches don't have file statuses
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "start"}) {
+		assert.Nil(t, resp.FileStatus)
+	}
+}
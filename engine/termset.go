@@ -0,0 +1,111 @@
+package engine
+
+import "regexp"
+
+const (
+	// maxTermSetLiterals is the number of literals that fit in the bit set of the matched literals
+	maxTermSetLiterals = 64
+	// maxTermSetStates limits the size of the automaton, literals that don't fit are matched by their
+	// regular expressions
+	maxTermSetStates = 4096
+)
+
+// termSet matches all the terms of a query in a single scan of a line. The literal texts of the terms,
+// and the literal prefixes of the other terms, are compiled to a single Aho-Corasick automaton, so the
+// cost of scanning a line does not grow with the number of terms. Terms that are not literal are matched
+// by their regular expressions, only on lines that contain all the literals.
+type termSet struct {
+	// delta is the transition table of the automaton, from a state and a byte to the next state
+	delta [][256]int32
+	// out is the bit set of the literals that are found when reaching a state
+	out []uint64
+	// all is the bit set of all the literals
+	all uint64
+	// regexps are the terms that are not matched by the automaton alone
+	regexps []*regexp.Regexp
+}
+
+// newTermSet compiles the terms of a query to a term set
+func newTermSet(terms []*regexp.Regexp) *termSet {
+	s := &termSet{delta: make([][256]int32, 1), out: make([]uint64, 1)}
+	var n uint
+	for _, re := range terms {
+		prefix, complete := re.LiteralPrefix()
+		if prefix == "" || n == maxTermSetLiterals || len(s.delta)+len(prefix) > maxTermSetStates {
+			s.regexps = append(s.regexps, re)
+			continue
+		}
+		s.add(prefix, n)
+		n++
+		// a line must contain the literal prefix of a term to match it, but the rest of the term is
+		// matched by its regular expression
+		if !complete {
+			s.regexps = append(s.regexps, re)
+		}
+	}
+	s.compile()
+	return s
+}
+
+// add adds a literal to the trie of the automaton, state 0 is the root of the trie
+func (s *termSet) add(literal string, bit uint) {
+	state := int32(0)
+	for i := 0; i < len(literal); i++ {
+		next := s.delta[state][literal[i]]
+		if next == 0 {
+			next = int32(len(s.delta))
+			s.delta = append(s.delta, [256]int32{})
+			s.out = append(s.out, 0)
+			s.delta[state][literal[i]] = next
+		}
+		state = next
+	}
+	s.out[state] |= 1 << bit
+	s.all |= 1 << bit
+}
+
+// compile completes the trie to an automaton: missing transitions of a state are the transitions of its
+// failure state, which is the state of the longest proper suffix of its path in the trie
+func (s *termSet) compile() {
+	fail := make([]int32, len(s.delta))
+	var queue []int32
+	for _, next := range s.delta[0] {
+		if next != 0 {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		s.out[state] |= s.out[fail[state]]
+		for c, next := range s.delta[state] {
+			if next == 0 {
+				s.delta[state][c] = s.delta[fail[state]][c]
+				continue
+			}
+			fail[next] = s.delta[fail[state]][c]
+			queue = append(queue, next)
+		}
+	}
+}
+
+// match returns true if a text matches all the terms
+func (s *termSet) match(text string) bool {
+	var (
+		found uint64
+		state int32
+	)
+	for i := 0; i < len(text) && found != s.all; i++ {
+		state = s.delta[state][text[i]]
+		found |= s.out[state]
+	}
+	if found != s.all {
+		return false
+	}
+	for _, re := range s.regexps {
+		if !re.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTermSet(t *testing.T) {
+	t.Parallel()
+
+	texts := []string{
+		"",
+		"error: disk full",
+		"error: disk is full on /dev/sda",
+		"disk error",
+		"aaab",
+		"ab",
+		"failed to mount: ENOSPC",
+		"retry 3 failed",
+		"שגיאה בדיסק",
+		"Error: DISK FULL",
+	}
+	tests := [][]string{
+		{"error", "disk"},
+		{"disk", "error", "full"},
+		// overlapping literals, and a literal that is a suffix of another
+		{"aab", "ab"},
+		{"ab", "b", "aaab"},
+		{"error", "error"},
+		// regular expressions with and without a literal prefix
+		{"fail(ed)?", "mount"},
+		{"retry \\d+", "failed"},
+		{"(?i)error", "disk"},
+		{"^disk", "error$"},
+		{"בדיסק", "שגיאה"},
+		{"error", "nothing"},
+	}
+	for _, patterns := range tests {
+		var terms []*regexp.Regexp
+		for _, p := range patterns {
+			terms = append(terms, regexp.MustCompile(p))
+		}
+		s := newTermSet(terms)
+		for _, text := range texts {
+			want := true
+			for _, re := range terms {
+				want = want && re.MatchString(text)
+			}
+			assert.Equal(t, want, s.match(text), "terms %q text %q", patterns, text)
+		}
+	}
+
+	// literals that don't fit in the automaton are matched by their regular expressions
+	var (
+		terms []*regexp.Regexp
+		text  []string
+	)
+	for i := 0; i < maxTermSetLiterals+10; i++ {
+		word := fmt.Sprintf("w%03d", i)
+		terms = append(terms, regexp.MustCompile(word))
+		text = append(text, word)
+	}
+	s := newTermSet(terms)
+	assert.Len(t, s.regexps, 10)
+	assert.True(t, s.match(strings.Join(text, " ")))
+	assert.False(t, s.match(strings.Join(text[:len(text)-1], " ")))
+	assert.False(t, s.match(strings.Join(text[1:], " ")))
+	long := regexp.MustCompile(strings.Repeat("x", maxTermSetStates))
+	s = newTermSet([]*regexp.Regexp{regexp.MustCompile("x"), long})
+	assert.Equal(t, []*regexp.Regexp{long}, s.regexps)
+}
+
+func TestMultiPatternTerms(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+
+	searched := func(c Config, query string) []string {
+		h := newHandler(c, memorySources(), parser, gcache.New(10).Build())
+		var msgs []string
+		for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Query: query}) {
+			for _, l := range resp.Lines {
+				msgs = append(msgs, l.Msg)
+			}
+		}
+		sort.Strings(msgs)
+		return msgs
+	}
+	for _, query := range []string{`error: full`, `"disk full" re:^err`, `error down re:net(work)?`, `error missing`, `error`} {
+		assert.Equal(t, searched(Config{}, query), searched(Config{MultiPatternTerms: true}, query), query)
+	}
+	assert.Equal(t, []string{"error: disk full"}, searched(Config{MultiPatternTerms: true}, `error: full`))
+
+	// the term set is compiled only for requests with several terms
+	h := newHandler(Config{MultiPatternTerms: true}, memorySources(), parser, gcache.New(10).Build())
+	for query, compiled := range map[string]bool{"error": false, "error disk": true, "level:ERROR fs:node1": false} {
+		req := Request{Meta: Meta{Action: "search"}, Query: query}
+		require.Nil(t, req.applyQuery(time.Now()))
+		h.compileTerms(&req)
+		assert.Equal(t, compiled, req.termSet != nil, query)
+	}
+}
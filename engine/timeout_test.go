@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowFS is a filesystem that lists directories slowly
+type slowFS struct {
+	filesystem.FileSystem
+	delay time.Duration
+}
+
+func (s slowFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	time.Sleep(s.delay)
+	return s.FileSystem.ReadDir(dirname)
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{TreeTimeout: time.Second, ContentTimeout: -1}, memorySources(), parser, gcache.New(10).Build())
+
+	tests := []struct {
+		req  Request
+		want time.Duration
+	}{
+		{req: Request{Meta: Meta{Action: "get-file-tree"}}, want: time.Second},
+		{req: Request{Meta: Meta{Action: "locate"}}, want: time.Second},
+		{req: Request{Meta: Meta{Action: "search"}}, want: defaultSearchTimeout},
+		{req: Request{Meta: Meta{Action: "aggregate"}}, want: defaultSearchTimeout},
+		// a negative timeout disables the timeout
+		{req: Request{Meta: Meta{Action: "get-content"}}, want: -1},
+		// followed files have no timeout
+		{req: Request{Meta: Meta{Action: "get-content"}, Follow: true}, want: 0},
+		{req: Request{Meta: Meta{Action: "get-sources"}}, want: 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, h.timeout(tt.req), "%s follow=%v", tt.req.Action, tt.req.Follow)
+	}
+}
+
+func TestTimeoutResponse(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	sources := source.Sources{{
+		Name: "node1",
+		FS:   slowFS{FileSystem: filesystem.NewMemory(map[string]string{"dir/a.log": "error a\n"}), delay: 50 * time.Millisecond},
+	}}
+	h := newHandler(Config{TreeTimeout: time.Millisecond, SearchTimeout: -1}, sources, parser, gcache.New(10).Build())
+
+	// a request that did not complete in its timeout gets an error
+	resps := serveRequest(t, h, Request{Meta: Meta{Action: "get-file-tree"}})
+	var errs []string
+	for _, resp := range resps {
+		if resp.Error != "" {
+			errs = append(errs, resp.Error)
+		}
+	}
+	assert.Equal(t, []string{"Request timed out after 1ms"}, errs)
+
+	// a request of an action without a timeout completes
+	var lines int
+	for _, resp := range serveRequest(t, h, Request{Meta: Meta{Action: "search"}, Regexp: "error"}) {
+		assert.False(t, strings.HasPrefix(resp.Error, "Request timed out"), resp.Error)
+		lines += len(resp.Lines)
+	}
+	assert.Equal(t, 1, lines)
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/Stratoscale/logserver/parse"
+)
+
+// trace searches all the sources for lines that contain an ID, in the time window of the request,
+// and responds with the matching lines merged chronologically across files and sources.
+// Lines without a time are sent after all the timed lines.
+func (h *handler) trace(ctx context.Context, req Request, send chan<- *Response) {
+	if req.Trace == "" {
+		send <- &Response{Meta: req.Meta, Error: "Trace ID was not specified"}
+		return
+	}
+	req.Regexp = regexp.QuoteMeta(req.Trace)
+
+	var (
+		lines   []parse.Log
+		partial bool
+		ch      = make(chan *Response)
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range ch {
+			if len(lines) < h.SearchMaxSize {
+				lines = append(lines, resp.Lines...)
+			} else if len(resp.Lines) > 0 {
+				partial = true
+			}
+			// errors and partial results are passed to the client, lines are sent after merging
+			if resp.Error != "" || resp.Partial || len(resp.SourceErrors) > 0 {
+				resp.Lines = nil
+				send <- resp
+			}
+		}
+	}()
+	h.search(ctx, req, ch)
+	close(ch)
+	<-done
+
+	if ctx.Err() != nil {
+		return
+	}
+	if len(lines) > h.SearchMaxSize {
+		lines, partial = lines[:h.SearchMaxSize], true
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return traceLess(&lines[i], &lines[j]) })
+
+	for len(lines) > 0 {
+		n := h.ContentBatchSize
+		if n > len(lines) {
+			n = len(lines)
+		}
+		send <- &Response{Meta: req.Meta, Lines: lines[:n]}
+		lines = lines[n:]
+	}
+	if partial {
+		send <- &Response{Meta: req.Meta, Partial: true}
+	}
+}
+
+// traceLess orders lines by time, and lines with the same time, or without time, by their location
+func traceLess(a, b *parse.Log) bool {
+	switch {
+	case a.Time != nil && b.Time != nil && !a.Time.Equal(*b.Time):
+		return a.Time.Before(*b.Time)
+	case a.Time != nil && b.Time == nil:
+		return true
+	case a.Time == nil && b.Time != nil:
+		return false
+	}
+	if a.FS != b.FS {
+		return a.FS < b.FS
+	}
+	if a.FileName != b.FileName {
+		return a.FileName < b.FileName
+	}
+	return a.Line < b.Line
+}
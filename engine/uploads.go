@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"github.com/Stratoscale/logserver/source"
+)
+
+// Uploads provides the source of the files that were uploaded in a session
+type Uploads interface {
+	Source(session string) (source.Source, bool)
+}
+
+// sources returns the sources of a request. If the request has a session with uploaded files,
+// the uploads source is added to the configured sources.
+func (h *handler) sources(req Request) source.Sources {
+	base := h.baseSources(req)
+	src, ok := h.uploadSource(req)
+	if !ok {
+		return base
+	}
+	sources := make(source.Sources, 0, len(base)+1)
+	return append(append(sources, base...), src)
+}
+
+// baseSources returns the sources of a request, without the uploads source
+func (h *handler) baseSources(req Request) source.Sources {
+	if h.Sources != nil {
+		return req.sources
+	}
+	return h.source
+}
+
+// acquire returns the current sources for a request, and a function that releases them when the request
+// finished
+func (h *handler) acquire() (source.Sources, func()) {
+	if h.Sources != nil {
+		return h.Sources.Acquire()
+	}
+	return h.source, func() {}
+}
+
+func (h *handler) uploadSource(req Request) (source.Source, bool) {
+	if h.Uploads == nil || req.Session == "" {
+		return source.Source{}, false
+	}
+	return h.Uploads.Source(req.Session)
+}
@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/parse"
+)
+
+// watchQueueSize is the number of mirrored responses that are queued for a watcher, a watcher that falls
+// further behind is disconnected from the session, so it does not slow down the shared connection
+const watchQueueSize = 256
+
+// watchSessions are the shared sessions of connections, by their watch keys
+type watchSessions struct {
+	sync.Mutex
+	m map[string]*watchSession
+}
+
+// watchSession mirrors the requests of a shared connection, and their responses, to the connections
+// that watch it
+type watchSession struct {
+	key string
+	// lock guards the current request and the watchers
+	lock     sync.Mutex
+	req      *Request
+	watchers map[*watcher]bool
+}
+
+// watcher is a watch request of a connection that joined a session
+type watcher struct {
+	ctx context.Context
+	// meta is the meta of the watch request, the mirrored responses are sent as its responses
+	meta Meta
+	ch   chan *Response
+	// allowed are the sources of the current request that the watcher is authorized to see, nil allows all
+	allowed map[string]bool
+	// forbidden is set if the watcher is not authorized to see the current request
+	forbidden bool
+	// lagged is set if the watcher was disconnected since it fell behind the session
+	lagged bool
+}
+
+// share starts a session that mirrors the requests of a connection, and returns its watch key
+func (h *handler) share() *watchSession {
+	b := make([]byte, 16)
+	rand.Read(b)
+	s := &watchSession{key: hex.EncodeToString(b), watchers: make(map[*watcher]bool)}
+	h.watches.Lock()
+	defer h.watches.Unlock()
+	h.watches.m[s.key] = s
+	return s
+}
+
+// unshare ends a session, its watch requests are finished
+func (h *handler) unshare(s *watchSession) {
+	h.watches.Lock()
+	delete(h.watches.m, s.key)
+	h.watches.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for w := range s.watchers {
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
+
+// mirror returns a channel that forwards the responses of a request to send, and mirrors them to the watchers
+// of the session. The returned function should be called after the request was served, it waits until all
+// the responses were forwarded. If the session is nil, send is returned.
+func (h *handler) mirror(s *watchSession, req Request, send chan<- *Response) (chan<- *Response, func()) {
+	if s == nil {
+		return send, func() {}
+	}
+	s.lock.Lock()
+	s.req = &req
+	for w := range s.watchers {
+		h.authorizeWatcher(w, req)
+		w.queueRequest(s)
+	}
+	s.lock.Unlock()
+
+	var (
+		ch   = make(chan *Response)
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for resp := range ch {
+			send <- resp
+			s.lock.Lock()
+			for w := range s.watchers {
+				if mirrored := h.watched(w, req, resp); mirrored != nil {
+					w.queue(s, &Response{Meta: w.meta, Watched: mirrored})
+				}
+			}
+			s.lock.Unlock()
+		}
+	}()
+	return ch, func() {
+		close(ch)
+		<-done
+	}
+}
+
+// watch mirrors the requests and responses of the shared session of the request watch key, until the request
+// is cancelled or the session ends
+func (h *handler) watch(ctx context.Context, req Request, send chan<- *Response) {
+	h.watches.Lock()
+	s := h.watches.m[req.WatchKey]
+	h.watches.Unlock()
+	if s == nil {
+		send <- &Response{Meta: req.Meta, Error: fmt.Sprintf("No shared session %q", req.WatchKey)}
+		return
+	}
+
+	w := &watcher{ctx: ctx, meta: req.Meta, ch: make(chan *Response, watchQueueSize)}
+	s.lock.Lock()
+	s.watchers[w] = true
+	// a watcher starts with the current request of the session
+	if s.req != nil {
+		h.authorizeWatcher(w, *s.req)
+		w.queueRequest(s)
+	}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.watchers[w] {
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case resp, ok := <-w.ch:
+			if !ok {
+				if w.lagged {
+					send <- &Response{Meta: req.Meta, Error: "Watcher fell behind the shared session"}
+				}
+				return
+			}
+			select {
+			case send <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// queue queues a mirrored response to a watcher without blocking, a watcher whose queue is full is removed
+// from the session. It is called with the session lock held.
+func (w *watcher) queue(s *watchSession, resp *Response) {
+	select {
+	case w.ch <- resp:
+	default:
+		log.Warnf("Watcher of session %s fell behind, disconnecting it", s.key)
+		w.lagged = true
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
+
+// queueRequest queues the current request of the session to a watcher, unless the watcher is not authorized
+// to see it. It is called with the session lock held.
+func (w *watcher) queueRequest(s *watchSession) {
+	if !w.forbidden {
+		w.queue(s, &Response{Meta: w.meta, WatchRequest: s.req})
+	}
+}
+
+// authorizeWatcher narrows the sources of a mirrored request to the sources that the watcher is authorized
+// to see. It is called with the session lock held.
+func (h *handler) authorizeWatcher(w *watcher, req Request) {
+	w.forbidden = h.authorize(w.ctx, &req) != nil
+	w.allowed = req.filterSourceMap
+}
+
+// watched returns the response of a mirrored request as the watcher may see it, or nil if the watcher may not
+// see it at all
+func (h *handler) watched(w *watcher, req Request, resp *Response) *Response {
+	if w.forbidden {
+		// the watcher knows about the request, but not about its results
+		if !resp.Finished {
+			return nil
+		}
+		return &Response{Meta: resp.Meta, Error: fmt.Sprintf("forbidden: %s", req.Action), Finished: true}
+	}
+	if resp.FS != "" && w.allowed != nil && !w.allowed[resp.FS] {
+		return nil
+	}
+	mirrored := resp.FilterSources(w.allowed)
+	if len(resp.Lines) > 0 {
+		lines := make([]parse.Log, 0, len(resp.Lines))
+		for _, line := range resp.Lines {
+			if w.allowedLine(h.Authorizer, req.Action, line) {
+				lines = append(lines, line)
+			}
+		}
+		mirrored.Lines = lines
+	}
+	return mirrored
+}
+
+// allowedLine returns true if the watcher may see a line. The files of actions that are authorized when they
+// are read, like get-window, are authorized for each line.
+func (w *watcher) allowedLine(authz auth.Authorizer, action string, line parse.Log) bool {
+	if line.FS == "" {
+		return true
+	}
+	if w.allowed != nil && !w.allowed[line.FS] {
+		return false
+	}
+	switch action {
+	case "get-window", "create-permalink", "resolve-permalink":
+		return auth.Authorized(w.ctx, authz, action, line.FS, line.FileName)
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/bluele/gcache"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	parser, err := parse.New(nil)
+	require.Nil(t, err)
+	h := newHandler(Config{}, memorySources(), parser, gcache.New(10).Build())
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+s.Listener.Addr().String(), nil)
+		require.Nil(t, err)
+		return conn
+	}
+	read := func(conn *websocket.Conn) *Response {
+		var resp Response
+		require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.Nil(t, conn.ReadJSON(&resp))
+		return &resp
+	}
+
+	owner, watcher := dial(), dial()
+	defer owner.Close()
+	defer watcher.Close()
+
+	require.Nil(t, watcher.WriteJSON(Request{Meta: Meta{ID: 1, Action: "watch"}, WatchKey: "missing"}))
+	assert.Contains(t, read(watcher).Error, "No shared session")
+	assert.True(t, read(watcher).Finished)
+
+	require.Nil(t, owner.WriteJSON(Request{Meta: Meta{ID: 1, Action: "share"}}))
+	key := read(owner).WatchKey
+	require.NotEmpty(t, key)
+	assert.True(t, read(owner).Finished)
+
+	require.Nil(t, watcher.WriteJSON(Request{Meta: Meta{ID: 2, Action: "watch"}, WatchKey: key}))
+	// wait for the watcher to join the session
+	h.watches.Lock()
+	sess := h.watches.m[key]
+	h.watches.Unlock()
+	for joined := false; !joined; time.Sleep(10 * time.Millisecond) {
+		sess.lock.Lock()
+		joined = len(sess.watchers) == 1
+		sess.lock.Unlock()
+	}
+
+	req := Request{Meta: Meta{ID: 2, Action: "get-content"}, Path: Path{"var", "log", "syslog"}, FilterSource: []string{"node1"}}
+	require.Nil(t, owner.WriteJSON(req))
+	var ownerLines []string
+	for resp := read(owner); !resp.Finished; resp = read(owner) {
+		for _, l := range resp.Lines {
+			ownerLines = append(ownerLines, l.Msg)
+		}
+	}
+	assert.Equal(t, []string{"start", "error: disk full", "stop"}, ownerLines)
+
+	resp := read(watcher)
+	assert.Equal(t, Meta{ID: 2, Action: "watch"}, resp.Meta)
+	require.NotNil(t, resp.WatchRequest)
+	assert.Equal(t, "get-content", resp.WatchRequest.Action)
+	assert.Equal(t, req.Path, resp.WatchRequest.Path)
+	var watchedLines []string
+	for {
+		resp := read(watcher)
+		require.NotNil(t, resp.Watched)
+		assert.Equal(t, 2, resp.ID)
+		if resp.Watched.Finished {
+			break
+		}
+		for _, l := range resp.Watched.Lines {
+			watchedLines = append(watchedLines, l.Msg)
+		}
+	}
+	assert.Equal(t, ownerLines, watchedLines)
+
+	// the watch request is finished when the session ends
+	require.Nil(t, owner.WriteJSON(Request{Meta: Meta{ID: 3, Action: "unshare"}}))
+	assert.True(t, read(owner).Finished)
+	resp = read(watcher)
+	assert.Equal(t, 2, resp.ID)
+	assert.True(t, resp.Finished)
+}
+
+func TestWatchedSources(t *testing.T) {
+	t.Parallel()
+
+	h := &handler{}
+	req := Request{Meta: Meta{Action: "search"}}
+	resp := &Response{
+		Meta:  req.Meta,
+		Lines: []parse.Log{{Msg: "a", FS: "node1"}, {Msg: "b", FS: "node2"}},
+		Files: []*File{{Key: "f", Instances: []FileInstance{{FS: "node1"}, {FS: "node2"}}}},
+	}
+
+	w := &watcher{allowed: map[string]bool{"node1": true}}
+	mirrored := h.watched(w, req, resp)
+	require.NotNil(t, mirrored)
+	assert.Equal(t, []parse.Log{{Msg: "a", FS: "node1"}}, mirrored.Lines)
+	require.Len(t, mirrored.Files, 1)
+	assert.Equal(t, []FileInstance{{FS: "node1"}}, mirrored.Files[0].Instances)
+	// the response of the shared connection is not changed
+	assert.Len(t, resp.Lines, 2)
+
+	assert.Nil(t, h.watched(w, req, &Response{Meta: Meta{FS: "node2"}, Lines: resp.Lines}))
+
+	w = &watcher{forbidden: true}
+	assert.Nil(t, h.watched(w, req, resp))
+	finished := h.watched(w, req, &Response{Meta: req.Meta, Finished: true})
+	require.NotNil(t, finished)
+	assert.Equal(t, "forbidden: search", finished.Error)
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+)
+
+const defaultWindowLines = 20
+
+// Target is a file in a source
+type Target struct {
+	FS   string `json:"fs"`
+	Path Path   `json:"path"`
+}
+
+// window responds for each target with the lines of the file around the request time: up to window_lines lines
+// before the first line at or after the time, and up to window_lines lines from it. Lines without a time are
+// considered to have the time of the line before them.
+func (h *handler) window(ctx context.Context, req Request, send chan<- *Response) {
+	if req.Time == nil {
+		send <- &Response{Meta: req.Meta, Error: "Time was not specified"}
+		return
+	}
+	n := req.WindowLines
+	if n <= 0 {
+		n = defaultWindowLines
+	}
+	if n > h.SearchMaxSize {
+		n = h.SearchMaxSize
+	}
+	sources := make(map[string]source.Source)
+	for _, src := range h.sources(req) {
+		sources[src.Name] = src
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(req.Targets))
+	for _, t := range req.Targets {
+		go func(t Target) {
+			defer wg.Done()
+			src, ok := sources[t.FS]
+			if !ok {
+				send <- sourceErrorResponse(req, t.FS, codeNotFound, fmt.Errorf("source %s was not found", t.FS))
+				return
+			}
+			path := src.FS.Join(t.Path...)
+			if !auth.Authorized(ctx, h.Authorizer, req.Action, src.Name, path) {
+				send <- sourceErrorResponse(req, t.FS, codePermission, fmt.Errorf("forbidden: %s", req.Action))
+				return
+			}
+			h.windowFile(ctx, send, req, src, path, n)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (h *handler) windowFile(ctx context.Context, send chan<- *Response, req Request, node source.Source, path string, n int) {
+	node = node.WithContext(ctx)
+	log := log.WithField("path", node.Name+":"+path)
+	if stat, err := node.FS.Lstat(path); err != nil || stat.IsDir() {
+		if err == nil {
+			err = fmt.Errorf("%s is a directory", path)
+		}
+		send <- sourceErrorResponse(req, node.Name, codeStat, err)
+		return
+	}
+	r, err := filesystem.OpenText(node.FS, path)
+	if err != nil {
+		log.WithError(err).Error("Failed open")
+		send <- sourceErrorResponse(req, node.Name, codeOpen, err)
+		return
+	}
+	defer r.Close()
+
+	var (
+		scanner, offsets = newLineScanner(r, 0)
+		mem              = new(parse.Memory)
+		before, after    []parse.Log
+		lastTime         *time.Time
+		lineNumber       = 0
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for len(after) < n && scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		lineNumber++
+		line := h.parseLine(path, scanner.Bytes(), mem, req.IncludeRaw)
+		line.FileName = path
+		line.FS = node.Name
+		line.Line = lineNumber
+		line.Offset = offsets.offset
+		if line.Time != nil {
+			lastTime = line.Time
+		}
+		if len(after) == 0 && (lastTime == nil || lastTime.Before(*req.Time)) {
+			if len(before) == n {
+				before = before[1:]
+			}
+			before = append(before, *line)
+			continue
+		}
+		after = append(after, *line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Error("Failed scan")
+		send <- sourceErrorResponse(req, node.Name, codeRead, err)
+		return
+	}
+	send <- &Response{Meta: fileMeta(req, node.Name, path), Lines: append(before, after...)}
+}
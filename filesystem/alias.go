@@ -0,0 +1,150 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WrapAliases wraps a filesystem with virtual paths that map to real paths in it, given as a map from the virtual
+// path to the real path. It is useful for showing commonly needed files at the same paths in sources with
+// different layouts. A real path can be a file or a directory, and the files under a directory alias are
+// accessible under the virtual path. Aliases whose real path doesn't exist in the filesystem are not shown.
+func WrapAliases(inner FileSystem, aliases map[string]string) (FileSystem, error) {
+	if len(aliases) == 0 {
+		return inner, nil
+	}
+	a := &aliasFS{FileSystem: inner, aliases: make(map[string]string, len(aliases))}
+	for virtual, real := range aliases {
+		v, r := cleanPath(virtual), cleanPath(real)
+		if v == "" || r == "" {
+			return nil, fmt.Errorf("alias %q -> %q: paths must not be empty", virtual, real)
+		}
+		a.aliases[v] = r
+		a.virtual = append(a.virtual, v)
+	}
+	sort.Strings(a.virtual)
+	for _, v := range a.virtual {
+		for _, other := range a.virtual {
+			if strings.HasPrefix(other, v+"/") {
+				return nil, fmt.Errorf("alias %s is inside alias %s", other, v)
+			}
+		}
+	}
+	return a, nil
+}
+
+type aliasFS struct {
+	FileSystem
+	// aliases maps clean virtual paths to clean real paths
+	aliases map[string]string
+	// virtual are the sorted virtual paths
+	virtual []string
+}
+
+// WithContext binds the inner filesystem to the context
+func (a *aliasFS) WithContext(ctx context.Context) FileSystem {
+	return &aliasFS{FileSystem: WithContext(ctx, a.FileSystem), aliases: a.aliases, virtual: a.virtual}
+}
+
+// resolve returns the real path of a name, and true if it is an alias or inside an alias
+func (a *aliasFS) resolve(name string) (string, bool) {
+	p := cleanPath(name)
+	for _, v := range a.virtual {
+		if p == v {
+			return a.aliases[v], true
+		}
+		if strings.HasPrefix(p, v+"/") {
+			return a.aliases[v] + strings.TrimPrefix(p, v), true
+		}
+	}
+	return name, false
+}
+
+func (a *aliasFS) Open(name string) (File, error) {
+	real, _ := a.resolve(name)
+	return a.FileSystem.Open(real)
+}
+
+func (a *aliasFS) Lstat(name string) (os.FileInfo, error) {
+	real, ok := a.resolve(name)
+	if ok {
+		stat, err := a.FileSystem.Lstat(real)
+		if err != nil {
+			return nil, err
+		}
+		return &aliasInfo{FileInfo: stat, name: path.Base(cleanPath(name))}, nil
+	}
+	stat, err := a.FileSystem.Lstat(name)
+	if os.IsNotExist(err) && a.virtualDir(cleanPath(name)) {
+		return &memoryInfo{name: path.Base(cleanPath(name)), isDir: true}, nil
+	}
+	return stat, err
+}
+
+func (a *aliasFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	real, ok := a.resolve(dirname)
+	if ok {
+		return a.FileSystem.ReadDir(real)
+	}
+	dir := cleanPath(dirname)
+	infos, err := a.FileSystem.ReadDir(dirname)
+	if err != nil && !(os.IsNotExist(err) && a.virtualDir(dir)) {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		seen[info.Name()] = true
+	}
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	for _, v := range a.virtual {
+		if !strings.HasPrefix(v, prefix) {
+			continue
+		}
+		child := strings.TrimPrefix(v, prefix)
+		if i := strings.Index(child, "/"); i >= 0 {
+			// the alias is deeper, its parent directories are shown if they don't exist
+			if child = child[:i]; !seen[child] {
+				seen[child] = true
+				infos = append(infos, &memoryInfo{name: child, isDir: true})
+			}
+			continue
+		}
+		stat, err := a.FileSystem.Lstat(a.aliases[v])
+		if err != nil || seen[child] {
+			continue
+		}
+		seen[child] = true
+		infos = append(infos, &aliasInfo{FileInfo: stat, name: child})
+	}
+	return infos, nil
+}
+
+// virtualDir returns true if a clean path is a directory that holds aliases
+func (a *aliasFS) virtualDir(p string) bool {
+	for _, v := range a.virtual {
+		if p == "" || strings.HasPrefix(v, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath returns a clean path without leading and trailing slashes, it is the key of a path in memory filesystems
+func cleanPath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// aliasInfo is the file info of a real path, with the name of its alias
+type aliasInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i *aliasInfo) Name() string { return i.name }
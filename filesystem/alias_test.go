@@ -0,0 +1,72 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliases(t *testing.T) {
+	t.Parallel()
+
+	inner := NewMemory(map[string]string{
+		"var/log/httpd/access_log": "GET /",
+		"var/log/app/app.log":      "started",
+		"etc/hosts":                "localhost",
+	})
+	fs, err := WrapAliases(inner, map[string]string{
+		"important/api.log": "/var/log/httpd/access_log",
+		"important/app":     "var/log/app/",
+		"important/missing": "var/log/missing.log",
+		"hosts":             "etc/hosts",
+	})
+	require.Nil(t, err)
+
+	names := func(dir string) []string {
+		infos, err := fs.ReadDir(dir)
+		require.Nil(t, err, dir)
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+	assert.Equal(t, []string{"etc", "var", "hosts", "important"}, names(""))
+	assert.Equal(t, []string{"api.log", "app"}, names("/important"))
+	assert.Equal(t, []string{"app.log"}, names("important/app"))
+	assert.Equal(t, []string{"app", "httpd"}, names("var/log"))
+
+	stat, err := fs.Lstat("/important/api.log")
+	require.Nil(t, err)
+	assert.Equal(t, "api.log", stat.Name())
+	assert.Equal(t, int64(5), stat.Size())
+	stat, err = fs.Lstat("important")
+	require.Nil(t, err)
+	assert.True(t, stat.IsDir())
+	_, err = fs.Lstat("important/missing")
+	assert.True(t, os.IsNotExist(err))
+	_, err = fs.Lstat("other")
+	assert.True(t, os.IsNotExist(err))
+
+	for name, want := range map[string]string{
+		"important/api.log":     "GET /",
+		"important/app/app.log": "started",
+		"hosts":                 "localhost",
+		"etc/hosts":             "localhost",
+	} {
+		f, err := fs.Open(name)
+		require.Nil(t, err, name)
+		got, err := ioutil.ReadAll(f)
+		f.Close()
+		require.Nil(t, err)
+		assert.Equal(t, want, string(got), name)
+	}
+
+	_, err = WrapAliases(inner, map[string]string{"a": "etc", "a/b": "var"})
+	assert.NotNil(t, err)
+	_, err = WrapAliases(inner, map[string]string{"/": "etc"})
+	assert.NotNil(t, err)
+}
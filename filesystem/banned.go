@@ -0,0 +1,131 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ArchiveSeparator is the separator between the path of an archive and the path of a file inside it,
+// for example: logs.tar.gz!first/service.log
+const ArchiveSeparator = "!"
+
+// WrapBanned wraps a filesystem so paths that match banned patterns, like keys and secrets, don't exist in it:
+// they are not listed in directories, can't be opened, and the files under banned directories are banned too.
+// Patterns without a slash, like *.key or shadow, match the names of files and directories at any depth, and
+// patterns with a slash, like etc/secrets or **/id_rsa*, match their paths from the root of the filesystem.
+// A trailing slash, like secrets/, is ignored.
+func WrapBanned(inner FileSystem, patterns []string) (FileSystem, error) {
+	if len(patterns) == 0 {
+		return inner, nil
+	}
+	b := &bannedFS{FileSystem: inner}
+	for _, pattern := range patterns {
+		p := strings.Trim(pattern, "/")
+		if p == "" {
+			return nil, fmt.Errorf("banned path %q: pattern must not be empty", pattern)
+		}
+		g, err := glob.Compile(p, '/')
+		if err != nil {
+			return nil, fmt.Errorf("banned path %q: %s", pattern, err)
+		}
+		if strings.Contains(p, "/") {
+			b.paths = append(b.paths, g)
+		} else {
+			b.names = append(b.names, g)
+		}
+	}
+	return b, nil
+}
+
+type bannedFS struct {
+	FileSystem
+	// names match the names of files at any depth, paths match clean paths
+	names []glob.Glob
+	paths []glob.Glob
+}
+
+// WithContext binds the inner filesystem to the context, the paths are banned in the view as in the filesystem
+func (b *bannedFS) WithContext(ctx context.Context) FileSystem {
+	return &bannedFS{FileSystem: WithContext(ctx, b.FileSystem), names: b.names, paths: b.paths}
+}
+
+// banned returns true if a path, or one of its parent directories, matches a banned pattern.
+// Files inside archives are matched as files under the archive, and path patterns also match their paths
+// from the root of the archive.
+func (b *bannedFS) banned(name string) bool {
+	p := cleanPath(name)
+	if p == "" {
+		return false
+	}
+	var elems []string
+	for i, part := range strings.Split(p, ArchiveSeparator) {
+		inner := strings.FieldsFunc(part, func(r rune) bool { return r == '/' })
+		if i > 0 && b.match(inner) {
+			return true
+		}
+		elems = append(elems, inner...)
+	}
+	return b.match(elems)
+}
+
+// match returns true if the path of the elements, or one of its parents, matches a banned pattern
+func (b *bannedFS) match(elems []string) bool {
+	for i, elem := range elems {
+		for _, g := range b.names {
+			if g.Match(elem) {
+				return true
+			}
+		}
+		if len(b.paths) == 0 {
+			continue
+		}
+		parent := strings.Join(elems[:i+1], "/")
+		for _, g := range b.paths {
+			if g.Match(parent) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notExist returns the error of a banned path, which is the error of a missing path, so banned paths can't
+// be told from paths that don't exist
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func (b *bannedFS) Open(name string) (File, error) {
+	if b.banned(name) {
+		return nil, notExist("open", name)
+	}
+	return b.FileSystem.Open(name)
+}
+
+func (b *bannedFS) Lstat(name string) (os.FileInfo, error) {
+	if b.banned(name) {
+		return nil, notExist("lstat", name)
+	}
+	return b.FileSystem.Lstat(name)
+}
+
+func (b *bannedFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if b.banned(dirname) {
+		return nil, notExist("readdir", dirname)
+	}
+	infos, err := b.FileSystem.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if !b.banned(b.Join(dirname, info.Name())) {
+			allowed = append(allowed, info)
+		}
+	}
+	return allowed, nil
+}
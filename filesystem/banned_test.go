@@ -0,0 +1,76 @@
+package filesystem
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanned(t *testing.T) {
+	t.Parallel()
+
+	inner := NewMemory(map[string]string{
+		"var/log/syslog":             "started",
+		"var/log/app/secrets/db":     "password",
+		"etc/ssl/server.key":         "key",
+		"etc/shadow":                 "root:x",
+		"etc/hosts":                  "localhost",
+		"home/user/.ssh/id_rsa":      "key",
+		"home/user/.ssh/known_hosts": "hosts",
+	})
+	fs, err := WrapBanned(inner, []string{"*.key", "secrets/", "/etc/shadow", "**/.ssh/id_rsa*"})
+	require.Nil(t, err)
+
+	names := func(dir string) []string {
+		infos, err := fs.ReadDir(dir)
+		require.Nil(t, err, dir)
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+	assert.Equal(t, []string{"hosts", "ssl"}, names("etc"))
+	assert.Equal(t, []string{"app", "syslog"}, names("/var/log"))
+	assert.Nil(t, names("var/log/app"))
+	assert.Equal(t, []string{"known_hosts"}, names("home/user/.ssh"))
+
+	for _, name := range []string{"etc/ssl/server.key", "var/log/app/secrets", "var/log/app/secrets/db", "/etc/shadow", "home/user/.ssh/id_rsa"} {
+		_, err := fs.Lstat(name)
+		assert.True(t, os.IsNotExist(err), name)
+		_, err = fs.Open(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	_, err = fs.ReadDir("var/log/app/secrets")
+	assert.True(t, os.IsNotExist(err))
+
+	f, err := fs.Open("etc/hosts")
+	require.Nil(t, err)
+	f.Close()
+
+	// files inside archives are banned by their names, by the names of their directories in the archive, and by
+	// their paths from the root of the filesystem or of the archive
+	archives, err := WrapBanned(inner, []string{"secrets", "*.pw", "etc/secrets/**"})
+	require.Nil(t, err)
+	b := archives.(*bannedFS)
+	for name, want := range map[string]bool{
+		"logs.tar.gz!secrets/db.pw":          true,
+		"logs.tar.gz!db.pw":                  true,
+		"logs.tar.gz!app/secrets":            true,
+		"etc/logs.tar!secrets/db":            true,
+		"logs.tar.gz!etc/secrets/db":         true,
+		"logs.tar.gz!first/inner.tar!db.pw":  true,
+		"logs.tar.gz!first/service.log":      false,
+		"logs.tar.gz!etc/hosts":              false,
+		"logs.tar.gz!first/inner.tar!db.log": false,
+	} {
+		assert.Equal(t, want, b.banned(name), name)
+	}
+
+	_, err = WrapBanned(inner, []string{"["})
+	assert.NotNil(t, err)
+	_, err = WrapBanned(inner, []string{"/"})
+	assert.NotNil(t, err)
+}
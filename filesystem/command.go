@@ -0,0 +1,211 @@
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/temp"
+)
+
+const (
+	defaultCommandFileName = "output"
+	// maxCommandStderr is the number of bytes of the end of the standard error of a command that are kept
+	// for its error
+	maxCommandStderr = 4096
+)
+
+// Command is a filesystem with a single file, which holds the output of a running command.
+// It is useful for log producers that don't write to files, like `kubectl logs -f`.
+// The output file grows as long as the command is running.
+type Command struct {
+	name   string
+	cmd    *exec.Cmd
+	output *temp.File
+	stderr *stderrTail
+	exited chan struct{}
+	lock   sync.Mutex
+	// err is the reason that the output stopped growing, if it is not a successful exit of the command
+	err error
+}
+
+// NewCommand runs a command and returns a filesystem that exposes its standard output.
+// The name of the file is the host of the URL, for example: exec://kubelet.log
+// The output is written in the temporary storage, and stops growing when the storage is full.
+// Reads of the output return an error after its end if it was truncated, or if the command failed, with the
+// end of the standard error of the command.
+func NewCommand(u *url.URL, command []string, tmp *temp.Storage) (FileSystem, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("command was not specified")
+	}
+	name := strings.Trim(u.Host+u.Path, sep)
+	if name == "" {
+		name = defaultCommandFileName
+	}
+
+	output, err := tmp.TempFile("logserver-cmd-")
+	if err != nil {
+		return nil, fmt.Errorf("create output file: %s", err)
+	}
+
+	c := &Command{
+		name:   name,
+		cmd:    exec.Command(command[0], command[1:]...),
+		output: output,
+		stderr: &stderrTail{},
+		exited: make(chan struct{}),
+	}
+	c.cmd.Stdout = &commandOutput{c: c, command: command}
+	c.cmd.Stderr = c.stderr
+	setProcessGroup(c.cmd)
+	if err := c.cmd.Start(); err != nil {
+		output.Remove()
+		return nil, fmt.Errorf("start command %v: %s", command, err)
+	}
+	go func() {
+		err := c.cmd.Wait()
+		logrus.WithField("pkg", "command").WithError(err).Infof("Command %v exited", command)
+		if err != nil {
+			if stderr := c.stderr.String(); stderr != "" {
+				err = fmt.Errorf("%s: %s", err, stderr)
+			}
+			c.fail(fmt.Errorf("command %v failed: %s", command, err))
+		}
+		close(c.exited)
+	}()
+	return c, nil
+}
+
+// fail keeps the first reason that the output stopped growing
+func (c *Command) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Err returns the reason that the output stopped growing, or nil if it is complete or still growing
+func (c *Command) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+// commandOutput writes the output of a command to its file. When the temporary storage is full, the rest
+// of the output is discarded, so the command is not blocked on its standard output.
+type commandOutput struct {
+	c       *Command
+	command []string
+	full    bool
+}
+
+func (o *commandOutput) Write(p []byte) (int, error) {
+	if o.full {
+		return len(p), nil
+	}
+	n, err := o.c.output.Write(p)
+	if err == temp.ErrQuota {
+		logrus.WithField("pkg", "command").Warnf("Temporary storage is full, discarding the output of command %v", o.command)
+		o.c.fail(fmt.Errorf("output of command %v truncated: %s", o.command, err))
+		o.full = true
+		return len(p), nil
+	}
+	return n, err
+}
+
+// stderrTail keeps the end of the standard error of a command
+type stderrTail struct {
+	lock sync.Mutex
+	b    []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.b = append(t.b, p...)
+	if len(t.b) > maxCommandStderr {
+		t.b = t.b[len(t.b)-maxCommandStderr:]
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return strings.TrimSpace(string(t.b))
+}
+
+func (c *Command) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if strings.Trim(dirname, sep) != "" {
+		return nil, os.ErrNotExist
+	}
+	stat, err := c.Lstat(c.name)
+	if err != nil {
+		return nil, err
+	}
+	return []os.FileInfo{stat}, nil
+}
+
+func (c *Command) Lstat(name string) (os.FileInfo, error) {
+	switch strings.Trim(name, sep) {
+	case "":
+		return file{isDir: true}, nil
+	case c.name:
+		stat, err := c.output.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return file{name: c.name, size: stat.Size(), time: stat.ModTime()}, nil
+	default:
+		return nil, os.ErrNotExist
+	}
+}
+
+func (c *Command) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (c *Command) Open(name string) (File, error) {
+	if strings.Trim(name, sep) != c.name {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(c.output.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &commandFile{File: f, c: c}, nil
+}
+
+// commandFile is the output file of a command, whose reads fail at its end if the output is incomplete
+type commandFile struct {
+	*os.File
+	c *Command
+}
+
+func (f *commandFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err == io.EOF {
+		if cerr := f.c.Err(); cerr != nil {
+			return n, cerr
+		}
+	}
+	return n, err
+}
+
+// Close kills the command, with the processes that it started, and removes its output
+func (c *Command) Close() error {
+	select {
+	case <-c.exited:
+	default:
+		killProcessGroup(c.cmd)
+		<-c.exited
+	}
+	return c.output.Remove()
+}
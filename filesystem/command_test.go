@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/temp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readCommand reads the output file of a command until the read is done
+func readCommand(t *testing.T, fs FileSystem, done func(got string, err error) bool) (string, error) {
+	t.Helper()
+	var (
+		got string
+		err error
+	)
+	for i := 0; i < 200; i++ {
+		f, openErr := fs.Open("app.log")
+		require.Nil(t, openErr)
+		var b []byte
+		b, err = ioutil.ReadAll(f)
+		f.Close()
+		if got = string(b); done(got, err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return got, err
+}
+
+// failed is done when a read fails
+func failed(_ string, err error) bool {
+	return err != nil
+}
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	u := &url.URL{Scheme: "exec", Host: "app.log"}
+	fs, err := NewCommand(u, []string{"echo", "hello"}, nil)
+	require.Nil(t, err)
+	defer fs.Close()
+
+	got, err := readCommand(t, fs, func(got string, err error) bool { return got != "" || err != nil })
+	require.Nil(t, err)
+	assert.Equal(t, "hello\n", got)
+
+	infos, err := fs.ReadDir("/")
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "app.log", infos[0].Name())
+	assert.Equal(t, int64(6), infos[0].Size())
+	stat, err := fs.Lstat("")
+	require.Nil(t, err)
+	assert.True(t, stat.IsDir())
+	_, err = fs.ReadDir("dir")
+	assert.True(t, os.IsNotExist(err))
+	_, err = fs.Lstat("other.log")
+	assert.True(t, os.IsNotExist(err))
+	_, err = fs.Open("other.log")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = NewCommand(u, nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewCommand(u, []string{"/no/such/command"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCommandFollow(t *testing.T) {
+	t.Parallel()
+
+	fs, err := NewCommand(&url.URL{Scheme: "exec", Host: "app.log"}, []string{"sh", "-c", "echo a; sleep 0.2; echo b; sleep 60"}, nil)
+	require.Nil(t, err)
+	c := fs.(*Command)
+
+	// a followed file is read again from where the last read stopped, as the output grows
+	f, err := fs.Open("app.log")
+	require.Nil(t, err)
+	defer f.Close()
+	var got string
+	for i := 0; i < 200 && got != "a\nb\n"; i++ {
+		b, err := ioutil.ReadAll(f)
+		require.Nil(t, err)
+		got += string(b)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "a\nb\n", got)
+
+	// close kills the running command and removes its output
+	done := make(chan error)
+	go func() { done <- fs.Close() }()
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not killed")
+	}
+	assert.NotNil(t, c.cmd.ProcessState)
+	_, err = os.Stat(c.output.Name())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCommandErrors(t *testing.T) {
+	t.Parallel()
+
+	// a failed command fails the reads after its output, with its standard error
+	fs, err := NewCommand(&url.URL{Scheme: "exec", Host: "app.log"}, []string{"sh", "-c", "echo out; echo bad config >&2; exit 3"}, nil)
+	require.Nil(t, err)
+	defer fs.Close()
+	got, err := readCommand(t, fs, failed)
+	assert.Equal(t, "out\n", got)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exit status 3: bad config")
+
+	// an output that did not fit in the temporary storage is truncated
+	dir, err := ioutil.TempDir("", "command-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tmp, err := temp.New(temp.Config{Dir: dir, MaxSize: 8})
+	require.Nil(t, err)
+	fs, err = NewCommand(&url.URL{Scheme: "exec", Host: "app.log"}, []string{"echo", strings.Repeat("x", 20)}, tmp)
+	require.Nil(t, err)
+	defer fs.Close()
+	got, err = readCommand(t, fs, failed)
+	assert.Equal(t, "", got)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "truncated")
+	assert.NotEqual(t, io.EOF, err)
+}
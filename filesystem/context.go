@@ -0,0 +1,133 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// Contexter is implemented by filesystems whose operations can be aborted by a context, like remote
+// filesystems, and by the wrappers of filesystems, which bind their inner filesystem to the context.
+type Contexter interface {
+	// WithContext returns a view of the filesystem whose operations, and the reads of the files that were
+	// opened by it, are aborted when the context is done. The view shares the resources of the filesystem,
+	// and should not be closed.
+	WithContext(ctx context.Context) FileSystem
+}
+
+// WithContext returns a view of a filesystem whose operations are aborted when the context is done.
+// Filesystems that don't implement Contexter, like local filesystems, are returned as is.
+func WithContext(ctx context.Context, fs FileSystem) FileSystem {
+	if c, ok := fs.(Contexter); ok {
+		return c.WithContext(ctx)
+	}
+	return fs
+}
+
+// done returns the done channel of a context, or nil, which blocks forever, for a filesystem without context
+func done(ctx context.Context) <-chan struct{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Done()
+}
+
+// contextDo calls f, and returns the error of the context if it is done before f returns. The call to f is not
+// aborted, it is left to complete in the background, and cleanup is called if f succeeds after it was abandoned.
+func contextDo(ctx context.Context, f func() error, cleanup func()) error {
+	if ctx == nil {
+		return f()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var (
+		result = make(chan error, 1)
+		lock   sync.Mutex
+		left   bool
+	)
+	go func() {
+		err := f()
+		lock.Lock()
+		defer lock.Unlock()
+		if left && err == nil && cleanup != nil {
+			cleanup()
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		lock.Lock()
+		defer lock.Unlock()
+		select {
+		case err := <-result:
+			return err
+		default:
+			left = true
+			return ctx.Err()
+		}
+	}
+}
+
+// contextFile is a file that is closed when its context is done, which aborts its pending reads
+type contextFile struct {
+	File
+	ctx    context.Context
+	once   sync.Once
+	err    error
+	closed chan struct{}
+}
+
+func newContextFile(ctx context.Context, f File) File {
+	if ctx == nil {
+		return f
+	}
+	cf := &contextFile{File: f, ctx: ctx, closed: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cf.close()
+		case <-cf.closed:
+		}
+	}()
+	return cf
+}
+
+func (f *contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Read(p)
+	if err != nil && err != io.EOF && f.ctx.Err() != nil {
+		err = f.ctx.Err()
+	}
+	return n, err
+}
+
+func (f *contextFile) close() {
+	f.once.Do(func() {
+		f.err = f.File.Close()
+		close(f.closed)
+	})
+}
+
+func (f *contextFile) Close() error {
+	f.close()
+	return f.err
+}
+
+// contextStat calls a function that returns a file info with contextDo
+func contextStat(ctx context.Context, f func() (os.FileInfo, error)) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := contextDo(ctx, func() (err error) {
+		info, err = f()
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ctxFS is a filesystem in memory whose views fail when their context is done
+type ctxFS struct {
+	memFS
+	ctx context.Context
+}
+
+func (c ctxFS) WithContext(ctx context.Context) FileSystem {
+	return ctxFS{memFS: c.memFS, ctx: ctx}
+}
+
+func (c ctxFS) Open(name string) (File, error) {
+	if c.ctx != nil && c.ctx.Err() != nil {
+		return nil, c.ctx.Err()
+	}
+	return c.memFS.Open(name)
+}
+
+func TestWithContext(t *testing.T) {
+	t.Parallel()
+
+	inner := ctxFS{memFS: memFS{"app.log": []byte("login from 10.0.0.1\n")}}
+	fs, err := WrapRedact(inner, []Redaction{{Regexp: `\d+\.\d+\.\d+\.\d+`}})
+	require.Nil(t, err)
+	fs, err = WrapAliases(fs, map[string]string{"current.log": "app.log"})
+	require.Nil(t, err)
+	fs = WrapRetry(WrapLimit(fs, "context", 2), Retry{Retries: 1})
+
+	read := func(fs FileSystem) (string, error) {
+		f, err := fs.Open("current.log")
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		return string(b), err
+	}
+
+	// a view is wrapped as the filesystem
+	ctx, cancel := context.WithCancel(context.Background())
+	got, err := read(WithContext(ctx, fs))
+	require.Nil(t, err)
+	assert.Equal(t, "login from [REDACTED]\n", got)
+
+	// the context reaches the inner filesystem, and the filesystem itself is not bound to it
+	cancel()
+	_, err = read(WithContext(ctx, fs))
+	assert.Equal(t, context.Canceled, err)
+	_, err = read(fs)
+	assert.Nil(t, err)
+
+	// filesystems without context support are returned as is
+	assert.Equal(t, FileSystem(inner.memFS), WithContext(ctx, inner.memFS))
+}
+
+func TestContextDo(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		release     = make(chan struct{})
+		cleaned     = make(chan struct{})
+	)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := contextDo(ctx, func() error {
+		<-release
+		return nil
+	}, func() { close(cleaned) })
+	assert.Equal(t, context.Canceled, err)
+
+	// the abandoned call is cleaned up when it completes
+	close(release)
+	select {
+	case <-cleaned:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned call was not cleaned up")
+	}
+
+	failure := errors.New("failure")
+	assert.Equal(t, failure, contextDo(context.Background(), func() error { return failure }, nil))
+}
+
+func TestNginxContext(t *testing.T) {
+	t.Parallel()
+
+	// the server sends the first part of the file, and blocks until the client goes away
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first part\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+	u, err := url.Parse("nginx+" + s.URL)
+	require.Nil(t, err)
+	fs, err := NewNginx(u)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := WithContext(ctx, fs).Open("app.log")
+	require.Nil(t, err)
+	defer f.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(f)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read was not aborted")
+	}
+}
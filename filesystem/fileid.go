@@ -0,0 +1,15 @@
+package filesystem
+
+import "os"
+
+// FileID identifies a file by its device and inode, so a file that is reachable through multiple paths,
+// like hard links and bind mounts, has the same id in all of them
+type FileID struct {
+	Dev, Ino uint64
+}
+
+// ID returns the id of a file from its stat. It returns false if the file has no id, like the files of
+// remote and in-memory filesystems.
+func ID(info os.FileInfo) (FileID, bool) {
+	return fileID(info)
+}
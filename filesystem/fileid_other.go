@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package filesystem
+
+import "os"
+
+func fileID(os.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
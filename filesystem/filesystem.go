@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"errors"
 	"io"
 
 	"github.com/kr/fs"
@@ -21,3 +22,13 @@ type FileSystem interface {
 	// This is useful for remote filesystems, like http, or sftp
 	Close() error
 }
+
+// NoSeek is a seeker for files that can't be seeked, like files that are streamed
+// over http or from inside an archive.
+var NoSeek io.Seeker = noSeek{}
+
+type noSeek struct{}
+
+func (noSeek) Seek(int64, int) (int64, error) {
+	return 0, errors.New("seek not supported")
+}
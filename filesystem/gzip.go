@@ -0,0 +1,37 @@
+package filesystem
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+const gzipExt = ".gz"
+
+// OpenText opens a file for reading its text. Files with a gzip extension are decompressed,
+// including files that are made of multiple gzip members, like compressed logs that were
+// appended to each other. Decompressed files can't be seeked. Files with a gzip extension
+// that are not compressed are read as is.
+func OpenText(fs FileSystem, name string) (File, error) {
+	f, err := fs.Open(name)
+	if err != nil || !strings.HasSuffix(name, gzipExt) {
+		return f, err
+	}
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		// not a gzip file, open it again since the gzip header was already read
+		f.Close()
+		return fs.Open(name)
+	}
+	return &gzipFile{Reader: z, Seeker: NoSeek, file: f}, nil
+}
+
+type gzipFile struct {
+	io.Reader
+	io.Seeker
+	file File
+}
+
+func (f *gzipFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,53 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenText(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "logserver-gzip-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a file of two gzip members
+	var buf bytes.Buffer
+	for _, member := range []string{"first\n", "second\n"} {
+		z := gzip.NewWriter(&buf)
+		z.Write([]byte(member))
+		require.Nil(t, z.Close())
+	}
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "rotated.log.gz"), buf.Bytes(), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "plain.log.gz"), []byte("plain\n"), 0644))
+
+	fs, err := NewLocal(&url.URL{Path: dir})
+	require.Nil(t, err)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "rotated.log.gz", want: "first\nsecond\n"},
+		{name: "plain.log.gz", want: "plain\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenText(fs, tt.name)
+			require.Nil(t, err)
+			defer f.Close()
+			got, err := ioutil.ReadAll(f)
+			require.Nil(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,14 +29,35 @@ const (
 type Nginx struct {
 	url *url.URL
 	c   *http.Client
+	// ctx aborts the requests of a view of the filesystem, see WithContext
+	ctx context.Context
+}
+
+// WithContext returns a view of the filesystem whose requests, including the reads of the opened files,
+// are aborted when the context is done
+func (n *Nginx) WithContext(ctx context.Context) FileSystem {
+	view := *n
+	view.ctx = ctx
+	return &view
 }
 
 func (n *Nginx) get(path string) (*http.Response, error) {
-	return n.c.Get(urlExtend(*n.url, path).String())
+	return n.do(http.MethodGet, path)
 }
 
 func (n *Nginx) head(path string) (*http.Response, error) {
-	return n.c.Head(urlExtend(*n.url, path).String())
+	return n.do(http.MethodHead, path)
+}
+
+func (n *Nginx) do(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, urlExtend(*n.url, path).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if n.ctx != nil {
+		req = req.WithContext(n.ctx)
+	}
+	return n.c.Do(req)
 }
 
 func urlExtend(u url.URL, path string) *url.URL {
@@ -142,6 +164,9 @@ func (n *Nginx) Lstat(name string) (os.FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("bad status %d for: %s", resp.StatusCode, name)
 	}
@@ -182,7 +207,7 @@ func (n *Nginx) Open(name string) (File, error) {
 		io.Seeker
 	}{
 		ReadCloser: resp.Body,
-		Seeker:     nil,
+		Seeker:     NoSeek,
 	}, nil
 }
 
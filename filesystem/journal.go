@@ -1,45 +1,54 @@
 package filesystem
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/temp"
 	"github.com/coreos/go-systemd/sdjournal"
 	"github.com/kr/fs"
 )
 
-const (
-	tmpDir = "/tmp"
-	sep    = string(os.PathSeparator)
-)
+const sep = string(os.PathSeparator)
 
 var log = logrus.StandardLogger().WithField("pkg", "journal")
 
 type journal struct {
 	inner   FileSystem
 	dirName string
-	// copyDir holds a copy of a journal directory in case the inner filesystem is not a local filesystem
-	// the copy is deleted when the filesystem is closed
+	*journalCopy
+}
+
+// journalCopy holds a copy of a journal directory in case the inner filesystem is not a local filesystem
+// the copy is deleted when the filesystem is closed
+type journalCopy struct {
 	copyDir string
+	tmp     *temp.Storage
 	sync.Mutex
 }
 
+// WithContext binds the inner filesystem to the context, the view shares the journal copy of the filesystem
+func (j *journal) WithContext(ctx context.Context) FileSystem {
+	return &journal{inner: WithContext(ctx, j.inner), dirName: j.dirName, journalCopy: j.journalCopy}
+}
+
 func (j *journal) Join(elem ...string) string {
 	return j.inner.Join(elem...)
 }
 
 // WrapTar wraps a filesystem, and show a journalctl directory on journalDirName
-// as a log file and not as a directory.
-func WrapJournal(inner FileSystem, journalDirName string) FileSystem {
+// as a log file and not as a directory. Journals of remote filesystems are copied to the temporary storage.
+func WrapJournal(inner FileSystem, journalDirName string, tmp *temp.Storage) FileSystem {
 	return &journal{
-		inner:   inner,
-		dirName: journalDirName,
+		inner:       inner,
+		dirName:     journalDirName,
+		journalCopy: &journalCopy{tmp: tmp},
 	}
 }
 
@@ -108,7 +117,7 @@ func (j *journal) cpJournalDir(path string) (string, error) {
 		return j.copyDir, nil
 	}
 
-	copyDir, err := ioutil.TempDir(tmpDir, "journal-")
+	copyDir, err := j.tmp.TempDir("journal-")
 	if err != nil {
 		return "", fmt.Errorf("create temp directory: %s", err)
 	}
@@ -118,6 +127,7 @@ func (j *journal) cpJournalDir(path string) (string, error) {
 	// walk the journal filesystem
 	for w := fs.WalkFS(path, j.inner); w.Step(); {
 		if err := w.Err(); err != nil {
+			j.tmp.RemoveAll(copyDir)
 			return "", fmt.Errorf("walk dir: %s", err)
 		}
 		if w.Stat().IsDir() {
@@ -128,6 +138,7 @@ func (j *journal) cpJournalDir(path string) (string, error) {
 		localPath := filepath.Join(copyDir, remotePath[len(path):])
 		err := j.copyFile(remotePath, localPath)
 		if err != nil {
+			j.tmp.RemoveAll(copyDir)
 			return "", fmt.Errorf("copy file: %s", err)
 		}
 	}
@@ -149,11 +160,8 @@ func (j *journal) copyFile(remotePath, localPath string) error {
 	}
 	defer r.Close()
 
-	// create file directory if not exists, omit the error
-	os.MkdirAll(filepath.Dir(localPath), 0755)
-
-	// open local file for writing
-	w, err := os.Create(localPath)
+	// open local file for writing, its directory is created if not exists
+	w, err := j.tmp.Create(localPath)
 	if err != nil {
 		return fmt.Errorf("open local file %s for writing: %s", localPath, err)
 	}
@@ -170,7 +178,7 @@ func (j *journal) copyFile(remotePath, localPath string) error {
 
 func (j *journal) Close() error {
 	if j.copyDir != "" {
-		os.RemoveAll(j.copyDir)
+		j.tmp.RemoveAll(j.copyDir)
 	}
 	j.copyDir = ""
 	return j.inner.Close()
@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// limitWait is the maximal time an open waits for another file of the filesystem to be closed.
+// Open fails after it, instead of blocking forever when files that are kept open hold all the slots.
+var limitWait = 30 * time.Second
+
+var (
+	// openFiles are the open files metrics of each limited filesystem, published in /debug/vars
+	openFiles = expvar.NewMap("open_files")
+	// limiters are the limits of open files by filesystem names
+	limiters     = make(map[string]*limiter)
+	limitersLock sync.Mutex
+)
+
+// limiter holds the open file slots of filesystems with the same name
+type limiter struct {
+	slots   chan struct{}
+	metrics *expvar.Map
+}
+
+// WrapLimit wraps a filesystem so at most max of its files are open at the same time.
+// Opens beyond the limit wait for a file to be closed. Filesystems with the same name share the
+// limit, like the sources that the dynamic mode creates for every request. The number of open files,
+// the number of opens that waited and the number of opens that failed waiting are published
+// under the name of the filesystem.
+func WrapLimit(inner FileSystem, name string, max int) FileSystem {
+	if max <= 0 {
+		return inner
+	}
+	limitersLock.Lock()
+	defer limitersLock.Unlock()
+	l := limiters[name]
+	if l == nil || cap(l.slots) != max {
+		l = &limiter{slots: make(chan struct{}, max), metrics: new(expvar.Map).Init()}
+		l.metrics.Add("max", int64(max))
+		limiters[name] = l
+		openFiles.Set(name, l.metrics)
+	}
+	return &limitFS{FileSystem: inner, name: name, limiter: l}
+}
+
+type limitFS struct {
+	FileSystem
+	*limiter
+	name string
+	// ctx aborts the opens of a view of the filesystem that wait for a slot
+	ctx context.Context
+}
+
+// WithContext binds the inner filesystem to the context, the view shares the limit of the filesystem
+func (l *limitFS) WithContext(ctx context.Context) FileSystem {
+	return &limitFS{FileSystem: WithContext(ctx, l.FileSystem), limiter: l.limiter, name: l.name, ctx: ctx}
+}
+
+func (l *limitFS) Open(name string) (File, error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		l.metrics.Add("waits", 1)
+		select {
+		case l.slots <- struct{}{}:
+		case <-time.After(limitWait):
+			l.metrics.Add("rejected", 1)
+			return nil, fmt.Errorf("open %s: too many open files in %s", name, l.name)
+		case <-done(l.ctx):
+			return nil, l.ctx.Err()
+		}
+	}
+	f, err := l.FileSystem.Open(name)
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	l.metrics.Add("open", 1)
+	return &limitFile{File: f, fs: l}, nil
+}
+
+// limitFile releases its slot when it is closed
+type limitFile struct {
+	File
+	fs   *limitFS
+	once sync.Once
+}
+
+func (f *limitFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(func() {
+		f.fs.metrics.Add("open", -1)
+		<-f.fs.slots
+	})
+	return err
+}
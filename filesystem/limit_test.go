@@ -0,0 +1,52 @@
+package filesystem
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimit(t *testing.T) {
+	defer func(wait time.Duration) { limitWait = wait }(limitWait)
+	limitWait = 50 * time.Millisecond
+
+	fs := WrapLimit(&flakyFS{content: "data"}, "limited", 2)
+	metric := func(key string) string {
+		v := openFiles.Get("limited").(*expvar.Map).Get(key)
+		if v == nil {
+			return "0"
+		}
+		return v.String()
+	}
+
+	f1, err := fs.Open("a")
+	require.Nil(t, err)
+	f2, err := fs.Open("b")
+	require.Nil(t, err)
+	assert.Equal(t, "2", metric("open"))
+
+	// the limit is reached, an open fails after waiting
+	_, err = fs.Open("c")
+	assert.NotNil(t, err)
+	assert.Equal(t, "1", metric("rejected"))
+
+	// an open waits for a file to be closed
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f1.Close()
+	}()
+	f3, err := fs.Open("c")
+	require.Nil(t, err)
+	assert.Equal(t, "2", metric("waits"))
+
+	// closing twice releases a single slot
+	f1.Close()
+	f2.Close()
+	f3.Close()
+	f3.Close()
+	assert.Equal(t, "0", metric("open"))
+	assert.Equal(t, "2", metric("max"))
+}
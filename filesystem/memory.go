@@ -0,0 +1,187 @@
+package filesystem
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// memories are the in-memory filesystems that sources can use with a mem://<name> URL
+	memories     = make(map[string]*Memory)
+	memoriesLock sync.Mutex
+)
+
+// Memory is an in-memory filesystem. Directories are implied by the paths of the files in them.
+// It is useful for tests of code that embeds the engine, which should not depend on files on the disk.
+type Memory struct {
+	lock  sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemory returns an in-memory filesystem with files, given by their paths and contents
+func NewMemory(files map[string]string) *Memory {
+	m := &Memory{files: make(map[string]memoryFile, len(files))}
+	for name, data := range files {
+		m.WriteFile(name, []byte(data), time.Now())
+	}
+	return m
+}
+
+// RegisterMemory registers an in-memory filesystem, so sources with a mem://<name> URL serve it
+func RegisterMemory(name string, m *Memory) {
+	memoriesLock.Lock()
+	defer memoriesLock.Unlock()
+	memories[name] = m
+}
+
+// OpenMemory returns the in-memory filesystem that was registered with the host of a mem:// URL
+func OpenMemory(u *url.URL) (FileSystem, error) {
+	memoriesLock.Lock()
+	defer memoriesLock.Unlock()
+	m, ok := memories[u.Host]
+	if !ok {
+		return nil, fmt.Errorf("memory filesystem %s was not registered", u.Host)
+	}
+	return m, nil
+}
+
+// WriteFile creates or replaces a file
+func (m *Memory) WriteFile(name string, data []byte, modTime time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.files[cleanPath(name)] = memoryFile{data: data, modTime: modTime}
+}
+
+// AppendFile appends data to a file, it creates the file if it does not exist
+func (m *Memory) AppendFile(name string, data []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	name = cleanPath(name)
+	f := m.files[name]
+	f.data = append(append([]byte(nil), f.data...), data...)
+	f.modTime = time.Now()
+	m.files[name] = f
+}
+
+// RemoveFile removes a file
+func (m *Memory) RemoveFile(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.files, cleanPath(name))
+}
+
+func (m *Memory) ReadDir(dirname string) ([]os.FileInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	dir := cleanPath(dirname)
+	if _, ok := m.files[dir]; ok {
+		return nil, fmt.Errorf("readdir %s: not a directory", dirname)
+	}
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	var (
+		infos []os.FileInfo
+		seen  = make(map[string]bool)
+	)
+	for name, f := range m.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		child := strings.TrimPrefix(name, prefix)
+		i := strings.Index(child, "/")
+		if i >= 0 {
+			child = child[:i]
+		}
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if i >= 0 {
+			infos = append(infos, &memoryInfo{name: child, isDir: true})
+		} else {
+			infos = append(infos, &memoryInfo{name: child, size: int64(len(f.data)), modTime: f.modTime})
+		}
+	}
+	if len(infos) == 0 && dir != "" {
+		return nil, &os.PathError{Op: "readdir", Path: dirname, Err: os.ErrNotExist}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (m *Memory) Lstat(name string) (os.FileInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	p := cleanPath(name)
+	if f, ok := m.files[p]; ok {
+		return &memoryInfo{name: path.Base(p), size: int64(len(f.data)), modTime: f.modTime}, nil
+	}
+	if p == "" {
+		return &memoryInfo{name: "/", isDir: true}, nil
+	}
+	for other := range m.files {
+		if strings.HasPrefix(other, p+"/") {
+			return &memoryInfo{name: path.Base(p), isDir: true}, nil
+		}
+	}
+	return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+}
+
+func (m *Memory) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (m *Memory) Open(name string) (File, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	f, ok := m.files[cleanPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	// files are replaced on writes, so the reader sees the content at the time of the open
+	return memoryReader{bytes.NewReader(f.data)}, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
+
+type memoryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i *memoryInfo) Name() string       { return i.name }
+func (i *memoryInfo) Size() int64        { return i.size }
+func (i *memoryInfo) ModTime() time.Time { return i.modTime }
+func (i *memoryInfo) IsDir() bool        { return i.isDir }
+func (i *memoryInfo) Sys() interface{}   { return nil }
+
+func (i *memoryInfo) Mode() os.FileMode {
+	if i.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
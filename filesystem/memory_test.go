@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+
+	m := NewMemory(map[string]string{
+		"a/b/c.log": "c",
+		"a/d.log":   "dd",
+	})
+
+	infos, err := m.ReadDir("a")
+	require.Nil(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "b", infos[0].Name())
+	assert.True(t, infos[0].IsDir())
+	assert.Equal(t, "d.log", infos[1].Name())
+	assert.Equal(t, int64(2), infos[1].Size())
+
+	infos, err = m.ReadDir("")
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+
+	_, err = m.ReadDir("missing")
+	assert.True(t, os.IsNotExist(err))
+	_, err = m.Lstat("a/missing")
+	assert.True(t, os.IsNotExist(err))
+
+	stat, err := m.Lstat("/a/b")
+	require.Nil(t, err)
+	assert.True(t, stat.IsDir())
+
+	f, err := m.Open("a/b/c.log")
+	require.Nil(t, err)
+	m.AppendFile("a/b/c.log", []byte("c"))
+	data, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	assert.Equal(t, "c", string(data))
+
+	f, err = m.Open("a/b/c.log")
+	require.Nil(t, err)
+	data, err = ioutil.ReadAll(f)
+	require.Nil(t, err)
+	assert.Equal(t, "cc", string(data))
+
+	m.WriteFile("a/e.log", []byte("e"), time.Now())
+	m.RemoveFile("a/d.log")
+	infos, err = m.ReadDir("a")
+	require.Nil(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "e.log", infos[1].Name())
+
+	RegisterMemory("test", m)
+	fs, err := OpenMemory(&url.URL{Scheme: "mem", Host: "test"})
+	require.Nil(t, err)
+	assert.Equal(t, m, fs)
+	_, err = OpenMemory(&url.URL{Scheme: "mem", Host: "missing"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,131 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const defaultRedactMask = "[REDACTED]"
+
+// archiveExts are extensions of archives, which are not opened by a redacting filesystem,
+// since their content can't be redacted as they are served as is
+var archiveExts = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// Redaction is a rule that masks parts of lines, like IP addresses or emails
+type Redaction struct {
+	// Regexp matches the parts of lines that are masked
+	Regexp string `json:"regexp"`
+	// Mask replaces each match, it can refer to submatches, like $1.
+	// By default, matches are replaced with [REDACTED].
+	Mask string `json:"mask"`
+}
+
+type redaction struct {
+	re   *regexp.Regexp
+	mask []byte
+}
+
+// WrapRedact wraps a filesystem so the lines of its files are redacted when they are read.
+// Files with a gzip extension are decompressed, redacted and compressed again. Archives can't be
+// opened, since their content would be served without redaction, files inside archives can be
+// opened when the archives are wrapped before the redaction.
+func WrapRedact(inner FileSystem, rules []Redaction) (FileSystem, error) {
+	if len(rules) == 0 {
+		return inner, nil
+	}
+	r := &redactFS{FileSystem: inner}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("compiling redaction regexp: %s", err)
+		}
+		if rule.Mask == "" {
+			rule.Mask = defaultRedactMask
+		}
+		r.rules = append(r.rules, redaction{re: re, mask: []byte(rule.Mask)})
+	}
+	return r, nil
+}
+
+type redactFS struct {
+	FileSystem
+	rules []redaction
+}
+
+// WithContext binds the inner filesystem to the context, the view is redacted as the filesystem
+func (r *redactFS) WithContext(ctx context.Context) FileSystem {
+	return &redactFS{FileSystem: WithContext(ctx, r.FileSystem), rules: r.rules}
+}
+
+func (r *redactFS) Open(name string) (File, error) {
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(name, ext) {
+			return nil, fmt.Errorf("open %s: archives can't be redacted", name)
+		}
+	}
+	f, err := OpenText(r.FileSystem, name)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		if strings.HasSuffix(name, gzipExt) {
+			z := gzip.NewWriter(pw)
+			if err = r.redact(z, f); err == nil {
+				err = z.Close()
+			}
+		} else {
+			err = r.redact(pw, f)
+		}
+		pw.CloseWithError(err)
+	}()
+	return &redactFile{Reader: pr, Seeker: NoSeek, pipe: pr, file: f}, nil
+}
+
+// redact copies lines from a reader to a writer, and masks the parts of each line that match the rules
+func (r *redactFS) redact(w io.Writer, src io.Reader) error {
+	br := bufio.NewReader(src)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			content := bytes.TrimSuffix(line, []byte{'\n'})
+			newLine := len(content) < len(line)
+			for _, rule := range r.rules {
+				content = rule.re.ReplaceAll(content, rule.mask)
+			}
+			if newLine {
+				content = append(content, '\n')
+			}
+			if _, werr := w.Write(content); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// redactFile is read from a pipe, which is written with the redacted content of a file
+type redactFile struct {
+	io.Reader
+	io.Seeker
+	pipe *io.PipeReader
+	file File
+}
+
+func (f *redactFile) Close() error {
+	// stop the redaction, and then close the file
+	f.pipe.Close()
+	return f.file.Close()
+}
@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memFS is a filesystem of files in memory
+type memFS map[string][]byte
+
+func (m memFS) ReadDir(string) ([]os.FileInfo, error) { return nil, nil }
+func (m memFS) Lstat(string) (os.FileInfo, error)     { return nil, nil }
+func (m memFS) Join(elem ...string) string            { return strings.Join(elem, "/") }
+func (m memFS) Close() error                          { return nil }
+
+func (m memFS) Open(name string) (File, error) {
+	b, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return memFile{bytes.NewReader(b)}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	var gz bytes.Buffer
+	z := gzip.NewWriter(&gz)
+	z.Write([]byte("login from 10.0.0.1\n"))
+	z.Close()
+
+	fs, err := WrapRedact(memFS{
+		"app.log":    []byte("login from 10.0.0.1 by joe@example.com\nlogout\nno new line 10.0.0.2"),
+		"app.log.gz": gz.Bytes(),
+		"app.tar":    []byte("archive"),
+	}, []Redaction{
+		{Regexp: `\d+\.\d+\.\d+\.\d+`},
+		{Regexp: `(\w+)@[\w.]+`, Mask: "$1@***"},
+	})
+	require.Nil(t, err)
+
+	read := func(name string) string {
+		f, err := OpenText(fs, name)
+		require.Nil(t, err)
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		require.Nil(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "login from [REDACTED] by joe@***\nlogout\nno new line [REDACTED]", read("app.log"))
+	assert.Equal(t, "login from [REDACTED]\n", read("app.log.gz"))
+
+	_, err = fs.Open("app.tar")
+	assert.NotNil(t, err)
+
+	_, err = WrapRedact(memFS{}, []Redaction{{Regexp: "("}})
+	assert.NotNil(t, err)
+}
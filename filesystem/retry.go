@@ -0,0 +1,183 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var retryLog = logrus.StandardLogger().WithField("pkg", "retry")
+
+// Retry configures retries of filesystem operations on transient errors
+type Retry struct {
+	// Retries is the number of retries of a failed operation
+	Retries int `json:"retries"`
+	// Backoff is the time to wait before the first retry, doubled on every retry
+	Backoff time.Duration `json:"retry_backoff"`
+}
+
+// WrapRetry wraps a filesystem so its operations are retried on transient errors, like a
+// connection reset. Reads that fail are resumed from the same offset in a reopened file.
+// Persistent errors are returned after all the retries failed.
+func WrapRetry(inner FileSystem, r Retry) FileSystem {
+	if r.Retries <= 0 {
+		return inner
+	}
+	return &retryFS{inner: inner, Retry: r}
+}
+
+type retryFS struct {
+	Retry
+	inner FileSystem
+	// ctx stops the retries of a view of the filesystem
+	ctx context.Context
+}
+
+// WithContext binds the inner filesystem to the context, and stops retrying when the context is done
+func (r *retryFS) WithContext(ctx context.Context) FileSystem {
+	return &retryFS{Retry: r.Retry, inner: WithContext(ctx, r.inner), ctx: ctx}
+}
+
+// do calls f until it succeeds, returns a persistent error, or the retries are exhausted
+func (r *retryFS) do(op string, name string, f func() error) error {
+	backoff := r.Backoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i == r.Retries || !transient(err) {
+			return err
+		}
+		retryLog.WithError(err).Warnf("Retrying %s %s in %s", op, name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-done(r.ctx):
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (r *retryFS) ReadDir(dirname string) (files []os.FileInfo, err error) {
+	err = r.do("readdir", dirname, func() error {
+		files, err = r.inner.ReadDir(dirname)
+		return err
+	})
+	return
+}
+
+func (r *retryFS) Lstat(name string) (info os.FileInfo, err error) {
+	err = r.do("lstat", name, func() error {
+		info, err = r.inner.Lstat(name)
+		return err
+	})
+	return
+}
+
+func (r *retryFS) Join(elem ...string) string {
+	return r.inner.Join(elem...)
+}
+
+func (r *retryFS) Open(name string) (File, error) {
+	f, err := r.open(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &retryFile{File: f, fs: r, name: name}, nil
+}
+
+// open opens a file and moves to an offset in it
+func (r *retryFS) open(name string, offset int64) (f File, err error) {
+	err = r.do("open", name, func() error {
+		f, err = r.inner.Open(name)
+		if err != nil || offset == 0 {
+			return err
+		}
+		if err = skip(f, offset); err != nil {
+			f.Close()
+		}
+		return err
+	})
+	return
+}
+
+func (r *retryFS) Close() error {
+	return r.inner.Close()
+}
+
+// retryFile is a file that is reopened when a read fails on a transient error
+type retryFile struct {
+	File
+	fs     *retryFS
+	name   string
+	offset int64
+}
+
+func (f *retryFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	if err == nil || err == io.EOF || !transient(err) {
+		return n, err
+	}
+	if n > 0 {
+		// return the data that was read, the error will repeat on the next read if it is persistent
+		return n, nil
+	}
+	retryLog.WithError(err).Warnf("Reopening %s at offset %d", f.name, f.offset)
+	f.File.Close()
+	reopened, openErr := f.fs.open(f.name, f.offset)
+	if openErr != nil {
+		return 0, err
+	}
+	f.File = reopened
+	return f.File.Read(p)
+}
+
+func (f *retryFile) Seek(offset int64, whence int) (int64, error) {
+	off, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.offset = off
+	}
+	return off, err
+}
+
+// skip moves to an offset in a file, by seeking if possible, or by reading up to the offset
+func skip(f File, offset int64) error {
+	if off, err := f.Seek(offset, io.SeekStart); err == nil && off == offset {
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, f, offset)
+	return err
+}
+
+// transient returns true for errors that might not repeat, like a dropped connection
+func transient(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if ne, ok := err.(net.Error); ok && (ne.Timeout() || ne.Temporary()) {
+		return true
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	switch err {
+	case syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE:
+		return true
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection reset", "connection lost", "broken pipe", "unexpected EOF"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package filesystem
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyFS is a filesystem with a single file, which fails to open and read a given number of times
+type flakyFS struct {
+	content   string
+	openFails int
+	readFails int
+	opens     int
+}
+
+func (f *flakyFS) ReadDir(string) ([]os.FileInfo, error) { return nil, nil }
+func (f *flakyFS) Lstat(string) (os.FileInfo, error)     { return nil, nil }
+func (f *flakyFS) Join(elem ...string) string            { return strings.Join(elem, "/") }
+func (f *flakyFS) Close() error                          { return nil }
+
+func (f *flakyFS) Open(string) (File, error) {
+	f.opens++
+	if f.openFails > 0 {
+		f.openFails--
+		return nil, syscall.ECONNRESET
+	}
+	return &flakyFile{Reader: strings.NewReader(f.content), fs: f}, nil
+}
+
+type flakyFile struct {
+	*strings.Reader
+	fs *flakyFS
+}
+
+func (f *flakyFile) Read(p []byte) (int, error) {
+	// fail in the middle of the file
+	if f.fs.readFails > 0 && int64(f.Len()) < f.Size()/2 {
+		f.fs.readFails--
+		return 0, errors.New("connection lost")
+	}
+	return f.Reader.Read(p[:1])
+}
+
+func (f *flakyFile) Close() error { return nil }
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		openFails int
+		readFails int
+		wantErr   bool
+		wantOpens int
+	}{
+		{name: "no failures", wantOpens: 1},
+		{name: "open", openFails: 2, wantOpens: 3},
+		{name: "read", readFails: 1, wantOpens: 2},
+		{name: "persistent", openFails: 4, wantErr: true, wantOpens: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyFS{content: "line 1\nline 2\n", openFails: tt.openFails, readFails: tt.readFails}
+			fs := WrapRetry(inner, Retry{Retries: 3})
+			f, err := fs.Open("file.log")
+			if tt.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				require.Nil(t, err)
+				content, err := ioutil.ReadAll(f)
+				require.Nil(t, err)
+				assert.Equal(t, inner.content, string(content))
+			}
+			assert.Equal(t, tt.wantOpens, inner.opens)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	t.Parallel()
+
+	r := NewRing("self.log", 2)
+	read := func() string {
+		f, err := r.Open("/self.log")
+		require.Nil(t, err)
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		require.Nil(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "", read())
+	r.Write([]byte("a\n"))
+	r.Write([]byte("b"))
+	assert.Equal(t, "a\nb\n", read())
+	r.Write([]byte("cc\n"))
+	assert.Equal(t, "b\ncc\n", read())
+
+	infos, err := r.ReadDir("")
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "self.log", infos[0].Name())
+	assert.Equal(t, int64(5), infos[0].Size())
+
+	stat, err := r.Lstat("")
+	require.Nil(t, err)
+	assert.True(t, stat.IsDir())
+	_, err = r.Lstat("other.log")
+	assert.True(t, os.IsNotExist(err))
+	_, err = r.Open("other.log")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -18,10 +19,68 @@ import (
 type SFTP struct {
 	client   *sftp.Client
 	basePath string
+	// conns are the ssh connections, including the connections to the jump hosts
+	conns []*ssh.Client
 }
 
-// NewSFTP returns a new SFTP filesystem
-func NewSFTP(u *url.URL) (FileSystem, error) {
+// NewSFTP returns a new SFTP filesystem.
+// proxyJump is an optional list of jump hosts, in the format of [user[:password]@]host[:port]
+// which are used in the given order to reach the sftp server.
+func NewSFTP(u *url.URL, proxyJump []string) (FileSystem, error) {
+	var hops []*url.URL
+	for _, jump := range proxyJump {
+		if !strings.Contains(jump, "://") {
+			jump = "ssh://" + jump
+		}
+		hop, err := url.Parse(jump)
+		if err != nil {
+			return nil, fmt.Errorf("parse jump host %s: %s", jump, err)
+		}
+		hops = append(hops, hop)
+	}
+	hops = append(hops, u)
+
+	var conns []*ssh.Client
+	closeAll := func() {
+		for i := len(conns) - 1; i >= 0; i-- {
+			conns[i].Close()
+		}
+	}
+
+	for _, hop := range hops {
+		var (
+			hp     = hostPort(hop.Host)
+			config = sshConfig(hop)
+			conn   *ssh.Client
+			err    error
+		)
+		if len(conns) == 0 {
+			conn, err = ssh.Dial("tcp", hp, config)
+		} else {
+			conn, err = dialThrough(conns[len(conns)-1], hp, config)
+		}
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("dial %s: %s", hp, err)
+		}
+		conns = append(conns, conn)
+	}
+
+	client, err := sftp.NewClient(conns[len(conns)-1])
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("create sftp client: %s", err)
+	}
+	basePath := u.Path
+	return &SFTP{
+		client:   client,
+		basePath: basePath,
+		conns:    conns,
+	}, nil
+}
+
+// sshConfig returns ssh client configuration for a given URL
+func sshConfig(u *url.URL) *ssh.ClientConfig {
 	config := &ssh.ClientConfig{
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil },
 	}
@@ -41,22 +100,21 @@ func NewSFTP(u *url.URL) (FileSystem, error) {
 			config.Auth = append(config.Auth, ssh.Password(password))
 		}
 	}
+	return config
+}
 
-	hp := hostPort(u.Host)
-	conn, err := ssh.Dial("tcp", hp, config)
+// dialThrough dials an ssh server through an existing ssh connection of a jump host
+func dialThrough(jump *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := jump.Dial("tcp", addr)
 	if err != nil {
-		return nil, fmt.Errorf("dial: %s", err)
+		return nil, err
 	}
-
-	client, err := sftp.NewClient(conn)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
-		return nil, fmt.Errorf("create sftp client: %s", err)
+		conn.Close()
+		return nil, err
 	}
-	basePath := u.Path
-	return &SFTP{
-		client:   client,
-		basePath: basePath,
-	}, nil
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 func (s *SFTP) ReadDir(dirname string) ([]os.FileInfo, error) {
@@ -76,7 +134,56 @@ func (s *SFTP) Open(path string) (File, error) {
 }
 
 func (s *SFTP) Close() error {
-	return s.client.Close()
+	err := s.client.Close()
+	for i := len(s.conns) - 1; i >= 0; i-- {
+		s.conns[i].Close()
+	}
+	return err
+}
+
+// WithContext returns a view of the filesystem whose operations return when the context is done. The sftp
+// client has no cancellation, so pending operations complete in the background, and files that were opened by
+// the view are closed when the context is done, which releases their remote handles.
+func (s *SFTP) WithContext(ctx context.Context) FileSystem {
+	return &sftpContext{SFTP: s, ctx: ctx}
+}
+
+type sftpContext struct {
+	*SFTP
+	ctx context.Context
+}
+
+func (s *sftpContext) ReadDir(dirname string) ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	err := contextDo(s.ctx, func() (err error) {
+		files, err = s.SFTP.ReadDir(dirname)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (s *sftpContext) Lstat(name string) (os.FileInfo, error) {
+	return contextStat(s.ctx, func() (os.FileInfo, error) { return s.SFTP.Lstat(name) })
+}
+
+func (s *sftpContext) Open(path string) (File, error) {
+	var f File
+	err := contextDo(s.ctx, func() (err error) {
+		f, err = s.SFTP.Open(path)
+		return err
+	}, func() { f.Close() })
+	if err != nil {
+		return nil, err
+	}
+	return newContextFile(s.ctx, f), nil
+}
+
+// Close does nothing, the view shares the connection of the filesystem
+func (s *sftpContext) Close() error {
+	return nil
 }
 
 func publicKey() (username string, pubKey ssh.AuthMethod) {
@@ -0,0 +1,180 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer is an in-process ssh server that serves sftp sessions, and forwards connections, like a jump host
+type sshServer struct {
+	addr string
+	lock sync.Mutex
+	// forwarded are the addresses that the server forwarded connections to
+	forwarded []string
+}
+
+// newSSHServer starts an ssh server that accepts the user test with the password secret
+func newSSHServer(t *testing.T) *sshServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.Nil(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "test" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("bad password of %s", c.User())
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := &sshServer{addr: l.Addr().String()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *sshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		switch newCh.ChannelType() {
+		case "session":
+			go s.session(newCh)
+		case "direct-tcpip":
+			go s.forward(newCh)
+		default:
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+// session serves the sftp subsystem
+func (s *sshServer) session(newCh ssh.NewChannel) {
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		// the payload of a subsystem request is the length prefixed name of the subsystem
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+		server, err := sftp.NewServer(ch)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		return
+	}
+}
+
+// forward forwards a connection of a client to the address that it asked for
+func (s *sshServer) forward(newCh ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &target); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(target.Host, fmt.Sprint(target.Port))
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	s.lock.Lock()
+	s.forwarded = append(s.forwarded, addr)
+	s.lock.Unlock()
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+	io.Copy(conn, ch)
+	conn.Close()
+	ch.Close()
+}
+
+func TestSFTPProxyJump(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "sftp-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app.log"), []byte("started\n"), 0644))
+
+	var (
+		target = newSSHServer(t)
+		jump1  = newSSHServer(t)
+		jump2  = newSSHServer(t)
+	)
+	u, err := url.Parse("sftp://test:secret@" + target.addr + dir)
+	require.Nil(t, err)
+
+	// the server is reached through the jump hosts, in their order
+	fs, err := NewSFTP(u, []string{"test:secret@" + jump1.addr, "ssh://test:secret@" + jump2.addr})
+	require.Nil(t, err)
+	defer fs.Close()
+	infos, err := fs.ReadDir("/")
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "app.log", infos[0].Name())
+	f, err := fs.Open("app.log")
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	require.Nil(t, err)
+	assert.Equal(t, "started\n", string(b))
+	assert.Equal(t, []string{jump2.addr}, jump1.forwarded)
+	assert.Equal(t, []string{target.addr}, jump2.forwarded)
+	assert.Empty(t, target.forwarded)
+
+	// a jump host that rejects the credentials fails the connection
+	_, err = NewSFTP(u, []string{"test:wrong@" + jump1.addr})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), jump1.addr)
+
+	_, err = NewSFTP(u, []string{"test:secret@%zz"})
+	assert.NotNil(t, err)
+}
@@ -35,6 +35,19 @@ type FileSystem struct {
 	Closer io.Closer
 }
 
+// indexEntrySize is the approximate size of a tar header and a map entry in the index
+const indexEntrySize = 512
+
+// MemSize estimates the memory footprint of the index of the tar file
+func (f *FileSystem) MemSize() int64 {
+	var size int64
+	for name := range f.index {
+		// the name is stored in the key and in the file info
+		size += 2*int64(len(name)) + indexEntrySize
+	}
+	return size
+}
+
 func (f *FileSystem) init() error {
 	tarReader := f.tarReader()
 	for {
@@ -112,7 +125,7 @@ func (f *FileSystem) Open(name string) (filesystem.File, error) {
 			return nil, err
 		}
 		if h.Name == name {
-			return &file{ReadCloser: ioutil.NopCloser(tarReader), Seeker: f.file}, nil
+			return &file{ReadCloser: ioutil.NopCloser(tarReader), Seeker: filesystem.NoSeek}, nil
 		}
 	}
 	return nil, notFound(name)
@@ -136,6 +149,8 @@ func (f *FileSystem) tarReader() *tar.Reader {
 	if z, err := gzip.NewReader(f.file); err == nil {
 		return tar.NewReader(z)
 	}
+	// not compressed, read the tar from the start of the file
+	f.file.Seek(0, io.SeekStart)
 	return tar.NewReader(f.file)
 }
 
@@ -1,6 +1,7 @@
 package tar
 
 import (
+	"context"
 	"os"
 	"regexp"
 	"strings"
@@ -9,8 +10,13 @@ import (
 	"github.com/bluele/gcache"
 )
 
+// Separator is the separator between the path of an archive and the path of a file inside it,
+// for example: logs.tar.gz!first/service.log
+const Separator = filesystem.ArchiveSeparator
+
 var (
-	reContains = regexp.MustCompile(`\.tar(\.gz)?`)
+	reContains = regexp.MustCompile(`\.tar(\.gz)?(!|/|$)`)
+	reLink     = regexp.MustCompile(`\.tar(\.gz)?!`)
 	reSuffix   = regexp.MustCompile(`\.tar(\.gz)?$`)
 )
 
@@ -20,15 +26,36 @@ var (
 func Wrap(inner filesystem.FileSystem, cache gcache.Cache, cachePrefix string) filesystem.FileSystem {
 	return &tarfs{
 		inner:       inner,
+		archives:    inner,
 		cache:       cache,
 		cachePrefix: cachePrefix,
+		re:          reContains,
+	}
+}
+
+// WrapLinks wraps a filesystem with a tar or tar.gz file opener only for paths that
+// address a file inside an archive with the archive separator. Archives are still
+// listed as files, but their inner files can be linked to directly.
+func WrapLinks(inner filesystem.FileSystem, cache gcache.Cache, cachePrefix string) filesystem.FileSystem {
+	return &tarfs{
+		inner:       inner,
+		archives:    inner,
+		cache:       cache,
+		cachePrefix: cachePrefix,
+		re:          reLink,
+		linksOnly:   true,
 	}
 }
 
 type tarfs struct {
-	inner       filesystem.FileSystem
+	inner filesystem.FileSystem
+	// archives opens the archives, which are cached and outlive the context of a view of the filesystem
+	archives    filesystem.FileSystem
 	cache       gcache.Cache
 	cachePrefix string
+	// re matches the end of an archive name in a path
+	re        *regexp.Regexp
+	linksOnly bool
 }
 
 func (w *tarfs) ReadDir(dirname string) ([]os.FileInfo, error) {
@@ -38,8 +65,8 @@ func (w *tarfs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	}
 	if tfs == nil {
 		files, err := w.inner.ReadDir(dirname)
-		if err != nil {
-			return nil, err
+		if err != nil || w.linksOnly {
+			return files, err
 		}
 		return changeTarToDir(files...), nil
 	}
@@ -53,8 +80,8 @@ func (w *tarfs) Lstat(name string) (os.FileInfo, error) {
 	}
 	if tfs == nil {
 		file, err := w.inner.Lstat(name)
-		if err != nil {
-			return nil, err
+		if err != nil || w.linksOnly {
+			return file, err
 		}
 		return changeTarToDir(file)[0], nil
 	}
@@ -76,14 +103,24 @@ func (w *tarfs) Open(name string) (filesystem.File, error) {
 	return tfs.Open(innerPath)
 }
 
+// WithContext binds the inner filesystem to the context, except for opening the cached archives
+func (w *tarfs) WithContext(ctx context.Context) filesystem.FileSystem {
+	view := *w
+	view.inner = filesystem.WithContext(ctx, w.inner)
+	return &view
+}
+
 func (w *tarfs) Close() error {
 	return w.inner.Close()
 }
 
 type cacheKey string
 
+// Kind names the kind of the key in the cache stats
+func (cacheKey) Kind() string { return "tar" }
+
 func (w *tarfs) getTarFS(dirname string) (filesystem.FileSystem, string, error) {
-	tarName, innerPath := split(dirname)
+	tarName, innerPath := split(w.re, dirname)
 	if tarName == "" {
 		return nil, dirname, nil
 	}
@@ -99,7 +136,7 @@ func (w *tarfs) getTarFS(dirname string) (filesystem.FileSystem, string, error)
 		fs = val.(filesystem.FileSystem)
 	} else { // not in cache
 		log.Infof("Opening new tar %s", key)
-		f, err := w.inner.Open(tarName)
+		f, err := w.archives.Open(tarName)
 		if err != nil {
 			return nil, "", err
 		}
@@ -115,14 +152,16 @@ func (w *tarfs) getTarFS(dirname string) (filesystem.FileSystem, string, error)
 	return fs, innerPath, nil
 }
 
-func split(dirname string) (tarName string, innerPath string) {
-	loc := reContains.FindStringIndex(dirname)
+// split splits a path to the path of an archive and the path inside it.
+// The archive is separated from its inner path by a path separator, or by the archive separator.
+func split(re *regexp.Regexp, dirname string) (tarName string, innerPath string) {
+	loc := re.FindStringIndex(dirname)
 	if len(loc) == 0 {
 		return "", dirname
 	}
 	end := loc[1]
 
-	tarName = dirname[:end]
+	tarName = strings.TrimRight(dirname[:end], sep+Separator)
 	innerPath = strings.Trim(dirname[end:], sep)
 	return
 }
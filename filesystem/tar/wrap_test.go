@@ -37,6 +37,10 @@ func TestWrap(t *testing.T) {
 			path:        "dir2/logs.tar.gz/first/second/third/tar_service.log",
 			wantContent: "blabla\n",
 		},
+		{
+			path:        "dir2/logs.tar.gz!first/second/third/tar_service.log",
+			wantContent: "blabla\n",
+		},
 	}
 
 	for _, tt := range openTests {
@@ -107,6 +111,49 @@ func TestWrap(t *testing.T) {
 	}
 }
 
+func TestWrapLinks(t *testing.T) {
+	u, err := url.Parse("file://../../example/log3")
+	require.Nil(t, err)
+	fs, err := filesystem.NewLocal(u)
+	require.Nil(t, err)
+	fs = WrapLinks(fs, gcache.New(0).Build(), "")
+
+	f, err := fs.Open("dir2/logs.tar.gz!first/second/third/tar_service.log")
+	require.Nil(t, err)
+	gotContent, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	assert.Equal(t, "blabla\n", string(gotContent))
+
+	// archives are not browsed without the archive separator
+	_, err = fs.Open("dir2/logs.tar.gz/first/second/third/tar_service.log")
+	assert.NotNil(t, err)
+	stat, err := fs.Lstat("dir2/logs.tar.gz")
+	require.Nil(t, err)
+	assert.False(t, stat.IsDir())
+}
+
+func Test_split(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path          string
+		wantTar       string
+		wantInnerPath string
+	}{
+		{path: "a/b.log", wantInnerPath: "a/b.log"},
+		{path: "a/b.tarball/c", wantInnerPath: "a/b.tarball/c"},
+		{path: "a/b.tar", wantTar: "a/b.tar"},
+		{path: "a/b.tar.gz/c/d", wantTar: "a/b.tar.gz", wantInnerPath: "c/d"},
+		{path: "a/b.tar.gz!c/d", wantTar: "a/b.tar.gz", wantInnerPath: "c/d"},
+	}
+
+	for _, tt := range tests {
+		tarName, innerPath := split(reContains, tt.path)
+		assert.Equal(t, tt.wantTar, tarName, tt.path)
+		assert.Equal(t, tt.wantInnerPath, innerPath, tt.path)
+	}
+}
+
 func Test_isInDir(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,219 @@
+package filesystem
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var (
+	watchLog         = logrus.StandardLogger().WithField("pkg", "watch")
+	errWatchNotLocal = errors.New("only local filesystems can be watched")
+)
+
+// watchFS is a local filesystem that keeps an index of its tree in memory, which is updated by
+// notifications of changes in the filesystem, so directories are listed without reading them.
+// Files are opened from the local filesystem. Stats of files that were modified are refreshed
+// lazily, when they are listed. Paths that are not in the index, like directories that could not
+// be watched, are read from the local filesystem.
+type watchFS struct {
+	*Local
+	lock sync.Mutex
+	// entries are the stats of the files and directories in the tree, by their relative paths
+	entries map[string]os.FileInfo
+	// children are the names of the entries in each indexed directory
+	children map[string]map[string]bool
+	// dirty are entries that were modified since they were indexed
+	dirty map[string]bool
+	// watcher is the platform specific notifications of changes
+	watcher watcher
+}
+
+// watcher watches directories for changes, and calls the filesystem handlers on changes
+type watcher interface {
+	// add watches a directory, it returns false if the directory can't be watched
+	add(dir string) bool
+	// remove stops watching a directory and all the directories under it
+	remove(dir string)
+	close() error
+}
+
+// WatchLocal returns a local filesystem with an index of its tree that is updated by notifications of
+// changes, instead of reading directories from the disk. It is supported only on linux.
+func WatchLocal(fs FileSystem) (FileSystem, error) {
+	local, ok := fs.(*Local)
+	if !ok {
+		return nil, errWatchNotLocal
+	}
+	w := &watchFS{Local: local}
+	var err error
+	if w.watcher, err = newWatcher(w); err != nil {
+		return nil, err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.reset()
+	return w, nil
+}
+
+// reset rebuilds the index, it should be called with the lock held
+func (w *watchFS) reset() {
+	w.watcher.remove("")
+	w.entries = make(map[string]os.FileInfo)
+	w.children = make(map[string]map[string]bool)
+	w.dirty = make(map[string]bool)
+	w.scan("")
+}
+
+// scan indexes a directory and all the directories under it, it should be called with the lock held
+func (w *watchFS) scan(dir string) {
+	// watch before reading, so files that are created during the scan are not missed
+	if !w.watcher.add(dir) {
+		return
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(w.basePath, dir))
+	if err != nil {
+		w.watcher.remove(dir)
+		return
+	}
+	names := make(map[string]bool, len(infos))
+	w.children[dir] = names
+	for _, info := range infos {
+		rel := filepath.Join(dir, info.Name())
+		names[info.Name()] = true
+		w.entries[rel] = info
+		if info.IsDir() {
+			w.scan(rel)
+		}
+	}
+}
+
+// created handles a file that was created or moved into a watched directory
+func (w *watchFS) created(rel string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	info, err := os.Lstat(filepath.Join(w.basePath, rel))
+	if err != nil {
+		return
+	}
+	dir, name := filepath.Split(rel)
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		dir = ""
+	}
+	if names := w.children[dir]; names != nil {
+		names[name] = true
+	}
+	w.entries[rel] = info
+	if info.IsDir() {
+		w.scan(rel)
+	}
+}
+
+// removed handles a file that was deleted or moved out of a watched directory
+func (w *watchFS) removed(rel string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	dir, name := filepath.Split(rel)
+	dir = filepath.Clean(dir)
+	if dir == "." {
+		dir = ""
+	}
+	if names := w.children[dir]; names != nil {
+		delete(names, name)
+	}
+	if info, ok := w.entries[rel]; ok && info.IsDir() {
+		w.watcher.remove(rel)
+		prefix := rel + string(os.PathSeparator)
+		for key := range w.entries {
+			if strings.HasPrefix(key, prefix) {
+				delete(w.entries, key)
+				delete(w.dirty, key)
+			}
+		}
+		for key := range w.children {
+			if key == rel || strings.HasPrefix(key, prefix) {
+				delete(w.children, key)
+			}
+		}
+	}
+	delete(w.entries, rel)
+	delete(w.dirty, rel)
+}
+
+// modified handles a file whose content or attributes were changed
+func (w *watchFS) modified(rel string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.entries[rel]; ok {
+		w.dirty[rel] = true
+	}
+}
+
+// overflowed handles lost notifications by rebuilding the index
+func (w *watchFS) overflowed() {
+	watchLog.Warnf("Notifications of %s were lost, rebuilding its index", w.basePath)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.reset()
+}
+
+// stat returns the indexed stat of an entry, it should be called with the lock held
+func (w *watchFS) stat(rel string) (os.FileInfo, bool) {
+	info, ok := w.entries[rel]
+	if ok && w.dirty[rel] {
+		if fresh, err := os.Lstat(filepath.Join(w.basePath, rel)); err == nil {
+			info, w.entries[rel] = fresh, fresh
+		}
+		delete(w.dirty, rel)
+	}
+	return info, ok
+}
+
+func (w *watchFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	rel := relPath(dirname)
+	w.lock.Lock()
+	names, ok := w.children[rel]
+	if !ok {
+		w.lock.Unlock()
+		return w.Local.ReadDir(dirname)
+	}
+	infos := make([]os.FileInfo, 0, len(names))
+	for name := range names {
+		if info, ok := w.stat(filepath.Join(rel, name)); ok {
+			infos = append(infos, info)
+		}
+	}
+	w.lock.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (w *watchFS) Lstat(name string) (os.FileInfo, error) {
+	w.lock.Lock()
+	info, ok := w.stat(relPath(name))
+	w.lock.Unlock()
+	if !ok {
+		return w.Local.Lstat(name)
+	}
+	return info, nil
+}
+
+func (w *watchFS) Close() error {
+	return w.watcher.close()
+}
+
+// relPath returns the index key of a path
+func relPath(name string) string {
+	rel := strings.Trim(filepath.Clean(name), string(os.PathSeparator))
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
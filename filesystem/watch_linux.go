@@ -0,0 +1,118 @@
+//go:build linux
+// +build linux
+
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_ONLYDIR
+
+// inotify watches directories with the linux inotify API
+type inotify struct {
+	fs   *watchFS
+	file *os.File
+	fd   int
+	lock sync.Mutex
+	// dirs are the watched directories by their watch descriptors, and the descriptors by the directories
+	dirs map[int]string
+	wds  map[string]int
+}
+
+func newWatcher(fs *watchFS) (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotify{
+		fs:   fs,
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int]string),
+		wds:  make(map[string]int),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *inotify) add(dir string) bool {
+	wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(w.fs.basePath, dir), watchMask)
+	if err != nil {
+		watchLog.WithError(err).Warnf("Failed watching %s, it will be read from the disk", filepath.Join(w.fs.basePath, dir))
+		return false
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.dirs[wd] = dir
+	w.wds[dir] = wd
+	return true
+}
+
+func (w *inotify) remove(dir string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	prefix := dir + string(os.PathSeparator)
+	for d, wd := range w.wds {
+		if d == dir || dir == "" || strings.HasPrefix(d, prefix) {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, d)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+func (w *inotify) close() error {
+	return w.file.Close()
+}
+
+// run reads the inotify events until the watcher is closed
+func (w *inotify) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			e := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := strings.TrimRight(string(buf[off+unix.SizeofInotifyEvent:off+unix.SizeofInotifyEvent+int(e.Len)]), "\x00")
+			off += unix.SizeofInotifyEvent + int(e.Len)
+			w.handle(int(e.Wd), e.Mask, name)
+		}
+	}
+}
+
+func (w *inotify) handle(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.fs.overflowed()
+		return
+	}
+	w.lock.Lock()
+	dir, ok := w.dirs[wd]
+	if ok && mask&unix.IN_IGNORED != 0 {
+		// the watched directory was removed
+		delete(w.dirs, wd)
+		delete(w.wds, dir)
+	}
+	w.lock.Unlock()
+	if !ok || name == "" {
+		return
+	}
+	rel := filepath.Join(dir, name)
+	switch {
+	case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		w.fs.created(rel)
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		w.fs.removed(rel)
+	case mask&(unix.IN_MODIFY|unix.IN_ATTRIB) != 0:
+		w.fs.modified(rel)
+	}
+}
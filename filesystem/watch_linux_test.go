@@ -0,0 +1,75 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchLocal(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "logserver-watch-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("a\n"), 0600))
+
+	local, err := NewLocal(&url.URL{Path: dir})
+	require.Nil(t, err)
+	fs, err := WatchLocal(local)
+	require.Nil(t, err)
+	defer fs.Close()
+
+	names := func(dirname string) []string {
+		infos, err := fs.ReadDir(dirname)
+		require.Nil(t, err)
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+	// eventually waits for the notifications of changes to be handled
+	eventually := func(want []string, dirname string) {
+		for i := 0; i < 100 && !assert.ObjectsAreEqual(want, names(dirname)); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, want, names(dirname))
+	}
+
+	assert.Equal(t, []string{"a.log"}, names(""))
+
+	// create files and directories
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "sub"), 0700))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "sub", "b.log"), []byte("b\n"), 0600))
+	eventually([]string{"a.log", "sub"}, "")
+	eventually([]string{"b.log"}, "sub")
+
+	// modify a file
+	f, err := os.OpenFile(filepath.Join(dir, "a.log"), os.O_APPEND|os.O_WRONLY, 0)
+	require.Nil(t, err)
+	f.Write([]byte("more\n"))
+	f.Close()
+	for i := 0; i < 100; i++ {
+		if info, err := fs.Lstat("a.log"); err == nil && info.Size() == 7 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err := fs.Lstat("a.log")
+	require.Nil(t, err)
+	assert.Equal(t, int64(7), info.Size())
+
+	// remove and move
+	require.Nil(t, os.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "moved")))
+	eventually([]string{"a.log", "moved"}, "")
+	eventually([]string{"b.log"}, "moved")
+	require.Nil(t, os.RemoveAll(filepath.Join(dir, "moved")))
+	eventually([]string{"a.log"}, "")
+}
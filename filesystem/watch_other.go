@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+import "errors"
+
+func newWatcher(*watchFS) (watcher, error) {
+	return nil, errors.New("watching a tree is supported only on linux")
+}
@@ -0,0 +1,75 @@
+package job
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// createRequest is the body of a job creation request
+type createRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Handler returns an HTTP handler for the job manager:
+//
+//	GET    /               list jobs
+//	POST   /               create a job: {"kind": "...", "params": {...}}
+//	GET    /<id>           job status
+//	DELETE /<id>           cancel a job
+//	GET    /<id>/artifact  download the file that the job produced
+func (m *Manager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case parts[0] == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, m.List())
+
+		case parts[0] == "" && r.Method == http.MethodPost:
+			var req createRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			j, err := m.Start(r.Context(), req.Kind, req.Params)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, j)
+
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			j, ok := m.Get(parts[0])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, http.StatusOK, j)
+
+		case len(parts) == 1 && r.Method == http.MethodDelete:
+			if err := m.Cancel(parts[0]); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case len(parts) == 2 && parts[1] == "artifact" && r.Method == http.MethodGet:
+			path, ok := m.Artifact(parts[0])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeFile(w, r, path)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,339 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/duration"
+	"github.com/Stratoscale/logserver/store"
+)
+
+var log = logrus.WithField("pkg", "job")
+
+const (
+	defaultExpiration = time.Hour
+	// minExpireInterval bounds the interval of the checks of expired jobs, for very short expirations
+	minExpireInterval = time.Millisecond
+	// bucket is the store bucket of the jobs
+	bucket = "jobs"
+)
+
+// Config is the job manager configuration
+type Config struct {
+	// Expiration is the time a job and its artifact are kept after it finished
+	Expiration time.Duration `json:"expiration"`
+}
+
+// UnmarshalJSON decodes the job manager configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// State of a job
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateDone      State = "done"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Job describes a long running operation
+type Job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	State    State      `json:"state"`
+	Done     int        `json:"done"`
+	Total    int        `json:"total"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// HasArtifact is true when the job produced a file that can be downloaded
+	HasArtifact bool `json:"has_artifact,omitempty"`
+}
+
+// Func is the work of a job. It reports its progress with the progress function,
+// and returns the path of a file that it produced, if any.
+// The function should return when the context is done.
+type Func func(ctx context.Context, progress func(done, total int)) (artifact string, err error)
+
+// Starter creates a job function from the job parameters in a create request. The context is the context of
+// the create request, it is done when the request returns, before the job finished.
+type Starter func(ctx context.Context, params json.RawMessage) (Func, error)
+
+type job struct {
+	Job
+	Artifact string `json:"artifact,omitempty"`
+	cancel   context.CancelFunc
+}
+
+// Manager runs and tracks jobs
+type Manager struct {
+	Config
+	jobs     map[string]*job
+	starters map[string]Starter
+	onFinish []func(Job)
+	store    store.Store
+	lock     sync.Mutex
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
+	if c.Expiration == 0 {
+		c.Expiration = defaultExpiration
+	}
+	return c
+}
+
+// NewManager returns a new job manager, with the jobs that were persisted in the store.
+// Jobs that were running when they were persisted are marked as failed.
+// Expired jobs are removed until the context is done.
+func NewManager(ctx context.Context, c Config, s store.Store) (*Manager, error) {
+	c = c.WithDefaults()
+	if c.Expiration < 0 {
+		return nil, fmt.Errorf("negative expiration: %s", c.Expiration)
+	}
+	m := &Manager{
+		Config:   c,
+		jobs:     make(map[string]*job),
+		starters: make(map[string]Starter),
+		store:    s,
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	go m.expire(ctx)
+	return m, nil
+}
+
+// Register registers a job kind that can be created with the create API
+func (m *Manager) Register(kind string, s Starter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.starters[kind] = s
+}
+
+// OnFinish registers a function that is called with every job that finished
+func (m *Manager) OnFinish(f func(Job)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.onFinish = append(m.onFinish, f)
+}
+
+// Start creates a job from parameters of a registered kind, in the context of a create request
+func (m *Manager) Start(ctx context.Context, kind string, params json.RawMessage) (Job, error) {
+	m.lock.Lock()
+	s := m.starters[kind]
+	m.lock.Unlock()
+	if s == nil {
+		return Job{}, fmt.Errorf("unknown job kind: %s", kind)
+	}
+	f, err := s(ctx, params)
+	if err != nil {
+		return Job{}, err
+	}
+	return m.Create(kind, f), nil
+}
+
+// Create runs a job function in the background and returns the created job
+func (m *Manager) Create(kind string, f Func) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: Job{
+			ID:      newID(),
+			Kind:    kind,
+			State:   StateRunning,
+			Created: time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	m.lock.Lock()
+	m.jobs[j.ID] = j
+	ret := j.Job
+	m.save(j)
+	m.lock.Unlock()
+
+	log.Infof("Starting %s job %s", kind, j.ID)
+	go m.run(ctx, j, f)
+	return ret
+}
+
+func (m *Manager) run(ctx context.Context, j *job, f Func) {
+	artifact, err := f(ctx, func(done, total int) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		j.Done, j.Total = done, total
+	})
+	cancelled := ctx.Err() != nil
+	j.cancel()
+
+	m.lock.Lock()
+	now := time.Now()
+	j.Finished = &now
+	j.Artifact = artifact
+	j.HasArtifact = artifact != ""
+	switch {
+	case cancelled:
+		j.State = StateCancelled
+	case err != nil:
+		j.State = StateFailed
+		j.Error = err.Error()
+	default:
+		j.State = StateDone
+	}
+	// artifacts of failed jobs are useless
+	if j.State != StateDone && artifact != "" {
+		os.Remove(artifact)
+		j.Artifact, j.HasArtifact = "", false
+	}
+	log.WithError(err).Infof("Job %s %s", j.ID, j.State)
+	ret, onFinish := j.Job, m.onFinish
+	m.save(j)
+	m.lock.Unlock()
+
+	for _, f := range onFinish {
+		f(ret)
+	}
+}
+
+// Get returns a job by its ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.Job, true
+}
+
+// List returns all the jobs, sorted by creation time
+func (m *Manager) List() []Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j.Job)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Created.Before(jobs[k].Created) })
+	return jobs
+}
+
+// Cancel cancels a running job
+func (m *Manager) Cancel(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	if j.State != StateRunning {
+		return fmt.Errorf("job %s is %s", id, j.State)
+	}
+	j.cancel()
+	return nil
+}
+
+// Artifact returns the path of the file that a finished job produced
+func (m *Manager) Artifact(id string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[id]
+	if !ok || j.State != StateDone || j.Artifact == "" {
+		return "", false
+	}
+	return j.Artifact, true
+}
+
+// Artifacts returns the paths of the files that the finished jobs produced
+func (m *Manager) Artifacts() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var artifacts []string
+	for _, j := range m.jobs {
+		if j.State == StateDone && j.Artifact != "" {
+			artifacts = append(artifacts, j.Artifact)
+		}
+	}
+	return artifacts
+}
+
+// expire removes finished jobs and their artifacts after they expire, until the context is done
+func (m *Manager) expire(ctx context.Context) {
+	interval := m.Expiration / 10
+	if interval < minExpireInterval {
+		interval = minExpireInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.lock.Lock()
+		for id, j := range m.jobs {
+			if j.Finished == nil || time.Since(*j.Finished) < m.Expiration {
+				continue
+			}
+			log.Debugf("Removing expired job %s", id)
+			if j.Artifact != "" {
+				os.Remove(j.Artifact)
+			}
+			delete(m.jobs, id)
+			if err := m.store.Delete(bucket, id); err != nil {
+				log.WithError(err).Errorf("Failed deleting job %s", id)
+			}
+		}
+		m.lock.Unlock()
+	}
+}
+
+func (m *Manager) load() error {
+	values, err := m.store.List(bucket)
+	if err != nil {
+		return fmt.Errorf("load jobs: %s", err)
+	}
+	for id, value := range values {
+		j := new(job)
+		if err := json.Unmarshal(value, j); err != nil {
+			return fmt.Errorf("decode job %s: %s", id, err)
+		}
+		j.cancel = func() {}
+		m.jobs[j.ID] = j
+		if j.State == StateRunning {
+			now := time.Now()
+			j.State = StateFailed
+			j.Error = "interrupted by restart"
+			j.Finished = &now
+			m.save(j)
+		}
+	}
+	log.Infof("Loaded %d jobs", len(values))
+	return nil
+}
+
+// save persists a job, it should be called with the lock held
+func (m *Manager) save(j *job) {
+	if err := m.store.Put(bucket, j.ID, j); err != nil {
+		log.WithError(err).Errorf("Failed saving job %s", j.ID)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,154 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// artifactJob returns a job function that produces an artifact file in a directory. If block is true, it
+// runs until it is cancelled.
+func artifactJob(t *testing.T, dir string, block bool) Func {
+	return func(ctx context.Context, progress func(done, total int)) (string, error) {
+		f, err := ioutil.TempFile(dir, "artifact-")
+		require.Nil(t, err)
+		f.Close()
+		progress(1, 2)
+		if block {
+			<-ctx.Done()
+			return f.Name(), ctx.Err()
+		}
+		return f.Name(), nil
+	}
+}
+
+// finished returns a channel of the jobs that finished in a manager
+func finished(m *Manager) <-chan Job {
+	c := make(chan Job, 10)
+	m.OnFinish(func(j Job) { c <- j })
+	return c
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "job-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, err := NewManager(ctx, Config{}, store.NewMemory())
+	require.Nil(t, err)
+	done := finished(m)
+
+	j := m.Create("test", artifactJob(t, dir, true))
+	assert.Equal(t, StateRunning, j.State)
+	require.Nil(t, m.Cancel(j.ID))
+	select {
+	case j = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not cancelled")
+	}
+	assert.Equal(t, StateCancelled, j.State)
+	assert.False(t, j.HasArtifact)
+	assert.NotNil(t, j.Finished)
+
+	// the artifact of a cancelled job is removed
+	_, ok := m.Artifact(j.ID)
+	assert.False(t, ok)
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Empty(t, files)
+
+	assert.NotNil(t, m.Cancel(j.ID))
+	assert.NotNil(t, m.Cancel("missing"))
+}
+
+func TestRestart(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "job-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	var (
+		st          = store.NewMemory()
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	m, err := NewManager(ctx, Config{}, st)
+	require.Nil(t, err)
+	done := finished(m)
+
+	doneJob := m.Create("test", artifactJob(t, dir, false))
+	<-done
+	runningJob := m.Create("test", func(ctx context.Context, _ func(done, total int)) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	defer m.Cancel(runningJob.ID)
+	artifact, ok := m.Artifact(doneJob.ID)
+	require.True(t, ok)
+
+	// a new manager on the same store has the jobs of the previous one, and jobs that were running failed
+	m, err = NewManager(ctx, Config{}, st)
+	require.Nil(t, err)
+	j, ok := m.Get(doneJob.ID)
+	require.True(t, ok)
+	assert.Equal(t, StateDone, j.State)
+	got, ok := m.Artifact(doneJob.ID)
+	require.True(t, ok)
+	assert.Equal(t, artifact, got)
+	assert.Equal(t, []string{artifact}, m.Artifacts())
+	j, ok = m.Get(runningJob.ID)
+	require.True(t, ok)
+	assert.Equal(t, StateFailed, j.State)
+	assert.Equal(t, "interrupted by restart", j.Error)
+	assert.NotNil(t, j.Finished)
+	assert.Len(t, m.List(), 2)
+}
+
+func TestExpiration(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "job-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = NewManager(ctx, Config{Expiration: -time.Second}, store.NewMemory())
+	assert.NotNil(t, err)
+
+	// expirations that are shorter than the interval of the expiration checks are expired on the next check
+	m, err := NewManager(ctx, Config{Expiration: time.Nanosecond}, store.NewMemory())
+	require.Nil(t, err)
+	done := finished(m)
+	j := m.Create("test", artifactJob(t, dir, false))
+	<-done
+	for i := 0; i < 100; i++ {
+		if _, ok := m.Get(j.ID); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, ok := m.Get(j.ID)
+	assert.False(t, ok)
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"expiration": "30m"}`), &c))
+	assert.Equal(t, 30*time.Minute, c.Expiration)
+}
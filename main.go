@@ -1,24 +1,40 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"expvar"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
-
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/bundle"
 	"github.com/Stratoscale/logserver/cache"
 	"github.com/Stratoscale/logserver/debug"
 	"github.com/Stratoscale/logserver/download"
 	"github.com/Stratoscale/logserver/dynamic"
 	"github.com/Stratoscale/logserver/engine"
+	"github.com/Stratoscale/logserver/job"
+	"github.com/Stratoscale/logserver/notify"
 	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/quota"
 	"github.com/Stratoscale/logserver/route"
+	"github.com/Stratoscale/logserver/schema"
+	"github.com/Stratoscale/logserver/sdk"
+	"github.com/Stratoscale/logserver/snapshot"
 	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/store"
+	"github.com/Stratoscale/logserver/temp"
+	"github.com/Stratoscale/logserver/upload"
+	"github.com/Stratoscale/logserver/version"
 	"github.com/bakins/logrus-middleware"
 	"github.com/gorilla/mux"
 )
@@ -28,29 +44,66 @@ var log = logrus.WithField("pkg", "main")
 const (
 	defaultConfig = "logserver.json"
 	defaultAddr   = "localhost:8888"
+	// parsersReloadInterval is the interval of the checks for changes in the parsers directory
+	parsersReloadInterval = 2 * time.Second
 )
 
 var options struct {
-	addr    string
-	config  string
-	debug   bool
-	dynamic bool
+	addr     string
+	config   string
+	format   string
+	debug    bool
+	dynamic  bool
+	readOnly bool
+	validate bool
+	print    bool
+	version  bool
 }
 
 func init() {
 	flag.StringVar(&options.addr, "addr", defaultAddr, "Serving address")
 	flag.StringVar(&options.config, "config", defaultConfig, "Path to a config file")
+	flag.StringVar(&options.format, "config-format", "", "Format of the config file, json or yaml. Detected by the file extension by default")
 	flag.BoolVar(&options.debug, "debug", false, "Show debug logs")
 	flag.BoolVar(&options.dynamic, "dynamic", false, "Run in dynamic mode")
+	flag.BoolVar(&options.readOnly, "read-only", false, "Disable the endpoints that change the server state")
+	flag.BoolVar(&options.validate, "validate", false, "Validate the config file without connecting to the sources, print the errors and exit")
+	flag.BoolVar(&options.print, "print-config", false, "Print the config with the defaults of unset values and without secrets as JSON and exit")
+	flag.BoolVar(&options.version, "version", false, "Show version and exit")
 }
 
 type config struct {
-	Global  engine.Config   `json:"global"`
-	Sources []source.Config `json:"sources"`
-	Parsers []parse.Config  `json:"parsers"`
-	Dynamic dynamic.Config  `json:"dynamic"`
-	Cache   cache.Config    `json:"cache"`
-	Route   route.Config    `json:"route"`
+	Global    engine.Config          `json:"global"`
+	Sources   []source.Config        `json:"sources"`
+	Parsers   []parse.Config         `json:"parsers"`
+	Dynamic   dynamic.Config         `json:"dynamic"`
+	Cache     cache.Config           `json:"cache"`
+	Route     route.Config           `json:"route"`
+	Jobs      job.Config             `json:"jobs"`
+	Webhooks  []notify.Config        `json:"webhooks"`
+	Auth      auth.Config            `json:"auth"`
+	Quotas    quota.Config           `json:"quotas"`
+	Uploads   upload.Config          `json:"uploads"`
+	Storage   store.Config           `json:"storage"`
+	Snapshots snapshot.Config        `json:"snapshots"`
+	Admission engine.AdmissionConfig `json:"admission"`
+	Downloads download.Limits        `json:"downloads"`
+	ReadOnly  bool                   `json:"read_only"`
+	Self      debug.SelfConfig       `json:"self"`
+	// ParsersDir is a directory of json files of parser lists, which are reloaded when the files change
+	ParsersDir string `json:"parsers_dir"`
+	// Temp is the temporary storage of zips, bundles, uploads and copies of remote files
+	Temp temp.Config `json:"temp"`
+	// Include are globs of files with more sources and parsers, relative to the directory of the config file
+	Include []string `json:"include"`
+	// BannedPaths are globs of sensitive paths that are hidden in all the sources, in addition to the banned
+	// paths of each source
+	BannedPaths []string `json:"banned_paths"`
+}
+
+// bannedPaths returns the banned paths of a source, with the banned paths of all the sources
+func (c config) bannedPaths(paths []string) []string {
+	return append(append([]string{}, c.BannedPaths...), paths...)
 }
 
 func (c config) journal() string {
@@ -65,13 +118,78 @@ func (c config) journal() string {
 	return ""
 }
 
+// parsers builds the parsers of the configuration: the configured parsers, then the parsers of the parsers
+// directory, the parser of the self-monitoring source and a journalctl parser, if they are needed
+func (c config) parsers(dirParsers []parse.Config, self *debug.Self) (parse.Parse, error) {
+	configs := append(append([]parse.Config{}, c.Parsers...), dirParsers...)
+	if self != nil {
+		configs = append(configs, self.Parser())
+	}
+	parser, err := parse.New(configs)
+	if err != nil {
+		return nil, err
+	}
+	if journalName := c.journal(); journalName != "" {
+		log.Infof("Adding a journalctl parser")
+		if err := parser.AppendJournal(journalName); err != nil {
+			log.WithError(err).Warn("Failed adding a journalctl parser")
+		}
+	}
+	return parser, nil
+}
+
 func main() {
 	flag.Parse()
 
+	if options.version {
+		fmt.Println(version.Get())
+		return
+	}
+
+	if options.validate {
+		v := validate(options.config)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		failOnErr(enc.Encode(v), "Encoding validation result")
+		if !v.Valid {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if options.print {
+		cfg := loadConfig(options.config).withDefaults().withoutSecrets()
+		cfg.ReadOnly = cfg.ReadOnly || options.readOnly
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		failOnErr(enc.Encode(cfg), "Encoding config")
+		return
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "config-schema":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		failOnErr(enc.Encode(schema.Generate(config{}, "logserver configuration")), "Encoding config schema")
+		return
+	case "client-sdk":
+		fmt.Print(clientSDK())
+		return
+	case "check":
+		if !check(loadConfig(options.config), os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	default:
+		log.Fatalf("Unknown command: %s", cmd)
+	}
+
 	// apply debug logs
 	if options.debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
+	log.Infof("Starting %s", version.Get())
 
 	// validate address
 	_, _, err := net.SplitHostPort(options.addr)
@@ -79,43 +197,185 @@ func main() {
 
 	cfg := loadConfig(options.config)
 
+	// the logs of the logserver are served as a source, and parsed after the configured parsers
+	var self *debug.Self
+	if cfg.Self.Enabled {
+		self, err = debug.NewSelf(cfg.Self)
+		failOnErr(err, "Creating self-monitoring source")
+	}
+
 	log.Infof("Loading parsers...")
-	parser, err := parse.New(cfg.Parsers)
+	// the parsers are rebuilt when the configuration is reloaded, the handlers get the current parsers
+	configs, err := newConfigReloader(options.config, cfg, self)
 	failOnErr(err, "Creating parsers")
-
-	// add journal parser if necessary
-	if journalName := cfg.journal(); journalName != "" {
-		log.Infof("Adding a journalctl parser")
-		err := parser.AppendJournal(journalName)
-		if err != nil {
-			log.WithError(err).Warn("Failed adding a journalctl parser")
-		}
-	}
+	parser := configs.Parse()
+	cfg.Global.Parsers = configs.Parse
+	configs.watchSignals()
 
 	log.Printf("Loaded with %d parsers", len(parser))
 
-	cache := cache.New(cfg.Cache)
+	cacheStore := cache.New(cfg.Cache)
+
+	// ctx is done when the server is stopped, it stops the background work of the server
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	st, err := store.New(cfg.Storage)
+	failOnErr(err, "Creating storage")
+	jobs, err := job.NewManager(ctx, cfg.Jobs, st)
+	failOnErr(err, "Creating job manager")
+	// the artifacts of persisted jobs are kept in the temporary storage across restarts
+	tmp, err := temp.New(cfg.Temp, jobs.Artifacts()...)
+	failOnErr(err, "Creating temporary storage")
+	// deferred functions don't run when the server is stopped by a signal
+	cleanOnSignal(func() {
+		stop()
+		if err := tmp.Clean(jobs.Artifacts()...); err != nil {
+			log.WithError(err).Error("Failed cleaning temporary storage")
+		}
+	})
+	cfg.Dynamic.Temp = tmp
+	cfg.Dynamic.BannedPaths = cfg.bannedPaths(cfg.Dynamic.BannedPaths)
+	cfg.Uploads.Temp = tmp
+	a, err := auth.New(cfg.Auth, st)
+	failOnErr(err, "Creating authentication")
+	origins, err := auth.NewOrigins(cfg.Auth.AllowedOrigins)
+	failOnErr(err, "Creating allowed origins")
+	cfg.Global.CheckOrigin = origins.CheckWebsocket
+	authz := auth.NewPolicy(cfg.Auth.Policy)
+	if self != nil {
+		// the logs of the server hold the IDs of upload sessions and snapshots, which grant access to them
+		authz = auth.RequireRole(authz, auth.RoleAdmin, self.Name)
+	}
+	cfg.Global.Authorizer = authz
+	cfg.Global.Admission = engine.NewAdmission(cfg.Admission)
+	downloads := download.NewLimiter(cfg.Downloads)
+	cfg.Dynamic.Downloads = downloads
+	quotas := quota.New(cfg.Quotas)
+	readOnly := cfg.ReadOnly || options.readOnly
+	if readOnly {
+		log.Infof("Serving in read-only mode")
+	}
+	mutating := mutatingMiddleware(readOnly)
 
 	r := mux.NewRouter()
+	// public routes are served without authentication
+	public := mux.NewRouter()
 	route.Static(r)
+	route.Version(r, "/", version.Handler())
+	if cfg.Route.RootPath != "" && cfg.Route.RootPath != "/" {
+		route.Version(r, cfg.Route.RootPath, version.Handler())
+	}
+	debug.VarsHandle(r, a.Require(auth.RoleAdmin, expvar.Handler()))
+	// profiling is enabled on startup in debug mode, and admins may enable it at runtime
+	profiling := debug.NewProfiling(options.debug)
+	debug.PProfHandle(r,
+		a.Require(auth.RoleAdmin, profiling.PProf()),
+		origins.Protect(a.Require(auth.RoleAdmin, mutating(profiling.Handler()))))
 
 	if !options.dynamic {
 
-		s, err := source.New(cfg.Sources, cache)
+		newSources := func(c config) (source.Sources, error) {
+			for i := range c.Sources {
+				c.Sources[i].Temp = tmp
+				c.Sources[i].BannedPaths = c.bannedPaths(c.Sources[i].BannedPaths)
+			}
+			s, err := source.New(c.Sources, cacheStore)
+			if err != nil {
+				return nil, err
+			}
+			if self != nil {
+				s = append(s, source.Source{Name: self.Name, FS: self.FS})
+			}
+			return s, nil
+		}
+		s, err := newSources(cfg)
 		failOnErr(err, "Creating config")
-		defer s.CloseSources()
+		// requests hold the sources until they finish, so they are closed only after the requests in flight
+		sources := source.NewRegistry(s)
+		defer func() {
+			if err := sources.Close(); err != nil {
+				log.WithError(err).Error("Failed closing sources")
+			}
+		}()
+		cfg.Global.Sources = sources
+		// the background work of the handlers stops before the sources are closed
+		engineCtx, stopEngine := context.WithCancel(ctx)
+		defer stopEngine()
+		cfg.Global.Context = engineCtx
+		configs.reloadSources(sources, newSources, cacheStore)
 
-		dl := download.New(filepath.Join(cfg.Route.RootPath, "_dl"), s, cache)
-		eng := engine.New(cfg.Global, s, parser, cache)
+		dl := a.Require(auth.RoleDownloader, downloads.Handler(download.New(filepath.Join(cfg.Route.RootPath, "_dl"), sources, cacheStore, authz, tmp)))
+		uploads, err := upload.New(ctx, cfg.Uploads)
+		failOnErr(err, "Creating uploads store")
+		cfg.Global.Uploads = uploads
+		webhooks, err := notify.New(cfg.Webhooks)
+		failOnErr(err, "Creating webhooks")
+		// events are sent to the webhooks and to the clients that subscribed to them
+		events := notify.NewBroker(webhooks)
+		cfg.Global.Events = events
+		snapshots := snapshot.New(cfg.Snapshots, st)
+		cfg.Global.Snapshots = snapshots
+		eng := engine.New(cfg.Global, s, parser, cacheStore)
+		gh := engine.NewGrafana(cfg.Global, s, parser, cacheStore)
+		jobs.OnFinish(func(j job.Job) {
+			e := notify.Event{Type: "job." + string(j.State), Data: j, Path: "_jobs/" + j.ID}
+			if j.HasArtifact {
+				e.Path += "/artifact"
+			}
+			events.Notify(e)
+		})
+		bnd := origins.Protect(a.Require(auth.RoleDownloader, mutating(bundle.New(sources, jobs, tmp, authz))))
+		// downloaders may follow their bundles, but only admins manage jobs
+		jh := origins.Protect(a.RequireWrite(auth.RoleDownloader, auth.RoleAdmin, mutating(jobs.Handler())))
+		th := origins.Protect(a.Require(auth.RoleAdmin, mutating(a.TokensHandler())))
+		sgh := origins.Protect(a.Require(auth.RoleDownloader, a.SignHandler(route.SignablePrefixes(cfg.Route.RootPath)...)))
+		uh := a.Require(auth.RoleAdmin, quotas.UsageHandler())
+		// flushing the cache is a state-changing request
+		ch := origins.Protect(a.Require(auth.RoleAdmin, mutating(cache.Handler(cacheStore))))
+		rh := origins.Protect(a.Require(auth.RoleAdmin, mutating(configs.Handler())))
+		uph := origins.Protect(mutating(uploads.Handler()))
+		snh := origins.Protect(mutating(snapshots.Handler()))
+		// snapshots are shared with people who can't access the sources, anyone with their URL may view them
+		publicSnapshots := public.Methods(http.MethodGet, http.MethodHead).Subrouter()
 
 		// put websocket handler behind the root and behind the proxy path
 		// it must be before the redirect handlers because it is on the proxy path
 		route.Engine(r, "/", eng)
 		route.Download(r, "/", dl)
+		route.Bundle(r, "/", bnd)
+		route.Jobs(r, "/", jh)
+		route.Tokens(r, "/", th)
+		route.Sign(r, "/", sgh)
+		route.Usage(r, "/", uh)
+		route.Cache(r, "/", ch)
+		route.Reload(r, "/", rh)
+		route.Upload(r, "/", uph)
+		route.Snapshot(r, "/", snh)
+		route.Snapshot(publicSnapshots, "/", snh)
+		route.Grafana(r, "/", gh)
 
 		if cfg.Route.RootPath != "" && cfg.Route.RootPath != "/" {
 			route.Engine(r, cfg.Route.RootPath, eng)
 			route.Download(r, cfg.Route.RootPath, dl)
+			route.Bundle(r, cfg.Route.RootPath, bnd)
+			route.Jobs(r, cfg.Route.RootPath, jh)
+			route.Tokens(r, cfg.Route.RootPath, th)
+			route.Sign(r, cfg.Route.RootPath, sgh)
+			route.Usage(r, cfg.Route.RootPath, uh)
+			route.Cache(r, cfg.Route.RootPath, ch)
+			route.Reload(r, cfg.Route.RootPath, rh)
+			route.Upload(r, cfg.Route.RootPath, uph)
+			route.Snapshot(r, cfg.Route.RootPath, snh)
+			route.Snapshot(publicSnapshots, cfg.Route.RootPath, snh)
+			route.Grafana(r, cfg.Route.RootPath, gh)
+		}
+
+		// bundles of dynamic mode are served together with the configured sources under their own prefix
+		if prefix := cfg.Dynamic.URLPrefix(); prefix != "" {
+			h, err := dynamic.New(cfg.Dynamic, cfg.Global, parser, cacheStore, a, st)
+			failOnErr(err, "Creating dynamic handler")
+			log.Infof("Serving bundles of %s on %s", cfg.Dynamic.Root, prefix)
+			r.PathPrefix(prefix).Handler(dynamicLog(h))
 		}
 
 		// add redirect of request that are sent to a proxy path with the same URL without the proxy prefix
@@ -126,32 +386,89 @@ func main() {
 
 	} else {
 		var err error
-		h, err := dynamic.New(cfg.Dynamic, cfg.Global, parser, cache)
+		h, err := dynamic.New(cfg.Dynamic, cfg.Global, parser, cacheStore, a, st)
 		failOnErr(err, "Creating dynamic handler")
-		logMW := logrusmiddleware.Middleware{Logger: log.Logger}
-		h = logMW.Handler(h, "")
-		r.PathPrefix("/").Handler(h)
+		r.PathPrefix("/").Handler(dynamicLog(h))
 	}
 
-	// add debug handlers
-	if options.debug {
-		debug.PProfHandle(r)
-	}
+	// by default every request requires at least a viewer, specific routes require higher roles
+	chain, err := route.Chain(r, cfg.Route.Middlewares, map[string]route.Middleware{
+		route.MiddlewareAuth: func(h http.Handler) http.Handler { return a.Require(auth.RoleViewer, h) },
+		route.MiddlewareLog:  route.Log,
+		route.MiddlewareGzip: route.Gzip,
+		route.MiddlewareCORS: route.CORS(cfg.Route.CORS, origins.Allowed),
+		// quotas are accounted to the authenticated users, so they should come after the authentication
+		route.MiddlewareQuota: quotas.Handler,
+	}, a != nil)
+	failOnErr(err, "Creating middleware chain")
 
 	log.Infof("Serving on http://%s", options.addr)
-	err = http.ListenAndServe(options.addr, r)
+	public.PathPrefix("/").Handler(chain)
+	err = http.ListenAndServe(options.addr, public)
 	failOnErr(err, "Serving")
 }
 
+// cleanOnSignal calls a cleanup function and exits when the server gets SIGTERM or SIGINT
+func cleanOnSignal(clean func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-c
+		log.Infof("Got %s, exiting", sig)
+		clean()
+		os.Exit(0)
+	}()
+}
+
+// mutatingMiddleware returns the middleware of the endpoints that change the server state. In read-only mode,
+// they only serve reads.
+func mutatingMiddleware(readOnly bool) func(http.Handler) http.Handler {
+	if readOnly {
+		return route.ReadOnly
+	}
+	return func(h http.Handler) http.Handler { return h }
+}
+
+// dynamicLog logs the requests of the dynamic handler
+func dynamicLog(h http.Handler) http.Handler {
+	logMW := logrusmiddleware.Middleware{Logger: log.Logger}
+	return logMW.Handler(h, "")
+}
+
+// clientSDK returns the TypeScript client of the websocket protocol
+func clientSDK() string {
+	return sdk.TypeScript(engine.Request{}, engine.Response{})
+}
+
 func loadConfig(fileName string) config {
+	cfg, err := readConfig(fileName)
+	failOnErr(err, "Load config file")
+	return cfg
+}
+
+// readConfig reads and decodes a configuration file
+func readConfig(fileName string) (config, error) {
+	var cfg config
+	format, err := configFormat(fileName, options.format)
+	if err != nil {
+		return cfg, err
+	}
 	f, err := os.Open(fileName)
-	failOnErr(err, fmt.Sprintf("open file %s", fileName))
+	if err != nil {
+		return cfg, fmt.Errorf("open file %s: %s", fileName, err)
+	}
 	defer f.Close()
 
-	var cfg config
-	err = json.NewDecoder(f).Decode(&cfg)
-	failOnErr(err, "Decode config file")
-	return cfg
+	if err := decodeConfig(f, format, &cfg); err != nil {
+		return cfg, fmt.Errorf("decode config file: %s", err)
+	}
+	if err := cfg.include(filepath.Dir(fileName)); err != nil {
+		return cfg, err
+	}
+	if err := cfg.expandEnv(); err != nil {
+		return cfg, fmt.Errorf("expand environment variables in config: %s", err)
+	}
+	return cfg, nil
 }
 
 func failOnErr(err error, msg string, args ...interface{}) {
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// subscriptionBuffer is the number of events that are kept for a slow subscriber, later events are dropped
+const subscriptionBuffer = 64
+
+// Broker sends events to the webhooks, and to the subscribers in the server, like connected clients
+type Broker struct {
+	webhooks Webhooks
+	lock     sync.Mutex
+	subs     map[*Subscription]bool
+}
+
+// NewBroker returns a broker that sends events to the given webhooks
+func NewBroker(webhooks Webhooks) *Broker {
+	return &Broker{webhooks: webhooks, subs: make(map[*Subscription]bool)}
+}
+
+// Subscription receives the events that match its globs
+type Subscription struct {
+	// C is the channel of the events
+	C      <-chan Event
+	ch     chan Event
+	events []glob.Glob
+	broker *Broker
+}
+
+// Subscribe returns a subscription to the events that match one of the globs of event types.
+// If no globs are given, all the events are received. The subscription should be closed when it is not needed.
+func (b *Broker) Subscribe(events []string) (*Subscription, error) {
+	s := &Subscription{ch: make(chan Event, subscriptionBuffer), broker: b}
+	s.C = s.ch
+	for _, e := range events {
+		g, err := glob.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("compiling event glob %s: %s", e, err)
+		}
+		s.events = append(s.events, g)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subs[s] = true
+	return s, nil
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.broker.lock.Lock()
+	defer s.broker.lock.Unlock()
+	delete(s.broker.subs, s)
+}
+
+// Notify sends an event to the webhooks and to the subscribers that are interested in it.
+// Events are not sent to subscribers that did not receive their previous events.
+func (b *Broker) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.webhooks.Notify(e)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for s := range b.subs {
+		if !matchEvent(s.events, e.Type) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			log.Warnf("Dropped event %s of a slow subscriber", e.Type)
+		}
+	}
+}
+
+// matchEvent returns true if an event type matches one of the globs, or if there are no globs
+func matchEvent(events []glob.Glob, eventType string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, g := range events {
+		if g.Match(eventType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package notify
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// teamsCard is the payload of a Microsoft Teams incoming webhook
+type teamsCard struct {
+	Type            string        `json:"@type"`
+	Context         string        `json:"@context"`
+	Summary         string        `json:"summary"`
+	Text            string        `json:"text"`
+	PotentialAction []teamsAction `json:"potentialAction,omitempty"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+func newTeamsCard(text, link string) teamsCard {
+	c := teamsCard{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: text,
+		Text:    text,
+	}
+	if link != "" {
+		c.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "Open in Logserver",
+			Targets: []teamsTarget{{OS: "default", URI: link}},
+		}}
+	}
+	return c
+}
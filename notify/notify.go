@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/duration"
+	"github.com/gobwas/glob"
+)
+
+var log = logrus.WithField("pkg", "notify")
+
+// Kinds of notifiers
+const (
+	// KindWebhook sends the event as json, or as the rendered template
+	KindWebhook = "webhook"
+	// KindSlack sends a message to a Slack incoming webhook
+	KindSlack = "slack"
+	// KindTeams sends a message card to a Microsoft Teams incoming webhook
+	KindTeams = "teams"
+)
+
+// defaultMessage is the message template of chat notifiers
+const defaultMessage = `Logserver {{.Type}}{{with .Link}}: {{.}}{{end}}`
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	defaultTimeout = 10 * time.Second
+)
+
+// Config is a webhook configuration
+type Config struct {
+	// Kind of the notifier: webhook (default), slack or teams
+	Kind string `json:"kind"`
+	// URL to POST the event payload to
+	URL string `json:"url"`
+	// UIURL is the external URL of the logserver, used for creating links in notifications
+	UIURL string `json:"ui_url"`
+	// Events are globs of event types that should be sent, for example "job.*".
+	// If empty, all events are sent.
+	Events []string `json:"events"`
+	// Template is a Go text template. The template is executed with the event.
+	// For webhooks it is the request body, and if empty, the event is sent as json.
+	// For chat notifiers it is the message text.
+	Template string `json:"template"`
+	// Headers are additional headers for the request
+	Headers map[string]string `json:"headers"`
+	// Retries is the number of times a failed request is retried
+	Retries int `json:"retries"`
+	// Backoff is the time to wait before the first retry, it is doubled on every retry
+	Backoff time.Duration `json:"backoff"`
+	// Timeout of a single request
+	Timeout time.Duration `json:"timeout"`
+}
+
+// UnmarshalJSON decodes the webhook configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// Event is a notification about something that happened in the server
+type Event struct {
+	// Type of the event, for example "job.done"
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+	// Path in the UI that the event refers to
+	Path string `json:"path,omitempty"`
+}
+
+// message is an event with a link to the UI, which is sent to the notifiers
+type message struct {
+	Event
+	Link string `json:"link,omitempty"`
+}
+
+// Webhooks sends events to webhook URLs
+type Webhooks []*webhook
+
+type webhook struct {
+	Config
+	events   []glob.Glob
+	template *template.Template
+	client   *http.Client
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
+	if c.Kind == "" {
+		c.Kind = KindWebhook
+	}
+	if c.Template == "" && c.Kind != KindWebhook {
+		c.Template = defaultMessage
+	}
+	if c.Retries == 0 {
+		c.Retries = defaultRetries
+	}
+	if c.Backoff == 0 {
+		c.Backoff = defaultBackoff
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	return c
+}
+
+// New creates webhooks from configuration
+func New(configs []Config) (Webhooks, error) {
+	var ws Webhooks
+	for _, c := range configs {
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook without url")
+		}
+		c = c.WithDefaults()
+		switch c.Kind {
+		case KindWebhook, KindSlack, KindTeams:
+		default:
+			return nil, fmt.Errorf("unknown kind of webhook %s: %s", c.URL, c.Kind)
+		}
+		w := &webhook{Config: c, client: &http.Client{Timeout: c.Timeout}}
+		for _, e := range c.Events {
+			g, err := glob.Compile(e)
+			if err != nil {
+				return nil, fmt.Errorf("compiling event glob %s: %s", e, err)
+			}
+			w.events = append(w.events, g)
+		}
+		if c.Template != "" {
+			t, err := template.New(c.URL).Funcs(funcs).Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("parsing template of webhook %s: %s", c.URL, err)
+			}
+			w.template = t
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+var funcs = template.FuncMap{
+	// json encodes a value as json, useful for escaping strings in json templates
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Notify sends an event to all the webhooks that are interested in it.
+// Sending is done in the background.
+func (ws Webhooks) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, w := range ws {
+		if !w.match(e.Type) {
+			continue
+		}
+		go w.send(e)
+	}
+}
+
+func (w *webhook) match(eventType string) bool {
+	return matchEvent(w.events, eventType)
+}
+
+func (w *webhook) send(e Event) {
+	log := log.WithField("url", w.URL).WithField("event", e.Type)
+	body, err := w.body(e)
+	if err != nil {
+		log.WithError(err).Errorf("Failed creating webhook body")
+		return
+	}
+	backoff := w.Backoff
+	for i := 0; ; i++ {
+		err := w.post(body)
+		if err == nil {
+			log.Debugf("Sent webhook")
+			return
+		}
+		if i >= w.Retries {
+			log.WithError(err).Errorf("Failed sending webhook")
+			return
+		}
+		log.WithError(err).Warnf("Failed sending webhook, retrying in %s", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *webhook) body(e Event) ([]byte, error) {
+	m := message{Event: e}
+	if w.UIURL != "" && e.Path != "" {
+		m.Link = strings.TrimRight(w.UIURL, "/") + "/" + strings.TrimLeft(e.Path, "/")
+	}
+	if w.template == nil {
+		return json.Marshal(m)
+	}
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, m); err != nil {
+		return nil, err
+	}
+	switch w.Kind {
+	case KindSlack:
+		return json.Marshal(slackMessage{Text: buf.String()})
+	case KindTeams:
+		return json.Marshal(newTeamsCard(buf.String(), m.Link))
+	default:
+		return buf.Bytes(), nil
+	}
+}
+
+func (w *webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls  int
+		bodies = make(chan string)
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// fail the first request to check retries
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer s.Close()
+
+	ws, err := New([]Config{{
+		URL:      s.URL,
+		Events:   []string{"job.*"},
+		Template: `{"text": {{json .Type}}}`,
+		Backoff:  time.Millisecond,
+	}})
+	require.Nil(t, err)
+
+	ws.Notify(Event{Type: "other"})
+	ws.Notify(Event{Type: "job.done"})
+
+	select {
+	case body := <-bodies:
+		assert.Equal(t, `{"text": "job.done"}`, body)
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not sent")
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestChat(t *testing.T) {
+	t.Parallel()
+
+	bodies := make(chan string, 2)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer s.Close()
+
+	ws, err := New([]Config{{Kind: KindSlack, URL: s.URL, UIURL: "http://logserver/"}})
+	require.Nil(t, err)
+
+	ws.Notify(Event{Type: "job.done", Path: "_jobs/1/artifact"})
+
+	select {
+	case body := <-bodies:
+		assert.Equal(t, `{"text":"Logserver job.done: http://logserver/_jobs/1/artifact"}`, body)
+	case <-time.After(time.Second):
+		t.Fatal("message was not sent")
+	}
+}
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker(nil)
+	jobs, err := b.Subscribe([]string{"job.*"})
+	require.Nil(t, err)
+	all, err := b.Subscribe(nil)
+	require.Nil(t, err)
+
+	b.Notify(Event{Type: "source.down"})
+	b.Notify(Event{Type: "job.done"})
+	jobs.Close()
+	b.Notify(Event{Type: "job.failed"})
+
+	assert.Equal(t, "job.done", (<-jobs.C).Type)
+	assert.Len(t, jobs.C, 0)
+	for _, want := range []string{"source.down", "job.done", "job.failed"} {
+		e := <-all.C
+		assert.Equal(t, want, e.Type)
+		assert.False(t, e.Time.IsZero())
+	}
+
+	_, err = b.Subscribe([]string{"job.["})
+	assert.NotNil(t, err)
+}
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var cs []Config
+	require.Nil(t, json.Unmarshal([]byte(`[{"url": "http://hook", "backoff": "500ms"}]`), &cs))
+	require.Len(t, cs, 1)
+	assert.Equal(t, "http://hook", cs[0].URL)
+	assert.Equal(t, 500*time.Millisecond, cs[0].Backoff)
+}
@@ -0,0 +1,79 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// newDelimited validates the configuration of a delimited parser and returns the delimiter rune
+func newDelimited(c Config) (rune, error) {
+	d := c.Delimiter
+	if d == "tab" {
+		d = "\t"
+	}
+	if utf8.RuneCountInString(d) != 1 {
+		return 0, fmt.Errorf("delimiter should be a single character, got: %q", c.Delimiter)
+	}
+	r, _ := utf8.DecodeRuneInString(d)
+	return r, nil
+}
+
+// parseDelimited parses a line of a CSV or TSV log. If the columns are not configured, the
+// first parsed line of the file is the header row, and the column names are taken from it.
+// Columns that are mapped to UI keys fill the log, and the rest are returned as log fields.
+func (p *parser) parseDelimited(line []byte, mem *Memory) *Log {
+	r := csv.NewReader(bytes.NewReader(line))
+	r.Comma = p.delimiter
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	record, err := r.Read()
+	// a line without the delimiter is not a delimited line
+	if err != nil || len(record) < 2 {
+		return nil
+	}
+
+	columns := p.Columns
+	if len(columns) == 0 {
+		if mem.columns == nil {
+			mem.columns = record
+			return &Log{Msg: string(line)}
+		}
+		columns = mem.columns
+	}
+	if len(record) != len(columns) {
+		return nil
+	}
+
+	log := &Log{Msg: string(line)}
+	for i, column := range columns {
+		// without a column mapping, columns that are named as UI keys are used as is
+		key := column
+		if len(p.ColumnMapping) > 0 {
+			key = p.uiKeys[column]
+		}
+		value := record[i]
+		switch key {
+		case KeyMsg:
+			log.Msg = value
+		case KeyLevel:
+			log.Level = value
+		case KeyTime:
+			log.parseTime(p.TimeFormats, value)
+		case KeyThreadName:
+			log.Thread = value
+		case KeyPathName:
+			log.Path = value
+		case KeyLineNo:
+			log.LineNo, _ = strconv.Atoi(value)
+		default:
+			if log.Fields == nil {
+				log.Fields = make(map[string]string, len(columns))
+			}
+			log.Fields[column] = value
+		}
+	}
+	return log
+}
@@ -0,0 +1,150 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "parse")
+
+// LoadDir loads the parser configs of the json files in a directory, each file is a list of parser dicts.
+// The parsers are ordered by the names of their files.
+func LoadDir(dir string) ([]Config, error) {
+	files, err := jsonFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var c []Config
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("parsing %s: %s", f.Name(), err)
+		}
+		configs = append(configs, c...)
+	}
+	return configs, nil
+}
+
+// jsonFiles returns the json files in a directory, sorted by their names
+func jsonFiles(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// Reloader keeps the parsers that are built with the parser configs of a directory, and rebuilds them
+// when the files in the directory change. If the new parsers fail to build, the previous parsers are kept.
+type Reloader struct {
+	dir   string
+	build func([]Config) (Parse, error)
+	lock  sync.RWMutex
+	parse Parse
+	// stamp identifies the state of the files in the directory, the parsers are rebuilt when it changes
+	stamp string
+}
+
+// NewReloader builds the parsers of a directory with a build function, which is given the parser configs
+// of the directory, and rebuilds them when the files in the directory change, checking for changes
+// in the given interval.
+func NewReloader(dir string, interval time.Duration, build func([]Config) (Parse, error)) (*Reloader, error) {
+	r := &Reloader{dir: dir, build: build}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := r.reload(); err != nil {
+				log.WithError(err).Errorf("Failed reloading parsers from %s, keeping the previous parsers", dir)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Parse returns the current parsers
+func (r *Reloader) Parse() Parse {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.parse
+}
+
+// Rebuild rebuilds the parsers even if the files in the directory did not change, for example when the
+// parsers that the build function adds to the directory parsers changed. If the new parsers fail to build,
+// the previous parsers are kept.
+func (r *Reloader) Rebuild() error {
+	return r.rebuild(true)
+}
+
+// reload rebuilds the parsers if the files in the directory changed
+func (r *Reloader) reload() error {
+	return r.rebuild(false)
+}
+
+func (r *Reloader) rebuild(force bool) error {
+	stamp, err := dirStamp(r.dir)
+	if err != nil {
+		return err
+	}
+	r.lock.RLock()
+	changed := stamp != r.stamp
+	r.lock.RUnlock()
+	if !changed && !force {
+		return nil
+	}
+	configs, err := LoadDir(r.dir)
+	var p Parse
+	if err == nil {
+		p, err = r.build(configs)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err != nil {
+		// a failed state is not retried until the files change again
+		if r.stamp != "" {
+			r.stamp = stamp
+		}
+		return err
+	}
+	if r.stamp != "" {
+		log.Infof("Reloaded %d parsers from %s", len(configs), r.dir)
+	}
+	r.parse, r.stamp = p, stamp
+	return nil
+}
+
+// dirStamp returns the names, sizes and modification times of the json files in a directory
+func dirStamp(dir string) (string, error) {
+	files, err := jsonFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	// an empty directory has a stamp, so it is not rebuilt on every check
+	b.WriteString(dir)
+	for _, f := range files {
+		fmt.Fprintf(&b, "\n%s %d %d", f.Name(), f.Size(), f.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "parsers")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	write("b.json", `[{"glob": "*.b", "regexp": "^(?P<msg>.*)$"}]`)
+	write("a.json", `[{"glob": "*.a", "regexp": "^(?P<msg>.*)$"}]`)
+	write("notes.txt", `not a parser`)
+
+	r, err := NewReloader(dir, 10*time.Millisecond, New)
+	require.Nil(t, err)
+	globs := func() []string {
+		var globs []string
+		for _, info := range r.Parse().Info() {
+			globs = append(globs, info.Glob)
+		}
+		return globs
+	}
+	assert.Equal(t, []string{"*.a", "*.b"}, globs())
+
+	// wait until the parsers are reloaded, or until the timeout
+	waitGlobs := func(want []string) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if assert.ObjectsAreEqual(want, globs()) {
+				return
+			}
+		}
+		assert.Equal(t, want, globs())
+	}
+
+	write("c.json", `[{"glob": "*.c", "json_mapping": {"msg": "msg"}}]`)
+	waitGlobs([]string{"*.a", "*.b", "*.c"})
+
+	// bad parsers are not loaded, the previous parsers are kept
+	write("c.json", `[{"glob": "*.c", "regexp": "("}]`)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"*.a", "*.b", "*.c"}, globs())
+
+	require.Nil(t, os.Remove(filepath.Join(dir, "c.json")))
+	waitGlobs([]string{"*.a", "*.b"})
+
+	_, err = NewReloader(filepath.Join(dir, "missing"), time.Hour, New)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,26 @@
+package parse
+
+// Info describes a configured parser
+type Info struct {
+	Config
+	// Format is the format of the files that the parser handles: "csv", "json" or "regexp"
+	Format string `json:"format"`
+}
+
+// Info describes the parsers, in the order in which they are tried on a file
+func (ps Parse) Info() []Info {
+	infos := make([]Info, 0, len(ps))
+	for i := range ps {
+		info := Info{Config: ps[i].Config, Format: ps[i].format()}
+		if info.Glob == "" {
+			info.Glob = "*"
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// AppliesAt returns true if the parser at index i applies to a log file
+func (ps Parse) AppliesAt(i int, logName string) bool {
+	return ps[i].glob.Match(logName)
+}
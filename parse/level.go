@@ -0,0 +1,26 @@
+package parse
+
+import "regexp"
+
+// Inferred levels of lines that were not parsed
+const (
+	LevelError   = "ERROR"
+	LevelWarning = "WARNING"
+)
+
+var (
+	errorKeywords   = regexp.MustCompile(`\b(ERROR|FATAL|CRITICAL|PANIC|Traceback|\w*Exception)\b|\b(panic|[Ee]rror|[Ff]atal):`)
+	warningKeywords = regexp.MustCompile(`\b(WARN|WARNING)\b|\b[Ww]arn(ing)?:`)
+)
+
+// InferLevel returns the level of an unstructured line according to keywords in its message,
+// or an empty string if it has none of them
+func InferLevel(msg string) string {
+	switch {
+	case errorKeywords.MatchString(msg):
+		return LevelError
+	case warningKeywords.MatchString(msg):
+		return LevelWarning
+	}
+	return ""
+}
@@ -20,6 +20,58 @@ type Log struct {
 	Thread   string     `json:"thread,omitempty"`
 	Path     string     `json:"path,omitempty"`
 	LineNo   int        `json:"lineno"`
+	// Fields are values that were extracted from the message by named capture groups of a search regexp,
+	// or columns of a CSV/TSV log that are not mapped to other keys
+	Fields map[string]string `json:"fields,omitempty"`
+	// Repeat is the number of identical consecutive lines that were collapsed into this line, including it
+	Repeat int `json:"repeat,omitempty"`
+	// Raw is the original line, before it was parsed, if it was requested
+	Raw string `json:"raw,omitempty"`
+	// Gap is set on a synthetic line that marks a gap between the times of the lines around it
+	Gap time.Duration `json:"gap,omitempty"`
+}
+
+// merge sets the keys that were parsed from the message of a line by a pipeline stage
+func (l *Log) merge(inner *Log) {
+	l.Msg = inner.Msg
+	if inner.Level != "" {
+		l.Level = inner.Level
+	}
+	if inner.Time != nil {
+		l.Time = inner.Time
+	}
+	if inner.Thread != "" {
+		l.Thread = inner.Thread
+	}
+	if inner.Path != "" {
+		l.Path = inner.Path
+	}
+	if inner.LineNo != 0 {
+		l.LineNo = inner.LineNo
+	}
+	for k, v := range inner.Fields {
+		if l.Fields == nil {
+			l.Fields = make(map[string]string, len(inner.Fields))
+		}
+		l.Fields[k] = v
+	}
+}
+
+// timeFormatReference is a time whose fields differ from each other, for checking that a time format
+// has layout elements
+var timeFormatReference = time.Date(2001, 2, 3, 16, 5, 6, 0, time.UTC)
+
+// CheckTimeFormat checks that a time format is unix_float, unix_int or a Go time layout. A layout without any
+// layout elements, like "yyyy-mm-dd", would never parse a time.
+func CheckTimeFormat(format string) error {
+	switch format {
+	case "unix_float", "unix_int":
+		return nil
+	}
+	if timeFormatReference.Format(format) == format {
+		return fmt.Errorf("%q has no time layout elements, expected a layout like %q", format, "2006-01-02 15:04:05")
+	}
+	return nil
 }
 
 func (l *Log) parseTime(timeFormats []string, timeString string) {
@@ -51,6 +103,13 @@ func (l *Log) parseTime(timeFormats []string, timeString string) {
 var keyword = regexp.MustCompile(`%(\(([^)]+)\)\d*\.?\d*)?[diouxXeEfFgGcrs]`)
 
 func (l *Log) injectArgs(args interface{}) {
+	// arguments that were captured from a text, like by a regexp, are decoded from json
+	if s, ok := args.(string); ok {
+		var obj interface{}
+		if err := json.Unmarshal([]byte(s), &obj); err == nil {
+			args = obj
+		}
+	}
 	l.Msg = strings.Replace(l.Msg, "%s", "%v", -1)
 
 	// special case is when a dict or a list should be inserted into one argument in the string
@@ -77,10 +136,5 @@ func (l *Log) injectArgs(args interface{}) {
 			}
 			return fmt.Sprintf("%v", val)
 		})
-	case string:
-		var obj interface{}
-		if err := json.Unmarshal([]byte(args), &obj); err != nil {
-			l.injectArgs(obj)
-		}
 	}
 }
@@ -35,6 +35,17 @@ type Config struct {
 	// For JSON mapping
 	// Add key=val to message with all unused key values of json
 	AppendArgs bool `json:"append_args"`
+	// For CSV/TSV logs
+	// Delimiter of the columns, for example "," or "tab"
+	Delimiter string `json:"delimiter"`
+	// Columns are the names of the columns, if not given, the first line of each file is the header row
+	Columns []string `json:"columns"`
+	// ColumnMapping maps UI keys to column names, if not given, columns that are named as UI keys are used
+	ColumnMapping map[string]string `json:"column_mapping"`
+	// Pipeline are parsers of the message of a parsed line, that are applied in order, for nested formats like
+	// a JSON log in a syslog envelope. The keys that a stage parses replace the keys of the line, and a stage
+	// that does not parse the message is skipped. The globs of the stages are ignored.
+	Pipeline []Config `json:"pipeline,omitempty"`
 }
 
 type Parse []parser
@@ -42,40 +53,81 @@ type Parse []parser
 func New(configs []Config) (Parse, error) {
 	var ps Parse
 	for _, c := range configs {
-		if c.Regexp != "" && len(c.JsonMapping) != 0 {
-			return nil, fmt.Errorf("can't specify both 'regexp' and 'json_mapping', got: %+v", c)
+		p, err := newParser(c)
+		if err != nil {
+			return nil, err
 		}
-		if c.Regexp == "" && len(c.JsonMapping) == 0 {
-			return nil, fmt.Errorf("must specify 'regexp' or 'json_mapping', got: %+v", c)
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func newParser(c Config) (parser, error) {
+	kinds := 0
+	for _, set := range []bool{c.Regexp != "", len(c.JsonMapping) != 0, c.Delimiter != ""} {
+		if set {
+			kinds++
 		}
+	}
+	if kinds > 1 {
+		return parser{}, fmt.Errorf("can specify only one of 'regexp', 'json_mapping' and 'delimiter', got: %+v", c)
+	}
+	if kinds == 0 {
+		return parser{}, fmt.Errorf("must specify 'regexp', 'json_mapping' or 'delimiter', got: %+v", c)
+	}
 
-		var (
-			p   = parser{Config: c}
-			err error
-		)
+	var (
+		p   = parser{Config: c}
+		err error
+	)
 
-		if c.Regexp != "" {
-			p.regexp, err = regexp.Compile(c.Regexp)
-			if err != nil {
-				return nil, fmt.Errorf("compiling regexp: %s", err)
-			}
+	if c.Regexp != "" {
+		p.regexp, err = regexp.Compile(c.Regexp)
+		if err != nil {
+			return parser{}, fmt.Errorf("compiling regexp: %s", err)
+		}
+	}
+	if c.Delimiter != "" {
+		p.delimiter, err = newDelimited(c)
+		if err != nil {
+			return parser{}, err
 		}
-		if c.Glob == "" {
-			c.Glob = "*"
+		p.uiKeys = make(map[string]string, len(c.ColumnMapping))
+		for key, column := range c.ColumnMapping {
+			p.uiKeys[column] = key
 		}
-		p.glob, err = glob.Compile(c.Glob)
+	}
+	if c.Glob == "" {
+		c.Glob = "*"
+	}
+	p.glob, err = glob.Compile(c.Glob)
+	if err != nil {
+		return parser{}, fmt.Errorf("compiling glob: %s", err)
+	}
+	for i, stage := range c.Pipeline {
+		// a message has no header row
+		if stage.Delimiter != "" && len(stage.Columns) == 0 {
+			return parser{}, fmt.Errorf("pipeline stage %d: 'columns' must be given with 'delimiter'", i)
+		}
+		sp, err := newParser(stage)
 		if err != nil {
-			return nil, fmt.Errorf("compiling glob: %s", err)
+			return parser{}, fmt.Errorf("pipeline stage %d: %s", i, err)
 		}
-		ps = append(ps, p)
+		p.pipeline = append(p.pipeline, sp)
 	}
-	return ps, nil
+	return p, nil
 }
 
 type parser struct {
 	Config
 	regexp *regexp.Regexp
 	glob   glob.Glob
+	// delimiter of a CSV/TSV parser
+	delimiter rune
+	// uiKeys maps column names to UI keys
+	uiKeys map[string]string
+	// pipeline are the parsers of the message of a parsed line
+	pipeline []parser
 }
 
 // Memory is used to remember which parser applied for a file
@@ -83,13 +135,36 @@ type parser struct {
 type Memory struct {
 	parser *parser
 	count  int
+	// columns are the header row of a CSV/TSV file
+	columns []string
+}
+
+// Format returns the format of a file according to the parser that parsed its lines:
+// "csv", "json", "regexp", or "text" if none of the parsers parsed them.
+func (m *Memory) Format() string {
+	if m.parser == nil {
+		return "text"
+	}
+	return m.parser.format()
+}
+
+func (p *parser) format() string {
+	switch {
+	case p.delimiter != 0:
+		return "csv"
+	case len(p.JsonMapping) > 0:
+		return "json"
+	case p.regexp != nil:
+		return "regexp"
+	}
+	return "text"
 }
 
 func (ps Parse) Parse(logName string, line []byte, mem *Memory) *Log {
 
 	// check for memory for file that was already parsed with a parser
 	if mem.parser != nil {
-		parsed := mem.parser.parse(line)
+		parsed := mem.parser.parse(line, mem)
 		if parsed != nil {
 			return parsed
 		} else {
@@ -101,7 +176,7 @@ func (ps Parse) Parse(logName string, line []byte, mem *Memory) *Log {
 		if !p.glob.Match(logName) {
 			continue
 		}
-		log := p.parse(line)
+		log := p.parse(line, mem)
 		if log != nil {
 			mem.parser = &p
 			return log
@@ -114,16 +189,47 @@ func (ps Parse) Parse(logName string, line []byte, mem *Memory) *Log {
 	return &Log{Msg: string(line)}
 }
 
-func (p *parser) parse(line []byte) *Log {
+// Applies returns true if one of the parsers applies to a log file according to its glob
+func (ps Parse) Applies(logName string) bool {
+	for _, p := range ps {
+		if p.glob.Match(logName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if one of the parsers applies to a log file and parses a line of it
+func (ps Parse) Matches(logName string, line []byte) bool {
+	for _, p := range ps {
+		if p.glob.Match(logName) && p.parse(line, &Memory{}) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parse(line []byte, mem *Memory) *Log {
+	var log *Log
 	switch {
+	case p.delimiter != 0:
+		log = p.parseDelimited(line, mem)
 	case len(p.JsonMapping) > 0:
-		return p.parseJson(line)
+		log = p.parseJson(line)
 	case p.regexp != nil:
-		return p.parseRegexp(line)
+		log = p.parseRegexp(line)
 	default:
 		// default no-parser
 		return &Log{Msg: string(line)}
 	}
+	if log != nil {
+		for i := range p.pipeline {
+			if inner := p.pipeline[i].parse([]byte(log.Msg), mem); inner != nil {
+				log.merge(inner)
+			}
+		}
+	}
+	return log
 }
 
 func (p *parser) parseJson(line []byte) *Log {
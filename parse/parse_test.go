@@ -171,3 +171,118 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestDelimited(t *testing.T) {
+	t.Parallel()
+	time1, err := time.Parse("2006-01-02 15:04:05", "2018-01-02 10:00:00")
+	require.Nil(t, err)
+
+	parsers, err := New([]Config{
+		{
+			Glob:        "*.csv",
+			Delimiter:   ",",
+			TimeFormats: []string{"2006-01-02 15:04:05"},
+		},
+		{
+			Glob:          "*.tsv",
+			Delimiter:     "tab",
+			Columns:       []string{"ts", "user", "action"},
+			ColumnMapping: map[string]string{"time": "ts", "msg": "action"},
+			TimeFormats:   []string{"2006-01-02 15:04:05"},
+		},
+	})
+	require.Nil(t, err)
+
+	mem := &Memory{}
+	assert.Equal(t, &Log{Msg: "time,level,msg,amount"}, parsers.Parse("billing.csv", []byte("time,level,msg,amount"), mem))
+	assert.Equal(t,
+		&Log{Msg: "charged, twice", Level: "INFO", Time: &time1, Fields: map[string]string{"amount": "12.5"}},
+		parsers.Parse("billing.csv", []byte(`2018-01-02 10:00:00,INFO,"charged, twice",12.5`), mem),
+	)
+	assert.Equal(t,
+		&Log{Msg: "login", Time: &time1, Fields: map[string]string{"user": "alice"}},
+		parsers.Parse("audit.tsv", []byte("2018-01-02 10:00:00\talice\tlogin"), &Memory{}),
+	)
+	assert.Equal(t, &Log{Msg: "no columns"}, parsers.Parse("audit.tsv", []byte("no columns"), &Memory{}))
+
+	_, err = New([]Config{{Delimiter: ",", Regexp: "."}})
+	assert.NotNil(t, err)
+	_, err = New([]Config{{Delimiter: ",;"}})
+	assert.NotNil(t, err)
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+	time1, err := time.Parse("2006-01-02 15:04:05", "2018-01-02 10:00:00")
+	require.Nil(t, err)
+
+	// the syslog envelope is stripped, and its message is parsed as a JSON log, or as a text log with args
+	syslog := `^\w{3} +\d+ \d{2}:\d{2}:\d{2} \S+ \S+: (?P<msg>.*)$`
+	parsers, err := New([]Config{
+		{
+			Glob:   "*.fwd",
+			Regexp: syslog,
+			Pipeline: []Config{
+				{
+					JsonMapping: map[string]string{"msg": "msg", "level": "levelname", "time": "asctime", "args": "args"},
+					TimeFormats: []string{"2006-01-02 15:04:05"},
+				},
+				{Regexp: `^(?P<level>[A-Z]+) (?P<msg>.*) args=(?P<args>.*)$`},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	tests := []struct {
+		name string
+		line string
+		want *Log
+	}{
+		{
+			name: "json",
+			line: `Jan  2 10:00:00 node1 app[12]: {"msg": "hello %s, you have %s messages", "levelname": "INFO", "asctime": "2018-01-02 10:00:00", "args": ["bob", 3]}`,
+			want: &Log{Msg: "hello bob, you have 3 messages", Level: "INFO", Time: &time1},
+		},
+		{
+			name: "text with args",
+			line: `Jan  2 10:00:00 node1 app[12]: WARNING disk %s is %s%% full args=["sda", 90]`,
+			want: &Log{Msg: "disk sda is 90% full", Level: "WARNING"},
+		},
+		{
+			name: "stages that don't parse are skipped",
+			line: `Jan  2 10:00:00 node1 app[12]: plain message`,
+			want: &Log{Msg: "plain message"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, parsers.Parse("app.fwd", []byte(tt.line), &Memory{}))
+		})
+	}
+
+	_, err = New([]Config{{Regexp: syslog, Pipeline: []Config{{Delimiter: ","}}}})
+	assert.NotNil(t, err)
+	_, err = New([]Config{{Regexp: syslog, Pipeline: []Config{{}}}})
+	assert.NotNil(t, err)
+}
+
+func TestInferLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"2018-01-02 ERROR disk full":                 LevelError,
+		"Traceback (most recent call last):":         LevelError,
+		"panic: runtime error: index out of range":   LevelError,
+		"error: network down":                        LevelError,
+		"java.lang.IllegalStateException: bad state": LevelError,
+		"WARN low memory":                            LevelWarning,
+		"warning: deprecated option":                 LevelWarning,
+		"no errors were found":                       "",
+		"service started":                            "",
+	}
+	for msg, want := range tests {
+		assert.Equal(t, want, InferLevel(msg), msg)
+	}
+}
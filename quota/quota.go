@@ -0,0 +1,224 @@
+package quota
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
+)
+
+var log = logrus.WithField("pkg", "quota")
+
+// Limits of a single user. Zero values mean no limit.
+type Limits struct {
+	// DailyBytes is the number of bytes that can be served to a user in a day
+	DailyBytes int64 `json:"daily_bytes"`
+	// MaxConcurrent is the number of requests, including open websockets, that a user can have at a time
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// Config is the quotas configuration
+type Config struct {
+	// Limits are the default limits of all users
+	Limits
+	// Users overrides the limits of specific users, by user name
+	Users map[string]Limits `json:"users"`
+}
+
+// Usage is the usage of a single user
+type Usage struct {
+	// Bytes that were served today
+	Bytes int64 `json:"bytes"`
+	// Concurrent is the number of running requests
+	Concurrent int `json:"concurrent"`
+}
+
+// Quotas accounts the usage of users and enforces their limits
+type Quotas struct {
+	Config
+	usage map[string]*Usage
+	day   string
+	lock  sync.Mutex
+}
+
+// New returns a new quotas handler
+func New(c Config) *Quotas {
+	return &Quotas{Config: c, usage: make(map[string]*Usage)}
+}
+
+// Handler wraps a handler with usage accounting and limits enforcement.
+// It should be wrapped by the authentication handler, so requests are accounted to users.
+// Requests without a user are accounted by their remote address.
+// The daily bytes are enforced as the response is written, so writes of long responses, like followed
+// files, fail when the quota is exceeded, and hijacked connections, like websockets, are closed.
+func (q *Quotas) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := auth.ClientName(r)
+		if err := q.start(user); err != nil {
+			log.Warnf("User %s rejected: %s", user, err)
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer q.finish(user)
+		count := func(n int) error {
+			err := q.add(user, n)
+			if err != nil {
+				log.Warnf("User %s cut off: %s", user, err)
+			}
+			return err
+		}
+		h.ServeHTTP(&countingWriter{ResponseWriter: w, count: count}, r)
+	})
+}
+
+// Usage returns the current usage of all users
+func (q *Quotas) Usage() map[string]Usage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.resetDay()
+	ret := make(map[string]Usage, len(q.usage))
+	for user, u := range q.usage {
+		ret[user] = *u
+	}
+	return ret
+}
+
+func (q *Quotas) limits(user string) Limits {
+	if l, ok := q.Users[user]; ok {
+		return l
+	}
+	return q.Limits
+}
+
+func (q *Quotas) start(user string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.resetDay()
+	u := q.get(user)
+	l := q.limits(user)
+	if l.DailyBytes > 0 && u.Bytes >= l.DailyBytes {
+		return fmt.Errorf("daily quota of %d bytes exceeded", l.DailyBytes)
+	}
+	if l.MaxConcurrent > 0 && u.Concurrent >= l.MaxConcurrent {
+		return fmt.Errorf("too many concurrent requests, limit is %d", l.MaxConcurrent)
+	}
+	u.Concurrent++
+	return nil
+}
+
+func (q *Quotas) finish(user string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.get(user).Concurrent--
+}
+
+// add accounts bytes that were served to a user, it returns an error if they exceeded the daily quota
+func (q *Quotas) add(user string, n int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.resetDay()
+	u := q.get(user)
+	u.Bytes += int64(n)
+	if l := q.limits(user); l.DailyBytes > 0 && u.Bytes > l.DailyBytes {
+		return fmt.Errorf("daily quota of %d bytes exceeded", l.DailyBytes)
+	}
+	return nil
+}
+
+// get returns the usage of a user, it should be called with the lock held
+func (q *Quotas) get(user string) *Usage {
+	u, ok := q.usage[user]
+	if !ok {
+		u = &Usage{}
+		q.usage[user] = u
+	}
+	return u
+}
+
+// resetDay resets the daily byte counts when the day changes, and removes the users without running
+// requests, so users of past days are not kept. It should be called with the lock held.
+func (q *Quotas) resetDay() {
+	day := time.Now().Format("2006-01-02")
+	if day == q.day {
+		return
+	}
+	q.day = day
+	for user, u := range q.usage {
+		if u.Concurrent == 0 {
+			delete(q.usage, user)
+			continue
+		}
+		u.Bytes = 0
+	}
+}
+
+// countingWriter counts the bytes that are written to a response, and fails the writes after the count
+// returned an error. It supports hijacking, so websocket traffic is counted as well.
+type countingWriter struct {
+	http.ResponseWriter
+	count func(int) error
+	err   error
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if w.err = w.count(n); w.err != nil && err == nil {
+		err = w.err
+	}
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &countingConn{Conn: conn, count: w.count}
+	rw.Writer.Reset(c)
+	return c, rw, nil
+}
+
+// countingConn counts the bytes that are written to a hijacked connection, and closes it when the count
+// returned an error
+type countingConn struct {
+	net.Conn
+	count func(int) error
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if cerr := c.count(n); cerr != nil {
+		c.Conn.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return n, err
+}
+
+// UsageHandler returns an HTTP handler that responds with the usage of all users
+func (q *Quotas) UsageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q.Usage())
+	})
+}
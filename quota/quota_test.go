@@ -0,0 +1,95 @@
+package quota
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDailyBytes(t *testing.T) {
+	t.Parallel()
+
+	q := New(Config{Limits: Limits{DailyBytes: 10}})
+	h := q.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+
+	codes := make([]int, 2)
+	for i := range codes {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		codes[i] = w.Code
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, Usage{Bytes: 10}, q.Usage()["192.0.2.1"])
+}
+
+func TestDailyBytesWhileWriting(t *testing.T) {
+	t.Parallel()
+
+	q := New(Config{Limits: Limits{DailyBytes: 10}})
+	var errs []error
+	h := q.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			_, err := w.Write([]byte("0123"))
+			errs = append(errs, err)
+		}
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Len(t, errs, 5)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	for _, err := range errs[2:] {
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 12, w.Body.Len())
+	assert.Equal(t, Usage{Bytes: 12}, q.Usage()["192.0.2.1"])
+}
+
+func TestDailyBytesHijacked(t *testing.T) {
+	t.Parallel()
+
+	q := New(Config{Limits: Limits{DailyBytes: 10}})
+	s := httptest.NewServer(q.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.Nil(t, err)
+		defer conn.Close()
+		// like a long websocket session, that writes until it fails
+		for i := 0; i < 100; i++ {
+			if _, err := rw.WriteString("0123"); err != nil {
+				return
+			}
+			if err := rw.Flush(); err != nil {
+				return
+			}
+		}
+	})))
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(conn)
+	require.Nil(t, err)
+	assert.Equal(t, "012301230123", string(b))
+}
+
+func TestPastDays(t *testing.T) {
+	t.Parallel()
+
+	q := New(Config{})
+	q.day = "2000-01-01"
+	q.usage["idle"] = &Usage{Bytes: 5}
+	q.usage["running"] = &Usage{Bytes: 5, Concurrent: 1}
+
+	// users of past days are removed, unless they have running requests
+	assert.Equal(t, map[string]Usage{"running": {Concurrent: 1}}, q.Usage())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/Stratoscale/logserver/debug"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/bluele/gcache"
+)
+
+// configReloader reloads the configuration file while the server runs, on SIGHUP or on a request of an admin,
+// and swaps the sources and the parsers of the server. Open websockets are not dropped, their following
+// requests use the new sources and parsers, and requests in flight finish with the previous ones.
+// Other changes of the configuration are applied only after a restart.
+type configReloader struct {
+	fileName string
+	self     *debug.Self
+	// lock guards the current configuration, which the parsers are built from, and the parsers
+	lock  sync.RWMutex
+	cfg   config
+	parse parse.Parse
+	// dir rebuilds the parsers when the files of the parsers directory change, if it is configured
+	dir *parse.Reloader
+	// reloading serializes the reloads
+	reloading sync.Mutex
+	// sources are the current sources, and newSources creates the sources of a configuration. They are not
+	// set in dynamic mode, where only the parsers are reloaded.
+	sources    *source.Registry
+	newSources func(config) (source.Sources, error)
+	// cache is purged on reloads, so trees of the previous sources are not served
+	cache gcache.Cache
+}
+
+// newConfigReloader builds the parsers of the loaded configuration
+func newConfigReloader(fileName string, cfg config, self *debug.Self) (*configReloader, error) {
+	r := &configReloader{fileName: fileName, cfg: cfg, self: self}
+	if cfg.ParsersDir == "" {
+		p, err := cfg.parsers(nil, self)
+		if err != nil {
+			return nil, err
+		}
+		r.parse = p
+		return r, nil
+	}
+	// parsers of the directory are reloaded when its files change
+	dir, err := parse.NewReloader(cfg.ParsersDir, parsersReloadInterval, func(dirParsers []parse.Config) (parse.Parse, error) {
+		return r.config().parsers(dirParsers, r.self)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.dir = dir
+	return r, nil
+}
+
+// Parse returns the current parsers
+func (r *configReloader) Parse() parse.Parse {
+	if r.dir != nil {
+		return r.dir.Parse()
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.parse
+}
+
+func (r *configReloader) config() config {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cfg
+}
+
+// reloadSources makes the reloads replace the sources in the registry with the sources that are created
+// by the given function
+func (r *configReloader) reloadSources(sources *source.Registry, newSources func(config) (source.Sources, error), cache gcache.Cache) {
+	r.sources = sources
+	r.newSources = newSources
+	r.cache = cache
+}
+
+// reload reads the configuration file, and replaces the sources and the parsers. If the configuration
+// is invalid, the current sources and parsers are kept.
+func (r *configReloader) reload() error {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	cfg, err := readConfig(r.fileName)
+	if err != nil {
+		return err
+	}
+	prev := r.config()
+	if cfg.ParsersDir != prev.ParsersDir {
+		log.Warnf("The parsers directory is changed only after a restart, keeping %q", prev.ParsersDir)
+		cfg.ParsersDir = prev.ParsersDir
+	}
+
+	var sources source.Sources
+	if r.sources != nil {
+		sources, err = r.newSources(cfg)
+		if err != nil {
+			return fmt.Errorf("creating sources: %s", err)
+		}
+	}
+
+	r.lock.Lock()
+	r.cfg = cfg
+	r.lock.Unlock()
+	if err := r.rebuildParsers(cfg); err != nil {
+		r.lock.Lock()
+		r.cfg = prev
+		r.lock.Unlock()
+		if sources != nil {
+			sources.CloseSources()
+		}
+		return fmt.Errorf("creating parsers: %s", err)
+	}
+
+	if r.sources != nil {
+		r.sources.Replace(sources)
+	}
+	if r.cache != nil {
+		r.cache.Purge()
+	}
+	log.Infof("Reloaded %s", r.fileName)
+	return nil
+}
+
+func (r *configReloader) rebuildParsers(cfg config) error {
+	if r.dir != nil {
+		return r.dir.Rebuild()
+	}
+	p, err := cfg.parsers(nil, r.self)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.parse = p
+	r.lock.Unlock()
+	return nil
+}
+
+// watchSignals reloads the configuration when the process gets SIGHUP
+func (r *configReloader) watchSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			log.Infof("Got SIGHUP, reloading %s", r.fileName)
+			if err := r.reload(); err != nil {
+				log.WithError(err).Error("Failed reloading the configuration, keeping the current configuration")
+			}
+		}
+	}()
+}
+
+// Handler returns a handler that reloads the configuration on POST requests
+func (r *configReloader) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.reload(); err != nil {
+			log.WithError(err).Error("Failed reloading the configuration, keeping the current configuration")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := map[string]int{"parsers": len(r.Parse())}
+		if r.sources != nil {
+			resp["sources"] = len(r.sources.Sources())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
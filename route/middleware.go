@@ -0,0 +1,262 @@
+package route
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/duration"
+)
+
+// Names of the middlewares in the middleware chain
+const (
+	MiddlewareAuth  = "auth"
+	MiddlewareLog   = "log"
+	MiddlewareGzip  = "gzip"
+	MiddlewareQuota = "quota"
+	MiddlewareCORS  = "cors"
+)
+
+// DefaultMiddlewares is the middleware chain when none is configured
+var DefaultMiddlewares = []string{MiddlewareAuth, MiddlewareQuota}
+
+// Middleware wraps a handler with a cross-cutting behavior
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps a handler with an ordered chain of middlewares, given by their names. The first middleware in the chain
+// is the outermost one, it is the first to handle a request. If no names are given, the default chain is used.
+// If requireAuth is true, the chain must have the auth middleware, since most routes are not authenticated
+// without it.
+func Chain(h http.Handler, names []string, middlewares map[string]Middleware, requireAuth bool) (http.Handler, error) {
+	if names == nil {
+		names = DefaultMiddlewares
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := middlewares[name]; !ok {
+			return nil, fmt.Errorf("unknown middleware: %s", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %s appears more than once", name)
+		}
+		seen[name] = true
+	}
+	if requireAuth && !seen[MiddlewareAuth] {
+		return nil, fmt.Errorf("middlewares must include %s when authentication is configured", MiddlewareAuth)
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		h = middlewares[names[i]](h)
+	}
+	return h, nil
+}
+
+// Log logs every request with its status, size and duration
+func Log(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			start = time.Now()
+			sw    = &statusWriter{ResponseWriter: w}
+		)
+		h.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		log.WithFields(logrus.Fields{
+			"status":   sw.status,
+			"method":   r.Method,
+			"request":  r.RequestURI,
+			"remote":   r.RemoteAddr,
+			"duration": time.Since(start),
+			"size":     sw.size,
+		}).Info("Handled request")
+	})
+}
+
+// Gzip compresses responses of clients that accept gzip encoding. Websocket connections are not compressed.
+func Gzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.Close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// ReadOnly rejects the requests that may change the state of the server, it serves only reads.
+// It wraps the handlers of mutating endpoints in read-only mode.
+func ReadOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+		default:
+			http.Error(w, "server is read-only", http.StatusForbidden)
+		}
+	})
+}
+
+// CORSConfig is the configuration of cross origin requests
+type CORSConfig struct {
+	// AllowedHeaders are the request headers that browsers may send in cross origin requests
+	AllowedHeaders []string `json:"allowed_headers"`
+	// AllowCredentials allows browsers to send credentials, like cookies and basic authentication, in
+	// cross origin requests
+	AllowCredentials bool `json:"allow_credentials"`
+	// MaxAge is the time that browsers may cache the response of a preflight request
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// UnmarshalJSON decodes the CORS configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *CORSConfig) UnmarshalJSON(b []byte) error {
+	type plain CORSConfig
+	return duration.Decode(b, (*plain)(c))
+}
+
+var (
+	defaultCORSHeaders = []string{"Authorization", "Content-Type"}
+	corsMethods        = strings.Join([]string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete,
+	}, ", ")
+)
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c CORSConfig) WithDefaults() CORSConfig {
+	if len(c.AllowedHeaders) == 0 {
+		c.AllowedHeaders = defaultCORSHeaders
+	}
+	return c
+}
+
+// CORS returns a middleware that allows browsers to send requests from the origins that the allowed function
+// accepts. It responds to preflight requests without passing them on, since browsers don't send credentials
+// in them, so it should come before the authentication in the chain.
+func CORS(c CORSConfig, allowed func(*http.Request) bool) Middleware {
+	c = c.WithDefaults()
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if !allowed(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if c.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if c.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", fmt.Sprint(int(c.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack supports websocket connections, their status is recorded as switching protocols
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// gzipWriter compresses a response. The compression starts with the first write, and is skipped if the
+// response is already encoded, or has no content.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	hdr := w.Header()
+	if hdr.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+		hdr.Set("Content-Encoding", "gzip")
+		hdr.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close flushes the compressed data to the response
+func (w *gzipWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
@@ -15,6 +15,17 @@ const (
 	pathStatic   = "/_static"
 	pathWS       = "/_ws"
 	pathDownload = "/_dl"
+	pathBundle   = "/_bundle"
+	pathJobs     = "/_jobs"
+	pathTokens   = "/_tokens"
+	pathUsage    = "/_usage"
+	pathCache    = "/_cache"
+	pathReload   = "/_reload"
+	pathUpload   = "/_upload"
+	pathVersion  = "/_version"
+	pathSnapshot = "/_snapshot"
+	pathGrafana  = "/_grafana"
+	pathSign     = "/_sign"
 )
 
 var (
@@ -30,6 +41,20 @@ type Config struct {
 	// BasePath is to change the base path after the root path.
 	// It is used for dynamic mode where we have different locations for the index page.
 	BasePath string `json:"base_path"`
+	// Middlewares is the ordered chain of middlewares that handle every request, by their names.
+	// By default requests are authenticated and then accounted in the quotas.
+	Middlewares []string `json:"middlewares"`
+	// CORS configures the cors middleware
+	CORS CORSConfig `json:"cors"`
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
+	if c.Middlewares == nil {
+		c.Middlewares = append([]string{}, DefaultMiddlewares...)
+	}
+	c.CORS = c.CORS.WithDefaults()
+	return c
 }
 
 // Static serves static files
@@ -74,6 +99,92 @@ func Download(r *mux.Router, basePath string, h http.Handler) {
 	r.PathPrefix(path + "/").Handler(http.StripPrefix(path, h))
 }
 
+// Bundle mounts the bundle builder handler on the router
+func Bundle(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathBundle)
+	log.Debugf("Adding bundle route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Jobs mounts the job manager handler on the router
+func Jobs(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathJobs)
+	log.Debugf("Adding jobs route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Tokens mounts the API tokens handler on the router
+func Tokens(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathTokens)
+	log.Debugf("Adding tokens route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Sign mounts the URL signing handler on the router
+func Sign(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathSign)
+	log.Debugf("Adding sign route on %s", path)
+	r.Path(path).Handler(h)
+}
+
+// SignablePrefixes are the path prefixes of the URLs that can be signed: downloads and job artifacts
+func SignablePrefixes(rootPath string) []string {
+	prefixes := []string{pathDownload + "/", pathJobs + "/"}
+	if rootPath != "" && rootPath != "/" {
+		prefixes = append(prefixes, filepath.Join(rootPath, pathDownload)+"/", filepath.Join(rootPath, pathJobs)+"/")
+	}
+	return prefixes
+}
+
+// Usage mounts the users usage handler on the router
+func Usage(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathUsage)
+	log.Debugf("Adding usage route on %s", path)
+	r.Path(path).Handler(h)
+}
+
+// Cache mounts the cache stats handler on the router
+func Cache(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathCache)
+	log.Debugf("Adding cache route on %s", path)
+	r.Path(path).Handler(h)
+}
+
+// Reload mounts the configuration reload handler on the router
+func Reload(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathReload)
+	log.Debugf("Adding reload route on %s", path)
+	r.Path(path).Handler(h)
+}
+
+// Upload mounts the file uploads handler on the router
+func Upload(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathUpload)
+	log.Debugf("Adding upload route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Snapshot mounts the snapshots handler on the router
+func Snapshot(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathSnapshot)
+	log.Debugf("Adding snapshot route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Grafana mounts the Grafana datasource handler on the router
+func Grafana(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathGrafana)
+	log.Debugf("Adding grafana route on %s", path)
+	r.PathPrefix(path).Handler(http.StripPrefix(path, h))
+}
+
+// Version mounts the build information handler on the router
+func Version(r *mux.Router, basePath string, h http.Handler) {
+	path := filepath.Join(basePath, pathVersion)
+	log.Debugf("Adding version route on %s", path)
+	r.Path(path).Handler(h)
+}
+
 // Redirect mounts a redirect handler for a proxy on the router
 func Redirect(r *mux.Router, c Config) {
 	if c.RootPath == "" {
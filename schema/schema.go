@@ -0,0 +1,120 @@
+// Package schema generates a JSON Schema of a configuration struct from its json tags
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema document
+type Schema map[string]interface{}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	timeType        = reflect.TypeOf(time.Time{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Generate returns the JSON Schema of a value, according to the way it is decoded by the json package.
+// Structs that contain themselves, like nested parsers, refer to their schema with a "$ref" JSON pointer.
+func Generate(v interface{}, title string) Schema {
+	s := generate(reflect.TypeOf(v), "#", make(map[reflect.Type]string))
+	s["$schema"] = draft
+	s["title"] = title
+	return s
+}
+
+// generate returns the schema of a type at a JSON pointer in the document. The structs that are being
+// generated are kept with their pointers, so a struct inside itself refers to them.
+func generate(t reflect.Type, pointer string, structs map[reflect.Type]string) Schema {
+	switch {
+	case t == durationType:
+		return Schema{"type": "integer", "description": "Duration in nanoseconds"}
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return Schema{}
+	case t.Kind() != reflect.Struct && (reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textType)):
+		// types with custom decoding are encoded as strings in the configuration, like roles
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return generate(t.Elem(), pointer, structs)
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": generate(t.Elem(), pointer+"/items", structs)}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": generate(t.Elem(), pointer+"/additionalProperties", structs)}
+	case reflect.Struct:
+		if ref, ok := structs[t]; ok {
+			return Schema{"$ref": ref}
+		}
+		structs[t] = pointer
+		defer delete(structs, t)
+		props := Schema{}
+		// structs with custom decoding decode objects, where durations can also be strings
+		addFields(t, pointer+"/properties/", props, structs, reflect.PtrTo(t).Implements(unmarshalerType))
+		return Schema{"type": "object", "properties": props, "additionalProperties": false}
+	}
+	// functions, channels and interfaces can't be configured
+	return Schema{}
+}
+
+// addFields adds the properties of the fields of a struct, fields of embedded structs are added
+// to the properties of the struct, as the json package decodes them. The pointer is the JSON pointer prefix
+// of the properties. If durationStrings is set, durations can be given as strings, like "2s".
+func addFields(t reflect.Type, pointer string, props Schema, structs map[reflect.Type]string, durationStrings bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(ft, pointer, props, structs, durationStrings)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if durationStrings && f.Type == durationType {
+			props[name] = Schema{"type": []string{"integer", "string"}, "description": "Duration in nanoseconds, or a string like \"2s\""}
+			continue
+		}
+		if s := generate(f.Type, pointer+escapePointer(name), structs); len(s) > 0 || f.Type == rawMessageType {
+			props[name] = s
+		}
+	}
+}
+
+// escapePointer escapes a key in a JSON pointer
+func escapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type role int
+
+func (r *role) UnmarshalJSON([]byte) error { return nil }
+
+type limits struct {
+	MaxFiles int `json:"max_files"`
+}
+
+type config struct {
+	Name    string            `json:"name"`
+	Timeout time.Duration     `json:"timeout"`
+	Tags    []string          `json:"tags"`
+	Headers map[string]string `json:"headers"`
+	Role    role              `json:"role"`
+	Ratio   *float64          `json:"ratio"`
+	limits
+	Check  func() bool `json:"-"`
+	hidden string
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(Generate(config{}, "test"))
+	require.Nil(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "test",
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string"},
+			"timeout": {"type": "integer", "description": "Duration in nanoseconds"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"headers": {"type": "object", "additionalProperties": {"type": "string"}},
+			"role": {"type": "string"},
+			"ratio": {"type": "number"},
+			"max_files": {"type": "integer"}
+		}
+	}`, string(b))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	var doc interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{
+		"name": 1,
+		"timeout": 1.5,
+		"tags": ["a", 2],
+		"headers": {"x": "y", "z": false},
+		"ratio": null,
+		"max_files": 10,
+		"max_file": 10
+	}`), &doc))
+	assert.Equal(t, []Error{
+		{Path: "headers.z", Message: "expected a string, got a boolean"},
+		{Path: "max_file", Message: "unknown key"},
+		{Path: "name", Message: "expected a string, got an integer"},
+		{Path: "tags[1]", Message: "expected a string, got an integer"},
+		{Path: "timeout", Message: "expected an integer, got a number"},
+	}, Validate(Generate(config{}, "test"), doc))
+
+	require.Nil(t, json.Unmarshal([]byte(`{"name": "n", "tags": [], "role": "admin"}`), &doc))
+	assert.Empty(t, Validate(Generate(config{}, "test"), doc))
+}
+
+type node struct {
+	Name     string `json:"name"`
+	Children []node `json:"children"`
+}
+
+func TestRecursive(t *testing.T) {
+	t.Parallel()
+
+	s := Generate(node{}, "test")
+	b, err := json.Marshal(s)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "test",
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"children": {"type": "array", "items": {"$ref": "#"}}
+		},
+		"additionalProperties": false
+	}`, string(b))
+
+	var doc interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{"children": [{"name": "a", "children": [{"name": 1}]}]}`), &doc))
+	assert.Equal(t, []Error{{Path: "children[0].children[0].name", Message: "expected a string, got an integer"}}, Validate(s, doc))
+}
+
+type timeouts struct {
+	Timeout time.Duration `json:"timeout"`
+}
+
+func (t *timeouts) UnmarshalJSON([]byte) error { return nil }
+
+func TestDurationStrings(t *testing.T) {
+	t.Parallel()
+
+	s := Generate(struct {
+		Timeouts timeouts      `json:"timeouts"`
+		Delay    time.Duration `json:"delay"`
+	}{}, "test")
+	var doc interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{"timeouts": {"timeout": "2s"}, "delay": "2s"}`), &doc))
+	assert.Equal(t, []Error{{Path: "delay", Message: "expected an integer, got a string"}}, Validate(s, doc))
+	require.Nil(t, json.Unmarshal([]byte(`{"timeouts": {"timeout": true}}`), &doc))
+	assert.Equal(t, []Error{{Path: "timeouts.timeout", Message: "expected one of integer, string, got a boolean"}}, Validate(s, doc))
+}
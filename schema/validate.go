@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Error is a value of a document that does not match its schema, at a JSON path like sources[1].url
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks a document, as decoded by the json package into an interface{}, against a schema that was
+// generated by Generate. It returns the errors ordered by their paths, keys that the schema does not have
+// are reported as unknown keys. Null values are valid, since the json package decodes them as zero values.
+func Validate(s Schema, doc interface{}) []Error {
+	var errs []Error
+	v := validator{root: s}
+	v.validate(s, doc, "", &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+// validator validates values against the schemas of a document, it resolves references to schemas
+// in the document
+type validator struct {
+	root Schema
+}
+
+func (vr validator) validate(s Schema, v interface{}, path string, errs *[]Error) {
+	if v == nil {
+		return
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		s = vr.resolve(ref)
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	// a value of a schema with multiple types should match one of them
+	if types, ok := s["type"].([]string); ok {
+		for _, typ := range types {
+			var typeErrs []Error
+			vr.validate(Schema{"type": typ}, v, path, &typeErrs)
+			if len(typeErrs) == 0 {
+				return
+			}
+		}
+		fail("expected one of %s, got %s", strings.Join(types, ", "), kind(v))
+		return
+	}
+	switch s["type"] {
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("expected a boolean, got %s", kind(v))
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			fail("expected an integer, got %s", kind(v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			fail("expected a number, got %s", kind(v))
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			fail("expected a string, got %s", kind(v))
+		}
+	case "array":
+		l, ok := v.([]interface{})
+		if !ok {
+			fail("expected a list, got %s", kind(v))
+			return
+		}
+		items, _ := s["items"].(Schema)
+		for i, item := range l {
+			vr.validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			fail("expected a dict, got %s", kind(v))
+			return
+		}
+		props, _ := s["properties"].(Schema)
+		for key, value := range m {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			if prop, ok := props[key].(Schema); ok {
+				vr.validate(prop, value, keyPath, errs)
+				continue
+			}
+			switch additional := s["additionalProperties"].(type) {
+			case Schema:
+				vr.validate(additional, value, keyPath, errs)
+			case bool:
+				if !additional {
+					*errs = append(*errs, Error{Path: keyPath, Message: "unknown key"})
+				}
+			}
+		}
+	}
+}
+
+// resolve returns the schema that a JSON pointer in the document refers to, or an empty schema, which accepts
+// any value, if the pointer is invalid
+func (vr validator) resolve(ref string) Schema {
+	s := vr.root
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		key = strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+		next, ok := s[key].(Schema)
+		if !ok {
+			return Schema{}
+		}
+		s = next
+	}
+	return s
+}
+
+// kind returns the name of the json type of a decoded value
+func kind(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "a boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "an integer"
+		}
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a dict"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,170 @@
+package sdk
+
+// runtime is the client of the websocket protocol, it is appended to the generated types
+const runtime = `
+// The client of the websocket protocol.
+
+// RequestInit is a request, where only the action is required
+export type RequestInit = Partial<Request> & { meta: Partial<Meta> & { action: string } };
+
+export interface ClientOptions {
+  // reconnectDelay is the delay before the first reconnection attempt, in milliseconds, 1000 by default.
+  // The delay is doubled on every failed attempt, up to maxReconnectDelay.
+  reconnectDelay?: number;
+  // maxReconnectDelay is the maximal delay between reconnection attempts, in milliseconds, 30000 by default
+  maxReconnectDelay?: number;
+  // WebSocket is the websocket implementation, the global one by default
+  WebSocket?: typeof WebSocket;
+}
+
+// CancelledError rejects requests that were cancelled, or replaced by another request
+export class CancelledError extends Error {
+  constructor(message = "request was cancelled") {
+    super(message);
+    this.name = "CancelledError";
+  }
+}
+
+interface Pending {
+  id: number;
+  onResponse: (resp: Response) => void;
+  resolve: () => void;
+  reject: (err: Error) => void;
+}
+
+interface Subscription {
+  events: string[];
+  onEvent: (resp: Response) => void;
+}
+
+// LogserverClient sends requests on a websocket, and reconnects when the connection is lost.
+// The server serves a single request at a time on a connection, so a new request cancels the running one.
+// Event subscriptions are kept across requests, and are renewed when the client reconnects.
+export class LogserverClient {
+  private ws: WebSocket | null = null;
+  private nextId = 1;
+  private pending: Pending | null = null;
+  private subscription: Subscription | null = null;
+  private queue: string[] = [];
+  private closed = false;
+  private delay: number;
+  private readonly options: Required<ClientOptions>;
+
+  constructor(private readonly url: string, options: ClientOptions = {}) {
+    this.options = {
+      reconnectDelay: options.reconnectDelay || 1000,
+      maxReconnectDelay: options.maxReconnectDelay || 30000,
+      WebSocket: options.WebSocket || WebSocket,
+    };
+    this.delay = this.options.reconnectDelay;
+    this.connect();
+  }
+
+  // request sends a request, and calls onResponse with each of its responses. The returned promise is resolved
+  // when the request finished, and rejected if it failed, was cancelled, or the connection was lost.
+  request(req: RequestInit, onResponse: (resp: Response) => void = () => undefined): Promise<void> {
+    this.cancelPending(new CancelledError("request was replaced by another request"));
+    const id = this.nextId++;
+    const message = { ...req, meta: { ...req.meta, id } };
+    return new Promise<void>((resolve, reject) => {
+      this.pending = { id, onResponse, resolve, reject };
+      this.send(message);
+    });
+  }
+
+  // cancel cancels the running request
+  cancel(): void {
+    if (this.cancelPending(new CancelledError())) {
+      this.send({ meta: { id: this.nextId++, action: "cancel" } });
+    }
+  }
+
+  // subscribe subscribes to server events with the given type globs, it replaces the previous subscription
+  subscribe(events: string[], onEvent: (resp: Response) => void): void {
+    this.subscription = { events, onEvent };
+    this.send({ meta: { id: this.nextId++, action: "subscribe-events" }, events });
+  }
+
+  // unsubscribe stops the subscription to server events
+  unsubscribe(): void {
+    this.subscription = null;
+    this.send({ meta: { id: this.nextId++, action: "unsubscribe-events" } });
+  }
+
+  // close closes the connection, and rejects the running request
+  close(): void {
+    this.closed = true;
+    this.cancelPending(new CancelledError("client was closed"));
+    if (this.ws) {
+      this.ws.close();
+    }
+  }
+
+  private connect(): void {
+    const ws = new this.options.WebSocket(this.url);
+    this.ws = ws;
+    ws.onopen = () => {
+      this.delay = this.options.reconnectDelay;
+      if (this.subscription) {
+        const { events } = this.subscription;
+        ws.send(JSON.stringify({ meta: { id: this.nextId++, action: "subscribe-events" }, events }));
+      }
+      this.queue.splice(0).forEach(message => ws.send(message));
+    };
+    ws.onmessage = (e: MessageEvent) => this.receive(JSON.parse(e.data) as Response);
+    ws.onclose = () => {
+      this.ws = null;
+      this.cancelPending(new Error("connection was lost"));
+      if (!this.closed) {
+        setTimeout(() => this.connect(), this.delay);
+        this.delay = Math.min(this.delay * 2, this.options.maxReconnectDelay);
+      }
+    };
+  }
+
+  private send(message: object): void {
+    const data = JSON.stringify(message);
+    if (this.ws && this.ws.readyState === this.options.WebSocket.OPEN) {
+      this.ws.send(data);
+    } else {
+      this.queue.push(data);
+    }
+  }
+
+  private receive(resp: Response): void {
+    if (resp.meta.action === "subscribe-events") {
+      if (this.subscription && !resp.finished) {
+        this.subscription.onEvent(resp);
+      }
+      return;
+    }
+    const pending = this.pending;
+    if (!pending || resp.meta.id !== pending.id) {
+      // responses of cancelled requests are ignored
+      return;
+    }
+    if (resp.finished) {
+      this.pending = null;
+      pending.resolve();
+      return;
+    }
+    if (resp.error) {
+      this.pending = null;
+      pending.reject(new Error(resp.error));
+      return;
+    }
+    pending.onResponse(resp);
+  }
+
+  private cancelPending(err: Error): boolean {
+    const pending = this.pending;
+    if (!pending) {
+      return false;
+    }
+    this.pending = null;
+    this.queue = this.queue.filter(message => JSON.parse(message).meta.id !== pending.id);
+    pending.reject(err);
+    return true;
+  }
+}
+`
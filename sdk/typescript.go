@@ -0,0 +1,191 @@
+// Package sdk generates a TypeScript client of the websocket protocol from the Go types of its messages,
+// so the protocol definitions of the frontend and the backend don't drift
+package sdk
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType   = reflect.TypeOf(time.Duration(0))
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType       = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	// identifier matches the field names that don't need quoting
+	identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+// TypeScript returns a TypeScript module with the types of the given values, the types that they refer to,
+// and a client of the websocket protocol
+func TypeScript(values ...interface{}) string {
+	g := &generator{names: make(map[reflect.Type]string), decls: make(map[string]string)}
+	for _, v := range values {
+		g.typeOf(reflect.TypeOf(v))
+	}
+	names := make([]string, 0, len(g.decls))
+	for name := range g.decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(header)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(g.decls[name])
+	}
+	b.WriteString(runtime)
+	return b.String()
+}
+
+const header = `// Code generated by "logserver client-sdk". DO NOT EDIT.
+
+// Types of the websocket protocol, generated from the Go types of the server.
+// Durations are in nanoseconds, and times are RFC3339 strings.
+`
+
+// generator collects the declarations of named types
+type generator struct {
+	// names are the TypeScript names of the declared types
+	names map[reflect.Type]string
+	// decls are the declarations by their names
+	decls map[string]string
+}
+
+// typeOf returns the TypeScript type of a Go type, according to the way it is encoded by the json package
+func (g *generator) typeOf(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return g.typeOf(t.Elem())
+	}
+	switch {
+	case t == durationType:
+		return "number"
+	case t == timeType:
+		return "string"
+	case t == rawMessageType:
+		return "unknown"
+	case t.Implements(marshalerType), reflect.PtrTo(t).Implements(marshalerType):
+		return "unknown"
+	case t.Implements(textType), reflect.PtrTo(t).Implements(textType):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		if t.Name() != "string" && t.PkgPath() != "" {
+			return g.declare(t, func() string { return "string" })
+		}
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices are encoded as base64 strings
+			return "string"
+		}
+		if t.Name() != "" {
+			return g.declare(t, func() string { return g.typeOf(t.Elem()) + "[]" })
+		}
+		return g.typeOf(t.Elem()) + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeOf(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, "")
+		}
+		return g.declare(t, nil)
+	}
+	// functions, channels and interfaces have no fixed encoding
+	return "unknown"
+}
+
+// declare declares a named type, and returns its name. Types with the same name in different packages are
+// prefixed by their package names. Structs are declared as interfaces, and other types as aliases.
+func (g *generator) declare(t reflect.Type, alias func() string) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.decls[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.names[t] = name
+	// the name is reserved before the fields are generated, for recursive types
+	g.decls[name] = ""
+	if alias != nil {
+		g.decls[name] = fmt.Sprintf("export type %s = %s;\n", name, alias())
+	} else {
+		g.decls[name] = fmt.Sprintf("export interface %s %s\n", name, g.object(t, ""))
+	}
+	return name
+}
+
+// object returns the TypeScript object type of a struct
+func (g *generator) object(t reflect.Type, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	g.fields(&b, t, indent+"  ")
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// fields writes the fields of a struct, fields of embedded structs are written as fields of the struct,
+// as the json package encodes them
+func (g *generator) fields(b *strings.Builder, t reflect.Type, indent string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(b, ft, indent)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		optional := f.Type.Kind() == reflect.Ptr
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				optional = true
+			}
+		}
+		typ := g.typeOf(f.Type)
+		if f.Type.Kind() == reflect.Ptr {
+			typ += " | null"
+		}
+		if !identifier.MatchString(name) {
+			name = strconv.Quote(name)
+		}
+		if optional {
+			name += "?"
+		}
+		fmt.Fprintf(b, "%s%s: %s;\n", indent, name, typ)
+	}
+}
@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type path []string
+
+type inner struct {
+	Size int64 `json:"size"`
+}
+
+type message struct {
+	inner
+	Name       string            `json:"name"`
+	Path       path              `json:"path"`
+	Time       *time.Time        `json:"time,omitempty"`
+	Created    time.Time         `json:"created"`
+	Timeout    time.Duration     `json:"timeout"`
+	Data       json.RawMessage   `json:"data"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Bytes      []byte            `json:"bytes"`
+	Children   []*message        `json:"children"`
+	Skipped    string            `json:"-"`
+	Dashed     bool              `json:"is-dashed"`
+	unexported int
+}
+
+func TestTypeScript(t *testing.T) {
+	t.Parallel()
+
+	got := TypeScript(message{})
+	assert.True(t, strings.HasPrefix(got, header))
+	assert.Contains(t, got, `export type path = string[];`)
+	assert.Contains(t, got, `export interface message {
+  size: number;
+  name: string;
+  path: path;
+  time?: string | null;
+  created: string;
+  timeout: number;
+  data: unknown;
+  fields?: Record<string, string>;
+  bytes: string;
+  children: message[];
+  "is-dashed": boolean;
+}`)
+	assert.NotContains(t, got, "Skipped")
+	assert.NotContains(t, got, "unexported")
+	assert.NotContains(t, got, "interface inner")
+}
@@ -0,0 +1,302 @@
+// Package snapshot keeps frozen result sets, like the lines of a search, that can be shared
+// with people who can't access the sources
+package snapshot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/duration"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/store"
+)
+
+var log = logrus.WithField("pkg", "snapshot")
+
+const (
+	// bucket is the store bucket of the snapshots
+	bucket               = "snapshots"
+	defaultExpiration    = 7 * 24 * time.Hour
+	defaultMaxExpiration = 30 * 24 * time.Hour
+	defaultMaxLines      = 10000
+	// maxBodySize bounds the size of a snapshot creation request
+	maxBodySize = 64 * 1024 * 1024
+)
+
+// Config is the snapshots configuration
+type Config struct {
+	// Expiration is the default time that a snapshot is kept after it was created
+	Expiration time.Duration `json:"expiration"`
+	// MaxExpiration is the maximal expiration that can be requested for a snapshot, 30 days by default
+	MaxExpiration time.Duration `json:"max_expiration"`
+	// MaxLines is the maximal number of lines in a snapshot
+	MaxLines int `json:"max_lines"`
+}
+
+// UnmarshalJSON decodes the snapshots configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+// Snapshot is a frozen result set
+type Snapshot struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Creator string `json:"creator,omitempty"`
+	// Request is the websocket request that produced the lines, it is kept for reference
+	Request json.RawMessage `json:"request,omitempty"`
+	Lines   []parse.Log     `json:"lines"`
+	Created time.Time       `json:"created"`
+	Expires time.Time       `json:"expires"`
+}
+
+// Summary is a snapshot without its lines
+type Summary struct {
+	// ID is the credential of the public page of the snapshot, it is empty in search results of users
+	// that may not share the snapshot
+	ID      string    `json:"id,omitempty"`
+	Title   string    `json:"title"`
+	Creator string    `json:"creator,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// createRequest is the body of a snapshot creation request
+type createRequest struct {
+	Title      string          `json:"title"`
+	Request    json.RawMessage `json:"request"`
+	Lines      []parse.Log     `json:"lines"`
+	Expiration time.Duration   `json:"expiration"`
+}
+
+// Snapshots stores snapshots
+type Snapshots struct {
+	Config
+	store store.Store
+}
+
+// WithDefaults returns the configuration with defaults for unset values
+func (c Config) WithDefaults() Config {
+	if c.Expiration == 0 {
+		c.Expiration = defaultExpiration
+	}
+	if c.MaxExpiration == 0 {
+		c.MaxExpiration = defaultMaxExpiration
+	}
+	if c.MaxLines == 0 {
+		c.MaxLines = defaultMaxLines
+	}
+	return c
+}
+
+// New returns a snapshots store, snapshots are persisted in the given store
+func New(c Config, s store.Store) *Snapshots {
+	c = c.WithDefaults()
+	sn := &Snapshots{Config: c, store: s}
+	go sn.expire()
+	return sn
+}
+
+// Handler returns an HTTP handler for snapshots:
+//
+//	POST   /                    create a snapshot: {"title": "...", "request": {...}, "lines": [...], "expiration": <nanoseconds>}
+//	GET    /<id>                view a snapshot as an HTML page
+//	GET    /<id>?format=json    get a snapshot as json
+//	DELETE /<id>                remove a snapshot
+//
+// The creation response holds the snapshot ID and its URL. Anyone with the URL can view the
+// snapshot, so viewing should not require authentication.
+func (sn *Snapshots) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(r.URL.Path, "/")
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			sn.create(w, r)
+
+		case (r.Method == http.MethodGet || r.Method == http.MethodHead) && id != "":
+			s, err := sn.get(id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			if r.URL.Query().Get("format") == "json" {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(s)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := page.Execute(w, s); err != nil {
+				log.WithError(err).Errorf("Failed rendering snapshot %s", id)
+			}
+
+		case r.Method == http.MethodDelete && id != "":
+			if _, err := sn.get(id); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			if err := sn.store.Delete(bucket, id); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (sn *Snapshots) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("bad snapshot: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Lines) > sn.MaxLines {
+		http.Error(w, fmt.Sprintf("snapshot has %d lines, more than %d", len(req.Lines), sn.MaxLines), http.StatusBadRequest)
+		return
+	}
+	if req.Expiration <= 0 {
+		req.Expiration = sn.Expiration
+	}
+	if req.Expiration > sn.MaxExpiration {
+		req.Expiration = sn.MaxExpiration
+	}
+	now := time.Now()
+	s := Snapshot{
+		ID:      newID(),
+		Title:   req.Title,
+		Request: req.Request,
+		Lines:   req.Lines,
+		Created: now,
+		Expires: now.Add(req.Expiration),
+	}
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		s.Creator = u.Name
+	}
+	if err := sn.store.Put(bucket, s.ID, s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Created snapshot %s with %d lines by %q", s.ID, len(s.Lines), s.Creator)
+
+	// the request URI is not changed by the routing, so it holds the path that the client used
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		ID      string    `json:"id"`
+		URL     string    `json:"url"`
+		Expires time.Time `json:"expires"`
+	}{ID: s.ID, URL: path.Join(strings.SplitN(r.RequestURI, "?", 2)[0], s.ID), Expires: s.Expires})
+}
+
+// get returns a snapshot that did not expire
+func (sn *Snapshots) get(id string) (*Snapshot, error) {
+	var s Snapshot
+	if err := sn.store.Get(bucket, id, &s); err != nil {
+		return nil, err
+	}
+	if time.Now().After(s.Expires) {
+		return nil, store.ErrNotFound
+	}
+	return &s, nil
+}
+
+// Search returns up to max summaries of the snapshots that did not expire and whose title matches,
+// the newest first. The IDs are returned only for snapshots that the user of the context created, or to
+// admins, since an ID gives access to the snapshot lines without authentication.
+func (sn *Snapshots) Search(ctx context.Context, match func(title string) bool, max int) ([]Summary, error) {
+	values, err := sn.store.List(bucket)
+	if err != nil {
+		return nil, err
+	}
+	var found []Summary
+	for id, value := range values {
+		// the lines are not decoded, the summary fields are enough for matching
+		var s Summary
+		if err := json.Unmarshal(value, &s); err != nil {
+			log.WithError(err).Warnf("Bad snapshot %s", id)
+			continue
+		}
+		if time.Now().After(s.Expires) || !match(s.Title) {
+			continue
+		}
+		if !owned(ctx, s.Creator) {
+			s.ID = ""
+		}
+		found = append(found, s)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Created.After(found[j].Created) })
+	if max > 0 && len(found) > max {
+		found = found[:max]
+	}
+	return found, nil
+}
+
+// owned returns true if the user of the context may share a snapshot of a creator. Without authentication
+// every user may.
+func owned(ctx context.Context, creator string) bool {
+	u, ok := auth.UserFromContext(ctx)
+	return !ok || u.Name == creator || u.Role >= auth.RoleAdmin
+}
+
+// expire removes expired snapshots from the store
+func (sn *Snapshots) expire() {
+	for range time.Tick(time.Hour) {
+		values, err := sn.store.List(bucket)
+		if err != nil {
+			log.WithError(err).Error("Failed listing snapshots")
+			continue
+		}
+		for id, value := range values {
+			var s Snapshot
+			if err := json.Unmarshal(value, &s); err != nil || time.Now().After(s.Expires) {
+				if err := sn.store.Delete(bucket, id); err != nil {
+					log.WithError(err).Errorf("Failed removing snapshot %s", id)
+				}
+			}
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var page = template.Must(template.New("snapshot").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}Snapshot {{.ID}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; font-family: monospace; font-size: 12px; }
+td, th { padding: 2px 8px; text-align: left; vertical-align: top; border-bottom: 1px solid #eee; }
+td.msg { white-space: pre-wrap; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h2>{{if .Title}}{{.Title}}{{else}}Snapshot {{.ID}}{{end}}</h2>
+<p class="meta">{{len .Lines}} lines, created {{.Created.Format "2006-01-02 15:04:05 MST"}}{{if .Creator}} by {{.Creator}}{{end}}, expires {{.Expires.Format "2006-01-02 15:04:05 MST"}}</p>
+<table>
+<tr><th>Time</th><th>Level</th><th>Source</th><th>File</th><th>Line</th><th>Message</th></tr>
+{{range .Lines}}<tr><td>{{if .Time}}{{.Time.Format "2006-01-02 15:04:05.000"}}{{end}}</td><td>{{.Level}}</td><td>{{.FS}}</td><td>{{.FileName}}</td><td>{{.Line}}</td><td class="msg">{{.Msg}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
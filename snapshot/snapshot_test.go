@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stratoscale/logserver/auth"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	t.Parallel()
+
+	sn := New(Config{MaxLines: 2}, store.NewMemory())
+	s := httptest.NewServer(http.StripPrefix("/_snapshot", sn.Handler()))
+	defer s.Close()
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(s.URL+"/_snapshot", "application/json", bytes.NewBufferString(body))
+		require.Nil(t, err)
+		return resp
+	}
+
+	// too many lines
+	resp := post(`{"lines": [{"msg": "a"}, {"msg": "b"}, {"msg": "c"}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"title": "disk <failure>", "lines": [{"msg": "disk failed", "level": "ERROR", "fs": "node1"}]}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created struct {
+		ID      string    `json:"id"`
+		URL     string    `json:"url"`
+		Expires time.Time `json:"expires"`
+	}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Equal(t, "/_snapshot/"+created.ID, created.URL)
+	assert.True(t, created.Expires.After(time.Now().Add(6*24*time.Hour)))
+
+	// view as json
+	resp, err := http.Get(s.URL + created.URL + "?format=json")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got Snapshot
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, "disk <failure>", got.Title)
+	assert.Equal(t, []parse.Log{{Msg: "disk failed", Level: "ERROR", FS: "node1"}}, got.Lines)
+
+	// view as html, the content is escaped
+	resp, err = http.Get(s.URL + created.URL)
+	require.Nil(t, err)
+	page, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.Contains(t, string(page), "disk &lt;failure&gt;")
+	assert.Contains(t, string(page), "disk failed")
+
+	// delete
+	req, err := http.NewRequest(http.MethodDelete, s.URL+created.URL, nil)
+	require.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, err = http.Get(s.URL + created.URL)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	st := store.NewMemory()
+	sn := New(Config{}, st)
+	now := time.Now()
+	for _, s := range []Snapshot{
+		{ID: "1", Title: "disk failure on node1", Creator: "alice", Created: now.Add(-2 * time.Hour), Expires: now.Add(time.Hour)},
+		{ID: "2", Title: "disk failure on node2", Created: now.Add(-time.Hour), Expires: now.Add(time.Hour)},
+		{ID: "3", Title: "disk failure, expired", Created: now.Add(-3 * time.Hour), Expires: now.Add(-time.Hour)},
+		{ID: "4", Title: "network outage", Created: now, Expires: now.Add(time.Hour)},
+	} {
+		require.Nil(t, st.Put(bucket, s.ID, s))
+	}
+
+	match := func(title string) bool { return strings.Contains(title, "disk") }
+	found, err := sn.Search(context.Background(), match, 0)
+	require.Nil(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "2", found[0].ID)
+	assert.Equal(t, "1", found[1].ID)
+
+	// authenticated users get the IDs only of the snapshots that they created, admins get all of them
+	ids := func(u auth.User) []string {
+		found, err := sn.Search(auth.WithUser(context.Background(), u), match, 0)
+		require.Nil(t, err)
+		var ids []string
+		for _, s := range found {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"", "1"}, ids(auth.User{Name: "alice"}))
+	assert.Equal(t, []string{"", ""}, ids(auth.User{Name: "bob", Role: auth.RoleDownloader}))
+	assert.Equal(t, []string{"2", "1"}, ids(auth.User{Name: "bob", Role: auth.RoleAdmin}))
+
+	found, err = sn.Search(context.Background(), match, 1)
+	require.Nil(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "disk failure on node2", found[0].Title)
+}
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"expiration": "24h", "max_expiration": 3600000000000}`), &c))
+	assert.Equal(t, 24*time.Hour, c.Expiration)
+	assert.Equal(t, time.Hour, c.MaxExpiration)
+}
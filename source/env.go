@@ -0,0 +1,40 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// envVar matches a ${VAR} placeholder of an environment variable
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the ${VAR} placeholders in a string with the values of the environment variables.
+// Other dollar signs, which are common in passwords, are left as is. It fails if a variable is not set.
+func ExpandEnv(s string) (string, error) {
+	var err error
+	expanded := envVar.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := envVar.FindStringSubmatch(placeholder)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// ExpandEnv expands the environment variables in the URL, which may hold the credentials of the source,
+// and in the jump hosts of the source
+func (c *Config) ExpandEnv() error {
+	var err error
+	if c.URL, err = ExpandEnv(c.URL); err != nil {
+		return fmt.Errorf("source %s url: %s", c.Name, err)
+	}
+	for i := range c.ProxyJump {
+		if c.ProxyJump[i], err = ExpandEnv(c.ProxyJump[i]); err != nil {
+			return fmt.Errorf("source %s proxy jump: %s", c.Name, err)
+		}
+	}
+	return nil
+}
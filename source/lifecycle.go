@@ -0,0 +1,156 @@
+package source
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CloseError has the errors of the sources that failed to close, by their names
+type CloseError map[string]error
+
+func (e CloseError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, e[name]))
+	}
+	return "closing sources: " + strings.Join(msgs, ", ")
+}
+
+// CloseSources closes the sources in the reverse order of their creation. All the sources are closed, and
+// the errors of the sources that failed to close are returned in a CloseError.
+func (s Sources) CloseSources() error {
+	errs := make(CloseError)
+	for i := len(s) - 1; i >= 0; i-- {
+		if err := s[i].FS.Close(); err != nil {
+			log.WithError(err).Errorf("Failed closing source %s", s[i].Name)
+			errs[s[i].Name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Provider provides the sources for a request, which must be released when the request is done
+type Provider interface {
+	Acquire() (Sources, func())
+}
+
+// Acquire returns the sources themselves, sources that are never replaced don't need to be released
+func (s Sources) Acquire() (Sources, func()) {
+	return s, func() {}
+}
+
+// Registry holds the current sources of the server, which can be replaced while it runs. Requests acquire
+// the current sources, and release them when they finish. Replaced sources are closed after the last request
+// that acquired them released them, so they are not closed under requests that are in flight.
+type Registry struct {
+	lock    sync.Mutex
+	current *generation
+	// closed is set when the registry was closed, no sources are acquired after it
+	closed bool
+}
+
+// generation is a set of sources that were current together, with the count of the requests that use them
+type generation struct {
+	sources Sources
+	refs    int
+	retired bool
+	// done is closed when the sources of a retired generation were closed, with their error
+	done chan struct{}
+	err  error
+}
+
+// NewRegistry returns a registry of the given current sources
+func NewRegistry(s Sources) *Registry {
+	return &Registry{current: newGeneration(s)}
+}
+
+func newGeneration(s Sources) *generation {
+	return &generation{sources: s, done: make(chan struct{})}
+}
+
+// Acquire returns the current sources, and a function that releases them, which must be called when
+// they are not used anymore. After the registry was closed, it returns no sources.
+func (r *Registry) Acquire() (Sources, func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, func() {}
+	}
+	g := r.current
+	g.refs++
+	var once sync.Once
+	return g.sources, func() { once.Do(func() { r.release(g) }) }
+}
+
+// Sources returns the current sources, without acquiring them. It is useful for listing the sources, but
+// their filesystems should only be used by acquiring them.
+func (r *Registry) Sources() Sources {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.current.sources
+}
+
+// Replace replaces the current sources. The replaced sources are closed in the background after they are
+// released, and their close errors are logged.
+func (r *Registry) Replace(s Sources) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		// the sources were replaced after the registry was closed, so they are not used
+		go s.CloseSources()
+		return
+	}
+	r.retire(r.current)
+	r.current = newGeneration(s)
+}
+
+// Close closes the current sources after they are released, and returns the errors of the sources that
+// failed to close
+func (r *Registry) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	g := r.current
+	r.retire(g)
+	r.lock.Unlock()
+	<-g.done
+	return g.err
+}
+
+// retire marks a generation as replaced, and closes it if it is not used. It is called with the lock held.
+func (r *Registry) retire(g *generation) {
+	g.retired = true
+	if g.refs == 0 {
+		go g.close()
+	}
+}
+
+func (r *Registry) release(g *generation) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	g.refs--
+	if g.refs == 0 && g.retired {
+		go g.close()
+	}
+}
+
+func (g *generation) close() {
+	defer close(g.done)
+	g.err = g.sources.CloseSources()
+}
@@ -0,0 +1,97 @@
+package source
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closeRecorder records the order in which filesystems are closed
+type closeRecorder struct {
+	lock   sync.Mutex
+	closed []string
+}
+
+type recordedFS struct {
+	*filesystem.Memory
+	name string
+	err  error
+	rec  *closeRecorder
+}
+
+func (fs *recordedFS) Close() error {
+	fs.rec.lock.Lock()
+	defer fs.rec.lock.Unlock()
+	fs.rec.closed = append(fs.rec.closed, fs.name)
+	return fs.err
+}
+
+func (r *closeRecorder) source(name string, err error) Source {
+	return Source{Name: name, FS: &recordedFS{Memory: filesystem.NewMemory(nil), name: name, err: err, rec: r}}
+}
+
+func (r *closeRecorder) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.closed...)
+}
+
+func TestCloseSources(t *testing.T) {
+	t.Parallel()
+
+	var rec closeRecorder
+	s := Sources{rec.source("a", nil), rec.source("b", errors.New("broken pipe")), rec.source("c", nil)}
+	err := s.CloseSources()
+	require.NotNil(t, err)
+	assert.Equal(t, CloseError{"b": errors.New("broken pipe")}, err)
+	assert.Equal(t, "closing sources: b: broken pipe", err.Error())
+	assert.Equal(t, []string{"c", "b", "a"}, rec.get())
+
+	assert.Nil(t, Sources{rec.source("d", nil)}.CloseSources())
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	var rec closeRecorder
+	r := NewRegistry(Sources{rec.source("old", nil)})
+
+	sources, release := r.Acquire()
+	require.Len(t, sources, 1)
+	assert.Equal(t, "old", sources[0].Name)
+
+	// the replaced sources are closed only when the request that acquired them released them
+	r.Replace(Sources{rec.source("new", errors.New("failed"))})
+	assert.Equal(t, "new", r.Sources()[0].Name)
+	assert.Empty(t, rec.get())
+	newSources, releaseNew := r.Acquire()
+	assert.Equal(t, "new", newSources[0].Name)
+
+	release()
+	release()
+	for len(rec.get()) == 0 {
+	}
+	assert.Equal(t, []string{"old"}, rec.get())
+
+	// close waits for the current sources to be released, and returns their errors
+	closed := make(chan error)
+	go func() { closed <- r.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("sources were closed while they were acquired")
+	default:
+	}
+	releaseNew()
+	err := <-closed
+	assert.Equal(t, CloseError{"new": errors.New("failed")}, err)
+	assert.Equal(t, []string{"old", "new"}, rec.get())
+
+	sources, release = r.Acquire()
+	assert.Empty(t, sources)
+	release()
+	assert.Nil(t, r.Close())
+}
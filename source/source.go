@@ -1,28 +1,97 @@
 package source
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/duration"
 	"github.com/Stratoscale/logserver/filesystem"
 	"github.com/Stratoscale/logserver/filesystem/tar"
+	"github.com/Stratoscale/logserver/temp"
 	"github.com/bluele/gcache"
 )
 
 var log = logrus.WithField("pkg", "config")
 
+const (
+	defaultRetries      = 3
+	defaultRetryBackoff = 200 * time.Millisecond
+	defaultMaxOpenFiles = 64
+)
+
 // Config is used to configure a filesystem source
 type Config struct {
 	Name string `json:"name"`
 	URL  string `json:"url"`
+	// ProxyJump is a list of jump hosts for sftp sources
+	ProxyJump []string `json:"proxy_jump"`
+	// Command is the command line of an exec source
+	Command []string `json:"command"`
+	// Groups are names of groups that the source belongs to
+	Groups []string `json:"groups"`
+	// Tags are arbitrary metadata of the source, like its rack, role or region
+	Tags map[string]string `json:"tags"`
+	// Aliases are virtual paths that map to real paths of the source, like {"important/api.log": "var/log/httpd/access_log"}
+	Aliases map[string]string `json:"aliases"`
 	Flags
 }
 
+// UnmarshalJSON decodes the source configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
 // Flags are configuration options for a source
 type Flags struct {
 	OpenTar     bool   `json:"open_tar"`
 	OpenJournal string `json:"open_journal"`
+	// WatchTree keeps the tree of a local source in memory, and updates it on changes in the filesystem,
+	// instead of walking the source. The tree of a watched source is always fresh, so it is not cached.
+	WatchTree bool `json:"watch_tree"`
+	Limits
+	Overrides
+	// MaxOpenFiles is the maximal number of files of the source that are open at the same time.
+	// 64 by default, a negative value disables the limit.
+	MaxOpenFiles int `json:"max_open_files"`
+	// Redact are rules that mask parts of the lines of the source files, the files on the source are not changed
+	Redact []filesystem.Redaction `json:"redact"`
+	// BannedPaths are globs of sensitive paths, like *.key or secrets/, that are hidden in the source, see
+	// filesystem.WrapBanned
+	BannedPaths []string `json:"banned_paths"`
+	// Retry configures retries of operations of remote sources on transient errors.
+	// By default, operations are retried 3 times. A negative number of retries disables the retries.
+	filesystem.Retry
+	// Temp is the temporary storage of the outputs of exec sources and the copies of remote journals
+	Temp *temp.Storage `json:"-"`
+}
+
+// Limits bound the walk of a source, so a source with a huge number of files
+// won't stall every tree and search request
+type Limits struct {
+	// MaxFiles is the maximal number of files walked in a single request
+	MaxFiles int `json:"max_files"`
+	// MaxDepth is the maximal directory depth walked from the request path
+	MaxDepth int `json:"max_depth"`
+	// WalkTimeout is the maximal duration of a walk
+	WalkTimeout time.Duration `json:"walk_timeout"`
+}
+
+// Overrides are values of global settings of the engine for a single source, like smaller batches for a slow
+// remote source. Zero numbers and missing lists keep the global settings, and an empty list overrides a global
+// list, like [] for a source without excluded directories.
+type Overrides struct {
+	// ContentBatchSize is the number of lines in a content response of a file of the source
+	ContentBatchSize int `json:"content_batch_size"`
+	// SearchMaxSize is the maximal number of lines in a search response of a file of the source
+	SearchMaxSize int `json:"search_max_size"`
+	// ExcludeDirs are names of directories that are not walked in the source
+	ExcludeDirs []string `json:"exclude_dirs"`
+	// ExcludeExtensions are extensions of files that are not walked in the source
+	ExcludeExtensions []string `json:"exclude_extensions"`
 }
 
 type Sources []Source
@@ -31,6 +100,21 @@ type Sources []Source
 type Source struct {
 	Name string
 	FS   filesystem.FileSystem
+	// Groups are names of groups that the source belongs to
+	Groups []string
+	// Tags are arbitrary metadata of the source
+	Tags map[string]string
+	// Watched is true if the tree of the source is updated on changes, so it is not cached
+	Watched bool
+	Limits
+	Overrides
+}
+
+// WithContext returns the source with a view of its filesystem whose operations are aborted when the
+// context is done
+func (s Source) WithContext(ctx context.Context) Source {
+	s.FS = filesystem.WithContext(ctx, s.FS)
+	return s
 }
 
 func New(c []Config, cache gcache.Cache) (Sources, error) {
@@ -40,39 +124,129 @@ func New(c []Config, cache gcache.Cache) (Sources, error) {
 		if err != nil {
 			return s, err
 		}
+		if srcDesc.WatchTree && u.Scheme != "file" {
+			return nil, fmt.Errorf("can have 'watch_tree' option only for local sources")
+		}
 		var fs filesystem.FileSystem
 		switch u.Scheme {
 		case "file":
 			fs, err = filesystem.NewLocal(u)
+			if err == nil && srcDesc.WatchTree {
+				fs, err = filesystem.WatchLocal(fs)
+			}
 		case "sftp", "ssh":
-			fs, err = filesystem.NewSFTP(u)
+			fs, err = filesystem.NewSFTP(u, srcDesc.ProxyJump)
 		case "nginx+http", "nginx+https":
 			if srcDesc.OpenTar {
 				return nil, fmt.Errorf("can't have 'open_tar' option over http")
 			}
 			fs, err = filesystem.NewNginx(u)
+		case "exec":
+			fs, err = filesystem.NewCommand(u, srcDesc.Command, srcDesc.Temp)
+		case "mem":
+			fs, err = filesystem.OpenMemory(u)
 		}
 		if err != nil {
 			log.WithError(err).Errorf("Failed adding source %s(%s)", srcDesc.Name, srcDesc.URL)
 			continue
 		}
 		log.Infof("Opened %s: %s", srcDesc.Name, srcDesc.URL)
-		if srcDesc.OpenTar {
+		fs = filesystem.WrapLimit(fs, srcDesc.Name, srcDesc.maxOpenFiles())
+		switch u.Scheme {
+		case "sftp", "ssh", "nginx+http", "nginx+https":
+			fs = filesystem.WrapRetry(fs, srcDesc.retry())
+		}
+		switch {
+		case srcDesc.OpenTar:
 			fs = tar.Wrap(fs, cache, srcDesc.URL+"/")
+		case u.Scheme == "file" || u.Scheme == "sftp" || u.Scheme == "ssh":
+			// files inside archives can be addressed directly, even if archives are not browsed
+			fs = tar.WrapLinks(fs, cache, srcDesc.URL+"/")
 		}
 		if srcDesc.OpenJournal != "" {
-			fs = filesystem.WrapJournal(fs, srcDesc.OpenJournal)
+			fs = filesystem.WrapJournal(fs, srcDesc.OpenJournal, srcDesc.Temp)
+		}
+		if fs, err = filesystem.WrapAliases(fs, srcDesc.Aliases); err != nil {
+			return nil, fmt.Errorf("source %s: %s", srcDesc.Name, err)
+		}
+		// redaction and banned paths are applied last, so no content of the source is served without them
+		if fs, err = filesystem.WrapRedact(fs, srcDesc.Redact); err != nil {
+			return nil, fmt.Errorf("source %s: %s", srcDesc.Name, err)
+		}
+		if fs, err = filesystem.WrapBanned(fs, srcDesc.BannedPaths); err != nil {
+			return nil, fmt.Errorf("source %s: %s", srcDesc.Name, err)
 		}
-		s = append(s, Source{srcDesc.Name, fs})
+		s = append(s, Source{Name: srcDesc.Name, FS: fs, Groups: srcDesc.Groups, Tags: srcDesc.Tags, Watched: srcDesc.WatchTree, Limits: srcDesc.Limits, Overrides: srcDesc.Overrides})
 	}
 	return s, nil
 }
 
-func (s Sources) CloseSources() {
-	for _, src := range s {
-		err := src.FS.Close()
-		if err != nil {
-			log.WithError(err).Errorf("Failed closing source %s", src.Name)
+// Validate checks the configuration of a source without connecting to it. The errors are keyed by the json
+// keys of the invalid options.
+func (c Config) Validate() map[string]error {
+	errs := make(map[string]error)
+	if c.Name == "" {
+		errs["name"] = fmt.Errorf("a source must have a name")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		errs["url"] = err
+		return errs
+	}
+	switch u.Scheme {
+	case "file", "sftp", "ssh", "mem":
+	case "nginx+http", "nginx+https":
+		if c.OpenTar {
+			errs["open_tar"] = fmt.Errorf("can't have 'open_tar' option over http")
 		}
+	case "exec":
+		if len(c.Command) == 0 {
+			errs["command"] = fmt.Errorf("command was not specified")
+		}
+	case "":
+		errs["url"] = fmt.Errorf("missing scheme in %q", c.URL)
+	default:
+		errs["url"] = fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+	if c.WatchTree && u.Scheme != "file" {
+		errs["watch_tree"] = fmt.Errorf("can have 'watch_tree' option only for local sources")
+	}
+	// the wrappers check their options when they are created, without using the filesystem
+	if _, err := filesystem.WrapAliases(nil, c.Aliases); err != nil {
+		errs["aliases"] = err
+	}
+	if _, err := filesystem.WrapRedact(nil, c.Redact); err != nil {
+		errs["redact"] = err
+	}
+	if _, err := filesystem.WrapBanned(nil, c.BannedPaths); err != nil {
+		errs["banned_paths"] = err
+	}
+	return errs
+}
+
+// WithDefaults returns the configuration of a source with defaults for unset values, as the source is opened with it
+func (c Config) WithDefaults() Config {
+	c.Retry = c.retry()
+	c.MaxOpenFiles = c.maxOpenFiles()
+	return c
+}
+
+// retry returns the retry configuration of a remote source, with defaults for unset values
+func (c Config) retry() filesystem.Retry {
+	r := c.Retry
+	if r.Retries == 0 {
+		r.Retries = defaultRetries
+	}
+	if r.Backoff == 0 {
+		r.Backoff = defaultRetryBackoff
+	}
+	return r
+}
+
+// maxOpenFiles returns the open files limit of a source, with a default for an unset value
+func (c Config) maxOpenFiles() int {
+	if c.MaxOpenFiles == 0 {
+		return defaultMaxOpenFiles
 	}
+	return c.MaxOpenFiles
 }
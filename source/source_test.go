@@ -1,9 +1,26 @@
 package source
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLocalFSConfig(t *testing.T) {
 
 }
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"name": "node1", "walk_timeout": "30s", "retry_backoff": "1s", "retries": 2}`), &c))
+	assert.Equal(t, "node1", c.Name)
+	assert.Equal(t, 30*time.Second, c.WalkTimeout)
+	assert.Equal(t, time.Second, c.Backoff)
+	assert.Equal(t, 2, c.Retries)
+	assert.NotNil(t, json.Unmarshal([]byte(`{"walk_timeout": "soon"}`), &c))
+}
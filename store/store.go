@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "store")
+
+// ErrNotFound is returned when a key does not exist in a bucket
+var ErrNotFound = errors.New("not found")
+
+// Store is a persistent store of the server state. Values are stored by keys in named buckets,
+// for example, jobs by their IDs in the jobs bucket.
+type Store interface {
+	// Put stores a value in a bucket
+	Put(bucket, key string, value interface{}) error
+	// Get loads a value from a bucket, it returns ErrNotFound if the key does not exist
+	Get(bucket, key string, value interface{}) error
+	// Delete removes a key from a bucket, deleting a key that does not exist is not an error
+	Delete(bucket, key string) error
+	// List returns the encoded values of all the keys in a bucket
+	List(bucket string) (map[string]json.RawMessage, error)
+}
+
+// Config is the storage configuration
+type Config struct {
+	// Dir is a directory for persisting the state. If not given, the state is kept only in memory.
+	Dir string `json:"dir"`
+}
+
+// New returns a store according to the configuration
+func New(c Config) (Store, error) {
+	if c.Dir == "" {
+		return NewMemory(), nil
+	}
+	return NewFile(c.Dir)
+}
+
+type buckets map[string]map[string]json.RawMessage
+
+// memory is a store that keeps values in memory
+type memory struct {
+	buckets buckets
+	lock    sync.Mutex
+	// persist is called with the values of a bucket after every change, with the lock held
+	persist func(bucket string, values map[string]json.RawMessage) error
+}
+
+// NewMemory returns a store that keeps the state in memory
+func NewMemory() Store {
+	return &memory{buckets: make(buckets)}
+}
+
+func (m *memory) Put(bucket, key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode %s/%s: %s", bucket, key, err)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	values := m.buckets[bucket]
+	if values == nil {
+		values = make(map[string]json.RawMessage)
+		m.buckets[bucket] = values
+	}
+	prev, existed := values[key]
+	values[key] = b
+	if err := m.save(bucket, values); err != nil {
+		if existed {
+			values[key] = prev
+		} else {
+			delete(values, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *memory) Get(bucket, key string, value interface{}) error {
+	m.lock.Lock()
+	b, ok := m.buckets[bucket][key]
+	m.lock.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if err := json.Unmarshal(b, value); err != nil {
+		return fmt.Errorf("decode %s/%s: %s", bucket, key, err)
+	}
+	return nil
+}
+
+func (m *memory) Delete(bucket, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	values := m.buckets[bucket]
+	prev, ok := values[key]
+	if !ok {
+		return nil
+	}
+	delete(values, key)
+	if err := m.save(bucket, values); err != nil {
+		values[key] = prev
+		return err
+	}
+	return nil
+}
+
+func (m *memory) List(bucket string) (map[string]json.RawMessage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	values := make(map[string]json.RawMessage, len(m.buckets[bucket]))
+	for key, value := range m.buckets[bucket] {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (m *memory) save(bucket string, values map[string]json.RawMessage) error {
+	if m.persist == nil {
+		return nil
+	}
+	return m.persist(bucket, values)
+}
+
+// NewFile returns a store that persists each bucket to a json file in a directory.
+// The buckets are loaded from the directory when the store is created.
+func NewFile(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create storage directory: %s", err)
+	}
+	m := &memory{buckets: make(buckets)}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %s", file, err)
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(b, &values); err != nil {
+			return nil, fmt.Errorf("decode %s: %s", file, err)
+		}
+		bucket := filepath.Base(file)
+		bucket = bucket[:len(bucket)-len(".json")]
+		m.buckets[bucket] = values
+		log.Debugf("Loaded %d values of %s", len(values), bucket)
+	}
+	m.persist = func(bucket string, values map[string]json.RawMessage) error {
+		return writeFile(filepath.Join(dir, bucket+".json"), values)
+	}
+	return m, nil
+}
+
+// writeFile writes a value to a temporary file and renames it, so the file is never partially written
+func writeFile(path string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("write %s: %s", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write %s: %s", path, err)
+	}
+	return nil
+}
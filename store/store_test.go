@@ -0,0 +1,48 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Name string `json:"name"`
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "logserver-store-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFile(dir)
+	require.Nil(t, err)
+	require.Nil(t, s.Put("jobs", "1", record{Name: "first"}))
+	require.Nil(t, s.Put("jobs", "2", record{Name: "second"}))
+	require.Nil(t, s.Put("tokens", "1", record{Name: "token"}))
+	require.Nil(t, s.Delete("jobs", "2"))
+	require.Nil(t, s.Delete("jobs", "3"))
+
+	// a new store loads the persisted state
+	s, err = NewFile(dir)
+	require.Nil(t, err)
+
+	var r record
+	require.Nil(t, s.Get("jobs", "1", &r))
+	assert.Equal(t, "first", r.Name)
+	assert.Equal(t, ErrNotFound, s.Get("jobs", "2", &r))
+
+	values, err := s.List("tokens")
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(values))
+	assert.JSONEq(t, `{"name":"token"}`, string(values["1"]))
+
+	values, err = s.List("unknown")
+	require.Nil(t, err)
+	assert.Empty(t, values)
+}
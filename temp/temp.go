@@ -0,0 +1,260 @@
+package temp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var log = logrus.WithField("pkg", "temp")
+
+// managedDir is the name of the storage directory under the configured directory
+const managedDir = "logserver"
+
+// ErrQuota is returned when writing to a temporary file would exceed the quota of the storage
+var ErrQuota = errors.New("temporary storage quota exceeded")
+
+// Config is the temporary storage configuration
+type Config struct {
+	// Dir is the directory under which the temporary files are created, the system temporary directory by default
+	Dir string `json:"dir"`
+	// MaxSize is the maximal total size of the temporary files in bytes, zero means no limit
+	MaxSize int64 `json:"max_size"`
+}
+
+// Storage manages the temporary files of the server, like zips, bundles and copies of remote files.
+// The files are created in a directory of the server, which is the same on every start, so files that a
+// previous run left in it are found and removed. Their total size is bounded by a quota.
+//
+// A nil storage creates the files in the system temporary directory without a quota.
+type Storage struct {
+	Config
+	// dir is the directory of the storage, under the configured directory
+	dir  string
+	lock sync.Mutex
+	// sizes are the sizes of the files that were written in the storage, by their paths
+	sizes map[string]int64
+	used  int64
+}
+
+// New creates the directory of the storage, and removes the files that previous runs left in it, except the
+// kept files, like the artifacts of persisted jobs, which are counted in the quota
+func New(c Config, keep ...string) (*Storage, error) {
+	if c.MaxSize < 0 {
+		return nil, fmt.Errorf("negative max size: %d", c.MaxSize)
+	}
+	base := c.Dir
+	if base == "" {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, managedDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create temp directory: %s", err)
+	}
+	s := &Storage{Config: c, dir: dir, sizes: make(map[string]int64)}
+	if err := s.Clean(keep...); err != nil {
+		return nil, fmt.Errorf("clean temp directory: %s", err)
+	}
+	log.Infof("Temporary files are stored in %s, %d bytes are used", dir, s.used)
+	return s, nil
+}
+
+// Dir returns the directory of the storage
+func (s *Storage) Dir() string {
+	if s == nil {
+		return os.TempDir()
+	}
+	return s.dir
+}
+
+// TempFile creates a new temporary file, its name starts with the given prefix
+func (s *Storage) TempFile(prefix string) (*File, error) {
+	f, err := ioutil.TempFile(s.Dir(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.file(f), nil
+}
+
+// TempDir creates a new temporary directory, its name starts with the given prefix.
+// Files in the directory should be created with Create, so they are counted in the quota.
+func (s *Storage) TempDir(prefix string) (string, error) {
+	return ioutil.TempDir(s.Dir(), prefix)
+}
+
+// Create creates a file and its parent directories. Files that are created in the storage directory are
+// counted in the quota.
+func (s *Storage) Create(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.file(f), nil
+}
+
+// RemoveAll removes a temporary file or directory, and releases the quota that its files used
+func (s *Storage) RemoveAll(path string) error {
+	err := os.RemoveAll(path)
+	if s == nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for p, size := range s.sizes {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			s.used -= size
+			delete(s.sizes, p)
+		}
+	}
+	return err
+}
+
+// Usage returns the total size of the temporary files in bytes
+func (s *Storage) Usage() int64 {
+	if s == nil {
+		return 0
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prune()
+	return s.used
+}
+
+// Clean removes the temporary files, except the kept files, which remain counted in the quota.
+// It is called on startup, and when the server is stopped, with the files that should survive a restart.
+func (s *Storage) Clean(keep ...string) error {
+	if s == nil {
+		return nil
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, p := range keep {
+		kept[filepath.Clean(p)] = true
+	}
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sizes = make(map[string]int64)
+	s.used = 0
+	for _, info := range infos {
+		p := filepath.Join(s.dir, info.Name())
+		if kept[p] && info.Mode().IsRegular() {
+			s.sizes[p] = info.Size()
+			s.used += info.Size()
+			continue
+		}
+		log.Debugf("Removing stale temporary file %s", p)
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the storage directory with all the temporary files
+func (s *Storage) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sizes = make(map[string]int64)
+	s.used = 0
+	return os.RemoveAll(s.dir)
+}
+
+func (s *Storage) file(f *os.File) *File {
+	tf := &File{f: f}
+	if s != nil && strings.HasPrefix(f.Name(), s.dir+string(filepath.Separator)) {
+		tf.s = s
+	}
+	return tf
+}
+
+// reserve counts n more bytes of a file in the quota, it fails if the quota would be exceeded
+func (s *Storage) reserve(path string, n int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.MaxSize > 0 && s.used+n > s.MaxSize {
+		// files may have been removed by their users since they were written
+		s.prune()
+		if s.used+n > s.MaxSize {
+			log.Warnf("Temporary storage is full: %d of %d bytes are used", s.used, s.MaxSize)
+			return ErrQuota
+		}
+	}
+	s.sizes[path] += n
+	s.used += n
+	return nil
+}
+
+// prune releases the quota of files that were removed. It is called with the lock held.
+func (s *Storage) prune() {
+	for p, size := range s.sizes {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			s.used -= size
+			delete(s.sizes, p)
+		}
+	}
+}
+
+// File is a temporary file, its writes are counted in the quota of its storage
+type File struct {
+	f *os.File
+	// s is the storage whose quota the file uses, nil if the file is not counted in a quota
+	s *Storage
+}
+
+// Name returns the path of the file
+func (f *File) Name() string {
+	return f.f.Name()
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.s != nil {
+		if err := f.s.reserve(f.f.Name(), int64(len(p))); err != nil {
+			return 0, err
+		}
+	}
+	return f.f.Write(p)
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	return f.f.Read(p)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return f.f.Seek(offset, whence)
+}
+
+// Stat returns the file info of the file
+func (f *File) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Remove closes and removes the file, and releases the quota that it used
+func (f *File) Remove() error {
+	f.f.Close()
+	if f.s == nil {
+		return os.Remove(f.f.Name())
+	}
+	return f.s.RemoveAll(f.f.Name())
+}
+
+var _ io.ReadWriteSeeker = (*File)(nil)
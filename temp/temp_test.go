@@ -0,0 +1,113 @@
+package temp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "temp-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Config{Dir: filepath.Join(dir, "tmp"), MaxSize: 10})
+	require.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "tmp"), filepath.Dir(s.Dir()))
+
+	f1, err := s.TempFile("f1-")
+	require.Nil(t, err)
+	_, err = f1.Write([]byte("123456"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(6), s.Usage())
+
+	sub, err := s.TempDir("sub-")
+	require.Nil(t, err)
+	f2, err := s.Create(filepath.Join(sub, "a", "f2"))
+	require.Nil(t, err)
+	_, err = f2.Write([]byte("12345"))
+	assert.Equal(t, ErrQuota, err)
+	_, err = f2.Write([]byte("1234"))
+	require.Nil(t, err)
+	f2.Close()
+	assert.Equal(t, int64(10), s.Usage())
+
+	// removing a directory releases the quota of its files
+	require.Nil(t, s.RemoveAll(sub))
+	assert.Equal(t, int64(6), s.Usage())
+
+	// files that were removed by their users are released
+	f1.Close()
+	require.Nil(t, os.Remove(f1.Name()))
+	assert.Equal(t, int64(0), s.Usage())
+
+	f3, err := s.TempFile("f3-")
+	require.Nil(t, err)
+	_, err = f3.Write([]byte("1234567890"))
+	require.Nil(t, err)
+	require.Nil(t, f3.Remove())
+	assert.Equal(t, int64(0), s.Usage())
+
+	require.Nil(t, s.Close())
+	_, err = os.Stat(s.Dir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStorageRestart(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "temp-test-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Config{Dir: dir, MaxSize: 10})
+	require.Nil(t, err)
+	kept, err := s.TempFile("kept-")
+	require.Nil(t, err)
+	_, err = kept.Write([]byte("123"))
+	require.Nil(t, err)
+	kept.Close()
+	stale, err := s.TempFile("stale-")
+	require.Nil(t, err)
+	stale.Close()
+	sub, err := s.TempDir("sub-")
+	require.Nil(t, err)
+
+	// a restarted storage has the same directory, without the files that were not kept
+	s, err = New(Config{Dir: dir, MaxSize: 10}, kept.Name())
+	require.Nil(t, err)
+	assert.Equal(t, filepath.Dir(kept.Name()), s.Dir())
+	for _, p := range []string{stale.Name(), sub} {
+		_, err = os.Stat(p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+	_, err = os.Stat(kept.Name())
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), s.Usage())
+
+	require.Nil(t, s.Clean())
+	_, err = os.Stat(kept.Name())
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, int64(0), s.Usage())
+}
+
+func TestNilStorage(t *testing.T) {
+	t.Parallel()
+
+	var s *Storage
+	f, err := s.TempFile("logserver-temp-test-")
+	require.Nil(t, err)
+	assert.Equal(t, os.TempDir(), filepath.Dir(f.Name()))
+	_, err = f.Write([]byte("content"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), s.Usage())
+	require.Nil(t, f.Remove())
+	_, err = os.Stat(f.Name())
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,245 @@
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/Stratoscale/logserver/duration"
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/source"
+	"github.com/Stratoscale/logserver/temp"
+)
+
+var log = logrus.WithField("pkg", "upload")
+
+// SourceName is the name of the source of the uploaded files
+const SourceName = "uploads"
+
+const (
+	defaultExpiration = time.Hour
+	defaultMaxSize    = 100 * 1024 * 1024
+	// minExpireInterval bounds the interval of the checks of expired sessions, for very short expirations
+	minExpireInterval = time.Millisecond
+)
+
+// Config is the uploads configuration
+type Config struct {
+	// Dir is the directory where uploaded files are stored, a temporary directory by default
+	Dir string `json:"dir"`
+	// Expiration is the time that a session is kept after it was last used
+	Expiration time.Duration `json:"expiration"`
+	// MaxSize is the maximal size of an uploaded file in bytes
+	MaxSize int64 `json:"max_size"`
+	// Temp is the temporary storage, the uploaded files are stored in it if no directory is configured
+	Temp *temp.Storage `json:"-"`
+}
+
+// UnmarshalJSON decodes the uploads configuration, where durations are given in nanoseconds, or as strings like "5m"
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type plain Config
+	return duration.Decode(b, (*plain)(c))
+}
+
+type session struct {
+	dir      string
+	fs       filesystem.FileSystem
+	lastUsed time.Time
+}
+
+// Store keeps files that users uploaded, grouped by sessions.
+// The files of a session are served as a source in requests of the session.
+type Store struct {
+	Config
+	sessions map[string]*session
+	lock     sync.Mutex
+}
+
+// WithDefaults returns the configuration with defaults for unset values. A temporary uploads directory is
+// created only when the store is created.
+func (c Config) WithDefaults() Config {
+	if c.Expiration == 0 {
+		c.Expiration = defaultExpiration
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = defaultMaxSize
+	}
+	return c
+}
+
+// New returns a new uploads store. Expired sessions are removed until the context is done.
+func New(ctx context.Context, c Config) (*Store, error) {
+	c = c.WithDefaults()
+	if c.Expiration < 0 {
+		return nil, fmt.Errorf("negative expiration: %s", c.Expiration)
+	}
+	if c.Dir == "" {
+		dir, err := c.Temp.TempDir("logserver-uploads-")
+		if err != nil {
+			return nil, fmt.Errorf("create uploads directory: %s", err)
+		}
+		c.Dir = dir
+	}
+	s := &Store{Config: c, sessions: make(map[string]*session)}
+	go s.expire(ctx)
+	return s, nil
+}
+
+// Source returns the source of the files that were uploaded in a session
+func (s *Store) Source(id string) (source.Source, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return source.Source{}, false
+	}
+	ss.lastUsed = time.Now()
+	return source.Source{Name: SourceName, FS: ss.fs}, true
+}
+
+// Handler returns an HTTP handler for uploading files:
+//
+//	POST   /?name=<name>             upload a file to a new session
+//	POST   /<session>?name=<name>    upload a file to an existing session
+//	DELETE /<session>                remove a session and its files
+//
+// The request body is the file content. The response holds the session ID, which should be
+// given in the session field of websocket requests to include the uploaded files.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodPost:
+			name := filepath.Base(filepath.Clean("/" + r.URL.Query().Get("name")))
+			if name == "/" || name == "." {
+				http.Error(w, "file name was not specified", http.StatusBadRequest)
+				return
+			}
+			id, err := s.save(id, name, http.MaxBytesReader(w, r.Body, s.MaxSize))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(struct {
+				Session string `json:"session"`
+				Name    string `json:"name"`
+			}{Session: id, Name: name})
+
+		case http.MethodDelete:
+			if !s.remove(id) {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// save stores an uploaded file in a session. If the session ID is empty, a new session is created.
+func (s *Store) save(id string, name string, r io.Reader) (string, error) {
+	ss, id, err := s.session(id)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.Temp.Create(filepath.Join(ss.dir, name))
+	if err != nil {
+		return "", fmt.Errorf("create file: %s", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		f.Remove()
+		return "", fmt.Errorf("upload file: %s", err)
+	}
+	log.Infof("Uploaded %s to session %s", name, id)
+	return id, nil
+}
+
+// session returns an existing session, or creates a new one if the ID is empty
+func (s *Store) session(id string) (*session, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if id != "" {
+		ss, ok := s.sessions[id]
+		if !ok {
+			return nil, "", fmt.Errorf("session %s not found", id)
+		}
+		ss.lastUsed = time.Now()
+		return ss, id, nil
+	}
+
+	id = newID()
+	dir := filepath.Join(s.Dir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, "", fmt.Errorf("create session directory: %s", err)
+	}
+	fs, err := filesystem.NewLocal(&url.URL{Path: dir})
+	if err != nil {
+		return nil, "", err
+	}
+	ss := &session{dir: dir, fs: fs, lastUsed: time.Now()}
+	s.sessions[id] = ss
+	return ss, id, nil
+}
+
+func (s *Store) remove(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+	delete(s.sessions, id)
+	s.Temp.RemoveAll(ss.dir)
+	log.Infof("Removed session %s", id)
+	return true
+}
+
+// expire removes sessions that were not used for the expiration time, until the context is done
+func (s *Store) expire(ctx context.Context) {
+	interval := s.Expiration / 10
+	if interval < minExpireInterval {
+		interval = minExpireInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.lock.Lock()
+		var expired []string
+		for id, ss := range s.sessions {
+			if time.Since(ss.lastUsed) > s.Expiration {
+				expired = append(expired, id)
+			}
+		}
+		s.lock.Unlock()
+		for _, id := range expired {
+			s.remove(id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	s, err := New(context.Background(), Config{})
+	require.Nil(t, err)
+	defer os.RemoveAll(s.Dir)
+	h := s.Handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/?name=../customer.log", strings.NewReader("line 1\nline 2\n")))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct{ Session, Name string }
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "customer.log", resp.Name)
+
+	src, ok := s.Source(resp.Session)
+	require.True(t, ok)
+	assert.Equal(t, SourceName, src.Name)
+	f, err := src.FS.Open("customer.log")
+	require.Nil(t, err)
+	content, err := ioutil.ReadAll(f)
+	f.Close()
+	require.Nil(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(content))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/unknown?name=a.log", strings.NewReader("")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/"+resp.Session, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, ok = s.Source(resp.Session)
+	assert.False(t, ok)
+}
+
+func TestMaxSize(t *testing.T) {
+	t.Parallel()
+
+	s, err := New(context.Background(), Config{MaxSize: 4})
+	require.Nil(t, err)
+	defer os.RemoveAll(s.Dir)
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/?name=a.log", strings.NewReader("too long")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	var c Config
+	require.Nil(t, json.Unmarshal([]byte(`{"expiration": "2h", "max_size": 100}`), &c))
+	assert.Equal(t, 2*time.Hour, c.Expiration)
+	assert.Equal(t, int64(100), c.MaxSize)
+}
+
+func TestExpiration(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(context.Background(), Config{Expiration: -time.Second})
+	assert.NotNil(t, err)
+
+	// sessions are removed until the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, Config{Expiration: time.Nanosecond})
+	require.Nil(t, err)
+	defer os.RemoveAll(s.Dir)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/?name=a.log", strings.NewReader("line\n")))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct{ Session string }
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+	for i := 0; i < 100; i++ {
+		s.lock.Lock()
+		_, ok := s.sessions[resp.Session]
+		s.lock.Unlock()
+		if !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.lock.Lock()
+	assert.Empty(t, s.sessions)
+	s.lock.Unlock()
+}
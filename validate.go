@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/Stratoscale/logserver/filesystem"
+	"github.com/Stratoscale/logserver/parse"
+	"github.com/Stratoscale/logserver/schema"
+)
+
+// validation is the result of validating a configuration file
+type validation struct {
+	Valid  bool           `json:"valid"`
+	Errors []schema.Error `json:"errors"`
+}
+
+// validate checks a configuration file without connecting to its sources: its syntax, its keys and the types
+// of their values, the source URLs and options, and the parsers with their regexps and time formats.
+// The errors have the JSON paths of the invalid values, like sources[1].url.
+func validate(fileName string) validation {
+	errs := validateFile(fileName)
+	if errs == nil {
+		errs = []schema.Error{}
+	}
+	return validation{Valid: len(errs) == 0, Errors: errs}
+}
+
+func validateFile(fileName string) []schema.Error {
+	fail := func(path string, format string, args ...interface{}) []schema.Error {
+		return []schema.Error{{Path: path, Message: fmt.Sprintf(format, args...)}}
+	}
+	format, err := configFormat(fileName, options.format)
+	if err != nil {
+		return fail("", "%s", err)
+	}
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return fail("", "%s", err)
+	}
+	if format == formatYAML {
+		if b, err = yamlToJSON(b); err != nil {
+			return fail("", "%s", err)
+		}
+	}
+
+	// the keys and the types of the values are checked before decoding, which stops at the first error
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			// the offset is after the invalid character
+			line, col := position(b, serr.Offset-1)
+			return fail("", "line %d column %d: %s", line, col, err)
+		}
+		return fail("", "%s", err)
+	}
+	if errs := schema.Validate(schema.Generate(config{}, ""), doc); len(errs) > 0 {
+		return errs
+	}
+	var cfg config
+	if err := decodeConfig(bytes.NewReader(b), formatJSON, &cfg); err != nil {
+		return fail("", "%s", err)
+	}
+
+	var errs []schema.Error
+	add := func(path string, err error) {
+		errs = append(errs, schema.Error{Path: path, Message: err.Error()})
+	}
+	// the sources and parsers of included files are validated after the sources and parsers of the file
+	if err := cfg.include(filepath.Dir(fileName)); err != nil {
+		add("include", err)
+	}
+	names := make(map[string]bool)
+	for i, src := range cfg.Sources {
+		path := fmt.Sprintf("sources[%d]", i)
+		if err := src.ExpandEnv(); err != nil {
+			add(path, err)
+			continue
+		}
+		srcErrs := src.Validate()
+		keys := make([]string, 0, len(srcErrs))
+		for key := range srcErrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			add(path+"."+key, srcErrs[key])
+		}
+		if names[src.Name] {
+			add(path+".name", fmt.Errorf("duplicate source name %s", src.Name))
+		}
+		names[src.Name] = true
+	}
+	if err := cfg.Dynamic.ExpandEnv(); err != nil {
+		add("dynamic", err)
+	}
+	if _, err := filesystem.WrapBanned(nil, cfg.BannedPaths); err != nil {
+		add("banned_paths", err)
+	}
+	for i, p := range cfg.Parsers {
+		errs = append(errs, validateParser(fmt.Sprintf("parsers[%d]", i), p)...)
+	}
+	if cfg.ParsersDir != "" {
+		dirParsers, err := parse.LoadDir(cfg.ParsersDir)
+		if err != nil {
+			add("parsers_dir", err)
+		}
+		for i, p := range dirParsers {
+			errs = append(errs, validateParser(fmt.Sprintf("parsers_dir[%d]", i), p)...)
+		}
+	}
+	return errs
+}
+
+// validateParser checks that a parser can be created, and that its time formats, and those of its pipeline
+// stages, can parse times
+func validateParser(path string, c parse.Config) []schema.Error {
+	var errs []schema.Error
+	if _, err := parse.New([]parse.Config{c}); err != nil {
+		errs = append(errs, schema.Error{Path: path, Message: err.Error()})
+	}
+	errs = append(errs, validateTimeFormats(path, c)...)
+	return errs
+}
+
+func validateTimeFormats(path string, c parse.Config) []schema.Error {
+	var errs []schema.Error
+	for i, format := range c.TimeFormats {
+		if err := parse.CheckTimeFormat(format); err != nil {
+			errs = append(errs, schema.Error{Path: fmt.Sprintf("%s.time_formats[%d]", path, i), Message: err.Error()})
+		}
+	}
+	for i, stage := range c.Pipeline {
+		errs = append(errs, validateTimeFormats(fmt.Sprintf("%s.pipeline[%d]", path, i), stage)...)
+	}
+	return errs
+}
+
+// position returns the line and column of the byte at an offset in a file
+func position(b []byte, offset int64) (line, col int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := b[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
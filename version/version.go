@@ -0,0 +1,44 @@
+// Package version holds the build information of the binary.
+// The variables are set when building with:
+//
+//	go build -ldflags "-X github.com/Stratoscale/logserver/version.Version=v1.2.0 -X github.com/Stratoscale/logserver/version.Commit=... -X github.com/Stratoscale/logserver/version.Date=..."
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// Build information, set with ldflags
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info is the build information of the binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("logserver %s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}
+
+// Handler serves the build information as json
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Get())
+	})
+}
@@ -0,0 +1,26 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	Version, Commit, Date = "v1.0.0", "abc", "2018-01-01"
+	defer func() { Version, Commit, Date = "dev", "unknown", "unknown" }()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/_version", nil))
+
+	var got Info
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, "v1.0.0", got.Version)
+	assert.Equal(t, "abc", got.Commit)
+	assert.Equal(t, "2018-01-01", got.Date)
+	assert.NotEmpty(t, got.GoVersion)
+	assert.Contains(t, Get().String(), "v1.0.0")
+}